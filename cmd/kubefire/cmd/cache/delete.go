@@ -3,24 +3,95 @@ package cache
 import (
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/pkg/cache"
+	"github.com/innobead/kubefire/pkg/util"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/thoas/go-funk"
 	"reflect"
+	"strings"
 )
 
+var deleteType string
+
 var deleteCmd = &cobra.Command{
-	Use:     "delete",
-	Short:   "Deletes caches",
+	Use:     "delete [path ...]",
+	Short:   "Deletes caches, except the images used by nodes",
 	Aliases: []string{"rm", "del"},
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if deleteType != "" && !funk.ContainsString(cacheTypes(), deleteType) {
+			return errors.Errorf("invalid type (%s), options: [%s]", deleteType, strings.Join(cacheTypes(), ", "))
+		}
+
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		for _, c := range cache.DefaultManagers(di.NodeManager()) {
-			err := c.DeleteAll()
+		managers := cache.DefaultManagers(di.NodeManager())
+
+		if len(args) > 0 {
+			return deleteCachePaths(managers, args)
+		}
+
+		for _, c := range managers {
+			var err error
+
+			if deleteType != "" {
+				err = c.Delete(cache.Type(deleteType))
+			} else {
+				err = c.DeleteAll()
+			}
+
 			if err != nil {
-				logrus.Error(errors.WithMessagef(err, "failed to delete %s caches", reflect.TypeOf(c).Name()))
+				logrus.Error(errors.WithMessagef(err, "failed to delete %s caches", reflect.TypeOf(c).Elem().Name()))
 			}
 		}
 
 		return nil
 	},
 }
+
+func init() {
+	deleteCmd.Flags().StringVar(&deleteType, "type", "", util.FlagsValuesUsage("Type of caches to delete, empty for all types", cacheTypes()))
+}
+
+func cacheTypes() []string {
+	var types []string
+
+	for _, t := range cache.Types {
+		types = append(types, string(t))
+	}
+
+	return types
+}
+
+// deleteCachePaths deletes the caches of the paths shown by 'kubefire cache show'.
+func deleteCachePaths(managers []cache.Manager, paths []string) error {
+	for _, p := range paths {
+		found := false
+
+		for _, m := range managers {
+			caches, err := m.ListAll(false)
+			if err != nil {
+				return errors.WithMessage(err, "failed to get cache info")
+			}
+
+			for _, c := range caches {
+				if string(c.Path) != p || (deleteType != "" && string(c.Type) != deleteType) {
+					continue
+				}
+
+				found = true
+
+				if err := m.DeletePath(c.Type, c.Path); err != nil {
+					return errors.WithMessagef(err, "failed to delete %s cache (%s)", c.Type, c.Path)
+				}
+			}
+		}
+
+		if !found {
+			return errors.Errorf("cache (%s) not found", p)
+		}
+	}
+
+	return nil
+}
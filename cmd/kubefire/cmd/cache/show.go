@@ -23,7 +23,7 @@ var showCmd = &cobra.Command{
 			caches = append(caches, cs...)
 		}
 
-		err := di.Output().Print(caches, []string{"Type", "Path", "Description"}, "")
+		err := di.Output().Print(caches, []string{"Type", "Path", "Size", "LastUsed", "InUse", "Pinned", "Description"}, "")
 		if err != nil {
 			return errors.WithMessagef(err, "failed to print output of cache info")
 		}
@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"context"
+	"github.com/avast/retry-go"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/config"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var cloneSnapshot string
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone [source name] [name]",
+	Short: "Clones cluster from a snapshot",
+	Args:  validate.ExactArgs("source cluster name", "cluster name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validate.CheckSnapshotExist(args[0], cloneSnapshot); err != nil {
+			return err
+		}
+
+		if err := validate.CheckClusterExist(args[1]); err == nil {
+			return errors.Errorf("cluster (%s) already exists", args[1])
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		return cloneCluster(ctx, args[0], cloneSnapshot, args[1])
+	},
+}
+
+func init() {
+	cloneCmd.Flags().StringVar(&cloneSnapshot, "snapshot", "", "Snapshot of the source cluster to clone from")
+	_ = cloneCmd.MarkFlagRequired("snapshot")
+}
+
+func cloneCluster(ctx context.Context, src string, snapshot string, name string) error {
+	origins, err := di.ClusterManager().Clone(ctx, src, snapshot, name)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to clone cluster (%s) from snapshot (%s) of cluster (%s)", name, snapshot, src)
+	}
+
+	cluster, err := di.ClusterManager().Get(ctx, name)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to get cluster (%s)", name)
+	}
+
+	if !cluster.Spec.Deployed {
+		return nil
+	}
+
+	// use the bootstrapper of the cloned cluster to re-key nodes
+	reinitDI := config.Bootstrapper != cluster.Spec.Bootstrapper
+	config.Bootstrapper = cluster.Spec.Bootstrapper
+	di.DelayInit(reinitDI)
+
+	if err := di.Bootstrapper().Rekey(ctx, cluster, origins); err != nil {
+		return errors.WithMessagef(err, "failed to re-key nodes of cluster (%s)", name)
+	}
+
+	_ = retry.Do(func() error {
+		if _, err := di.Bootstrapper().DownloadKubeConfig(ctx, cluster, ""); err != nil {
+			return errors.WithMessagef(err, "failed to download the kubeconfig of cluster (%s)", cluster.Name)
+		}
+
+		return nil
+	},
+		retry.Context(ctx),
+		retry.Delay(10*time.Second),
+	)
+
+	logrus.WithFields(logrus.Fields{
+		"cluster": name,
+		"source":  src,
+	}).Infoln("cloned cluster")
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/internal/validate"
 	"github.com/spf13/cobra"
@@ -12,6 +13,16 @@ var Cmd = &cobra.Command{
 	Short:   "Manages clusters",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		di.DelayInit(false)
+
+		// the commands check if the cluster exists by themselves
+		if len(args) > 0 {
+			if cluster, err := di.ConfigManager().GetCluster(args[0]); err == nil {
+				if err := intcmd.UseClusterNodeBackend(cmd, cluster); err != nil {
+					return err
+				}
+			}
+		}
+
 		return validate.CheckPrerequisites()
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -22,10 +33,19 @@ var Cmd = &cobra.Command{
 func init() {
 	cmds := []*cobra.Command{
 		createCmd,
+		planCmd,
 		startCmd,
 		stopCmd,
 		restartCmd,
 		deleteCmd,
+		scaleCmd,
+		resizeCmd,
+		snapshotCmd,
+		restoreCmd,
+		cloneCmd,
+		repairCmd,
+		routeCmd,
+		execCmd,
 		showCmd,
 		listCmd,
 		envCmd,
@@ -36,4 +56,24 @@ func init() {
 	for _, c := range cmds {
 		Cmd.AddCommand(c)
 	}
+
+	// the long-running commands can be cancelled by the timeout, as well as interrupted by Ctrl-C
+	timeoutCmds := []*cobra.Command{
+		createCmd,
+		startCmd,
+		stopCmd,
+		restartCmd,
+		deleteCmd,
+		scaleCmd,
+		resizeCmd,
+		snapshotCmd,
+		restoreCmd,
+		cloneCmd,
+		repairCmd,
+		execCmd,
+	}
+
+	for _, c := range timeoutCmds {
+		intcmd.AddTimeoutFlag(c)
+	}
 }
@@ -1,18 +1,23 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
 	"github.com/avast/retry-go"
 	"github.com/goccy/go-yaml"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/config"
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/internal/validate"
 	"github.com/innobead/kubefire/pkg/bootstrap"
+	pkgcluster "github.com/innobead/kubefire/pkg/cluster"
 	pkgconfig "github.com/innobead/kubefire/pkg/config"
 	"github.com/innobead/kubefire/pkg/data"
 	"github.com/innobead/kubefire/pkg/util"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"io/ioutil"
 	"regexp"
 	"strings"
@@ -20,11 +25,15 @@ import (
 )
 
 var (
-	cluster      = pkgconfig.NewDefaultCluster()
-	noStart      bool
-	noCache      bool
-	extraOptions string
-	configFile   string
+	cluster        = pkgconfig.NewDefaultCluster()
+	noStart        bool
+	noCache        bool
+	extraOptions   string
+	configFile     string
+	subnet         string
+	routes         []string
+	createOptions  pkgcluster.CreateOptions
+	ignoreCapacity bool
 )
 
 var createCmd = &cobra.Command{
@@ -32,21 +41,32 @@ var createCmd = &cobra.Command{
 	Short: "Creates cluster",
 	Args:  validate.OneArg("cluster name"),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		if configFile != "" {
-			bytes, err := ioutil.ReadFile(configFile)
-			if err != nil {
-				return errors.WithMessage(err, fmt.Sprintf("failed to get the cluster config file %s", configFile))
-			}
-
-			if err := yaml.Unmarshal(bytes, cluster); err != nil {
-				return errors.WithMessage(err, fmt.Sprintf("failed to parse the cluster config file %s", configFile))
-			}
+		if err := loadClusterConfig(); err != nil {
+			return err
 		}
 
 		if err := validate.CheckBootstrapperType(cluster.Bootstrapper); err != nil {
 			return err
 		}
 
+		if err := validate.CheckRestartPolicy(cluster.Restart); err != nil {
+			return err
+		}
+
+		if subnet != "" {
+			cluster.Network = &pkgconfig.Network{Subnet: subnet, Routes: routes}
+		}
+
+		cluster.Name = args[0]
+		cluster.NodeBackend = config.NodeBackend
+		if err := validate.CheckClusterNetwork(cluster); err != nil {
+			return err
+		}
+
+		if err := validate.CheckClusterAddresses(cluster); err != nil {
+			return err
+		}
+
 		reinitDI := config.Bootstrapper != cluster.Bootstrapper
 		config.Bootstrapper = cluster.Bootstrapper
 		di.DelayInit(reinitDI)
@@ -73,22 +93,31 @@ var createCmd = &cobra.Command{
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
 		cluster.Name = args[0]
 
 		if forceDeleteCluster {
-			_ = di.ClusterManager().Delete(cluster.Name, true)
+			_ = di.ClusterManager().Delete(ctx, cluster.Name, true)
+		}
+
+		if err := checkCapacity(ctx, cluster); err != nil {
+			return err
 		}
 
 		if err := di.ClusterManager().Init(cluster); err != nil {
 			return errors.WithMessagef(err, "failed to init cluster (%s)", cluster.Name)
 		}
 
-		if err := di.ClusterManager().Create(cluster.Name, !noStart); err != nil {
+		createOptions.Started = !noStart
+
+		if err := di.ClusterManager().Create(ctx, cluster.Name, createOptions); err != nil {
 			return errors.WithMessagef(err, "failed to create cluster (%s)", cluster.Name)
 		}
 
 		if !noStart {
-			if err := deployCluster(cluster.Name); err != nil {
+			if err := deployCluster(ctx, cluster.Name); err != nil {
 				return err
 			}
 		}
@@ -107,7 +136,26 @@ func init() {
 	flags.StringVar(&cluster.KernelImage, "kernel-image", cluster.KernelImage, "Kernel container image")
 	flags.StringVar(&cluster.KernelArgs, "kernel-args", cluster.KernelArgs, "Kernel arguments")
 	flags.StringVarP(&extraOptions, "extra-options", "o", "", "Extra options (ex: key=value,...) for bootstrapper")
+	flags.StringVar(&subnet, "subnet", "", "Subnet of the isolated cluster network (ex: 10.63.0.0/24), empty for the shared kubefire bridge network")
+	flags.StringSliceVar(&routes, "routes", nil, "Clusters routed with the isolated cluster network (ex: cluster1,cluster2)")
+	flags.StringVar(&cluster.Restart, "restart", "", util.FlagsValuesUsage("Restart policy of nodes applied by 'kubefire supervise'", pkgconfig.RestartPolicies))
+
+	addNodeConfigFlags(flags)
+	flags.StringToStringVar(&cluster.Master.Labels, "master-labels", nil, "Kubernetes labels of master node (ex: key=value,...)")
+	flags.StringSliceVar(&cluster.Master.Taints, "master-taints", nil, "Kubernetes taints of master node (ex: key=value:NoSchedule,...)")
+	flags.StringToStringVar(&cluster.Worker.Labels, "worker-labels", nil, "Kubernetes labels of worker node (ex: key=value,...)")
+	flags.StringSliceVar(&cluster.Worker.Taints, "worker-taints", nil, "Kubernetes taints of worker node (ex: key=value:NoSchedule,...)")
+
+	flags.BoolVarP(&forceDeleteCluster, "force", "f", false, "Force to recreate if the cluster exists")
+	flags.BoolVar(&noCache, "no-cache", false, "Forget caches")
+	flags.BoolVar(&noStart, "no-start", false, "Don't start nodes")
+	flags.IntVar(&createOptions.Retries, "retries", 0, "Times of retrying to create the failed nodes")
+	flags.BoolVar(&createOptions.KeepOnFailure, "keep-on-failure", false, "Keep the nodes created instead of rolling back if any node fails to be created")
+	flags.BoolVar(&ignoreCapacity, "ignore-capacity", false, "Only warn instead of refusing to create if the host capacity is insufficient")
+}
 
+// addNodeConfigFlags adds the flags of the node configs, which are shared by create and plan commands.
+func addNodeConfigFlags(flags *pflag.FlagSet) {
 	flags.IntVar(&cluster.Master.Count, "master-count", cluster.Master.Count, "Count of master node")
 	flags.IntVar(&cluster.Master.Cpus, "master-cpu", cluster.Master.Cpus, "CPUs of master node")
 	flags.StringVar(&cluster.Master.Memory, "master-memory", cluster.Master.Memory, "Memory of master node")
@@ -118,22 +166,52 @@ func init() {
 	flags.StringVar(&cluster.Worker.Memory, "worker-memory", cluster.Worker.Memory, "Memory of worker node")
 	flags.StringVar(&cluster.Worker.DiskSize, "worker-size", cluster.Worker.DiskSize, "Disk size of worker node")
 	flags.StringVarP(&configFile, "config", "c", "", "Cluster configuration file (ex: use 'config-template' command to generate the default cluster config)")
+}
 
-	flags.BoolVarP(&forceDeleteCluster, "force", "f", false, "Force to recreate if the cluster exists")
-	flags.BoolVar(&noCache, "no-cache", false, "Forget caches")
-	flags.BoolVar(&noStart, "no-start", false, "Don't start nodes")
+// loadClusterConfig loads the cluster config file if specified, and validates the node configs.
+func loadClusterConfig() error {
+	if configFile != "" {
+		bytes, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("failed to get the cluster config file %s", configFile))
+		}
+
+		if err := yaml.Unmarshal(bytes, cluster); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("failed to parse the cluster config file %s", configFile))
+		}
+	}
+
+	return validate.CheckNodeConfigs(cluster)
 }
 
-func deployCluster(name string) error {
-	cluster, err := di.ClusterManager().Get(name)
+// checkCapacity refuses to create the cluster if the host capacity is insufficient, unless the capacity is ignored.
+func checkCapacity(ctx context.Context, cluster *pkgconfig.Cluster) error {
+	plan, err := di.ClusterManager().Plan(ctx, cluster)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to plan the host capacity of cluster (%s)", cluster.Name)
+	}
+
+	if err := plan.Check(); err != nil {
+		if !ignoreCapacity {
+			return err
+		}
+
+		logrus.WithField("cluster", cluster.Name).WithError(err).Warnln("ignored the insufficient host capacity")
+	}
+
+	return nil
+}
+
+func deployCluster(ctx context.Context, name string) error {
+	cluster, err := di.ClusterManager().Get(ctx, name)
 	if err != nil {
 		return errors.WithMessagef(err, "failed to get cluster (%s) before bootstrapping", name)
 	}
 
-	err = di.Bootstrapper().Deploy(
+	err = di.Bootstrapper().Deploy(ctx,
 		cluster,
 		func() error {
-			return di.Bootstrapper().Prepare(cluster, forceDeleteCluster)
+			return di.Bootstrapper().Prepare(ctx, cluster, forceDeleteCluster)
 		},
 	)
 	if err != nil {
@@ -145,13 +223,18 @@ func deployCluster(name string) error {
 		return errors.WithMessagef(err, "failed to mark the cluster (%s) as deployed", cluster.Name)
 	}
 
+	if err := di.ClusterManager().RecordAddresses(ctx, cluster.Name); err != nil {
+		return errors.WithMessagef(err, "failed to record node addresses of cluster (%s)", cluster.Name)
+	}
+
 	_ = retry.Do(func() error {
-		if _, err := di.Bootstrapper().DownloadKubeConfig(cluster, ""); err != nil {
+		if _, err := di.Bootstrapper().DownloadKubeConfig(ctx, cluster, ""); err != nil {
 			return errors.WithMessagef(err, "failed to download the kubeconfig of cluster (%s)", cluster.Name)
 		}
 
 		return nil
 	},
+		retry.Context(ctx),
 		retry.Delay(10*time.Second),
 	)
 
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/internal/validate"
 	"github.com/pkg/errors"
@@ -22,8 +23,11 @@ var deleteCmd = &cobra.Command{
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
 		for _, n := range args {
-			if err := di.ClusterManager().Delete(n, forceDeleteCluster); err != nil {
+			if err := di.ClusterManager().Delete(ctx, n, forceDeleteCluster); err != nil {
 				return errors.WithMessagef(err, "failed to delete cluster (%s)", n)
 			}
 		}
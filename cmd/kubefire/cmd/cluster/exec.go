@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"fmt"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var execRole string
+
+var execCmd = &cobra.Command{
+	Use:   "exec [name] -- [command...]",
+	Short: "Runs command on all nodes of cluster in parallel",
+	Args:  validate.CommandArgs("cluster name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if execRole != "" && execRole != string(node.Master) && execRole != string(node.Worker) {
+			return errors.Errorf("invalid role (%s), options: [%s, %s]", execRole, node.Master, node.Worker)
+		}
+
+		return validate.CheckClusterExist(args[0])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		name := args[0]
+
+		cluster, err := di.ClusterManager().Get(ctx, name)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to get cluster (%s)", name)
+		}
+
+		var nodes []string
+
+		for _, n := range cluster.Nodes {
+			if execRole == "" || n.Labels[node.RoleLabel] == execRole {
+				nodes = append(nodes, n.Name)
+			}
+		}
+
+		if len(nodes) == 0 {
+			return errors.Errorf("no node of cluster (%s) to run command", name)
+		}
+
+		if err := di.ClusterManager().ExecNodes(ctx, name, nodes, util.ShellQuote(args[1:]...), os.Stdout, os.Stderr); err != nil {
+			return errors.WithMessagef(err, "failed to run command on nodes of cluster (%s)", name)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	execCmd.Flags().StringVar(&execRole, "role", "", fmt.Sprintf("Role of the nodes to run command, options: [%s, %s], empty for all nodes", node.Master, node.Worker))
+}
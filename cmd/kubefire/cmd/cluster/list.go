@@ -13,7 +13,7 @@ var listCmd = &cobra.Command{
 	Aliases: []string{"ls"},
 	Short:   "Lists clusters",
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		_, err := di.ClusterManager().List()
+		_, err := di.ClusterManager().List(cmd.Context())
 		if err != nil {
 			return errors.WithMessagef(err, "failed to list clusters info")
 		}
@@ -21,7 +21,7 @@ var listCmd = &cobra.Command{
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		clusters, _ := di.ClusterManager().List()
+		clusters, _ := di.ClusterManager().List(cmd.Context())
 
 		var configClusters []*config.Cluster
 		for _, c := range clusters {
@@ -0,0 +1,37 @@
+package cluster
+
+import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan [name]",
+	Short: "Checks if the host has enough capacity to create cluster",
+	Args:  validate.OneArg("cluster name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadClusterConfig()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cluster.Name = args[0]
+
+		plan, err := di.ClusterManager().Plan(cmd.Context(), cluster)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to plan the host capacity of cluster (%s)", cluster.Name)
+		}
+
+		if err := di.Output().Print(plan.Resources, nil, ""); err != nil {
+			return errors.WithMessagef(err, "failed to print output of the plan of cluster (%s)", cluster.Name)
+		}
+
+		return plan.Check()
+	},
+}
+
+func init() {
+	addNodeConfigFlags(planCmd.Flags())
+	intcmd.AddOutputFlag(planCmd)
+}
@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"context"
+	"github.com/avast/retry-go"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/config"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var repairCmd = &cobra.Command{
+	Use:   "repair [name]",
+	Short: "Repairs cluster if the node addresses have been changed",
+	Args:  validate.OneArg("cluster name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validate.CheckClusterExist(args[0])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		return repairCluster(ctx, args[0])
+	},
+}
+
+// repairCluster re-keys the deployed cluster with the current node addresses if they are different from the persistent
+// addresses, for example, the persistent address has been taken by others or ignite allocates a new address after
+// restarting. The current addresses are recorded as the persistent addresses afterwards.
+func repairCluster(ctx context.Context, name string) error {
+	changed, err := di.ClusterManager().CheckAddresses(ctx, name)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to check node addresses of cluster (%s)", name)
+	}
+
+	if len(changed) > 0 {
+		cluster, err := di.ClusterManager().Get(ctx, name)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to get cluster (%s)", name)
+		}
+
+		if cluster.Spec.Deployed {
+			logrus.WithField("cluster", name).Infof("repairing cluster, because the addresses of %d nodes changed", len(changed))
+
+			// use the bootstrapper of the cluster to re-key nodes
+			reinitDI := config.Bootstrapper != cluster.Spec.Bootstrapper
+			config.Bootstrapper = cluster.Spec.Bootstrapper
+			di.DelayInit(reinitDI)
+
+			// the unchanged nodes are their own original nodes
+			origins := map[string]*data.Node{}
+			for _, n := range cluster.Nodes {
+				origins[n.Name] = n
+
+				if origin, ok := changed[n.Name]; ok {
+					origins[n.Name] = origin
+				}
+			}
+
+			if err := di.Bootstrapper().Rekey(ctx, cluster, origins); err != nil {
+				return errors.WithMessagef(err, "failed to re-key nodes of cluster (%s)", name)
+			}
+
+			_ = retry.Do(func() error {
+				if _, err := di.Bootstrapper().DownloadKubeConfig(ctx, cluster, ""); err != nil {
+					return errors.WithMessagef(err, "failed to download the kubeconfig of cluster (%s)", cluster.Name)
+				}
+
+				return nil
+			},
+				retry.Context(ctx),
+				retry.Delay(10*time.Second),
+			)
+		}
+	}
+
+	if err := di.ClusterManager().RecordAddresses(ctx, name); err != nil {
+		return errors.WithMessagef(err, "failed to record node addresses of cluster (%s)", name)
+	}
+
+	return nil
+}
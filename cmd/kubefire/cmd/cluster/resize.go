@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/config"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	pkgcluster "github.com/innobead/kubefire/pkg/cluster"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resizeRole    string
+	resizePool    string
+	resizeSpec    pkgconfig.Node
+	resizeRolling bool
+)
+
+var resizeCmd = &cobra.Command{
+	Use:   "resize [name]",
+	Short: "Resizes CPUs, memory or disk of nodes of cluster",
+	Args:  validate.OneArg("cluster name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if resizeRole != "" && resizeRole != string(node.Master) && resizeRole != string(node.Worker) {
+			return errors.Errorf("invalid role (%s), options: [%s, %s]", resizeRole, node.Master, node.Worker)
+		}
+
+		if resizePool != "" && resizeRole == string(node.Master) {
+			return errors.New("--pool is not applicable to master nodes")
+		}
+
+		if err := validate.CheckClusterExist(args[0]); err != nil {
+			return err
+		}
+
+		if err := validate.CheckNodeResources(&resizeSpec); err != nil {
+			return err
+		}
+
+		cluster, err := di.ConfigManager().GetCluster(args[0])
+		if err != nil {
+			return err
+		}
+
+		// use the bootstrapper of the cluster to drain and uncordon nodes
+		reinitDI := config.Bootstrapper != cluster.Bootstrapper
+		config.Bootstrapper = cluster.Bootstrapper
+		di.DelayInit(reinitDI)
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		return resizeCluster(ctx, args[0], resizeRole, resizePool, &resizeSpec, resizeRolling)
+	},
+}
+
+func init() {
+	flags := resizeCmd.Flags()
+
+	flags.StringVar(&resizeRole, "role", "", fmt.Sprintf("Role of the nodes to resize, options: [%s, %s], empty for all nodes", node.Master, node.Worker))
+	flags.StringVar(&resizePool, "pool", "", "Worker pool to resize instead of all nodes")
+	flags.IntVar(&resizeSpec.Cpus, "cpus", 0, "CPUs of nodes (ex: 0 means unchanged)")
+	flags.StringVar(&resizeSpec.Memory, "memory", "", "Memory of nodes (ex: 2GB, empty means unchanged)")
+	flags.StringVar(&resizeSpec.DiskSize, "disk", "", "Disk size of nodes, which can only grow (ex: 20GB, empty means unchanged)")
+	flags.BoolVar(&resizeRolling, "rolling", false, "Resize nodes one by one, and drain and uncordon them if the cluster has been deployed")
+}
+
+func resizeCluster(ctx context.Context, name string, role string, pool string, spec *pkgconfig.Node, rolling bool) error {
+	cluster, err := di.ClusterManager().Get(ctx, name)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to get cluster (%s)", name)
+	}
+
+	var nodes []*data.Node
+
+	for _, n := range cluster.Nodes {
+		if role != "" && n.Labels[node.RoleLabel] != role {
+			continue
+		}
+
+		if pool != "" && n.Labels[node.PoolLabel] != pool {
+			continue
+		}
+
+		nodes = append(nodes, n)
+	}
+
+	if len(nodes) == 0 {
+		return errors.Errorf("no node of cluster (%s) to resize", name)
+	}
+
+	opts := pkgcluster.ResizeOptions{Rolling: rolling}
+
+	if rolling && cluster.Spec.Deployed {
+		opts.Drain = func(ctx context.Context, n *data.Node) error {
+			return di.Bootstrapper().DrainNode(ctx, cluster, n)
+		}
+		opts.Uncordon = func(ctx context.Context, n *data.Node) error {
+			return di.Bootstrapper().UncordonNode(ctx, cluster, n)
+		}
+	}
+
+	if err := di.ClusterManager().ResizeNodes(ctx, name, nodes, spec, opts); err != nil {
+		return errors.WithMessagef(err, "failed to resize nodes of cluster (%s)", name)
+	}
+
+	// the node backend like ignite may allocate new addresses after restarting nodes
+	if err := repairCluster(ctx, name); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"cluster": name,
+		"resized": len(nodes),
+	}).Infoln("resized cluster")
+
+	return nil
+}
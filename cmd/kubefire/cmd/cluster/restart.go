@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/validate"
 	"github.com/spf13/cobra"
 )
@@ -13,16 +14,24 @@ var restartCmd = &cobra.Command{
 		return validate.CheckClusterExist(args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
 		name := args[0]
 
-		if err := stopCluster(name); err != nil {
+		if err := stopCluster(ctx, name); err != nil {
 			return err
 		}
 
-		if _, err := startCluster(name); err != nil {
+		cluster, err := startCluster(ctx, name)
+		if err != nil {
 			return err
 		}
 
+		if cluster.Deployed {
+			return repairCluster(ctx, name)
+		}
+
 		return nil
 	},
 }
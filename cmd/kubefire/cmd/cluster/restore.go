@@ -0,0 +1,29 @@
+package cluster
+
+import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [name] [snapshot name]",
+	Short: "Restores cluster from a snapshot",
+	Args:  validate.ExactArgs("cluster name", "snapshot name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		// the cluster may have been deleted, so only the snapshot is required
+		return validate.CheckSnapshotExist(args[0], args[1])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		if err := di.ClusterManager().Restore(ctx, args[0], args[1]); err != nil {
+			return errors.WithMessagef(err, "failed to restore cluster (%s) from snapshot (%s)", args[0], args[1])
+		}
+
+		return repairCluster(ctx, args[0])
+	},
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var routeCmd = &cobra.Command{
+	Use:   "route [name] [cluster...]",
+	Short: "Routes the isolated network of cluster with other clusters, or isolates it from all clusters if no cluster specified",
+	Args:  validate.MinimumArgs("cluster name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validate.CheckClusterExist(args[0])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		name := args[0]
+
+		cluster, err := di.ConfigManager().GetCluster(name)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to get cluster (%s)", name)
+		}
+
+		if cluster.Network == nil {
+			return errors.Errorf("cluster (%s) does not have an isolated network", name)
+		}
+
+		cluster.Network.Routes = args[1:]
+
+		if err := validate.CheckClusterNetwork(cluster); err != nil {
+			return err
+		}
+
+		if err := di.ConfigManager().SaveCluster(cluster); err != nil {
+			return errors.WithMessagef(err, "failed to save cluster (%s)", name)
+		}
+
+		if err := di.ClusterManager().SyncNetworks(ctx); err != nil {
+			return errors.WithMessagef(err, "failed to sync network of cluster (%s)", name)
+		}
+
+		logrus.WithField("cluster", name).Infof("routed cluster network with %v", cluster.Network.Routes)
+
+		return nil
+	},
+}
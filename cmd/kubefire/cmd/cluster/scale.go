@@ -0,0 +1,165 @@
+package cluster
+
+import (
+	"context"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/config"
+	"github.com/innobead/kubefire/internal/di"
+	interr "github.com/innobead/kubefire/internal/error"
+	"github.com/innobead/kubefire/internal/validate"
+	pkgcluster "github.com/innobead/kubefire/pkg/cluster"
+	"github.com/innobead/kubefire/pkg/constants"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scaleMasterCount int
+	scaleWorkerCount int
+	scaleWorkerPool  string
+	scaleOptions     pkgcluster.CreateOptions
+)
+
+var scaleCmd = &cobra.Command{
+	Use:   "scale [name]",
+	Short: "Scales cluster by adding or removing nodes",
+	Args:  validate.OneArg("cluster name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validate.CheckClusterExist(args[0]); err != nil {
+			return err
+		}
+
+		if scaleMasterCount < 0 && scaleWorkerCount < 0 {
+			return errors.New("--masters or --workers is required")
+		}
+
+		if scaleWorkerPool != "" && scaleMasterCount >= 0 {
+			return errors.New("--masters is not applicable to worker pool")
+		}
+
+		if scaleMasterCount == 0 {
+			return errors.New("cluster requires at least one master node")
+		}
+
+		cluster, err := di.ConfigManager().GetCluster(args[0])
+		if err != nil {
+			return err
+		}
+
+		// kubeadm joins the added nodes as workers only, because the cluster has no control plane endpoint shared by masters
+		if cluster.Bootstrapper == constants.KUBEADM && scaleMasterCount > cluster.Master.Count {
+			return errors.WithMessagef(interr.BootstrapperNotSupportError, "adding master nodes to %s cluster", cluster.Bootstrapper)
+		}
+
+		// the removed nodes are only drained and deleted from the cluster without leaving etcd, so removing master nodes
+		// makes the etcd cluster of k3s, rke2 and k0s lose the quorum
+		if scaleMasterCount >= 0 && scaleMasterCount < cluster.Master.Count {
+			return errors.WithMessagef(interr.BootstrapperNotSupportError, "removing master nodes from %s cluster", cluster.Bootstrapper)
+		}
+
+		// use the bootstrapper of the cluster to join or remove nodes
+		reinitDI := config.Bootstrapper != cluster.Bootstrapper
+		config.Bootstrapper = cluster.Bootstrapper
+		di.DelayInit(reinitDI)
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		return scaleCluster(ctx, args[0], scaleMasterCount, scaleWorkerCount, scaleWorkerPool, scaleOptions)
+	},
+}
+
+func init() {
+	flags := scaleCmd.Flags()
+
+	flags.IntVar(&scaleMasterCount, "masters", -1, "Count of master nodes after scaling (ex: -1 means unchanged)")
+	flags.IntVar(&scaleWorkerCount, "workers", -1, "Count of worker nodes after scaling (ex: -1 means unchanged)")
+	flags.StringVar(&scaleWorkerPool, "pool", "", "Worker pool to scale by --workers instead of the default worker nodes")
+	flags.IntVar(&scaleOptions.Retries, "retries", 0, "Times of retrying to create the failed nodes")
+	flags.BoolVar(&scaleOptions.KeepOnFailure, "keep-on-failure", false, "Keep the nodes added instead of rolling back if any node fails to be created")
+}
+
+func scaleCluster(ctx context.Context, name string, masterCount int, workerCount int, workerPool string, opts pkgcluster.CreateOptions) error {
+	cluster, err := di.ClusterManager().Get(ctx, name)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to get cluster (%s)", name)
+	}
+
+	var addedNodes []*data.Node
+	var removedNodes []*data.Node
+
+	nodeTypeCounts := []struct {
+		nodeType node.Type
+		pool     string
+		count    int
+	}{
+		{node.Master, "", masterCount},
+		{node.Worker, workerPool, workerCount},
+	}
+
+	for _, c := range nodeTypeCounts {
+		if c.count < 0 {
+			continue
+		}
+
+		current := 0
+		for _, n := range cluster.Nodes {
+			if n.Labels[node.RoleLabel] == string(c.nodeType) && n.Labels[node.PoolLabel] == c.pool {
+				current++
+			}
+		}
+
+		switch {
+		case c.count > current:
+			// the new nodes only need to be started if the cluster has been deployed, otherwise they will be started and deployed along with the existing nodes by 'cluster start'
+			opts.Started = cluster.Spec.Deployed
+
+			nodes, err := di.ClusterManager().AddNodes(ctx, name, c.nodeType, c.pool, c.count-current, opts)
+			if err != nil {
+				return errors.WithMessagef(err, "failed to add %s nodes to cluster (%s)", c.nodeType, name)
+			}
+
+			addedNodes = append(addedNodes, nodes...)
+
+		case c.count < current:
+			removedNodes = append(removedNodes, pkgcluster.NodesToRemove(cluster.Nodes, c.nodeType, c.pool, current-c.count)...)
+		}
+	}
+
+	if len(removedNodes) > 0 {
+		if cluster.Spec.Deployed {
+			if err := di.Bootstrapper().RemoveNodes(ctx, cluster, removedNodes); err != nil {
+				return errors.WithMessagef(err, "failed to remove nodes from cluster (%s)", name)
+			}
+		}
+
+		if err := di.ClusterManager().DeleteNodes(ctx, name, removedNodes); err != nil {
+			return errors.WithMessagef(err, "failed to delete nodes of cluster (%s)", name)
+		}
+	}
+
+	if len(addedNodes) > 0 && cluster.Spec.Deployed {
+		cluster, err := di.ClusterManager().Get(ctx, name)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to get cluster (%s) before joining nodes", name)
+		}
+
+		if err := di.Bootstrapper().JoinNodes(ctx, cluster, addedNodes); err != nil {
+			return errors.WithMessagef(err, "failed to join nodes to cluster (%s)", name)
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"cluster": name,
+		"added":   len(addedNodes),
+		"removed": len(removedNodes),
+	}).Infoln("scaled cluster")
+
+	return nil
+}
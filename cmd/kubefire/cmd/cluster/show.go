@@ -16,9 +16,11 @@ var showCmd = &cobra.Command{
 		return validate.CheckClusterExist(args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
 		name := args[0]
 
-		cluster, err := di.ClusterManager().Get(name)
+		cluster, err := di.ClusterManager().Get(ctx, name)
 		if err != nil {
 			return errors.WithMessagef(err, "failed to get cluster (%s) info", name)
 		}
@@ -0,0 +1,34 @@
+package cluster
+
+import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var snapshotMemory bool
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot [name] [snapshot name]",
+	Short: "Takes a snapshot of cluster",
+	Args:  validate.ExactArgs("cluster name", "snapshot name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validate.CheckClusterExist(args[0])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		if err := di.ClusterManager().Snapshot(ctx, args[0], args[1], snapshotMemory); err != nil {
+			return errors.WithMessagef(err, "failed to take snapshot (%s) of cluster (%s)", args[1], args[0])
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	snapshotCmd.Flags().BoolVar(&snapshotMemory, "memory", false, "Include the memory of running nodes without stopping them (only supported by firecracker node backend)")
+}
@@ -1,6 +1,8 @@
 package cluster
 
 import (
+	"context"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/internal/validate"
 	"github.com/innobead/kubefire/pkg/config"
@@ -17,16 +19,19 @@ var startCmd = &cobra.Command{
 		return validate.CheckClusterExist(args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cluster, err := startCluster(args[0])
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		cluster, err := startCluster(ctx, args[0])
 		if err != nil {
 			return err
 		}
 
 		if cluster.Deployed {
-			return nil
+			return repairCluster(ctx, cluster.Name)
 		}
 
-		if err := deployCluster(cluster.Name); err != nil {
+		if err := deployCluster(ctx, cluster.Name); err != nil {
 			return err
 		}
 
@@ -34,8 +39,20 @@ var startCmd = &cobra.Command{
 	},
 }
 
-func startCluster(name string) (*config.Cluster, error) {
-	if err := di.NodeManager().StartNodes(name); err != nil {
+func startCluster(ctx context.Context, name string) (*config.Cluster, error) {
+	cluster, err := di.ConfigManager().GetCluster(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the iptables rules of the isolated cluster networks do not survive the host reboot
+	if cluster.Network != nil {
+		if err := di.ClusterManager().SyncNetworks(ctx); err != nil {
+			return nil, errors.WithMessagef(err, "failed to sync network of cluster (%s)", name)
+		}
+	}
+
+	if err := di.NodeManager().StartNodes(ctx, name); err != nil {
 		err := errors.WithMessagef(err, "failed to start all nodes cluster (%s)", name)
 
 		if !forceDeleteCluster {
@@ -45,9 +62,8 @@ func startCluster(name string) (*config.Cluster, error) {
 		logrus.WithError(err).WithField("node", name).Println()
 	}
 
-	cluster, err := di.ConfigManager().GetCluster(name)
-	if err != nil {
-		return nil, err
+	if err := di.ClusterManager().MarkNodesStopped(ctx, name, nil, false); err != nil {
+		return nil, errors.WithMessagef(err, "failed to unmark the nodes of cluster (%s) stopped", name)
 	}
 
 	return cluster, nil
@@ -1,6 +1,8 @@
 package cluster
 
 import (
+	"context"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/internal/validate"
 	"github.com/pkg/errors"
@@ -15,12 +17,19 @@ var stopCmd = &cobra.Command{
 		return validate.CheckClusterExist(args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return stopCluster(args[0])
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		return stopCluster(ctx, args[0])
 	},
 }
 
-func stopCluster(name string) error {
-	if err := di.NodeManager().StopNodes(name); err != nil {
+func stopCluster(ctx context.Context, name string) error {
+	if err := di.ClusterManager().MarkNodesStopped(ctx, name, nil, true); err != nil {
+		return errors.WithMessagef(err, "failed to mark the nodes of cluster (%s) stopped", name)
+	}
+
+	if err := di.NodeManager().StopNodes(ctx, name); err != nil {
 		return errors.WithMessagef(err, "failed to stop all nodes cluster (%s)", name)
 	}
 
@@ -0,0 +1,60 @@
+package image
+
+import (
+	"fmt"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/pkg/cache"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var Cmd = &cobra.Command{
+	Use:     "image",
+	Aliases: []string{"i"},
+	Short:   "Shows supported RootFS and Kernel images, or manages the cached images",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		logrus.SetLevel(logrus.ErrorLevel)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		infos, err := intcmd.ImageInfos()
+		if err != nil {
+			return errors.WithMessage(err, "failed to print output of images info")
+		}
+
+		if err := di.Output().Print(infos, nil, ""); err != nil {
+			return errors.WithMessage(err, "failed to print output of images info")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	intcmd.AddOutputFlag(Cmd)
+
+	cmds := []*cobra.Command{
+		pullCmd,
+		pinCmd,
+		unpinCmd,
+	}
+
+	for _, c := range cmds {
+		Cmd.AddCommand(c)
+	}
+
+	intcmd.AddTimeoutFlag(pullCmd)
+}
+
+func checkImageType(t string) error {
+	if t != string(cache.NodeImageCacheType) && t != string(cache.NodeKernelCacheType) {
+		return errors.Errorf("invalid type (%s), options: [%s, %s]", t, cache.NodeImageCacheType, cache.NodeKernelCacheType)
+	}
+
+	return nil
+}
+
+func imageTypeUsage(prefix string) string {
+	return fmt.Sprintf("%s, options: [%s, %s]", prefix, cache.NodeImageCacheType, cache.NodeKernelCacheType)
+}
@@ -0,0 +1,66 @@
+package image
+
+import (
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/innobead/kubefire/pkg/cache"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var pinType string
+
+var pinCmd = &cobra.Command{
+	Use:   "pin [image ...]",
+	Short: "Pins the cached images, so they are not deleted by 'kubefire cache delete'",
+	Args:  validate.MinimumArgs("image"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkImageType(pinType); err != nil {
+			return err
+		}
+
+		return validate.CheckPrerequisites()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodeCache := cache.NewNodeCache(di.NodeManager())
+
+		for _, image := range args {
+			if err := nodeCache.Pin(cache.Type(pinType), cache.Path(image)); err != nil {
+				return errors.WithMessagef(err, "failed to pin %s (%s)", pinType, image)
+			}
+
+			logrus.WithField(pinType, image).Infoln("pinned")
+		}
+
+		return nil
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin [image ...]",
+	Short: "Unpins the images",
+	Args:  validate.MinimumArgs("image"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return checkImageType(pinType)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		nodeCache := cache.NewNodeCache(di.NodeManager())
+
+		for _, image := range args {
+			if err := nodeCache.Unpin(cache.Type(pinType), cache.Path(image)); err != nil {
+				return errors.WithMessagef(err, "failed to unpin %s (%s)", pinType, image)
+			}
+
+			logrus.WithField(pinType, image).Infoln("unpinned")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{pinCmd, unpinCmd} {
+		c.Flags().StringVar(&pinType, "type", string(cache.NodeImageCacheType), imageTypeUsage("Type of the images"))
+	}
+}
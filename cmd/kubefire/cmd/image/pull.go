@@ -0,0 +1,146 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/innobead/kubefire/pkg/cache"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var (
+	pullType         string
+	pullAllDefaults  bool
+	pullAllSupported bool
+	pullPin          bool
+)
+
+// pullImage is the rootfs or kernel image to pull.
+type pullImage struct {
+	t     cache.Type
+	image string
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull [image ...]",
+	Short: "Pulls RootFS or Kernel images to the caches",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		options := 0
+		for _, ok := range []bool{len(args) > 0, pullAllDefaults, pullAllSupported} {
+			if ok {
+				options++
+			}
+		}
+
+		if options != 1 {
+			return errors.New("either images, --all-defaults or --all-supported is required")
+		}
+
+		if err := checkImageType(pullType); err != nil {
+			return err
+		}
+
+		return validate.CheckPrerequisites()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		var images []pullImage
+
+		switch {
+		case pullAllDefaults:
+			cluster := pkgconfig.NewDefaultCluster()
+
+			images = append(
+				images,
+				pullImage{cache.NodeImageCacheType, cluster.Image},
+				pullImage{cache.NodeKernelCacheType, cluster.KernelImage},
+			)
+
+		case pullAllSupported:
+			infos, err := intcmd.ImageInfos()
+			if err != nil {
+				return errors.WithMessage(err, "failed to get the supported images")
+			}
+
+			for _, info := range *infos {
+				if info.Type == "RootFS" {
+					images = append(images, pullImage{cache.NodeImageCacheType, info.Image})
+					continue
+				}
+
+				// the kernel images are built for the architectures
+				if strings.HasSuffix(info.Image, "-"+runtime.GOARCH) {
+					images = append(images, pullImage{cache.NodeKernelCacheType, info.Image})
+				}
+			}
+
+		default:
+			for _, image := range args {
+				images = append(images, pullImage{cache.Type(pullType), image})
+			}
+		}
+
+		return pullImages(ctx, images, pullPin)
+	},
+}
+
+func init() {
+	flags := pullCmd.Flags()
+
+	flags.StringVar(&pullType, "type", string(cache.NodeImageCacheType), imageTypeUsage("Type of the images to pull"))
+	flags.BoolVar(&pullAllDefaults, "all-defaults", false, "Pull the default RootFS and Kernel images of clusters")
+	flags.BoolVar(&pullAllSupported, "all-supported", false, "Pull all supported RootFS images and the Kernel images of the host architecture")
+	flags.BoolVar(&pullPin, "pin", false, "Pin the images pulled, so they are not deleted by 'kubefire cache delete'")
+
+	intcmd.AddOutputFlag(pullCmd)
+}
+
+func pullImages(ctx context.Context, images []pullImage, pin bool) error {
+	nodeCache := cache.NewNodeCache(di.NodeManager())
+
+	var caches []*cache.Cache
+
+	for i, img := range images {
+		progress := fmt.Sprintf("[%d/%d]", i+1, len(images))
+		start := time.Now()
+
+		logrus.WithField(string(img.t), img.image).Infof("%s pulling %s", progress, img.t)
+
+		c, err := nodeCache.Pull(ctx, img.t, img.image)
+		if err != nil {
+			return err
+		}
+
+		if pin {
+			if err := nodeCache.Pin(c.Type, c.Path); err != nil {
+				return errors.WithMessagef(err, "failed to pin %s (%s)", c.Type, c.Path)
+			}
+
+			c.Pinned = true
+		}
+
+		logrus.WithFields(logrus.Fields{
+			string(img.t): c.Path,
+			"size":        c.Size,
+			"duration":    time.Since(start).Round(time.Second),
+		}).Infof("%s pulled %s", progress, img.t)
+
+		caches = append(caches, c)
+	}
+
+	if err := di.Output().Print(caches, []string{"Type", "Path", "Size", "Pinned", "Description"}, ""); err != nil {
+		return errors.WithMessage(err, "failed to print output of images pulled")
+	}
+
+	return nil
+}
@@ -29,7 +29,7 @@ var InstallCmd = &cobra.Command{
 				return err
 			}
 
-			if err := script.Run(s, config.TagVersion, createSetupInstallCommandEnvsFunc()); err != nil {
+			if err := script.Run(cmd.Context(), s, config.TagVersion, createSetupInstallCommandEnvsFunc()); err != nil {
 				return err
 			}
 		}
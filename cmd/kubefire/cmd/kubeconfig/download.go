@@ -18,9 +18,11 @@ var downloadCmd = &cobra.Command{
 		return validate.CheckClusterExist(args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
 		name := args[0]
 
-		cluster, err := di.ClusterManager().Get(name)
+		cluster, err := di.ClusterManager().Get(ctx, name)
 		if err != nil {
 			return errors.WithMessagef(err, "failed to get cluster (%s) info", name)
 		}
@@ -29,7 +31,7 @@ var downloadCmd = &cobra.Command{
 		di.DelayInit(true)
 
 		wd, _ := os.Getwd()
-		if _, err := di.Bootstrapper().DownloadKubeConfig(cluster, wd); err != nil {
+		if _, err := di.Bootstrapper().DownloadKubeConfig(ctx, cluster, wd); err != nil {
 			return errors.WithMessagef(err, "failed to download kubeconfig of cluster (%s)", name)
 		}
 
@@ -23,9 +23,11 @@ var showCmd = &cobra.Command{
 		return validate.CheckClusterExist(args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
 		name := args[0]
 
-		cluster, err := di.ClusterManager().Get(name)
+		cluster, err := di.ClusterManager().Get(ctx, name)
 		if err != nil {
 			return errors.WithMessagef(err, "failed to get cluster (%s) info", name)
 		}
@@ -39,7 +41,7 @@ var showCmd = &cobra.Command{
 		di.DelayInit(true)
 
 		wd, _ := os.Getwd()
-		kubeconfigPath, err := di.Bootstrapper().DownloadKubeConfig(cluster, wd)
+		kubeconfigPath, err := di.Bootstrapper().DownloadKubeConfig(ctx, cluster, wd)
 		if err != nil {
 			return errors.WithMessagef(err, "failed to download kubeconfig of cluster (%s)", name)
 		}
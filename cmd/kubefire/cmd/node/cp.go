@@ -0,0 +1,68 @@
+package node
+
+import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp [[node name:]source path] [[node name:]destination path]",
+	Short: "Copies files or folders recursively between host and node (ex: demo-master-1:/etc/hosts, or a path on host)",
+	Args:  validate.ExactArgs("source path", "destination path"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		srcNode, _ := parseNodePath(args[0])
+		destNode, _ := parseNodePath(args[1])
+
+		switch {
+		case srcNode != "" && destNode != "":
+			return errors.New("copying files between nodes is not supported")
+		case srcNode == "" && destNode == "":
+			return errors.New("missing node name of source or destination path (ex: demo-master-1:/root)")
+		case srcNode != "":
+			return validate.CheckNodeExist(cmd.Context(), srcNode)
+		default:
+			return validate.CheckNodeExist(cmd.Context(), destNode)
+		}
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		srcNode, srcPath := parseNodePath(args[0])
+		destNode, destPath := parseNodePath(args[1])
+
+		if srcNode != "" {
+			if err := di.ClusterManager().CopyFromNode(ctx, srcNode, srcPath, destPath); err != nil {
+				return errors.WithMessagef(err, "failed to copy %s from node (%s)", srcPath, srcNode)
+			}
+
+			return nil
+		}
+
+		if err := di.ClusterManager().CopyToNode(ctx, destNode, srcPath, destPath); err != nil {
+			return errors.WithMessagef(err, "failed to copy %s to node (%s)", srcPath, destNode)
+		}
+
+		return nil
+	},
+}
+
+// parseNodePath returns the node name and the path of the node path like <node name>:<path>, or the empty node name
+// for the host path. The path is the home folder of the node if not specified.
+func parseNodePath(arg string) (string, string) {
+	i := strings.Index(arg, ":")
+	if i <= 0 || strings.Contains(arg[:i], "/") {
+		return "", arg
+	}
+
+	nodePath := arg[i+1:]
+	if nodePath == "" {
+		nodePath = "."
+	}
+
+	return arg[:i], nodePath
+}
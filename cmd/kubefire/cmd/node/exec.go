@@ -0,0 +1,44 @@
+package node
+
+import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"os"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec [name] -- [command...]",
+	Short: "Runs command on node, and exits with the exit status of the command",
+	Args:  validate.CommandArgs("node name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validate.CheckNodeExist(cmd.Context(), args[0])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		node, err := di.NodeManager().GetNode(ctx, args[0])
+		if err != nil {
+			return errors.WithMessagef(err, "failed to get node (%s)", args[0])
+		}
+
+		err = di.ClusterManager().ExecNodes(ctx, node.Spec.Cluster.Name, []string{node.Name}, util.ShellQuote(args[1:]...), os.Stdout, os.Stderr)
+		if err != nil {
+			var exitErr *ssh.ExitError
+			if errors.As(err, &exitErr) {
+				logrus.WithField("node", node.Name).Errorf("command exited with status %d", exitErr.ExitStatus())
+				os.Exit(exitErr.ExitStatus())
+			}
+
+			return errors.WithMessagef(err, "failed to run command on node (%s)", node.Name)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,31 @@
+package node
+
+import (
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var followLogs bool
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [name]",
+	Short: "Shows the serial console output of node",
+	Args:  validate.OneArg("node name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validate.CheckNodeExist(cmd.Context(), args[0])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := di.NodeManager().Logs(cmd.Context(), args[0], followLogs, os.Stdout); err != nil {
+			return errors.WithMessagef(err, "failed to get the console logs of node (%s)", args[0])
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&followLogs, "follow", "f", false, "Follow the console output")
+}
@@ -1,6 +1,7 @@
 package node
 
 import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/internal/validate"
 	"github.com/spf13/cobra"
@@ -12,6 +13,20 @@ var Cmd = &cobra.Command{
 	Short:   "Manages nodes",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		di.DelayInit(false)
+
+		if name := nodeArg(cmd, args); name != "" {
+			cluster, err := intcmd.NodeCluster(cmd.Context(), name)
+			if err != nil {
+				return err
+			}
+
+			if cluster != nil {
+				if err := intcmd.UseClusterNodeBackend(cmd, cluster); err != nil {
+					return err
+				}
+			}
+		}
+
 		return validate.CheckPrerequisites()
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -19,16 +34,56 @@ var Cmd = &cobra.Command{
 	},
 }
 
+// nodeArg returns the node name of the command, which is the node part of the source or destination path for cp
+// command, or the first argument for the others.
+func nodeArg(cmd *cobra.Command, args []string) string {
+	if cmd == cpCmd {
+		for _, arg := range args {
+			if name, _ := parseNodePath(arg); name != "" {
+				return name
+			}
+		}
+
+		return ""
+	}
+
+	if len(args) == 0 {
+		return ""
+	}
+
+	return args[0]
+}
+
 func init() {
 	cmds := []*cobra.Command{
 		sshCmd,
+		execCmd,
+		cpCmd,
 		showCmd,
 		startCmd,
 		stopCmd,
 		restartCmd,
+		resizeCmd,
+		logsCmd,
+		saveLogsCmd,
+		portForwardCmd,
 	}
 
 	for _, c := range cmds {
 		Cmd.AddCommand(c)
 	}
+
+	// the long-running commands can be cancelled by the timeout, as well as interrupted by Ctrl-C
+	timeoutCmds := []*cobra.Command{
+		execCmd,
+		cpCmd,
+		startCmd,
+		stopCmd,
+		restartCmd,
+		resizeCmd,
+	}
+
+	for _, c := range timeoutCmds {
+		intcmd.AddTimeoutFlag(c)
+	}
 }
@@ -0,0 +1,142 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/innobead/kubefire/pkg/data"
+	pkgnode "github.com/innobead/kubefire/pkg/node"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net"
+	"strconv"
+)
+
+const apiServerPort = 6443
+
+var (
+	portForwardAddress    string
+	portForwardKubeConfig string
+)
+
+var portForwardCmd = &cobra.Command{
+	Use:   "port-forward [name] [[host port:]node port...]",
+	Short: "Forwards host ports to node ports, or the ports in the node config if no port specified",
+	Args:  validate.MinimumArgs("node name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return validate.CheckNodeExist(cmd.Context(), args[0])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return portForward(cmd.Context(), args[0], args[1:])
+	},
+}
+
+func init() {
+	flags := portForwardCmd.Flags()
+
+	flags.StringVar(&portForwardAddress, "address", "127.0.0.1", "Host address to listen on (ex: 0.0.0.0 for the access from other machines)")
+	flags.StringVar(&portForwardKubeConfig, "kubeconfig", "", "Path to write the kubeconfig against the forwarded API server endpoint (6443) of master node")
+}
+
+func portForward(ctx context.Context, name string, portArgs []string) error {
+	node, err := di.NodeManager().GetNode(ctx, name)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to get node (%s)", name)
+	}
+
+	if !node.Status.Running || node.Status.IPAddresses == "" {
+		return errors.Errorf("node (%s) is not running", name)
+	}
+
+	if len(portArgs) == 0 {
+		portArgs, err = nodeConfigPorts(node)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(portArgs) == 0 {
+		return errors.Errorf("no port specified, or declared by ports in the node config of node (%s)", name)
+	}
+
+	var ports []util.PortForward
+
+	for _, arg := range portArgs {
+		port, err := util.ParsePortForward(arg)
+		if err != nil {
+			return err
+		}
+
+		ports = append(ports, *port)
+	}
+
+	if portForwardKubeConfig != "" {
+		if err := writeForwardedKubeConfig(node, ports); err != nil {
+			return err
+		}
+	}
+
+	return util.ForwardPorts(ctx, portForwardAddress, node.Address(), ports)
+}
+
+func nodeConfigPorts(node *data.Node) ([]string, error) {
+	cluster, err := di.ConfigManager().GetCluster(node.Spec.Cluster.Name)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to get cluster (%s) of node (%s)", node.Spec.Cluster.Name, node.Name)
+	}
+
+	nodeConfig := cluster.NodeConfig(node.Labels[pkgnode.RoleLabel], node.Labels[pkgnode.PoolLabel])
+	if nodeConfig == nil {
+		return nil, nil
+	}
+
+	return nodeConfig.Ports, nil
+}
+
+func writeForwardedKubeConfig(node *data.Node, ports []util.PortForward) error {
+	if !node.IsMaster() {
+		return errors.Errorf("node (%s) is not a master node to forward the API server", node.Name)
+	}
+
+	hostPort := 0
+	for _, p := range ports {
+		if p.NodePort == apiServerPort {
+			hostPort = p.HostPort
+			break
+		}
+	}
+
+	if hostPort == 0 {
+		return errors.Errorf("API server port (%d) is not forwarded", apiServerPort)
+	}
+
+	cluster, err := di.ConfigManager().GetCluster(node.Spec.Cluster.Name)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to get cluster (%s) of node (%s)", node.Spec.Cluster.Name, node.Name)
+	}
+
+	kubeConfig, err := ioutil.ReadFile(cluster.LocalKubeConfig())
+	if err != nil {
+		return errors.WithMessagef(err, "failed to read the kubeconfig of cluster (%s), the cluster may not be deployed yet", cluster.Name)
+	}
+
+	// the unspecified address is not reachable as a destination, so use the loopback address instead
+	host := portForwardAddress
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	server := fmt.Sprintf("https://%s", net.JoinHostPort(host, strconv.Itoa(hostPort)))
+
+	if err := ioutil.WriteFile(portForwardKubeConfig, []byte(util.UpdateKubeConfigServer(string(kubeConfig), server)), 0600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	logrus.Infof("saved the kubeconfig of cluster (%s) against %s to %s", cluster.Name, server, portForwardKubeConfig)
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package node
+
+import (
+	"context"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
+	"github.com/innobead/kubefire/internal/config"
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	pkgcluster "github.com/innobead/kubefire/pkg/cluster"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/data"
+	pkgnode "github.com/innobead/kubefire/pkg/node"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resizeSpec  pkgconfig.Node
+	resizeDrain bool
+)
+
+var resizeCmd = &cobra.Command{
+	Use:   "resize [name]",
+	Short: "Resizes CPUs, memory or disk of node",
+	Args:  validate.OneArg("node name"),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validate.CheckNodeExist(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+
+		if err := validate.CheckNodeResources(&resizeSpec); err != nil {
+			return err
+		}
+
+		if resizeDrain {
+			node, err := di.NodeManager().GetNode(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			cluster, err := di.ConfigManager().GetCluster(node.Labels[pkgnode.ClusterLabel])
+			if err != nil {
+				return err
+			}
+
+			// use the bootstrapper of the cluster to drain and uncordon the node
+			reinitDI := config.Bootstrapper != cluster.Bootstrapper
+			config.Bootstrapper = cluster.Bootstrapper
+			di.DelayInit(reinitDI)
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		return resizeNode(ctx, args[0], &resizeSpec, resizeDrain)
+	},
+}
+
+func init() {
+	flags := resizeCmd.Flags()
+
+	flags.IntVar(&resizeSpec.Cpus, "cpus", 0, "CPUs of node (ex: 0 means unchanged)")
+	flags.StringVar(&resizeSpec.Memory, "memory", "", "Memory of node (ex: 2GB, empty means unchanged)")
+	flags.StringVar(&resizeSpec.DiskSize, "disk", "", "Disk size of node, which can only grow (ex: 20GB, empty means unchanged)")
+	flags.BoolVar(&resizeDrain, "drain", false, "Drain the node before stopping it, and uncordon it after started if the cluster has been deployed")
+}
+
+func resizeNode(ctx context.Context, name string, spec *pkgconfig.Node, drain bool) error {
+	node, err := di.NodeManager().GetNode(ctx, name)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to get node (%s)", name)
+	}
+
+	clusterName := node.Labels[pkgnode.ClusterLabel]
+
+	cluster, err := di.ClusterManager().Get(ctx, clusterName)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to get cluster (%s)", clusterName)
+	}
+
+	opts := pkgcluster.ResizeOptions{}
+
+	if drain && cluster.Spec.Deployed {
+		opts.Rolling = true
+		opts.Drain = func(ctx context.Context, n *data.Node) error {
+			return di.Bootstrapper().DrainNode(ctx, cluster, n)
+		}
+		opts.Uncordon = func(ctx context.Context, n *data.Node) error {
+			return di.Bootstrapper().UncordonNode(ctx, cluster, n)
+		}
+	}
+
+	if err := di.ClusterManager().ResizeNodes(ctx, clusterName, []*data.Node{node}, spec, opts); err != nil {
+		return errors.WithMessagef(err, "failed to resize node (%s)", name)
+	}
+
+	changed, err := di.ClusterManager().CheckAddresses(ctx, clusterName)
+	if err != nil {
+		return errors.WithMessagef(err, "failed to check node addresses of cluster (%s)", clusterName)
+	}
+
+	if _, ok := changed[name]; ok {
+		logrus.WithField("node", name).Warnf("node address changed, run 'kubefire cluster repair %s' to repair the cluster", clusterName)
+	}
+
+	logrus.WithField("node", name).Infoln("resized node")
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package node
 
 import (
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/validate"
 	"github.com/spf13/cobra"
 )
@@ -10,16 +11,19 @@ var restartCmd = &cobra.Command{
 	Short: "Restarts node",
 	Args:  validate.OneArg("node name"),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		return validate.CheckNodeExist(args[0])
+		return validate.CheckNodeExist(cmd.Context(), args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
 		name := args[0]
 
-		if err := stopNode(name); err != nil {
+		if err := stopNode(ctx, name); err != nil {
 			return err
 		}
 
-		if err := startNode(name); err != nil {
+		if err := startNode(ctx, name); err != nil {
 			return err
 		}
 
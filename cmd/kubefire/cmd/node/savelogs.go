@@ -0,0 +1,26 @@
+package node
+
+import (
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	pkgnode "github.com/innobead/kubefire/pkg/node"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// saveLogsCmd is run in the background by the ignite node backend to save the console output of the started node until
+// it is stopped, because ignite only keeps the output while the node is running.
+var saveLogsCmd = &cobra.Command{
+	Use:    "save-logs [name]",
+	Short:  "Saves the serial console output of ignite node until it is stopped",
+	Hidden: true,
+	Args:   validate.OneArg("node name"),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, ok := di.NodeManager().(*pkgnode.IgniteNodeManager)
+		if !ok {
+			return errors.New("saving console logs is only required by ignite node backend")
+		}
+
+		return manager.FollowLogs(cmd.Context(), args[0])
+	},
+}
@@ -4,6 +4,8 @@ import (
 	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/internal/validate"
+	pkgcluster "github.com/innobead/kubefire/pkg/cluster"
+	pkgnode "github.com/innobead/kubefire/pkg/node"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -13,16 +15,22 @@ var showCmd = &cobra.Command{
 	Short: "Shows node info",
 	Args:  validate.OneArg("node name"),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		return validate.CheckNodeExist(args[0])
+		return validate.CheckNodeExist(cmd.Context(), args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
 		name := args[0]
 
-		node, err := di.NodeManager().GetNode(name)
+		node, err := di.NodeManager().GetNode(ctx, name)
 		if err != nil {
 			return errors.WithMessagef(err, "failed to get node (%s) info", name)
 		}
 
+		if err := pkgcluster.UpdateNodeRestarts(di.ConfigManager(), node.Labels[pkgnode.ClusterLabel], node); err != nil {
+			return errors.WithMessagef(err, "failed to get the restarts of node (%s)", name)
+		}
+
 		if err := di.Output().Print(node, nil, ""); err != nil {
 			return errors.WithMessagef(err, "failed to print output of node (%s)", name)
 		}
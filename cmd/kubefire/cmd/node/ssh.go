@@ -11,10 +11,11 @@ var sshCmd = &cobra.Command{
 	Short: "SSH into node",
 	Args:  validate.OneArg("node name"),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		return validate.CheckNodeExist(args[0])
+		return validate.CheckNodeExist(cmd.Context(), args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return di.ClusterManager().GetNodeManager().LoginBySSH(
+			cmd.Context(),
 			args[0],
 			di.ClusterManager().GetConfigManager(),
 		)
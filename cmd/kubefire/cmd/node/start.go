@@ -1,8 +1,11 @@
 package node
 
 import (
+	"context"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/internal/validate"
+	pkgnode "github.com/innobead/kubefire/pkg/node"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -13,24 +16,31 @@ var startCmd = &cobra.Command{
 	Short: "Starts node",
 	Args:  validate.OneArg("node name"),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		return validate.CheckNodeExist(args[0])
+		return validate.CheckNodeExist(cmd.Context(), args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return startNode(args[0])
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		return startNode(ctx, args[0])
 	},
 }
 
-func startNode(name string) error {
-	node, _ := di.NodeManager().GetNode(name)
+func startNode(ctx context.Context, name string) error {
+	node, _ := di.NodeManager().GetNode(ctx, name)
 
 	if node.Status.Running {
 		logrus.WithField("node", node.Name).Infoln("node is already running")
 		return nil
 	}
 
-	if err := di.NodeManager().StartNode(name); err != nil {
+	if err := di.NodeManager().StartNode(ctx, name); err != nil {
 		return errors.WithMessagef(err, "failed to start node (%s)", name)
 	}
 
+	if err := di.ClusterManager().MarkNodesStopped(ctx, node.Labels[pkgnode.ClusterLabel], []string{name}, false); err != nil {
+		return errors.WithMessagef(err, "failed to unmark node (%s) stopped", name)
+	}
+
 	return nil
 }
@@ -1,8 +1,11 @@
 package node
 
 import (
+	"context"
+	intcmd "github.com/innobead/kubefire/internal/cmd"
 	"github.com/innobead/kubefire/internal/di"
 	"github.com/innobead/kubefire/internal/validate"
+	pkgnode "github.com/innobead/kubefire/pkg/node"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -13,22 +16,29 @@ var stopCmd = &cobra.Command{
 	Short: "Stops node",
 	Args:  validate.OneArg("node name"),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
-		return validate.CheckNodeExist(args[0])
+		return validate.CheckNodeExist(cmd.Context(), args[0])
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return stopNode(args[0])
+		ctx, cancel := intcmd.Context(cmd)
+		defer cancel()
+
+		return stopNode(ctx, args[0])
 	},
 }
 
-func stopNode(name string) error {
-	node, _ := di.NodeManager().GetNode(name)
+func stopNode(ctx context.Context, name string) error {
+	node, _ := di.NodeManager().GetNode(ctx, name)
 
 	if !node.Status.Running {
 		logrus.WithField("node", node.Name).Infoln("node is already stopped")
 		return nil
 	}
 
-	if err := di.NodeManager().StopNode(name); err != nil {
+	if err := di.ClusterManager().MarkNodesStopped(ctx, node.Labels[pkgnode.ClusterLabel], []string{name}, true); err != nil {
+		return errors.WithMessagef(err, "failed to mark node (%s) stopped", name)
+	}
+
+	if err := di.NodeManager().StopNode(ctx, name); err != nil {
 		return errors.WithMessagef(err, "failed to stop node (%s)", name)
 	}
 
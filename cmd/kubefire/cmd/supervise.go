@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	pkgcluster "github.com/innobead/kubefire/pkg/cluster"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var (
+	superviseInterval time.Duration
+	superviseRestart  string
+)
+
+var SuperviseCmd = &cobra.Command{
+	Use:   "supervise [cluster name ...]",
+	Short: "Watches nodes and restarts the failed nodes per the restart policy of clusters",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if superviseInterval <= 0 {
+			return errors.Errorf("invalid interval (%s), should be positive", superviseInterval)
+		}
+
+		if err := validate.CheckRestartPolicy(superviseRestart); err != nil {
+			return err
+		}
+
+		for _, name := range args {
+			if err := validate.CheckClusterExist(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		supervisor := pkgcluster.NewSupervisor(di.ClusterManager(), superviseRestart)
+
+		logrus.WithField("interval", superviseInterval).Infoln("supervising nodes, press Ctrl-C to stop")
+
+		return supervisor.Run(cmd.Context(), args, superviseInterval)
+	},
+}
+
+func init() {
+	flags := SuperviseCmd.Flags()
+
+	flags.DurationVar(&superviseInterval, "interval", 10*time.Second, "Interval of checking nodes")
+	flags.StringVar(&superviseRestart, "restart", "", util.FlagsValuesUsage("Restart policy overriding the policies of clusters, empty to use the cluster policies", pkgconfig.RestartPolicies))
+}
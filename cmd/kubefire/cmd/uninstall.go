@@ -20,7 +20,7 @@ var UninstallCmd = &cobra.Command{
 			return err
 		}
 
-		if err := script.Run(script.UninstallPrerequisites, config.TagVersion, createSetupInstallCommandEnvsFunc()); err != nil {
+		if err := script.Run(cmd.Context(), script.UninstallPrerequisites, config.TagVersion, createSetupInstallCommandEnvsFunc()); err != nil {
 			return err
 		}
 
@@ -1,19 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/innobead/kubefire/cmd/kubefire/cmd"
 	"github.com/innobead/kubefire/cmd/kubefire/cmd/cache"
 	"github.com/innobead/kubefire/cmd/kubefire/cmd/cluster"
+	"github.com/innobead/kubefire/cmd/kubefire/cmd/image"
 	"github.com/innobead/kubefire/cmd/kubefire/cmd/kubeconfig"
 	"github.com/innobead/kubefire/cmd/kubefire/cmd/node"
 	"github.com/innobead/kubefire/internal/config"
 	"github.com/innobead/kubefire/internal/di"
+	"github.com/innobead/kubefire/internal/validate"
+	"github.com/innobead/kubefire/pkg/constants"
+	pkgnode "github.com/innobead/kubefire/pkg/node"
 	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
 	"path"
 	"runtime"
+	"syscall"
 )
 
 var rootCmd = &cobra.Command{
@@ -32,6 +41,8 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVarP(&config.LogLevel, "log-level", "l", logrus.InfoLevel.String(), util.FlagsValuesUsage("log level", logrus.AllLevels))
+	rootCmd.PersistentFlags().StringVar(&config.NodeBackend, "node-backend", constants.IGNITE, util.FlagsValuesUsage("node backend to create and manage nodes", pkgnode.BuiltinBackends))
+	rootCmd.PersistentFlags().StringVar(&config.QemuMachine, "qemu-machine", pkgnode.QemuMicroVMMachine, util.FlagsValuesUsage("machine type of qemu node backend", pkgnode.QemuBuiltinMachines))
 	rootCmd.PersistentFlags().StringVarP(&config.GithubToken, "github-token", "t", "", "GIthub Personal Access Token used to query repo release info")
 }
 
@@ -51,6 +62,10 @@ func initConfig() {
 	if level >= logrus.TraceLevel {
 		logrus.SetReportCaller(true)
 	}
+
+	if err := validate.CheckNodeBackend(config.NodeBackend); err != nil {
+		logrus.WithError(err).Fatalf("failed to run kubefire")
+	}
 }
 
 func main() {
@@ -59,7 +74,8 @@ func main() {
 		cmd.InstallCmd,
 		cmd.UninstallCmd,
 		cmd.InfoCmd,
-		cmd.ImageCmd,
+		image.Cmd,
+		cmd.SuperviseCmd,
 		kubeconfig.Cmd,
 		cluster.Cmd,
 		node.Cmd,
@@ -70,7 +86,22 @@ func main() {
 		rootCmd.AddCommand(c)
 	}
 
-	if err := rootCmd.Execute(); err != nil {
+	// the first Ctrl-C cancels the running operations cleanly, and the second one terminates immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		logrus.Warnln("interrupted, cleaning up (press Ctrl-C again to force quit)")
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			err = errors.WithMessagef(err, "timed out after %s", config.Timeout)
+		case errors.Is(err, context.Canceled):
+			err = errors.WithMessage(err, "interrupted")
+		}
+
 		logrus.Tracef("%+v", err)
 		logrus.WithError(err).Fatalf("failed to run kubefire")
 	}
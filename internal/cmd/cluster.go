@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/innobead/kubefire/internal/config"
+	"github.com/innobead/kubefire/internal/di"
+	interr "github.com/innobead/kubefire/internal/error"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// UseClusterNodeBackend switches the node backend to the one creating the cluster, so the nodes of the cluster are
+// always managed by the same node backend. The node backend flag conflicting with the cluster is refused. Nothing is
+// switched for the clusters created by the previous versions, which have no node backend recorded.
+func UseClusterNodeBackend(cmd *cobra.Command, cluster *pkgconfig.Cluster) error {
+	if cluster.NodeBackend == "" || cluster.NodeBackend == config.NodeBackend {
+		return nil
+	}
+
+	if flag := cmd.Flags().Lookup("node-backend"); flag != nil && flag.Changed {
+		return errors.WithMessage(
+			interr.NodeBackendConflictError,
+			fmt.Sprintf("cluster (%s) is created by %s node backend instead of %s", cluster.Name, cluster.NodeBackend, config.NodeBackend),
+		)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"cluster":      cluster.Name,
+		"node-backend": cluster.NodeBackend,
+	}).Debugln("switching to the node backend of cluster")
+
+	config.NodeBackend = cluster.NodeBackend
+	di.DelayInit(true)
+
+	return nil
+}
+
+// NodeCluster returns the cluster owning the node by the cluster label of the node, or nil if no cluster found. The
+// node is looked up on the node backends recorded by the clusters, because the node backend of the command can be
+// different from the one creating the node.
+func NodeCluster(ctx context.Context, name string) (*pkgconfig.Cluster, error) {
+	clusters, err := di.ConfigManager().ListClusters()
+	if err != nil {
+		return nil, err
+	}
+
+	// the node on every node backend, or nil if the node unavailable
+	nodes := map[string]*data.Node{}
+
+	for _, c := range clusters {
+		backend := c.NodeBackend
+		if backend == "" {
+			backend = config.NodeBackend
+		}
+
+		n, ok := nodes[backend]
+		if !ok {
+			n = backendNode(ctx, backend, name)
+			nodes[backend] = n
+		}
+
+		if n != nil && n.Labels[node.ClusterLabel] == c.Name {
+			return c, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func backendNode(ctx context.Context, backend string, name string) *data.Node {
+	manager := di.NodeManager()
+	if backend != config.NodeBackend {
+		manager = node.New(backend)
+	}
+
+	n, err := manager.GetNode(ctx, name)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"node":         name,
+			"node-backend": backend,
+		}).WithError(err).Debugln("node unavailable on node backend")
+
+		return nil
+	}
+
+	return n
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"github.com/innobead/kubefire/internal/config"
 	"github.com/innobead/kubefire/pkg/output"
 	"github.com/innobead/kubefire/pkg/util"
@@ -10,3 +11,21 @@ import (
 func AddOutputFlag(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&config.Output, "output", "o", string(output.DEFAULT), util.FlagsValuesUsage("output format", output.BuiltinTypes))
 }
+
+func AddTimeoutFlag(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&config.Timeout, "timeout", 0, "Timeout of the command (ex: 10m, 1h), 0 for no timeout")
+}
+
+// Context returns the context of the command, which is cancelled when interrupted or the timeout is reached.
+func Context(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if config.Timeout > 0 {
+		return context.WithTimeout(ctx, config.Timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	gocni "github.com/containerd/go-cni"
 	"github.com/innobead/kubefire/internal/config"
+	"github.com/innobead/kubefire/pkg/constants"
 	"github.com/sirupsen/logrus"
 	"os/exec"
 	"reflect"
@@ -12,8 +13,8 @@ import (
 )
 
 const (
-	CniConfigDir = "/etc/cni/net.d"
-	CniBinDir    = "/opt/cni/bin"
+	CniConfigDir = constants.CniConfigDir
+	CniBinDir    = constants.CniBinDir
 )
 
 type PrerequisiteMatcher interface {
@@ -1,12 +1,18 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 var (
 	LogLevel     string
 	Output       string
 	Bootstrapper string
+	NodeBackend  string
+	QemuMachine  string
 	GithubToken  string
+	Timeout      time.Duration
 )
 
 var (
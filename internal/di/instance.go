@@ -42,7 +42,7 @@ func NodeManager() node.Manager {
 	return addObjToContainer(
 		new(node.Manager),
 		func() interface{} {
-			return node.NewIgniteNodeManager()
+			return node.New(config.NodeBackend)
 		},
 	).(node.Manager)
 }
@@ -7,9 +7,27 @@ var (
 	NotFoundError                       = errors.New("not found")
 	NodeNotFoundError                   = errors.New("node not found")
 	ClusterNotFoundError                = errors.New("cluster not found")
+	SnapshotNotFoundError               = errors.New("snapshot not found")
 	ClusterVersionInvalidError          = errors.New("version is invalid. The format should be v<major>.<minor> or v<major>.<minor.<patch>")
 	BootstrapperNotFoundError           = errors.New("bootstrapper not found")
 	BootstrapperNotSupportError         = errors.New("bootstrapper not supported")
+	NodeBackendNotFoundError            = errors.New("node backend not found")
+	NodeBackendConflictError            = errors.New("node backend conflicts with the node backend creating the cluster")
+	NodeSnapshotNotSupportError         = errors.New("node snapshot not supported")
+	NodeExtraDiskNotSupportError        = errors.New("node extra disk not supported")
+	NodeResizeNotSupportError           = errors.New("node resize not supported")
+	ClusterNetworkNotSupportError       = errors.New("cluster network not supported")
+	NodeAddressNotSupportError          = errors.New("persistent node address not supported")
+	ClusterNetworkInvalidError          = errors.New("cluster network is invalid. The subnet should be an IPv4 CIDR not overlapping with other kubefire networks")
+	NodePortInvalidError                = errors.New("node port is invalid. The format should be [<host port>:]<node port>")
+	NodeExtraDiskInvalidError           = errors.New("node extra disk is invalid. The size should be like 10GB, and the count should not be negative")
+	NodePoolInvalidError                = errors.New("node pool is invalid. The name should be a lowercase DNS label other than master and worker")
+	NodeResourceInvalidError            = errors.New("node resource is invalid. At least one of cpus, memory and disk should be specified, the cpus should be positive, and the sizes should be like 2GB")
+	NodeTaintInvalidError               = errors.New("node taint is invalid. The format should be <key>[=<value>]:<NoSchedule|PreferNoSchedule|NoExecute>")
+	HostCapacityInsufficientError       = errors.New("host capacity is insufficient. Check the capacity by 'kubefire cluster plan', or use --ignore-capacity to create anyway")
+	CachePinnedError                    = errors.New("cache is pinned. Unpin the cache by 'kubefire image unpin' first")
+	CacheInUseError                     = errors.New("cache in use by nodes. Delete the nodes using the cache first")
+	RestartPolicyInvalidError           = errors.New("restart policy is invalid. The policy should be always, on-failure or never")
 )
 
 func CheckErrors(errorFuncs ...func() error) error {
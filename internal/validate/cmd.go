@@ -3,6 +3,7 @@ package validate
 import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"strings"
 )
 
 func OneArg(name string) cobra.PositionalArgs {
@@ -24,3 +25,24 @@ func MinimumArgs(name string) cobra.PositionalArgs {
 		return nil
 	}
 }
+
+func ExactArgs(names ...string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := cobra.ExactArgs(len(names))(cmd, args); err != nil {
+			return errors.WithMessagef(err, "missing %s", strings.Join(names, " or "))
+		}
+
+		return nil
+	}
+}
+
+// CommandArgs checks there is one argument before `--`, and the command after `--`.
+func CommandArgs(name string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if cmd.ArgsLenAtDash() != 1 || len(args) < 2 {
+			return errors.Errorf("missing %s, or command after --", name)
+		}
+
+		return nil
+	}
+}
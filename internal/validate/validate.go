@@ -1,17 +1,31 @@
 package validate
 
 import (
+	"context"
 	"fmt"
 	intcmd "github.com/innobead/kubefire/internal/cmd"
+	intconfig "github.com/innobead/kubefire/internal/config"
 	"github.com/innobead/kubefire/internal/di"
 	interr "github.com/innobead/kubefire/internal/error"
 	"github.com/innobead/kubefire/pkg/bootstrap"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
 	"github.com/innobead/kubefire/pkg/constants"
 	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/innobead/kubefire/pkg/util"
 	"github.com/pkg/errors"
+	"github.com/thoas/go-funk"
+	"net"
+	"os"
+	"regexp"
 	"runtime"
 )
 
+var (
+	poolNamePattern = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+	taintPattern    = regexp.MustCompile(`^[^=:\s]+(=[^=:\s]*)?:(NoSchedule|PreferNoSchedule|NoExecute)$`)
+)
+
 func CheckPrerequisites() error {
 	if intcmd.CurrentPrerequisitesInfos().Matched() {
 		return nil
@@ -29,8 +43,16 @@ func CheckClusterExist(name string) error {
 	return nil
 }
 
-func CheckNodeExist(name string) error {
-	if _, err := di.NodeManager().GetNode(name); err != nil {
+func CheckSnapshotExist(clusterName string, name string) error {
+	if _, err := di.ConfigManager().GetSnapshot(clusterName, name); err != nil {
+		return errors.WithMessage(interr.SnapshotNotFoundError, fmt.Sprintf("%s, %s", Field("cluster", clusterName), Field("snapshot", name)))
+	}
+
+	return nil
+}
+
+func CheckNodeExist(ctx context.Context, name string) error {
+	if _, err := di.NodeManager().GetNode(ctx, name); err != nil {
 		return errors.WithMessage(interr.NodeNotFoundError, Field("node", name))
 	}
 
@@ -63,6 +85,174 @@ func CheckBootstrapperType(bootstrapper string) error {
 	return nil
 }
 
+func CheckNodeBackend(backend string) error {
+	if !node.IsValidBackend(backend) {
+		return errors.WithMessage(interr.NodeBackendNotFoundError, Field("node-backend", backend))
+	}
+
+	return nil
+}
+
+func CheckNodeConfigs(cluster *pkgconfig.Cluster) error {
+	pools := map[string]bool{}
+
+	for _, n := range cluster.WorkerPools {
+		if !poolNamePattern.MatchString(n.Name) || n.Name == string(node.Master) || n.Name == string(node.Worker) || pools[n.Name] {
+			return errors.WithMessage(interr.NodePoolInvalidError, Field("pool", n.Name))
+		}
+
+		pools[n.Name] = true
+	}
+
+	for _, n := range cluster.NodeConfigs() {
+		for _, taint := range n.Taints {
+			if !taintPattern.MatchString(taint) {
+				return errors.WithMessage(interr.NodeTaintInvalidError, Field("taint", taint))
+			}
+		}
+
+		for _, port := range n.Ports {
+			if _, err := util.ParsePortForward(port); err != nil {
+				return errors.WithMessage(interr.NodePortInvalidError, Field("port", port))
+			}
+		}
+
+		for _, disk := range n.ExtraDisks {
+			if err := checkExtraDisk(disk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckNodeResources checks the resources of resizing nodes, and the empty resources are unchanged. Growing disks is
+// refused for ignite before any node is stopped, because ignite cannot grow the disks of the existing VMs.
+func CheckNodeResources(spec *pkgconfig.Node) error {
+	if spec.Cpus < 0 || (spec.Cpus == 0 && spec.Memory == "" && spec.DiskSize == "") {
+		return errors.WithMessage(interr.NodeResourceInvalidError, Field("cpus", fmt.Sprint(spec.Cpus)))
+	}
+
+	sizes := []struct {
+		key   string
+		value string
+	}{
+		{"memory", spec.Memory},
+		{"disk", spec.DiskSize},
+	}
+
+	for _, s := range sizes {
+		if s.value == "" {
+			continue
+		}
+
+		if size, err := util.ParseSize(s.value); err != nil || size <= 0 {
+			return errors.WithMessage(interr.NodeResourceInvalidError, Field(s.key, s.value))
+		}
+	}
+
+	if spec.DiskSize != "" && intconfig.NodeBackend == constants.IGNITE {
+		return errors.WithMessagef(interr.NodeResizeNotSupportError, "growing disk is not supported by %s node backend, only --cpus and --memory can be resized", intconfig.NodeBackend)
+	}
+
+	return nil
+}
+
+func CheckRestartPolicy(policy string) error {
+	if policy != "" && !funk.ContainsString(pkgconfig.RestartPolicies, policy) {
+		return errors.WithMessage(interr.RestartPolicyInvalidError, Field("restart", policy))
+	}
+
+	return nil
+}
+
+// CheckClusterNetwork checks the isolated network of the cluster, which should not overlap with the kubefire bridge
+// network and the networks of other clusters.
+func CheckClusterNetwork(cluster *pkgconfig.Cluster) error {
+	if cluster.Network == nil {
+		return nil
+	}
+
+	if intconfig.NodeBackend == constants.IGNITE {
+		return errors.WithMessage(interr.ClusterNetworkNotSupportError, Field("node-backend", intconfig.NodeBackend))
+	}
+
+	_, subnet, err := net.ParseCIDR(cluster.Network.Subnet)
+	if err != nil || subnet.IP.To4() == nil {
+		return errors.WithMessage(interr.ClusterNetworkInvalidError, Field("subnet", cluster.Network.Subnet))
+	}
+
+	if ones, bits := subnet.Mask.Size(); bits-ones < 2 {
+		return errors.WithMessage(interr.ClusterNetworkInvalidError, Field("subnet", cluster.Network.Subnet))
+	}
+
+	defaultSubnet, err := node.DefaultSubnet()
+	if err != nil {
+		return err
+	}
+
+	subnets := map[string]string{"kubefire-cni-bridge": defaultSubnet}
+
+	clusters, err := di.ConfigManager().ListClusters()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range clusters {
+		if c.Name != cluster.Name && c.Network != nil {
+			subnets[node.ClusterNetworkName(c.Name)] = c.Network.Subnet
+		}
+	}
+
+	for name, s := range subnets {
+		_, other, err := net.ParseCIDR(s)
+		if err != nil {
+			continue
+		}
+
+		if other.Contains(subnet.IP) || subnet.Contains(other.IP) {
+			return errors.WithMessage(interr.ClusterNetworkInvalidError, fmt.Sprintf("%s, %s", Field("subnet", cluster.Network.Subnet), Field("overlapped-network", name)))
+		}
+	}
+
+	for _, r := range cluster.Network.Routes {
+		if r == "" || r == cluster.Name {
+			return errors.WithMessage(interr.ClusterNetworkInvalidError, Field("route", r))
+		}
+	}
+
+	return nil
+}
+
+// CheckClusterAddresses checks the persistent node addresses in the cluster config, which are not supported by ignite,
+// because ignite allocates the node addresses by itself.
+func CheckClusterAddresses(cluster *pkgconfig.Cluster) error {
+	if len(cluster.Addresses) > 0 && intconfig.NodeBackend == constants.IGNITE {
+		return errors.WithMessage(interr.NodeAddressNotSupportError, Field("node-backend", intconfig.NodeBackend))
+	}
+
+	return nil
+}
+
+func checkExtraDisk(disk pkgconfig.ExtraDisk) error {
+	if intconfig.NodeBackend == constants.IGNITE {
+		return errors.WithMessage(interr.NodeExtraDiskNotSupportError, Field("node-backend", intconfig.NodeBackend))
+	}
+
+	if _, err := util.ParseSize(disk.Size); err != nil || disk.Count < 0 {
+		return errors.WithMessage(interr.NodeExtraDiskInvalidError, fmt.Sprintf("%s, %s", Field("size", disk.Size), Field("count", fmt.Sprint(disk.Count))))
+	}
+
+	if disk.BackingFile != "" {
+		if _, err := os.Stat(disk.BackingFile); err != nil {
+			return errors.WithMessage(interr.NodeExtraDiskInvalidError, Field("backing_file", disk.BackingFile))
+		}
+	}
+
+	return nil
+}
+
 func Field(key, value string) string {
 	return fmt.Sprintf("%s=%s", key, value)
 }
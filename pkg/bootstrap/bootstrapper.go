@@ -1,6 +1,8 @@
 package bootstrap
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/avast/retry-go"
 	"github.com/goccy/go-yaml"
@@ -15,9 +17,11 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/thoas/go-funk"
+	"golang.org/x/crypto/ssh"
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -32,10 +36,18 @@ var BuiltinTypes = []string{
 	constants.K0s,
 }
 
+// nodesRunningTimeout is the timeout of waiting for the cluster nodes running before bootstrapping.
+const nodesRunningTimeout = 5 * time.Minute
+
 type Bootstrapper interface {
-	Deploy(cluster *data.Cluster, before func() error) error
-	DownloadKubeConfig(cluster *data.Cluster, destDir string) (string, error)
-	Prepare(cluster *data.Cluster, force bool) error
+	Deploy(ctx context.Context, cluster *data.Cluster, before func() error) error
+	JoinNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error
+	RemoveNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error
+	DrainNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error
+	UncordonNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error
+	Rekey(ctx context.Context, cluster *data.Cluster, origins map[string]*data.Node) error
+	DownloadKubeConfig(ctx context.Context, cluster *data.Cluster, destDir string) (string, error)
+	Prepare(ctx context.Context, cluster *data.Cluster, force bool) error
 	Type() string
 }
 
@@ -191,19 +203,19 @@ func GenerateSaveBootstrapperVersions(bootstrapperType string, configManager pkg
 	return
 }
 
-func downloadKubeConfig(nodeManager node.Manager, cluster *data.Cluster, remoteKubeConfigPath string, destDir string) (string, error) {
+func downloadKubeConfig(ctx context.Context, nodeManager node.Manager, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, remoteKubeConfigPath string, destDir string) (string, error) {
 	logrus.Infof("downloading the kubeconfig of cluster (%s)", cluster.Name)
 
-	firstMaster, err := nodeManager.GetNode(node.Name(cluster.Name, node.Master, 1))
+	firstMaster, err := nodeManager.GetNode(ctx, node.Name(cluster.Name, node.Master, 1))
 	if err != nil {
 		return "", err
 	}
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := sshClientFactory(ctx,
 		firstMaster.Name,
 		cluster.Spec.Prikey,
 		"root",
-		firstMaster.Status.IPAddresses,
+		firstMaster.Address(),
 		nil,
 	)
 	if err != nil {
@@ -238,7 +250,7 @@ func downloadKubeConfig(nodeManager node.Manager, cluster *data.Cluster, remoteK
 			result := strings.Replace(
 				string(rawBytes),
 				fmt.Sprintf("https://%s:", ipaddr),
-				fmt.Sprintf("https://%s:", firstMaster.Status.IPAddresses),
+				fmt.Sprintf("https://%s:", firstMaster.Address()),
 				1,
 			)
 
@@ -286,7 +298,7 @@ func getSupportedBootstrapperVersion(versionFinder versionfinder.Finder, configM
 	)
 }
 
-func initNodes(cluster *data.Cluster, cmds []string) error {
+func initNodes(ctx context.Context, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, cmds []string) error {
 	logrus.WithField("cluster", cluster.Name).Infoln("initializing cluster nodes")
 
 	wgInitNodes := sync.WaitGroup{}
@@ -301,11 +313,11 @@ func initNodes(cluster *data.Cluster, cmds []string) error {
 			defer wgInitNodes.Done()
 
 			_ = retry.Do(func() error {
-				sshClient, err := utilssh.NewClient(
+				sshClient, err := sshClientFactory(ctx,
 					n.Name,
 					cluster.Spec.Prikey,
 					"root",
-					n.Status.IPAddresses,
+					n.Address(),
 					nil,
 				)
 				if err != nil {
@@ -320,6 +332,7 @@ func initNodes(cluster *data.Cluster, cmds []string) error {
 
 				return nil
 			},
+				retry.Context(ctx),
 				retry.Delay(10*time.Second),
 				retry.MaxDelay(1*time.Minute),
 			)
@@ -331,6 +344,10 @@ func initNodes(cluster *data.Cluster, cmds []string) error {
 	wgInitNodes.Wait()
 	close(chErr)
 
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
 	var err error
 	for {
 		e, ok := <-chErr
@@ -346,6 +363,243 @@ func initNodes(cluster *data.Cluster, cmds []string) error {
 	return err
 }
 
+// clusterWithNodes returns a copy of the cluster only having the specified nodes, which is used to initialize the nodes
+// added to a deployed cluster without touching the existing ones.
+func clusterWithNodes(cluster *data.Cluster, nodes []*data.Node) *data.Cluster {
+	c := *cluster
+	c.Nodes = nodes
+
+	return &c
+}
+
+func getFirstMaster(ctx context.Context, nodeManager node.Manager, cluster *data.Cluster) (*data.Node, error) {
+	firstMaster, err := nodeManager.GetNode(ctx, node.Name(cluster.Name, node.Master, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	firstMaster.Spec.Cluster = &cluster.Spec
+
+	return firstMaster, nil
+}
+
+// runNodeCommand runs the command on the node, and returns the output without the trailing newline.
+func runNodeCommand(ctx context.Context, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, n *data.Node, cmd string) (string, error) {
+	sshClient, err := sshClientFactory(ctx,
+		n.Name,
+		cluster.Spec.Prikey,
+		"root",
+		n.Address(),
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer sshClient.Close()
+
+	outputBuf := bytes.Buffer{}
+
+	before := func(session *ssh.Session) bool {
+		session.Stdout = &outputBuf
+		return true
+	}
+
+	if err := sshClient.Run(before, nil, cmd); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return strings.TrimSuffix(outputBuf.String(), "\n"), nil
+}
+
+// removeNodes drains and deletes the nodes from the cluster by running kubectl on the first master node.
+func removeNodes(ctx context.Context, nodeManager node.Manager, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, kubectl string, nodes []*data.Node) error {
+	firstMaster, err := getFirstMaster(ctx, nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	sshClient, err := sshClientFactory(ctx,
+		firstMaster.Name,
+		cluster.Spec.Prikey,
+		"root",
+		firstMaster.Address(),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+
+	for _, n := range nodes {
+		if n.Name == firstMaster.Name {
+			return errors.Errorf("the first master node (%s) is not removable", n.Name)
+		}
+
+		logrus.WithField("node", n.Name).Infoln("draining node")
+
+		// the node may be not ready or not joined at all, so still delete it even if draining failed
+		drainCmd := fmt.Sprintf("%s drain %s --ignore-daemonsets --delete-emptydir-data --force --timeout=5m", kubectl, n.Name)
+		if err := sshClient.Run(nil, nil, drainCmd); err != nil {
+			logrus.WithField("node", n.Name).WithError(err).Warnln("failed to drain node")
+		}
+
+		logrus.WithField("node", n.Name).Infoln("deleting node from cluster")
+
+		if err := sshClient.Run(nil, nil, fmt.Sprintf("%s delete node %s --ignore-not-found", kubectl, n.Name)); err != nil {
+			return errors.WithMessagef(err, "failed to delete node (%s) from cluster", n.Name)
+		}
+	}
+
+	return nil
+}
+
+// drainNode cordons the node and evicts its pods by running kubectl on the first master node, before the node is stopped
+// for maintenance.
+func drainNode(ctx context.Context, nodeManager node.Manager, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, kubectl string, n *data.Node) error {
+	firstMaster, err := getFirstMaster(ctx, nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("node", n.Name).Infoln("draining node")
+
+	drainCmd := fmt.Sprintf("%s drain %s --ignore-daemonsets --delete-emptydir-data --force --timeout=5m", kubectl, n.Name)
+	if _, err := runNodeCommand(ctx, sshClientFactory, cluster, firstMaster, drainCmd); err != nil {
+		return errors.WithMessagef(err, "failed to drain node (%s)", n.Name)
+	}
+
+	return nil
+}
+
+// uncordonNode waits for the node ready after it is started again, then makes it schedulable. The API server is waited
+// first, because the node may be the master node.
+func uncordonNode(ctx context.Context, nodeManager node.Manager, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, kubectl string, n *data.Node) error {
+	firstMaster, err := getFirstMaster(ctx, nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	if err := waitAPIServer(ctx, sshClientFactory, cluster, firstMaster, kubectl); err != nil {
+		return err
+	}
+
+	logrus.WithField("node", n.Name).Infoln("uncordoning node")
+
+	cmds := []string{
+		fmt.Sprintf("%s wait --for=condition=Ready node/%s --timeout=5m", kubectl, n.Name),
+		fmt.Sprintf("%s uncordon %s", kubectl, n.Name),
+	}
+
+	for _, cmd := range cmds {
+		if _, err := runNodeCommand(ctx, sshClientFactory, cluster, firstMaster, cmd); err != nil {
+			return errors.WithMessagef(err, "failed to uncordon node (%s)", n.Name)
+		}
+	}
+
+	return nil
+}
+
+// nativeNodeLabelsTaints returns the labels and taints of the node config, which are registered by the node agent itself
+// via the bootstrapper options. The labels in kubernetes.io and k8s.io namespaces are excluded, because the kubelet is
+// not allowed to set them by the NodeRestriction admission plugin, so they are only applied by applyNodeLabelsTaints.
+func nativeNodeLabelsTaints(n *data.Node) (labels []string, taints []string) {
+	if n.Spec.Cluster == nil {
+		return nil, nil
+	}
+
+	nodeConfig := n.Spec.Cluster.NodeConfig(n.Labels[node.RoleLabel], n.Labels[node.PoolLabel])
+	if nodeConfig == nil {
+		return nil, nil
+	}
+
+	for k, v := range nodeConfig.Labels {
+		if i := strings.Index(k, "/"); i > 0 {
+			prefix := k[:i]
+
+			if strings.HasSuffix(prefix, "kubernetes.io") || strings.HasSuffix(prefix, "k8s.io") {
+				continue
+			}
+		}
+
+		labels = append(labels, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(labels)
+
+	return labels, nodeConfig.Taints
+}
+
+// applyNodeLabelsTaints applies the Kubernetes labels and taints declared in the node configs to the nodes by running
+// kubectl on the first master node. It is required for the bootstrappers or labels not supported natively, and the
+// ones already registered natively are overwritten with the same values.
+func applyNodeLabelsTaints(ctx context.Context, nodeManager node.Manager, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, kubectl string, nodes []*data.Node) error {
+	nodeCmds := map[string][]string{}
+
+	for _, n := range nodes {
+		nodeConfig := cluster.Spec.NodeConfig(n.Labels[node.RoleLabel], n.Labels[node.PoolLabel])
+		if nodeConfig == nil {
+			continue
+		}
+
+		if len(nodeConfig.Labels) > 0 {
+			var labels []string
+			for k, v := range nodeConfig.Labels {
+				labels = append(labels, fmt.Sprintf("%s=%s", k, v))
+			}
+			sort.Strings(labels)
+
+			nodeCmds[n.Name] = append(nodeCmds[n.Name], fmt.Sprintf("%s label node %s %s --overwrite", kubectl, n.Name, strings.Join(labels, " ")))
+		}
+
+		if len(nodeConfig.Taints) > 0 {
+			nodeCmds[n.Name] = append(nodeCmds[n.Name], fmt.Sprintf("%s taint node %s %s --overwrite", kubectl, n.Name, strings.Join(nodeConfig.Taints, " ")))
+		}
+	}
+
+	if len(nodeCmds) == 0 {
+		return nil
+	}
+
+	firstMaster, err := getFirstMaster(ctx, nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	sshClient, err := sshClientFactory(ctx,
+		firstMaster.Name,
+		cluster.Spec.Prikey,
+		"root",
+		firstMaster.Address(),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+
+	for _, n := range nodes {
+		cmds, ok := nodeCmds[n.Name]
+		if !ok {
+			continue
+		}
+
+		logrus.WithField("node", n.Name).Infoln("applying node labels and taints")
+
+		// the node may be not registered yet right after joining
+		err := retry.Do(func() error {
+			return sshClient.Run(nil, nil, cmds...)
+		},
+			retry.Context(ctx),
+			retry.Delay(10*time.Second),
+			retry.MaxDelay(1*time.Minute),
+		)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to apply labels and taints to node (%s)", n.Name)
+		}
+	}
+
+	return nil
+}
+
 func mergeClusterConfig(clusterConfigPath string, userClusterConfigFile string, ignoredKeys []string) error {
 	if userClusterConfigFile == "" {
 		return nil
@@ -0,0 +1,528 @@
+package bootstrap
+
+import (
+	"context"
+	interr "github.com/innobead/kubefire/internal/error"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	utilssh "github.com/innobead/kubefire/pkg/util/ssh"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+type fakeVersionFinder struct {
+	version string
+}
+
+func (f *fakeVersionFinder) GetVersionsAfterVersion(afterVersion data.Version) ([]*data.Version, error) {
+	return []*data.Version{data.ParseVersion(f.version)}, nil
+}
+
+func (f *fakeVersionFinder) GetLatestVersion() (*data.Version, error) {
+	return data.ParseVersion(f.version), nil
+}
+
+type fakeConfigManager struct {
+	pkgconfig.Manager
+	versions []pkgconfig.BootstrapperVersioner
+}
+
+func (f *fakeConfigManager) GetBootstrapperVersions(latestVersion pkgconfig.BootstrapperVersioner) ([]pkgconfig.BootstrapperVersioner, error) {
+	return f.versions, nil
+}
+
+type sshClientFactorySetter interface {
+	SetNodeManager(nodeManager node.Manager)
+	SetSSHClientFactory(factory utilssh.ClientFactory)
+}
+
+func newFakeCluster(t *testing.T, bootstrapper string, masterCount int, workerCount int) (*data.Cluster, *node.FakeNodeManager) {
+	rootDir := pkgconfig.ClusterRootDir
+	pkgconfig.ClusterRootDir = t.TempDir()
+	t.Cleanup(func() {
+		pkgconfig.ClusterRootDir = rootDir
+	})
+
+	spec := pkgconfig.NewDefaultCluster()
+	spec.Name = "demo"
+	spec.Bootstrapper = bootstrapper
+	spec.Version = "v1.20.0"
+	spec.Prikey = "/tmp/key"
+	spec.Master.Count = masterCount
+	spec.Worker.Count = workerCount
+
+	assert.NoError(t, os.MkdirAll(spec.LocalClusterDir(), 0755))
+
+	nodeManager := node.NewFakeNodeManager()
+	assert.NoError(t, nodeManager.CreateNodes(context.Background(), node.Master, &spec.Master, true))
+	assert.NoError(t, nodeManager.CreateNodes(context.Background(), node.Worker, &spec.Worker, true))
+
+	// the node can have several addresses, and only the first one is used to reach the node
+	firstMaster, err := nodeManager.GetNode(context.Background(), node.Name(spec.Name, node.Master, 1))
+	assert.NoError(t, err)
+	assert.NoError(t, nodeManager.SetAddress(firstMaster.Name, firstMaster.Status.IPAddresses+",fd00::1"))
+
+	nodes, err := nodeManager.ListNodes(context.Background(), spec.Name)
+	assert.NoError(t, err)
+
+	return &data.Cluster{Name: spec.Name, Spec: *spec, Nodes: nodes}, nodeManager
+}
+
+func findCmd(cmds []string, substr string) string {
+	for _, c := range cmds {
+		if strings.Contains(c, substr) {
+			return c
+		}
+	}
+
+	return ""
+}
+
+func TestBootstrapper_Deploy(t *testing.T) {
+	tests := []struct {
+		name    string
+		new     func() Bootstrapper
+		outputs map[string]string
+		verify  func(t *testing.T, cluster *data.Cluster, clients *utilssh.FakeClients)
+	}{
+		{
+			name: "kubeadm",
+			new: func() Bootstrapper {
+				b := NewKubeadmBootstrapper()
+				b.SetVersionFinder(&fakeVersionFinder{version: "v1.20.0"})
+				b.SetConfigManager(&fakeConfigManager{
+					versions: []pkgconfig.BootstrapperVersioner{pkgconfig.NewKubeadmBootstrapperVersion("v1.20.0", "v1.20.0", "v0.4.0")},
+				})
+				return b
+			},
+			outputs: map[string]string{
+				"kubeadm token create": "kubeadm join 10.62.0.2:6443 --token abc\n",
+			},
+			verify: func(t *testing.T, cluster *data.Cluster, clients *utilssh.FakeClients) {
+				for _, n := range cluster.Nodes {
+					assert.NotEmpty(t, findCmd(clients.Commands(n.Name), "kubeadm init phase preflight"), n.Name)
+				}
+
+				assert.NotEmpty(t, findCmd(clients.Commands("demo-master-1"), `kubeadm init -v 5 --node-name="demo-master-1"`))
+				assert.Empty(t, findCmd(clients.Commands("demo-master-1"), "kubeadm join"))
+				assert.Equal(
+					t,
+					`kubeadm join 10.62.0.2:6443 --token abc -v 5 --node-name="demo-worker-1"`,
+					findCmd(clients.Commands("demo-worker-1"), "kubeadm join"),
+				)
+			},
+		},
+		{
+			name: "k3s",
+			new: func() Bootstrapper {
+				return NewK3sBootstrapper()
+			},
+			outputs: map[string]string{
+				"node-token": "K10token\n",
+			},
+			verify: func(t *testing.T, cluster *data.Cluster, clients *utilssh.FakeClients) {
+				assert.Contains(t, findCmd(clients.Commands("demo-master-1"), "k3s-install.sh"), "--cluster-init")
+
+				masterJoin := findCmd(clients.Commands("demo-master-2"), "k3s-install.sh")
+				assert.Contains(t, masterJoin, "--server")
+				assert.Contains(t, masterJoin, "K3S_TOKEN=K10token")
+
+				workerJoin := findCmd(clients.Commands("demo-worker-1"), "k3s-install.sh")
+				assert.NotContains(t, workerJoin, "--server")
+				assert.Contains(t, workerJoin, "K3S_URL=https://"+cluster.Nodes[0].Address()+":6443")
+			},
+		},
+		{
+			name: "rke2",
+			new: func() Bootstrapper {
+				return NewRKE2Bootstrapper()
+			},
+			verify: func(t *testing.T, cluster *data.Cluster, clients *utilssh.FakeClients) {
+				assert.NotEmpty(t, findCmd(clients.Commands("demo-master-1"), "systemctl start rke2-server.service"))
+				assert.NotEmpty(t, findCmd(clients.Commands("demo-master-2"), "systemctl start rke2-server.service"))
+				assert.NotEmpty(t, findCmd(clients.Commands("demo-worker-1"), "systemctl start rke2-agent.service"))
+				assert.Contains(
+					t,
+					findCmd(clients.Commands("demo-worker-1"), "create_config"),
+					"server: https://"+cluster.Nodes[0].Address()+":9345",
+				)
+			},
+		},
+		{
+			name: "k0s",
+			new: func() Bootstrapper {
+				return NewK0sBootstrapper()
+			},
+			outputs: map[string]string{
+				"--role=controller": "controller-token\n",
+				"--role=worker":     "worker-token\n",
+			},
+			verify: func(t *testing.T, cluster *data.Cluster, clients *utilssh.FakeClients) {
+				assert.NotEmpty(t, findCmd(clients.Commands("demo-master-1"), "create_controller"))
+				assert.NotEmpty(t, findCmd(clients.Commands("demo-master-2"), `echo "controller-token" > /etc/k0s/join-token`))
+				assert.NotEmpty(t, findCmd(clients.Commands("demo-worker-1"), `echo "worker-token" > /etc/k0s/join-token`))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, nodeManager := newFakeCluster(t, tt.name, 2, 1)
+
+			clients := utilssh.NewFakeClients()
+			for k, v := range tt.outputs {
+				clients.Outputs[k] = v
+			}
+
+			bootstrapper := tt.new()
+			bootstrapper.(sshClientFactorySetter).SetNodeManager(nodeManager)
+			bootstrapper.(sshClientFactorySetter).SetSSHClientFactory(clients.Factory())
+
+			assert.NoError(t, bootstrapper.Deploy(context.Background(), cluster, nil))
+			assert.ElementsMatch(t, []string{"demo-master-1", "demo-master-2", "demo-worker-1"}, clients.Nodes())
+
+			tt.verify(t, cluster, clients)
+		})
+	}
+}
+
+func TestBootstrapper_DownloadKubeConfig(t *testing.T) {
+	cluster, nodeManager := newFakeCluster(t, "k3s", 1, 0)
+
+	clients := utilssh.NewFakeClients()
+	clients.Files["/etc/rancher/k3s/k3s.yaml"] = "server: https://127.0.0.1:6443\n"
+
+	bootstrapper := NewK3sBootstrapper()
+	bootstrapper.SetNodeManager(nodeManager)
+	bootstrapper.SetSSHClientFactory(clients.Factory())
+
+	kubeconfig, err := bootstrapper.DownloadKubeConfig(context.Background(), cluster, t.TempDir())
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(kubeconfig)
+	assert.NoError(t, err)
+	assert.Equal(t, "server: https://"+cluster.Nodes[0].Address()+":6443\n", string(content))
+}
+
+func TestBootstrapper_JoinNodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		new     func() Bootstrapper
+		outputs map[string]string
+		verify  func(t *testing.T, cluster *data.Cluster, clients *utilssh.FakeClients)
+	}{
+		{
+			name: "kubeadm",
+			new: func() Bootstrapper {
+				b := NewKubeadmBootstrapper()
+				b.SetVersionFinder(&fakeVersionFinder{version: "v1.20.0"})
+				b.SetConfigManager(&fakeConfigManager{
+					versions: []pkgconfig.BootstrapperVersioner{pkgconfig.NewKubeadmBootstrapperVersion("v1.20.0", "v1.20.0", "v0.4.0")},
+				})
+				return b
+			},
+			outputs: map[string]string{
+				"kubeadm token create": "kubeadm join 10.62.0.2:6443 --token new\n",
+			},
+			verify: func(t *testing.T, cluster *data.Cluster, clients *utilssh.FakeClients) {
+				assert.Equal(t, []string{"kubeadm token create --print-join-command"}, clients.Commands("demo-master-1"))
+				assert.Equal(
+					t,
+					`kubeadm join 10.62.0.2:6443 --token new -v 5 --node-name="demo-worker-2"`,
+					findCmd(clients.Commands("demo-worker-2"), "kubeadm join"),
+				)
+			},
+		},
+		{
+			name: "k3s",
+			new: func() Bootstrapper {
+				return NewK3sBootstrapper()
+			},
+			outputs: map[string]string{
+				"node-token": "K10token\n",
+			},
+			verify: func(t *testing.T, cluster *data.Cluster, clients *utilssh.FakeClients) {
+				assert.Equal(t, []string{"cat /var/lib/rancher/k3s/server/node-token"}, clients.Commands("demo-master-1"))
+				assert.Contains(t, findCmd(clients.Commands("demo-worker-2"), "k3s-install.sh"), "K3S_TOKEN=K10token")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, nodeManager := newFakeCluster(t, tt.name, 1, 1)
+
+			cluster.Spec.Worker.Count = 2
+			assert.NoError(t, nodeManager.CreateNodesWithIndices(context.Background(), node.Worker, &cluster.Spec.Worker, []int{2}, true))
+
+			newNode, err := nodeManager.GetNode(context.Background(), "demo-worker-2")
+			assert.NoError(t, err)
+
+			clients := utilssh.NewFakeClients()
+			for k, v := range tt.outputs {
+				clients.Outputs[k] = v
+			}
+
+			bootstrapper := tt.new()
+			bootstrapper.(sshClientFactorySetter).SetNodeManager(nodeManager)
+			bootstrapper.(sshClientFactorySetter).SetSSHClientFactory(clients.Factory())
+
+			assert.NoError(t, bootstrapper.JoinNodes(context.Background(), cluster, []*data.Node{newNode}))
+			assert.ElementsMatch(t, []string{"demo-master-1", "demo-worker-2"}, clients.Nodes())
+
+			tt.verify(t, cluster, clients)
+		})
+	}
+}
+
+func TestKubeadmBootstrapper_JoinMasterNodes(t *testing.T) {
+	cluster, nodeManager := newFakeCluster(t, "kubeadm", 2, 0)
+
+	clients := utilssh.NewFakeClients()
+
+	bootstrapper := NewKubeadmBootstrapper()
+	bootstrapper.SetNodeManager(nodeManager)
+	bootstrapper.SetSSHClientFactory(clients.Factory())
+
+	err := bootstrapper.JoinNodes(context.Background(), cluster, cluster.Nodes[1:])
+	assert.True(t, errors.Is(err, interr.BootstrapperNotSupportError))
+	assert.Empty(t, clients.Nodes())
+}
+
+func TestBootstrapper_RemoveNodes(t *testing.T) {
+	cluster, nodeManager := newFakeCluster(t, "k3s", 2, 1)
+
+	clients := utilssh.NewFakeClients()
+
+	bootstrapper := NewK3sBootstrapper()
+	bootstrapper.SetNodeManager(nodeManager)
+	bootstrapper.SetSSHClientFactory(clients.Factory())
+
+	assert.NoError(t, bootstrapper.RemoveNodes(context.Background(), cluster, cluster.Nodes[1:]))
+	assert.Equal(t, []string{"demo-master-1"}, clients.Nodes())
+	assert.Equal(
+		t,
+		[]string{
+			"k3s kubectl drain demo-master-2 --ignore-daemonsets --delete-emptydir-data --force --timeout=5m",
+			"k3s kubectl delete node demo-master-2 --ignore-not-found",
+			"k3s kubectl drain demo-worker-1 --ignore-daemonsets --delete-emptydir-data --force --timeout=5m",
+			"k3s kubectl delete node demo-worker-1 --ignore-not-found",
+		},
+		clients.Commands(""),
+	)
+
+	assert.Error(t, bootstrapper.RemoveNodes(context.Background(), cluster, cluster.Nodes[:1]))
+}
+
+func TestBootstrapper_DrainUncordonNode(t *testing.T) {
+	cluster, nodeManager := newFakeCluster(t, "k3s", 1, 1)
+
+	clients := utilssh.NewFakeClients()
+
+	bootstrapper := NewK3sBootstrapper()
+	bootstrapper.SetNodeManager(nodeManager)
+	bootstrapper.SetSSHClientFactory(clients.Factory())
+
+	assert.NoError(t, bootstrapper.DrainNode(context.Background(), cluster, cluster.Nodes[1]))
+	assert.NoError(t, bootstrapper.UncordonNode(context.Background(), cluster, cluster.Nodes[1]))
+	assert.Equal(t, []string{"demo-master-1"}, clients.Nodes())
+	assert.Equal(
+		t,
+		[]string{
+			"k3s kubectl drain demo-worker-1 --ignore-daemonsets --delete-emptydir-data --force --timeout=5m",
+			"k3s kubectl get --raw=/readyz",
+			"k3s kubectl wait --for=condition=Ready node/demo-worker-1 --timeout=5m",
+			"k3s kubectl uncordon demo-worker-1",
+		},
+		clients.Commands(""),
+	)
+}
+
+func TestBootstrapper_Rekey(t *testing.T) {
+	tests := []struct {
+		name    string
+		new     func() Bootstrapper
+		outputs map[string]string
+		verify  func(t *testing.T, clients *utilssh.FakeClients)
+	}{
+		{
+			name: "kubeadm",
+			new: func() Bootstrapper {
+				return NewKubeadmBootstrapper()
+			},
+			outputs: map[string]string{
+				"kubeadm token create": "kubeadm join 10.62.0.2:6443 --token new\n",
+			},
+			verify: func(t *testing.T, clients *utilssh.FakeClients) {
+				masterCmds := clients.Commands("demo-master-1")
+				assert.Equal(t, "systemctl stop kubelet", masterCmds[0])
+				assert.Contains(t, masterCmds, `kubeadm init phase kubeconfig kubelet --node-name="demo-master-1"`)
+				assert.Contains(t, masterCmds, "KUBECONFIG=/etc/kubernetes/admin.conf kubectl delete node src-master-1 src-worker-1 --ignore-not-found")
+
+				workerCmds := clients.Commands("demo-worker-1")
+				assert.Contains(t, workerCmds, "kubeadm reset -f")
+				assert.Equal(t, `kubeadm join 10.62.0.2:6443 --token new -v 5 --node-name="demo-worker-1"`, workerCmds[len(workerCmds)-1])
+			},
+		},
+		{
+			name: "k3s",
+			new: func() Bootstrapper {
+				return NewK3sBootstrapper()
+			},
+			verify: func(t *testing.T, clients *utilssh.FakeClients) {
+				masterCmds := clients.Commands("demo-master-1")
+				assert.Equal(t, "systemctl stop k3s", masterCmds[0])
+				assert.Contains(t, masterCmds, "if [ -d /var/lib/rancher/k3s/server/db/etcd ]; then k3s server --cluster-reset; fi")
+				assert.Contains(t, masterCmds, "k3s kubectl delete node src-master-1 src-worker-1 --ignore-not-found")
+
+				workerCmds := clients.Commands("demo-worker-1")
+				assert.Equal(t, "systemctl stop k3s-agent", workerCmds[0])
+				assert.Equal(t, "systemctl start k3s-agent", workerCmds[len(workerCmds)-1])
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, nodeManager := newFakeCluster(t, tt.name, 1, 1)
+			cluster.Spec.Deployed = true
+
+			// the cloned nodes get the addresses of each other's original node
+			origins := map[string]*data.Node{
+				"demo-master-1": {Name: "src-master-1", Status: data.NodeStatus{IPAddresses: "10.62.0.3"}},
+				"demo-worker-1": {Name: "src-worker-1", Status: data.NodeStatus{IPAddresses: "10.62.0.2"}},
+			}
+
+			clients := utilssh.NewFakeClients()
+			for k, v := range tt.outputs {
+				clients.Outputs[k] = v
+			}
+
+			bootstrapper := tt.new()
+			bootstrapper.(sshClientFactorySetter).SetNodeManager(nodeManager)
+			bootstrapper.(sshClientFactorySetter).SetSSHClientFactory(clients.Factory())
+
+			assert.NoError(t, bootstrapper.Rekey(context.Background(), cluster, origins))
+			assert.Contains(t, clients.Commands("demo-worker-1"), "hostname demo-worker-1")
+
+			tt.verify(t, clients)
+		})
+	}
+}
+
+func TestRekeyScript(t *testing.T) {
+	cluster, _ := newFakeCluster(t, "k3s", 1, 0)
+
+	script, err := rekeyScript(cluster, map[string]*data.Node{
+		"demo-master-1": {Name: "src-master-1", Status: data.NodeStatus{IPAddresses: "10.62.0.12"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		`s/\bsrc-master-1\b/@KUBEFIRE_REKEY_0@/g;s/\b10\.62\.0\.12\b/@KUBEFIRE_REKEY_1@/g;s/@KUBEFIRE_REKEY_0@/demo-master-1/g;s/@KUBEFIRE_REKEY_1@/10.62.0.2/g`,
+		script,
+	)
+
+	_, err = rekeyScript(cluster, map[string]*data.Node{})
+	assert.Error(t, err)
+}
+
+func TestBootstrapper_ApplyNodeLabelsTaints(t *testing.T) {
+	cluster, nodeManager := newFakeCluster(t, "k3s", 1, 1)
+
+	cluster.Spec.WorkerPools = []pkgconfig.Node{
+		{
+			Name:   "gpu",
+			Count:  1,
+			Labels: map[string]string{"accelerator": "gpu", "zone": "a"},
+			Taints: []string{"gpu=true:NoSchedule"},
+		},
+	}
+	cluster.Spec.UpdateNodeReferences()
+	assert.NoError(t, nodeManager.CreateNodes(context.Background(), node.Worker, &cluster.Spec.WorkerPools[0], true))
+
+	nodes, err := nodeManager.ListNodes(context.Background(), cluster.Name)
+	assert.NoError(t, err)
+
+	clients := utilssh.NewFakeClients()
+
+	assert.NoError(t, applyNodeLabelsTaints(context.Background(), nodeManager, clients.Factory(), cluster, k3sKubectl, nodes))
+	assert.Equal(
+		t,
+		[]string{
+			"k3s kubectl label node demo-worker-gpu-1 accelerator=gpu zone=a --overwrite",
+			"k3s kubectl taint node demo-worker-gpu-1 gpu=true:NoSchedule --overwrite",
+		},
+		clients.Commands("demo-master-1"),
+	)
+}
+
+func TestBootstrapper_DeployNodeLabelsTaints(t *testing.T) {
+	cluster, nodeManager := newFakeCluster(t, "k3s", 1, 1)
+
+	cluster.Spec.Worker.Labels = map[string]string{
+		"tier":                           "web",
+		"node-role.kubernetes.io/worker": "true",
+	}
+	cluster.Spec.Worker.Taints = []string{"dedicated=web:NoSchedule"}
+
+	clients := utilssh.NewFakeClients()
+	clients.Outputs["node-token"] = "K10token\n"
+
+	bootstrapper := NewK3sBootstrapper()
+	bootstrapper.SetNodeManager(nodeManager)
+	bootstrapper.SetSSHClientFactory(clients.Factory())
+
+	assert.NoError(t, bootstrapper.Deploy(context.Background(), cluster, nil))
+
+	masterInstall := findCmd(clients.Commands("demo-master-1"), "k3s-install.sh")
+	assert.NotContains(t, masterInstall, "--node-label")
+
+	workerInstall := findCmd(clients.Commands("demo-worker-1"), "k3s-install.sh")
+	assert.Contains(t, workerInstall, "--node-label=tier=web --node-taint=dedicated=web:NoSchedule")
+	assert.NotContains(t, workerInstall, "node-role.kubernetes.io")
+
+	assert.Equal(
+		t,
+		"k3s kubectl label node demo-worker-1 node-role.kubernetes.io/worker=true tier=web --overwrite",
+		findCmd(clients.Commands("demo-master-1"), "kubectl label"),
+	)
+	assert.Equal(
+		t,
+		"k3s kubectl taint node demo-worker-1 dedicated=web:NoSchedule --overwrite",
+		findCmd(clients.Commands("demo-master-1"), "kubectl taint"),
+	)
+}
+
+func TestCreateRKE2Config(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []string
+		want    string
+	}{
+		{
+			name:    "single options",
+			options: []string{"--token=abc", "--node-name=demo-master-1"},
+			want:    "node-name: demo-master-1\ntoken: abc\n",
+		},
+		{
+			name:    "repeated options",
+			options: []string{"--tls-san=a", "--tls-san=b"},
+			want:    "tls-san:\n- a\n- b\n",
+		},
+		{
+			name:    "list options",
+			options: []string{"--node-label=tier=web", "--node-taint=dedicated=web:NoSchedule"},
+			want:    "node-label:\n- tier=web\nnode-taint:\n- dedicated=web:NoSchedule\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := createRKE2Config(tt.options)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
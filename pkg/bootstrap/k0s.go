@@ -2,8 +2,10 @@ package bootstrap
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/innobead/kubefire/internal/config"
+	interr "github.com/innobead/kubefire/internal/error"
 	pkgconfig "github.com/innobead/kubefire/pkg/config"
 	"github.com/innobead/kubefire/pkg/constants"
 	"github.com/innobead/kubefire/pkg/data"
@@ -20,6 +22,8 @@ import (
 	"text/template"
 )
 
+const k0sKubectl = "k0s kubectl"
+
 const configTemplate = `apiVersion: k0s.k0sproject.io/v1beta1
 kind: Cluster
 metadata:
@@ -40,18 +44,25 @@ type K0sExtraOptions struct {
 }
 
 type K0sBootstrapper struct {
-	nodeManager node.Manager
+	nodeManager      node.Manager
+	sshClientFactory utilssh.ClientFactory
 }
 
 func NewK0sBootstrapper() *K0sBootstrapper {
-	return &K0sBootstrapper{}
+	return &K0sBootstrapper{
+		sshClientFactory: utilssh.DefaultClientFactory,
+	}
 }
 
 func (k *K0sBootstrapper) SetNodeManager(nodeManager node.Manager) {
 	k.nodeManager = nodeManager
 }
 
-func (k *K0sBootstrapper) Deploy(cluster *data.Cluster, before func() error) error {
+func (k *K0sBootstrapper) SetSSHClientFactory(factory utilssh.ClientFactory) {
+	k.sshClientFactory = factory
+}
+
+func (k *K0sBootstrapper) Deploy(ctx context.Context, cluster *data.Cluster, before func() error) error {
 	if before != nil {
 		if err := before(); err != nil {
 			return err
@@ -65,27 +76,27 @@ func (k *K0sBootstrapper) Deploy(cluster *data.Cluster, before func() error) err
 		return err
 	}
 
-	if err := k.nodeManager.WaitNodesRunning(cluster.Name, 5); err != nil {
+	if err := k.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
 		return errors.WithMessage(err, "some nodes are not running")
 	}
 
-	if err := k.init(cluster); err != nil {
+	if err := k.init(ctx, cluster); err != nil {
 		return err
 	}
 
-	firstMaster, err := k.nodeManager.GetNode(node.Name(cluster.Name, node.Master, 1))
+	firstMaster, err := k.nodeManager.GetNode(ctx, node.Name(cluster.Name, node.Master, 1))
 	if err != nil {
 		return err
 	}
 
 	firstMaster.Spec.Cluster = &cluster.Spec
 
-	serverJoinToken, workerJoinToken, err := k.bootstrap(firstMaster, len(cluster.Nodes) == 1, &extraOptions)
+	serverJoinToken, workerJoinToken, err := k.bootstrap(ctx, firstMaster, len(cluster.Nodes) == 1, &extraOptions)
 	if err != nil {
 		return err
 	}
 
-	nodes, err := k.nodeManager.ListNodes(cluster.Name)
+	nodes, err := k.nodeManager.ListNodes(ctx, cluster.Name)
 	if err != nil {
 		return err
 	}
@@ -100,19 +111,77 @@ func (k *K0sBootstrapper) Deploy(cluster *data.Cluster, before func() error) err
 		}
 		n.Spec.Cluster = &cluster.Spec
 
-		if err := k.join(n, serverJoinToken, workerJoinToken, &extraOptions); err != nil {
+		if err := k.join(ctx, n, serverJoinToken, workerJoinToken, &extraOptions); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return applyNodeLabelsTaints(ctx, k.nodeManager, k.sshClientFactory, cluster, k0sKubectl, nodes)
 }
 
-func (k *K0sBootstrapper) DownloadKubeConfig(cluster *data.Cluster, destDir string) (string, error) {
-	return downloadKubeConfig(k.nodeManager, cluster, "/var/lib/k0s/pki/admin.conf", destDir)
+func (k *K0sBootstrapper) JoinNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	extraOptions := K0sExtraOptions{
+		ExtraOptions: config.K0sVersionsEnvVars(cluster.Spec.Version, "", ""),
+	}
+	if err := cluster.Spec.ParseExtraOptions(&extraOptions); err != nil {
+		return err
+	}
+
+	if err := k.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
+		return errors.WithMessage(err, "some nodes are not running")
+	}
+
+	if err := k.init(ctx, clusterWithNodes(cluster, nodes)); err != nil {
+		return err
+	}
+
+	firstMaster, err := getFirstMaster(ctx, k.nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	serverJoinToken, err := runNodeCommand(ctx, k.sshClientFactory, cluster, firstMaster, "k0s token create --role=controller")
+	if err != nil {
+		return err
+	}
+
+	workerJoinToken, err := runNodeCommand(ctx, k.sshClientFactory, cluster, firstMaster, "k0s token create --role=worker")
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		n.Spec.Cluster = &cluster.Spec
+
+		if err := k.join(ctx, n, serverJoinToken, workerJoinToken, &extraOptions); err != nil {
+			return err
+		}
+	}
+
+	return applyNodeLabelsTaints(ctx, k.nodeManager, k.sshClientFactory, cluster, k0sKubectl, nodes)
+}
+
+func (k *K0sBootstrapper) RemoveNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	return removeNodes(ctx, k.nodeManager, k.sshClientFactory, cluster, k0sKubectl, nodes)
 }
 
-func (k *K0sBootstrapper) Prepare(cluster *data.Cluster, force bool) error {
+func (k *K0sBootstrapper) DrainNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return drainNode(ctx, k.nodeManager, k.sshClientFactory, cluster, k0sKubectl, n)
+}
+
+func (k *K0sBootstrapper) UncordonNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return uncordonNode(ctx, k.nodeManager, k.sshClientFactory, cluster, k0sKubectl, n)
+}
+
+func (k *K0sBootstrapper) Rekey(ctx context.Context, cluster *data.Cluster, origins map[string]*data.Node) error {
+	return errors.WithMessagef(interr.BootstrapperNotSupportError, "re-keying nodes of %s cluster", k.Type())
+}
+
+func (k *K0sBootstrapper) DownloadKubeConfig(ctx context.Context, cluster *data.Cluster, destDir string) (string, error) {
+	return downloadKubeConfig(ctx, k.nodeManager, k.sshClientFactory, cluster, "/var/lib/k0s/pki/admin.conf", destDir)
+}
+
+func (k *K0sBootstrapper) Prepare(ctx context.Context, cluster *data.Cluster, force bool) error {
 	return nil
 }
 
@@ -120,7 +189,7 @@ func (k *K0sBootstrapper) Type() string {
 	return constants.K0s
 }
 
-func (k *K0sBootstrapper) init(cluster *data.Cluster) error {
+func (k *K0sBootstrapper) init(ctx context.Context, cluster *data.Cluster) error {
 	cmds := []string{
 		"swapoff -a",
 		fmt.Sprintf("curl -sfSLO %s", script.RemoteScriptUrl(script.InstallPrerequisitesK0s)),
@@ -128,17 +197,17 @@ func (k *K0sBootstrapper) init(cluster *data.Cluster) error {
 		fmt.Sprintf("%s ./%s install_k0s", config.K0sVersionsEnvVars(cluster.Spec.Version, "", "").String(), script.InstallPrerequisitesK0s),
 	}
 
-	return initNodes(cluster, cmds)
+	return initNodes(ctx, k.sshClientFactory, cluster, cmds)
 }
 
-func (k *K0sBootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOptions *K0sExtraOptions) (serverToken string, workerToken string, err error) {
+func (k *K0sBootstrapper) bootstrap(ctx context.Context, node *data.Node, isSingleNode bool, extraOptions *K0sExtraOptions) (serverToken string, workerToken string, err error) {
 	logrus.WithField("node", node.Name).Infoln("bootstrapping the first master node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := k.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
@@ -171,7 +240,7 @@ func (k *K0sBootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOpt
 	err = tmp.Execute(file, struct {
 		BindAddress string
 	}{
-		BindAddress: node.Status.IPAddresses,
+		BindAddress: node.Address(),
 	})
 	if err != nil {
 		return "", "", errors.WithStack(err)
@@ -236,14 +305,14 @@ func (k *K0sBootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOpt
 	return strings.TrimSuffix(serverTokenBuf.String(), "\n"), strings.TrimSuffix(workerTokenBuf.String(), "\n"), nil
 }
 
-func (k *K0sBootstrapper) join(node *data.Node, serverJoinToken string, workerJoinToken string, extraOptions *K0sExtraOptions) error {
+func (k *K0sBootstrapper) join(ctx context.Context, node *data.Node, serverJoinToken string, workerJoinToken string, extraOptions *K0sExtraOptions) error {
 	logrus.WithField("node", node.Name).Infoln("joining node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := k.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
@@ -263,6 +332,16 @@ func (k *K0sBootstrapper) join(node *data.Node, serverJoinToken string, workerJo
 	} else {
 		joinToken = workerJoinToken
 		cmd = "worker"
+
+		// the controllers are labeled and tainted by kubectl, because the options are only available for workers
+		labels, taints := nativeNodeLabelsTaints(node)
+		if len(labels) > 0 {
+			deployCmdOpts = append(deployCmdOpts, fmt.Sprintf("--labels=%s", strings.Join(labels, ",")))
+		}
+		if len(taints) > 0 {
+			deployCmdOpts = append(deployCmdOpts, fmt.Sprintf("--taints=%s", strings.Join(taints, ",")))
+		}
+
 		if len(extraOptions.WorkerInstallOptions) > 0 {
 			deployCmdOpts = append(deployCmdOpts, extraOptions.WorkerInstallOptions...)
 		}
@@ -2,6 +2,7 @@ package bootstrap
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/innobead/kubefire/internal/config"
 	"github.com/innobead/kubefire/pkg/constants"
@@ -15,6 +16,8 @@ import (
 	"strings"
 )
 
+const k3sKubectl = "k3s kubectl"
+
 type K3sExtraOptions struct {
 	ServerInstallOptions []string `json:"server_install_options"`
 	AgentInstallOptions  []string `json:"agent_install_options"`
@@ -22,18 +25,25 @@ type K3sExtraOptions struct {
 }
 
 type K3sBootstrapper struct {
-	nodeManager node.Manager
+	nodeManager      node.Manager
+	sshClientFactory utilssh.ClientFactory
 }
 
 func NewK3sBootstrapper() *K3sBootstrapper {
-	return &K3sBootstrapper{}
+	return &K3sBootstrapper{
+		sshClientFactory: utilssh.DefaultClientFactory,
+	}
 }
 
 func (k *K3sBootstrapper) SetNodeManager(nodeManager node.Manager) {
 	k.nodeManager = nodeManager
 }
 
-func (k *K3sBootstrapper) Deploy(cluster *data.Cluster, before func() error) error {
+func (k *K3sBootstrapper) SetSSHClientFactory(factory utilssh.ClientFactory) {
+	k.sshClientFactory = factory
+}
+
+func (k *K3sBootstrapper) Deploy(ctx context.Context, cluster *data.Cluster, before func() error) error {
 	if before != nil {
 		if err := before(); err != nil {
 			return err
@@ -47,27 +57,27 @@ func (k *K3sBootstrapper) Deploy(cluster *data.Cluster, before func() error) err
 		return err
 	}
 
-	if err := k.nodeManager.WaitNodesRunning(cluster.Name, 5); err != nil {
+	if err := k.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
 		return errors.WithMessage(err, "some nodes are not running")
 	}
 
-	if err := k.init(cluster); err != nil {
+	if err := k.init(ctx, cluster); err != nil {
 		return err
 	}
 
-	firstMaster, err := k.nodeManager.GetNode(node.Name(cluster.Name, node.Master, 1))
+	firstMaster, err := k.nodeManager.GetNode(ctx, node.Name(cluster.Name, node.Master, 1))
 	if err != nil {
 		return err
 	}
 
 	firstMaster.Spec.Cluster = &cluster.Spec
 
-	joinToken, err := k.bootstrap(firstMaster, len(cluster.Nodes) == 1, &extraOptions)
+	joinToken, err := k.bootstrap(ctx, firstMaster, len(cluster.Nodes) == 1, &extraOptions)
 	if err != nil {
 		return err
 	}
 
-	nodes, err := k.nodeManager.ListNodes(cluster.Name)
+	nodes, err := k.nodeManager.ListNodes(ctx, cluster.Name)
 	if err != nil {
 		return err
 	}
@@ -82,19 +92,85 @@ func (k *K3sBootstrapper) Deploy(cluster *data.Cluster, before func() error) err
 		}
 		n.Spec.Cluster = &cluster.Spec
 
-		if err := k.join(n, firstMaster.Status.IPAddresses, joinToken, &extraOptions); err != nil {
+		if err := k.join(ctx, n, firstMaster.Address(), joinToken, &extraOptions); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return applyNodeLabelsTaints(ctx, k.nodeManager, k.sshClientFactory, cluster, k3sKubectl, nodes)
+}
+
+func (k *K3sBootstrapper) JoinNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	extraOptions := K3sExtraOptions{
+		ExtraOptions: config.K3sVersionsEnvVars(cluster.Spec.Version),
+	}
+	if err := cluster.Spec.ParseExtraOptions(&extraOptions); err != nil {
+		return err
+	}
+
+	if err := k.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
+		return errors.WithMessage(err, "some nodes are not running")
+	}
+
+	if err := k.init(ctx, clusterWithNodes(cluster, nodes)); err != nil {
+		return err
+	}
+
+	firstMaster, err := getFirstMaster(ctx, k.nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	joinToken, err := runNodeCommand(ctx, k.sshClientFactory, cluster, firstMaster, "cat /var/lib/rancher/k3s/server/node-token")
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		n.Spec.Cluster = &cluster.Spec
+
+		if err := k.join(ctx, n, firstMaster.Address(), joinToken, &extraOptions); err != nil {
+			return err
+		}
+	}
+
+	return applyNodeLabelsTaints(ctx, k.nodeManager, k.sshClientFactory, cluster, k3sKubectl, nodes)
+}
+
+func (k *K3sBootstrapper) RemoveNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	return removeNodes(ctx, k.nodeManager, k.sshClientFactory, cluster, k3sKubectl, nodes)
 }
 
-func (k *K3sBootstrapper) DownloadKubeConfig(cluster *data.Cluster, destDir string) (string, error) {
-	return downloadKubeConfig(k.nodeManager, cluster, "/etc/rancher/k3s/k3s.yaml", destDir)
+func (k *K3sBootstrapper) DrainNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return drainNode(ctx, k.nodeManager, k.sshClientFactory, cluster, k3sKubectl, n)
 }
 
-func (k *K3sBootstrapper) Prepare(cluster *data.Cluster, force bool) error {
+func (k *K3sBootstrapper) UncordonNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return uncordonNode(ctx, k.nodeManager, k.sshClientFactory, cluster, k3sKubectl, n)
+}
+
+func (k *K3sBootstrapper) Rekey(ctx context.Context, cluster *data.Cluster, origins map[string]*data.Node) error {
+	return rekeyNodes(ctx, k.nodeManager, k.sshClientFactory, cluster, origins, &rekeyServices{
+		kubectl: k3sKubectl,
+		files: []string{
+			"/etc/hosts",
+			"/etc/systemd/system/k3s.service",
+			"/etc/systemd/system/k3s.service.env",
+			"/etc/systemd/system/k3s-agent.service",
+			"/etc/systemd/system/k3s-agent.service.env",
+		},
+		server:  "k3s",
+		agent:   "k3s-agent",
+		etcdDir: "/var/lib/rancher/k3s/server/db/etcd",
+		reset:   "k3s server --cluster-reset",
+	})
+}
+
+func (k *K3sBootstrapper) DownloadKubeConfig(ctx context.Context, cluster *data.Cluster, destDir string) (string, error) {
+	return downloadKubeConfig(ctx, k.nodeManager, k.sshClientFactory, cluster, "/etc/rancher/k3s/k3s.yaml", destDir)
+}
+
+func (k *K3sBootstrapper) Prepare(ctx context.Context, cluster *data.Cluster, force bool) error {
 	return nil
 }
 
@@ -102,7 +178,7 @@ func (k *K3sBootstrapper) Type() string {
 	return constants.K3S
 }
 
-func (k *K3sBootstrapper) init(cluster *data.Cluster) error {
+func (k *K3sBootstrapper) init(ctx context.Context, cluster *data.Cluster) error {
 	cmds := []string{
 		"swapoff -a",
 		fmt.Sprintf("curl -sfSLO %s", script.RemoteScriptUrl(script.InstallPrerequisitesK3s)),
@@ -110,17 +186,17 @@ func (k *K3sBootstrapper) init(cluster *data.Cluster) error {
 		fmt.Sprintf("%s ./%s", config.K3sVersionsEnvVars(cluster.Spec.Version).String(), script.InstallPrerequisitesK3s),
 	}
 
-	return initNodes(cluster, cmds)
+	return initNodes(ctx, k.sshClientFactory, cluster, cmds)
 }
 
-func (k *K3sBootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOptions *K3sExtraOptions) (token string, err error) {
+func (k *K3sBootstrapper) bootstrap(ctx context.Context, node *data.Node, isSingleNode bool, extraOptions *K3sExtraOptions) (token string, err error) {
 	logrus.WithField("node", node.Name).Infoln("bootstrapping the first master node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := k.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
@@ -137,6 +213,8 @@ func (k *K3sBootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOpt
 		deployCmdOpts = append(deployCmdOpts, "--cluster-init")
 	}
 
+	deployCmdOpts = append(deployCmdOpts, k3sNodeLabelTaintOptions(node)...)
+
 	if extraOptions.ServerInstallOptions != nil {
 		deployCmdOpts = append(deployCmdOpts, extraOptions.ServerInstallOptions...)
 	}
@@ -172,14 +250,14 @@ func (k *K3sBootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOpt
 	return strings.TrimSuffix(tokenBuf.String(), "\n"), nil
 }
 
-func (k *K3sBootstrapper) join(node *data.Node, apiServerAddress string, joinToken string, extraOptions *K3sExtraOptions) error {
+func (k *K3sBootstrapper) join(ctx context.Context, node *data.Node, apiServerAddress string, joinToken string, extraOptions *K3sExtraOptions) error {
 	logrus.WithField("node", node.Name).Infoln("joining node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := k.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
@@ -190,6 +268,8 @@ func (k *K3sBootstrapper) join(node *data.Node, apiServerAddress string, joinTok
 	deployCmdOpts := []string{
 		fmt.Sprintf(`--node-name="%s"`, node.Name),
 	}
+	deployCmdOpts = append(deployCmdOpts, k3sNodeLabelTaintOptions(node)...)
+
 	cmd := fmt.Sprintf(
 		"%s K3S_URL=https://%s:6443 K3S_TOKEN=%s k3s-install.sh",
 		config.K3sVersionsEnvVars(node.Spec.Cluster.Version).String(),
@@ -217,3 +297,19 @@ func (k *K3sBootstrapper) join(node *data.Node, apiServerAddress string, joinTok
 
 	return nil
 }
+
+func k3sNodeLabelTaintOptions(node *data.Node) []string {
+	var options []string
+
+	labels, taints := nativeNodeLabelsTaints(node)
+
+	for _, l := range labels {
+		options = append(options, fmt.Sprintf("--node-label=%s", l))
+	}
+
+	for _, t := range taints {
+		options = append(options, fmt.Sprintf("--node-taint=%s", t))
+	}
+
+	return options
+}
@@ -2,10 +2,12 @@ package bootstrap
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/avast/retry-go"
 	"github.com/hashicorp/go-multierror"
 	"github.com/innobead/kubefire/internal/config"
+	interr "github.com/innobead/kubefire/internal/error"
 	"github.com/innobead/kubefire/pkg/bootstrap/versionfinder"
 	pkgconfig "github.com/innobead/kubefire/pkg/config"
 	"github.com/innobead/kubefire/pkg/constants"
@@ -21,6 +23,30 @@ import (
 	"time"
 )
 
+const kubeadmKubectl = "KUBECONFIG=/etc/kubernetes/admin.conf kubectl"
+
+var kubeadmCertsOptions = []string{
+	"--apiserver-cert-extra-sans",
+	"--control-plane-endpoint",
+	"--service-cidr",
+	"--service-dns-domain",
+}
+
+// kubeadmRekeyFiles are the files having the node names or addresses on the master node.
+var kubeadmRekeyFiles = []string{
+	"/etc/hosts",
+	"/etc/kubernetes/*.conf",
+	"/etc/kubernetes/manifests/*.yaml",
+	"/var/lib/kubelet/kubeadm-flags.env",
+}
+
+// kubeadmRekeyConfigMaps are the config maps having the address of the master node.
+var kubeadmRekeyConfigMaps = [][]string{
+	{"kube-system", "kube-proxy"},
+	{"kube-system", "kubeadm-config"},
+	{"kube-public", "cluster-info"},
+}
+
 type KubeadmExtraOptions struct {
 	InitOptions              []string `json:"init_options"`
 	ApiServerOptions         []string `json:"api_server_options"`
@@ -29,13 +55,16 @@ type KubeadmExtraOptions struct {
 }
 
 type KubeadmBootstrapper struct {
-	nodeManager   node.Manager
-	versionFinder versionfinder.Finder
-	configManager pkgconfig.Manager
+	nodeManager      node.Manager
+	versionFinder    versionfinder.Finder
+	configManager    pkgconfig.Manager
+	sshClientFactory utilssh.ClientFactory
 }
 
 func NewKubeadmBootstrapper() *KubeadmBootstrapper {
-	return &KubeadmBootstrapper{}
+	return &KubeadmBootstrapper{
+		sshClientFactory: utilssh.DefaultClientFactory,
+	}
 }
 
 func (k *KubeadmExtraOptions) generateKubeadmInitOptions() []string {
@@ -51,6 +80,22 @@ func (k *KubeadmExtraOptions) generateKubeadmInitOptions() []string {
 	return options
 }
 
+// generateKubeadmCertsOptions returns the init options affecting the SANs of the API server certificate, which are used to
+// regenerate the certificate.
+func (k *KubeadmExtraOptions) generateKubeadmCertsOptions() []string {
+	var options []string
+
+	for _, o := range k.generateKubeadmInitOptions() {
+		for _, name := range kubeadmCertsOptions {
+			if o == name || strings.HasPrefix(o, name+"=") {
+				options = append(options, o)
+			}
+		}
+	}
+
+	return options
+}
+
 func (k *KubeadmExtraOptions) generateControlPlaneComponentOptions(cpOptions *[]string) []string {
 	var options []string
 	for _, o := range *cpOptions {
@@ -73,7 +118,11 @@ func (k *KubeadmBootstrapper) SetNodeManager(nodeManager node.Manager) {
 	k.nodeManager = nodeManager
 }
 
-func (k *KubeadmBootstrapper) Deploy(cluster *data.Cluster, before func() error) error {
+func (k *KubeadmBootstrapper) SetSSHClientFactory(factory utilssh.ClientFactory) {
+	k.sshClientFactory = factory
+}
+
+func (k *KubeadmBootstrapper) Deploy(ctx context.Context, cluster *data.Cluster, before func() error) error {
 	if before != nil {
 		if err := before(); err != nil {
 			return err
@@ -85,27 +134,27 @@ func (k *KubeadmBootstrapper) Deploy(cluster *data.Cluster, before func() error)
 		return err
 	}
 
-	if err := k.nodeManager.WaitNodesRunning(cluster.Name, 5); err != nil {
+	if err := k.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
 		return errors.WithMessage(err, "some nodes are not running")
 	}
 
-	if err := k.init(cluster); err != nil {
+	if err := k.init(ctx, cluster); err != nil {
 		return err
 	}
 
-	firstMaster, err := k.nodeManager.GetNode(node.Name(cluster.Name, node.Master, 1))
+	firstMaster, err := k.nodeManager.GetNode(ctx, node.Name(cluster.Name, node.Master, 1))
 	if err != nil {
 		return err
 	}
 
 	firstMaster.Spec.Cluster = &cluster.Spec
 
-	joinCmd, err := k.bootstrap(firstMaster, len(cluster.Nodes) == 1, &extraOptions)
+	joinCmd, err := k.bootstrap(ctx, firstMaster, len(cluster.Nodes) == 1, &extraOptions)
 	if err != nil {
 		return err
 	}
 
-	nodes, err := k.nodeManager.ListNodes(cluster.Name)
+	nodes, err := k.nodeManager.ListNodes(ctx, cluster.Name)
 	if err != nil {
 		return err
 	}
@@ -120,19 +169,149 @@ func (k *KubeadmBootstrapper) Deploy(cluster *data.Cluster, before func() error)
 		}
 		n.Spec.Cluster = &cluster.Spec
 
-		if err := k.join(n, joinCmd); err != nil {
+		if err := k.join(ctx, n, joinCmd); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return applyNodeLabelsTaints(ctx, k.nodeManager, k.sshClientFactory, cluster, kubeadmKubectl, nodes)
+}
+
+// JoinNodes joins the worker nodes to the cluster. The master nodes are refused, because the join command only joins
+// the nodes as workers without a control plane endpoint shared by masters.
+func (k *KubeadmBootstrapper) JoinNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	for _, n := range nodes {
+		if n.IsMaster() {
+			return errors.WithMessagef(interr.BootstrapperNotSupportError, "joining master node (%s) to %s cluster", n.Name, k.Type())
+		}
+	}
+
+	if err := k.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
+		return errors.WithMessage(err, "some nodes are not running")
+	}
+
+	if err := k.init(ctx, clusterWithNodes(cluster, nodes)); err != nil {
+		return err
+	}
+
+	firstMaster, err := getFirstMaster(ctx, k.nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	// the bootstrap token created during deployment may be expired already, so always create a new one
+	joinCmd, err := runNodeCommand(ctx, k.sshClientFactory, cluster, firstMaster, "kubeadm token create --print-join-command")
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		n.Spec.Cluster = &cluster.Spec
+
+		if err := k.join(ctx, n, joinCmd); err != nil {
+			return err
+		}
+	}
+
+	return applyNodeLabelsTaints(ctx, k.nodeManager, k.sshClientFactory, cluster, kubeadmKubectl, nodes)
+}
+
+func (k *KubeadmBootstrapper) RemoveNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	return removeNodes(ctx, k.nodeManager, k.sshClientFactory, cluster, kubeadmKubectl, nodes)
+}
+
+func (k *KubeadmBootstrapper) DrainNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return drainNode(ctx, k.nodeManager, k.sshClientFactory, cluster, kubeadmKubectl, n)
+}
+
+func (k *KubeadmBootstrapper) UncordonNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return uncordonNode(ctx, k.nodeManager, k.sshClientFactory, cluster, kubeadmKubectl, n)
 }
 
-func (k *KubeadmBootstrapper) DownloadKubeConfig(cluster *data.Cluster, destDir string) (string, error) {
-	return downloadKubeConfig(k.nodeManager, cluster, "", destDir)
+// Rekey regenerates the certificates and kubeconfigs of the cloned master node having the new name and address, then
+// resets and joins the cloned worker nodes again.
+func (k *KubeadmBootstrapper) Rekey(ctx context.Context, cluster *data.Cluster, origins map[string]*data.Node) error {
+	extraOptions := KubeadmExtraOptions{}
+	if err := cluster.Spec.ParseExtraOptions(&extraOptions); err != nil {
+		return err
+	}
+
+	cluster, script, err := prepareRekey(ctx, k.nodeManager, cluster, origins)
+	if err != nil {
+		return err
+	}
+
+	firstMaster, err := getFirstMaster(ctx, k.nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	cmds := []string{"systemctl stop kubelet"}
+	cmds = append(cmds, rekeyNodeCmds(firstMaster, script, kubeadmRekeyFiles)...)
+	cmds = append(
+		cmds,
+		"rm -f /etc/kubernetes/pki/apiserver.crt /etc/kubernetes/pki/apiserver.key /etc/kubernetes/pki/etcd/server.* /etc/kubernetes/pki/etcd/peer.* /etc/kubernetes/kubelet.conf /var/lib/kubelet/pki/kubelet*",
+		strings.TrimSpace(fmt.Sprintf("kubeadm init phase certs apiserver %s", strings.Join(extraOptions.generateKubeadmCertsOptions(), " "))),
+		"kubeadm init phase certs etcd-server",
+		"kubeadm init phase certs etcd-peer",
+		fmt.Sprintf(`kubeadm init phase kubeconfig kubelet --node-name="%s"`, firstMaster.Name),
+		"systemctl start kubelet",
+	)
+
+	if err := runNodeCommands(ctx, k.sshClientFactory, cluster, firstMaster, cmds...); err != nil {
+		return err
+	}
+
+	if err := waitAPIServer(ctx, k.sshClientFactory, cluster, firstMaster, kubeadmKubectl); err != nil {
+		return err
+	}
+
+	for _, cm := range kubeadmRekeyConfigMaps {
+		cmd := fmt.Sprintf("%s -n %s get configmap %s -o yaml | sed '%s' | %s replace -f -", kubeadmKubectl, cm[0], cm[1], script, kubeadmKubectl)
+
+		if _, err := runNodeCommand(ctx, k.sshClientFactory, cluster, firstMaster, cmd); err != nil {
+			logrus.WithError(err).Warnf("failed to re-key config map (%s/%s)", cm[0], cm[1])
+		}
+	}
+
+	// kube-proxy may have been started with the original address before updating the config map
+	if _, err := runNodeCommand(ctx, k.sshClientFactory, cluster, firstMaster, fmt.Sprintf("%s -n kube-system delete pod -l k8s-app=kube-proxy", kubeadmKubectl)); err != nil {
+		logrus.WithError(err).Warnln("failed to restart kube-proxy")
+	}
+
+	if err := deleteOriginNodes(ctx, k.sshClientFactory, cluster, firstMaster, kubeadmKubectl, origins); err != nil {
+		return err
+	}
+
+	joinCmd, err := runNodeCommand(ctx, k.sshClientFactory, cluster, firstMaster, "kubeadm token create --print-join-command")
+	if err != nil {
+		return err
+	}
+
+	for _, n := range cluster.Nodes {
+		if n.Name == firstMaster.Name {
+			continue
+		}
+		n.Spec.Cluster = &cluster.Spec
+
+		cmds := append(rekeyNodeCmds(n, script, []string{"/etc/hosts"}), "kubeadm reset -f")
+		if err := runNodeCommands(ctx, k.sshClientFactory, cluster, n, cmds...); err != nil {
+			return err
+		}
+
+		if err := k.join(ctx, n, joinCmd); err != nil {
+			return err
+		}
+	}
+
+	return applyNodeLabelsTaints(ctx, k.nodeManager, k.sshClientFactory, cluster, kubeadmKubectl, cluster.Nodes)
+}
+
+func (k *KubeadmBootstrapper) DownloadKubeConfig(ctx context.Context, cluster *data.Cluster, destDir string) (string, error) {
+	return downloadKubeConfig(ctx, k.nodeManager, k.sshClientFactory, cluster, "", destDir)
 }
 
-func (k *KubeadmBootstrapper) Prepare(cluster *data.Cluster, force bool) error {
+func (k *KubeadmBootstrapper) Prepare(ctx context.Context, cluster *data.Cluster, force bool) error {
 	return nil
 }
 
@@ -140,7 +319,7 @@ func (k *KubeadmBootstrapper) Type() string {
 	return constants.KUBEADM
 }
 
-func (k *KubeadmBootstrapper) init(cluster *data.Cluster) error {
+func (k *KubeadmBootstrapper) init(ctx context.Context, cluster *data.Cluster) error {
 	logrus.WithField("cluster", cluster.Name).Infoln("initializing cluster")
 
 	bootstrapperVersion, err := getSupportedBootstrapperVersion(k.versionFinder, k.configManager, k, cluster.Spec.Version)
@@ -162,11 +341,11 @@ func (k *KubeadmBootstrapper) init(cluster *data.Cluster) error {
 			defer wgInitNodes.Done()
 
 			_ = retry.Do(func() error {
-				sshClient, err := utilssh.NewClient(
+				sshClient, err := k.sshClientFactory(ctx,
 					n.Name,
 					cluster.Spec.Prikey,
 					"root",
-					n.Status.IPAddresses,
+					n.Address(),
 					nil,
 				)
 				if err != nil {
@@ -201,6 +380,7 @@ func (k *KubeadmBootstrapper) init(cluster *data.Cluster) error {
 
 				return nil
 			},
+				retry.Context(ctx),
 				retry.Delay(10*time.Second),
 				retry.MaxDelay(1*time.Minute),
 			)
@@ -212,6 +392,10 @@ func (k *KubeadmBootstrapper) init(cluster *data.Cluster) error {
 	wgInitNodes.Wait()
 	close(chErr)
 
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
 	err = nil
 	for {
 		e, ok := <-chErr
@@ -227,14 +411,14 @@ func (k *KubeadmBootstrapper) init(cluster *data.Cluster) error {
 	return err
 }
 
-func (k *KubeadmBootstrapper) bootstrap(node *data.Node, isSingleNode bool, options *KubeadmExtraOptions) (joinCmd string, err error) {
+func (k *KubeadmBootstrapper) bootstrap(ctx context.Context, node *data.Node, isSingleNode bool, options *KubeadmExtraOptions) (joinCmd string, err error) {
 	logrus.WithField("node", node.Name).Infoln("bootstrapping the first master node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := k.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
@@ -315,14 +499,14 @@ func (k *KubeadmBootstrapper) bootstrap(node *data.Node, isSingleNode bool, opti
 	return strings.TrimSuffix(joinCmdBuf.String(), "\n"), nil
 }
 
-func (k *KubeadmBootstrapper) join(node *data.Node, joinCmd string) error {
+func (k *KubeadmBootstrapper) join(ctx context.Context, node *data.Node, joinCmd string) error {
 	logrus.WithField("node", node.Name).Infoln("joining node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := k.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
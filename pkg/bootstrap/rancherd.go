@@ -1,8 +1,10 @@
 package bootstrap
 
 import (
+	"context"
 	"fmt"
 	"github.com/innobead/kubefire/internal/config"
+	interr "github.com/innobead/kubefire/internal/error"
 	"github.com/innobead/kubefire/pkg/constants"
 	"github.com/innobead/kubefire/pkg/data"
 	"github.com/innobead/kubefire/pkg/node"
@@ -34,7 +36,7 @@ func (r *RancherdBootstrapper) SetNodeManager(nodeManager node.Manager) {
 	r.nodeManager = nodeManager
 }
 
-func (r *RancherdBootstrapper) Deploy(cluster *data.Cluster, before func() error) error {
+func (r *RancherdBootstrapper) Deploy(ctx context.Context, cluster *data.Cluster, before func() error) error {
 	if before != nil {
 		if err := before(); err != nil {
 			return err
@@ -48,27 +50,27 @@ func (r *RancherdBootstrapper) Deploy(cluster *data.Cluster, before func() error
 		return err
 	}
 
-	if err := r.nodeManager.WaitNodesRunning(cluster.Name, 5); err != nil {
+	if err := r.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
 		return errors.WithMessage(err, "some nodes are not running")
 	}
 
-	if err := r.init(cluster); err != nil {
+	if err := r.init(ctx, cluster); err != nil {
 		return err
 	}
 
-	firstMaster, err := r.nodeManager.GetNode(node.Name(cluster.Name, node.Master, 1))
+	firstMaster, err := r.nodeManager.GetNode(ctx, node.Name(cluster.Name, node.Master, 1))
 	if err != nil {
 		return err
 	}
 
 	firstMaster.Spec.Cluster = &cluster.Spec
 
-	joinToken, err := r.bootstrap(firstMaster, len(cluster.Nodes) == 1, &extraOptions)
+	joinToken, err := r.bootstrap(ctx, firstMaster, len(cluster.Nodes) == 1, &extraOptions)
 	if err != nil {
 		return err
 	}
 
-	nodes, err := r.nodeManager.ListNodes(cluster.Name)
+	nodes, err := r.nodeManager.ListNodes(ctx, cluster.Name)
 	if err != nil {
 		return err
 	}
@@ -83,7 +85,7 @@ func (r *RancherdBootstrapper) Deploy(cluster *data.Cluster, before func() error
 		}
 		n.Spec.Cluster = &cluster.Spec
 
-		if err := r.join(n, firstMaster.Status.IPAddresses, joinToken, &extraOptions); err != nil {
+		if err := r.join(ctx, n, firstMaster.Address(), joinToken, &extraOptions); err != nil {
 			return err
 		}
 	}
@@ -91,19 +93,27 @@ func (r *RancherdBootstrapper) Deploy(cluster *data.Cluster, before func() error
 	return nil
 }
 
-func (r *RancherdBootstrapper) DownloadKubeConfig(cluster *data.Cluster, destDir string) (string, error) {
-	return r.RKE2Bootstrapper.DownloadKubeConfig(cluster, destDir)
+func (r *RancherdBootstrapper) JoinNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	return errors.WithMessagef(interr.BootstrapperNotSupportError, "joining nodes to %s cluster", r.Type())
 }
 
-func (r *RancherdBootstrapper) Prepare(cluster *data.Cluster, force bool) error {
-	return r.RKE2Bootstrapper.Prepare(cluster, force)
+func (r *RancherdBootstrapper) Rekey(ctx context.Context, cluster *data.Cluster, origins map[string]*data.Node) error {
+	return errors.WithMessagef(interr.BootstrapperNotSupportError, "re-keying nodes of %s cluster", r.Type())
+}
+
+func (r *RancherdBootstrapper) DownloadKubeConfig(ctx context.Context, cluster *data.Cluster, destDir string) (string, error) {
+	return r.RKE2Bootstrapper.DownloadKubeConfig(ctx, cluster, destDir)
+}
+
+func (r *RancherdBootstrapper) Prepare(ctx context.Context, cluster *data.Cluster, force bool) error {
+	return r.RKE2Bootstrapper.Prepare(ctx, cluster, force)
 }
 
 func (r *RancherdBootstrapper) Type() string {
 	return constants.RANCHERD
 }
 
-func (r *RancherdBootstrapper) init(cluster *data.Cluster) error {
+func (r *RancherdBootstrapper) init(ctx context.Context, cluster *data.Cluster) error {
 	cmds := []string{
 		"swapoff -a",
 		fmt.Sprintf("curl -sfSLO %s", script.RemoteScriptUrl(script.InstallPrerequisitesRKE2)),
@@ -111,17 +121,17 @@ func (r *RancherdBootstrapper) init(cluster *data.Cluster) error {
 		fmt.Sprintf("%s ./%s install_rancherd", config.RancherdVersionsEnvVars(cluster.Spec.Version, "").String(), script.InstallPrerequisitesRKE2),
 	}
 
-	return initNodes(cluster, cmds)
+	return initNodes(ctx, r.sshClientFactory, cluster, cmds)
 }
 
-func (r *RancherdBootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOptions *RancherdExtraOptions) (token string, err error) {
+func (r *RancherdBootstrapper) bootstrap(ctx context.Context, node *data.Node, isSingleNode bool, extraOptions *RancherdExtraOptions) (token string, err error) {
 	logrus.WithField("node", node.Name).Infoln("bootstrapping the first master node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := r.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
@@ -131,7 +141,7 @@ func (r *RancherdBootstrapper) bootstrap(node *data.Node, isSingleNode bool, ext
 
 	joinToken := util.GenerateRandomStr(8)
 	deployCmdOpts := []string{
-		fmt.Sprintf("--bind-address=%s", node.Status.IPAddresses),
+		fmt.Sprintf("--bind-address=%s", node.Address()),
 		fmt.Sprintf("--token=%s", joinToken),
 	}
 
@@ -179,14 +189,14 @@ func (r *RancherdBootstrapper) bootstrap(node *data.Node, isSingleNode bool, ext
 	return strings.TrimSuffix(joinToken, "\n"), nil
 }
 
-func (r *RancherdBootstrapper) join(node *data.Node, apiServerAddress string, joinToken string, extraOptions *RancherdExtraOptions) error {
+func (r *RancherdBootstrapper) join(ctx context.Context, node *data.Node, apiServerAddress string, joinToken string, extraOptions *RancherdExtraOptions) error {
 	logrus.WithField("node", node.Name).Infoln("joining node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := r.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
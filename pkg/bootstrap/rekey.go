@@ -0,0 +1,233 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"github.com/avast/retry-go"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	utilssh "github.com/innobead/kubefire/pkg/util/ssh"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rekeyServices describes how to re-key the nodes whose Kubernetes components are run by systemd services, which pick up
+// the re-keyed node names and addresses from the updated files after restarting.
+type rekeyServices struct {
+	kubectl string
+	files   []string
+	server  string // the systemd service run on master nodes
+	agent   string // the systemd service run on worker nodes
+	etcdDir string // the data folder of the embedded etcd, which membership has to be reset to the re-keyed address
+	reset   string // the command to reset the embedded etcd membership
+}
+
+// rekeyNodes re-keys the cloned nodes of the systemd service based bootstrappers. The master node is re-keyed first,
+// then the worker nodes reconnect to it after being re-keyed.
+func rekeyNodes(ctx context.Context, nodeManager node.Manager, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, origins map[string]*data.Node, services *rekeyServices) error {
+	cluster, script, err := prepareRekey(ctx, nodeManager, cluster, origins)
+	if err != nil {
+		return err
+	}
+
+	firstMaster, err := getFirstMaster(ctx, nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range cluster.Nodes {
+		service := services.agent
+		if n.IsMaster() {
+			service = services.server
+		}
+
+		cmds := []string{fmt.Sprintf("systemctl stop %s", service)}
+		cmds = append(cmds, rekeyNodeCmds(n, script, services.files)...)
+		cmds = append(cmds, "systemctl daemon-reload")
+
+		if n.IsMaster() {
+			cmds = append(cmds, fmt.Sprintf("if [ -d %s ]; then %s; fi", services.etcdDir, services.reset))
+		}
+
+		cmds = append(cmds, fmt.Sprintf("systemctl start %s", service))
+
+		if err := runNodeCommands(ctx, sshClientFactory, cluster, n, cmds...); err != nil {
+			return err
+		}
+
+		if n.Name == firstMaster.Name {
+			if err := waitAPIServer(ctx, sshClientFactory, cluster, firstMaster, services.kubectl); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := deleteOriginNodes(ctx, sshClientFactory, cluster, firstMaster, services.kubectl, origins); err != nil {
+		return err
+	}
+
+	return applyNodeLabelsTaints(ctx, nodeManager, sshClientFactory, cluster, services.kubectl, cluster.Nodes)
+}
+
+// prepareRekey returns the cluster having the running cloned nodes with the allocated addresses, and the sed script
+// replacing the names and addresses of the original nodes with the cloned ones. Only the cluster having one master node
+// is supported, because the cloned master nodes can not rejoin the control plane having the original addresses.
+func prepareRekey(ctx context.Context, nodeManager node.Manager, cluster *data.Cluster, origins map[string]*data.Node) (*data.Cluster, string, error) {
+	if err := nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
+		return nil, "", errors.WithMessage(err, "some nodes are not running")
+	}
+
+	nodes, err := nodeManager.ListNodes(ctx, cluster.Name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	masterCount := 0
+	for _, n := range nodes {
+		if n.IsMaster() {
+			masterCount++
+		}
+	}
+
+	if masterCount != 1 {
+		return nil, "", errors.Errorf("re-keying cluster (%s) having %d master nodes is not supported, only 1 master node supported", cluster.Name, masterCount)
+	}
+
+	// the master node is re-keyed first, so the worker nodes can reconnect to it
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].IsMaster() && !nodes[j].IsMaster()
+	})
+
+	cluster = clusterWithNodes(cluster, nodes)
+
+	script, err := rekeyScript(cluster, origins)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return cluster, script, nil
+}
+
+// rekeyScript returns the sed script replacing the names and addresses of the original nodes with the cloned ones. The
+// replacements are done via placeholders, because a cloned node may get the address of another original node.
+func rekeyScript(cluster *data.Cluster, origins map[string]*data.Node) (string, error) {
+	var toPlaceholders []string
+	var fromPlaceholders []string
+
+	nodes := make([]*data.Node, len(cluster.Nodes))
+	copy(nodes, cluster.Nodes)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+
+	for _, n := range nodes {
+		origin, ok := origins[n.Name]
+		if !ok {
+			return "", errors.Errorf("original node of node (%s) not found", n.Name)
+		}
+
+		if origin.Address() == "" || n.Address() == "" {
+			return "", errors.Errorf("address of node (%s) or original node (%s) unknown", n.Name, origin.Name)
+		}
+
+		replacements := [][]string{
+			{origin.Name, n.Name},
+			{origin.Address(), n.Address()},
+		}
+
+		for _, r := range replacements {
+			placeholder := fmt.Sprintf("@KUBEFIRE_REKEY_%d@", len(toPlaceholders))
+
+			toPlaceholders = append(toPlaceholders, fmt.Sprintf(`s/\b%s\b/%s/g`, strings.ReplaceAll(r[0], ".", `\.`), placeholder))
+			fromPlaceholders = append(fromPlaceholders, fmt.Sprintf(`s/%s/%s/g`, placeholder, r[1]))
+		}
+	}
+
+	return strings.Join(append(toPlaceholders, fromPlaceholders...), ";"), nil
+}
+
+// rekeyNodeCmds returns the commands renaming the host of the node, and replacing the names and addresses of the
+// original nodes in the existing files.
+func rekeyNodeCmds(n *data.Node, script string, files []string) []string {
+	return []string{
+		fmt.Sprintf("echo %s > /etc/hostname", n.Name),
+		fmt.Sprintf("hostname %s", n.Name),
+		fmt.Sprintf(`for f in %s; do if [ -f "$f" ]; then sed -i '%s' "$f"; fi; done`, strings.Join(files, " "), script),
+	}
+}
+
+// runNodeCommands runs the commands on the node in order. The node may be still booting, so the connection is retried.
+func runNodeCommands(ctx context.Context, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, n *data.Node, cmds ...string) error {
+	logrus.WithField("node", n.Name).Infoln("re-keying node")
+
+	var sshClient utilssh.Commander
+
+	err := retry.Do(func() error {
+		var err error
+
+		sshClient, err = sshClientFactory(ctx,
+			n.Name,
+			cluster.Spec.Prikey,
+			"root",
+			n.Address(),
+			nil,
+		)
+
+		return err
+	},
+		retry.Context(ctx),
+		retry.Delay(10*time.Second),
+		retry.MaxDelay(1*time.Minute),
+	)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+
+	if err := sshClient.Run(nil, nil, cmds...); err != nil {
+		return errors.WithMessagef(err, "failed on node (%s)", n.Name)
+	}
+
+	return nil
+}
+
+func waitAPIServer(ctx context.Context, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, firstMaster *data.Node, kubectl string) error {
+	logrus.WithField("cluster", cluster.Name).Infoln("waiting API server ready")
+
+	return retry.Do(func() error {
+		_, err := runNodeCommand(ctx, sshClientFactory, cluster, firstMaster, fmt.Sprintf("%s get --raw=/readyz", kubectl))
+		return err
+	},
+		retry.Context(ctx),
+		retry.Attempts(30),
+		retry.Delay(10*time.Second),
+		retry.DelayType(retry.FixedDelay),
+	)
+}
+
+// deleteOriginNodes deletes the original nodes from the cloned cluster, because the cloned nodes are registered with the
+// new names. The pods of the original nodes are rescheduled to the cloned nodes then.
+func deleteOriginNodes(ctx context.Context, sshClientFactory utilssh.ClientFactory, cluster *data.Cluster, firstMaster *data.Node, kubectl string, origins map[string]*data.Node) error {
+	var names []string
+
+	for _, n := range cluster.Nodes {
+		if origin, ok := origins[n.Name]; ok && origin.Name != n.Name {
+			names = append(names, origin.Name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	sort.Strings(names)
+
+	logrus.WithField("cluster", cluster.Name).Infof("deleting original nodes (%s) from cluster", strings.Join(names, ", "))
+
+	_, err := runNodeCommand(ctx, sshClientFactory, cluster, firstMaster, fmt.Sprintf("%s delete node %s --ignore-not-found", kubectl, strings.Join(names, " ")))
+
+	return err
+}
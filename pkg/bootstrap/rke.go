@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"github.com/goccy/go-yaml"
 	"github.com/innobead/kubefire/internal/config"
+	interr "github.com/innobead/kubefire/internal/error"
 	pkgconfig "github.com/innobead/kubefire/pkg/config"
 	"github.com/innobead/kubefire/pkg/constants"
 	"github.com/innobead/kubefire/pkg/data"
 	"github.com/innobead/kubefire/pkg/node"
 	"github.com/innobead/kubefire/pkg/script"
 	"github.com/innobead/kubefire/pkg/util"
+	utilssh "github.com/innobead/kubefire/pkg/util/ssh"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"io"
@@ -28,18 +30,25 @@ type RKEExtraOptions struct {
 }
 
 type RKEBootstrapper struct {
-	nodeManager node.Manager
+	nodeManager      node.Manager
+	sshClientFactory utilssh.ClientFactory
 }
 
 func NewRKEBootstrapper() *RKEBootstrapper {
-	return &RKEBootstrapper{}
+	return &RKEBootstrapper{
+		sshClientFactory: utilssh.DefaultClientFactory,
+	}
 }
 
 func (k *RKEBootstrapper) SetNodeManager(nodeManager node.Manager) {
 	k.nodeManager = nodeManager
 }
 
-func (k *RKEBootstrapper) Deploy(cluster *data.Cluster, before func() error) error {
+func (k *RKEBootstrapper) SetSSHClientFactory(factory utilssh.ClientFactory) {
+	k.sshClientFactory = factory
+}
+
+func (k *RKEBootstrapper) Deploy(ctx context.Context, cluster *data.Cluster, before func() error) error {
 	if before != nil {
 		if err := before(); err != nil {
 			return err
@@ -51,26 +60,46 @@ func (k *RKEBootstrapper) Deploy(cluster *data.Cluster, before func() error) err
 		return err
 	}
 
-	if err := k.nodeManager.WaitNodesRunning(cluster.Name, 5); err != nil {
+	if err := k.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
 		return errors.WithMessage(err, "some nodes are not running")
 	}
 
-	if err := k.init(cluster, &extraOptions); err != nil {
+	if err := k.init(ctx, cluster, &extraOptions); err != nil {
 		return err
 	}
 
-	firstMaster, err := k.nodeManager.GetNode(node.Name(cluster.Name, node.Master, 1))
+	firstMaster, err := k.nodeManager.GetNode(ctx, node.Name(cluster.Name, node.Master, 1))
 	if err != nil {
 		return err
 	}
-	if _, err := k.bootstrap(firstMaster, &extraOptions); err != nil {
+	if _, err := k.bootstrap(ctx, firstMaster, &extraOptions); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (k *RKEBootstrapper) DownloadKubeConfig(cluster *data.Cluster, destDir string) (string, error) {
+func (k *RKEBootstrapper) JoinNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	return errors.WithMessagef(interr.BootstrapperNotSupportError, "joining nodes to %s cluster", k.Type())
+}
+
+func (k *RKEBootstrapper) RemoveNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	return errors.WithMessagef(interr.BootstrapperNotSupportError, "removing nodes from %s cluster", k.Type())
+}
+
+func (k *RKEBootstrapper) DrainNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return errors.WithMessagef(interr.BootstrapperNotSupportError, "draining nodes of %s cluster", k.Type())
+}
+
+func (k *RKEBootstrapper) UncordonNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return errors.WithMessagef(interr.BootstrapperNotSupportError, "uncordoning nodes of %s cluster", k.Type())
+}
+
+func (k *RKEBootstrapper) Rekey(ctx context.Context, cluster *data.Cluster, origins map[string]*data.Node) error {
+	return errors.WithMessagef(interr.BootstrapperNotSupportError, "re-keying nodes of %s cluster", k.Type())
+}
+
+func (k *RKEBootstrapper) DownloadKubeConfig(ctx context.Context, cluster *data.Cluster, destDir string) (string, error) {
 	downloadedKubeConfigPath := filepath.Join(cluster.Spec.LocalClusterDir(), "kube_config_cluster.rke.yaml")
 
 	srcFile, err := os.Open(downloadedKubeConfigPath)
@@ -95,15 +124,15 @@ func (k *RKEBootstrapper) DownloadKubeConfig(cluster *data.Cluster, destDir stri
 	return destPath, nil
 }
 
-func (k *RKEBootstrapper) Prepare(cluster *data.Cluster, force bool) error {
-	return k.installRKEExecutables(cluster.Spec.Version, force)
+func (k *RKEBootstrapper) Prepare(ctx context.Context, cluster *data.Cluster, force bool) error {
+	return k.installRKEExecutables(ctx, cluster.Spec.Version, force)
 }
 
 func (k *RKEBootstrapper) Type() string {
 	return constants.RKE
 }
 
-func (k *RKEBootstrapper) init(cluster *data.Cluster, extraOptions *RKEExtraOptions) error {
+func (k *RKEBootstrapper) init(ctx context.Context, cluster *data.Cluster, extraOptions *RKEExtraOptions) error {
 	cmds := []string{
 		"swapoff -a",
 		fmt.Sprintf("curl -sfSLO %s", script.RemoteScriptUrl(script.InstallPrerequisitesRKE)),
@@ -111,7 +140,7 @@ func (k *RKEBootstrapper) init(cluster *data.Cluster, extraOptions *RKEExtraOpti
 		fmt.Sprintf("./%s node", script.InstallPrerequisitesRKE),
 	}
 
-	if err := initNodes(cluster, cmds); err != nil {
+	if err := initNodes(ctx, k.sshClientFactory, cluster, cmds); err != nil {
 		return err
 	}
 
@@ -131,7 +160,7 @@ func (k *RKEBootstrapper) init(cluster *data.Cluster, extraOptions *RKEExtraOpti
 	var nodes []Node
 	for _, n := range cluster.Nodes {
 		var node = Node{
-			Address:    n.Status.IPAddresses,
+			Address:    n.Address(),
 			User:       "root",
 			SshKeyPath: cluster.Spec.Prikey,
 			Port:       22,
@@ -172,7 +201,7 @@ func (k *RKEBootstrapper) init(cluster *data.Cluster, extraOptions *RKEExtraOpti
 	return nil
 }
 
-func (k *RKEBootstrapper) bootstrap(node *data.Node, extraOptions *RKEExtraOptions) (token string, err error) {
+func (k *RKEBootstrapper) bootstrap(ctx context.Context, node *data.Node, extraOptions *RKEExtraOptions) (token string, err error) {
 	cluster := node.Spec.Cluster
 	configPath := k.clusterConfigPath(cluster)
 
@@ -187,8 +216,8 @@ func (k *RKEBootstrapper) bootstrap(node *data.Node, extraOptions *RKEExtraOptio
 	cmdArgs := strings.Split(cmdline, " ")
 
 	cmd := util.UpdateCommandDefaultLogWithInfo(
-		exec.CommandContext(
-			context.Background(),
+		util.CommandContext(
+			ctx,
 			cmdArgs[0],
 			cmdArgs[1:]...,
 		),
@@ -202,7 +231,7 @@ func (k *RKEBootstrapper) bootstrap(node *data.Node, extraOptions *RKEExtraOptio
 	return "", nil
 }
 
-func (k *RKEBootstrapper) installRKEExecutables(version string, force bool) error {
+func (k *RKEBootstrapper) installRKEExecutables(ctx context.Context, version string, force bool) error {
 	scripts := []script.Type{
 		script.InstallPrerequisitesRKE,
 	}
@@ -212,7 +241,7 @@ func (k *RKEBootstrapper) installRKEExecutables(version string, force bool) erro
 			return err
 		}
 
-		if err := script.Run(s, config.TagVersion, func(cmd *exec.Cmd) error {
+		if err := script.Run(ctx, s, config.TagVersion, func(cmd *exec.Cmd) error {
 			cmd.Env = append(
 				cmd.Env,
 				config.RKEVersionsEnvVars(version)...,
@@ -1,6 +1,7 @@
 package bootstrap
 
 import (
+	"context"
 	"fmt"
 	"github.com/goccy/go-yaml"
 	"github.com/innobead/kubefire/internal/config"
@@ -12,10 +13,14 @@ import (
 	utilssh "github.com/innobead/kubefire/pkg/util/ssh"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"reflect"
+	"github.com/thoas/go-funk"
 	"strings"
 )
 
+const rke2Kubectl = "/var/lib/rancher/rke2/bin/kubectl --kubeconfig /etc/rancher/rke2/rke2.yaml"
+
+var rke2ListOptions = []string{"node-label", "node-taint"}
+
 type RKE2ExtraOptions struct {
 	ServerInstallOptions []string `json:"server_install_options"`
 	AgentInstallOptions  []string `json:"agent_install_options"`
@@ -23,18 +28,25 @@ type RKE2ExtraOptions struct {
 }
 
 type RKE2Bootstrapper struct {
-	nodeManager node.Manager
+	nodeManager      node.Manager
+	sshClientFactory utilssh.ClientFactory
 }
 
 func NewRKE2Bootstrapper() *RKE2Bootstrapper {
-	return &RKE2Bootstrapper{}
+	return &RKE2Bootstrapper{
+		sshClientFactory: utilssh.DefaultClientFactory,
+	}
 }
 
 func (r *RKE2Bootstrapper) SetNodeManager(nodeManager node.Manager) {
 	r.nodeManager = nodeManager
 }
 
-func (r *RKE2Bootstrapper) Deploy(cluster *data.Cluster, before func() error) error {
+func (r *RKE2Bootstrapper) SetSSHClientFactory(factory utilssh.ClientFactory) {
+	r.sshClientFactory = factory
+}
+
+func (r *RKE2Bootstrapper) Deploy(ctx context.Context, cluster *data.Cluster, before func() error) error {
 	if before != nil {
 		if err := before(); err != nil {
 			return err
@@ -48,27 +60,27 @@ func (r *RKE2Bootstrapper) Deploy(cluster *data.Cluster, before func() error) er
 		return err
 	}
 
-	if err := r.nodeManager.WaitNodesRunning(cluster.Name, 5); err != nil {
+	if err := r.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
 		return errors.WithMessage(err, "some nodes are not running")
 	}
 
-	if err := r.init(cluster); err != nil {
+	if err := r.init(ctx, cluster); err != nil {
 		return err
 	}
 
-	firstMaster, err := r.nodeManager.GetNode(node.Name(cluster.Name, node.Master, 1))
+	firstMaster, err := r.nodeManager.GetNode(ctx, node.Name(cluster.Name, node.Master, 1))
 	if err != nil {
 		return err
 	}
 
 	firstMaster.Spec.Cluster = &cluster.Spec
 
-	joinToken, err := r.bootstrap(firstMaster, len(cluster.Nodes) == 1, &extraOptions)
+	joinToken, err := r.bootstrap(ctx, firstMaster, len(cluster.Nodes) == 1, &extraOptions)
 	if err != nil {
 		return err
 	}
 
-	nodes, err := r.nodeManager.ListNodes(cluster.Name)
+	nodes, err := r.nodeManager.ListNodes(ctx, cluster.Name)
 	if err != nil {
 		return err
 	}
@@ -83,19 +95,82 @@ func (r *RKE2Bootstrapper) Deploy(cluster *data.Cluster, before func() error) er
 		}
 		n.Spec.Cluster = &cluster.Spec
 
-		if err := r.join(n, firstMaster.Status.IPAddresses, joinToken, &extraOptions); err != nil {
+		if err := r.join(ctx, n, firstMaster.Address(), joinToken, &extraOptions); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return applyNodeLabelsTaints(ctx, r.nodeManager, r.sshClientFactory, cluster, rke2Kubectl, nodes)
 }
 
-func (r *RKE2Bootstrapper) DownloadKubeConfig(cluster *data.Cluster, destDir string) (string, error) {
-	return downloadKubeConfig(r.nodeManager, cluster, "/etc/rancher/rke2/rke2.yaml", destDir)
+func (r *RKE2Bootstrapper) JoinNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	extraOptions := RKE2ExtraOptions{
+		ExtraOptions: config.RKE2VersionsEnvVars(cluster.Spec.Version, ""),
+	}
+	if err := cluster.Spec.ParseExtraOptions(&extraOptions); err != nil {
+		return err
+	}
+
+	if err := r.nodeManager.WaitNodesRunning(ctx, cluster.Name, nodesRunningTimeout); err != nil {
+		return errors.WithMessage(err, "some nodes are not running")
+	}
+
+	if err := r.init(ctx, clusterWithNodes(cluster, nodes)); err != nil {
+		return err
+	}
+
+	firstMaster, err := getFirstMaster(ctx, r.nodeManager, cluster)
+	if err != nil {
+		return err
+	}
+
+	joinToken, err := runNodeCommand(ctx, r.sshClientFactory, cluster, firstMaster, "cat /var/lib/rancher/rke2/server/node-token")
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		n.Spec.Cluster = &cluster.Spec
+
+		if err := r.join(ctx, n, firstMaster.Address(), joinToken, &extraOptions); err != nil {
+			return err
+		}
+	}
+
+	return applyNodeLabelsTaints(ctx, r.nodeManager, r.sshClientFactory, cluster, rke2Kubectl, nodes)
+}
+
+func (r *RKE2Bootstrapper) RemoveNodes(ctx context.Context, cluster *data.Cluster, nodes []*data.Node) error {
+	return removeNodes(ctx, r.nodeManager, r.sshClientFactory, cluster, rke2Kubectl, nodes)
+}
+
+func (r *RKE2Bootstrapper) DrainNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return drainNode(ctx, r.nodeManager, r.sshClientFactory, cluster, rke2Kubectl, n)
 }
 
-func (r *RKE2Bootstrapper) Prepare(cluster *data.Cluster, force bool) error {
+func (r *RKE2Bootstrapper) UncordonNode(ctx context.Context, cluster *data.Cluster, n *data.Node) error {
+	return uncordonNode(ctx, r.nodeManager, r.sshClientFactory, cluster, rke2Kubectl, n)
+}
+
+func (r *RKE2Bootstrapper) Rekey(ctx context.Context, cluster *data.Cluster, origins map[string]*data.Node) error {
+	return rekeyNodes(ctx, r.nodeManager, r.sshClientFactory, cluster, origins, &rekeyServices{
+		kubectl: rke2Kubectl,
+		files: []string{
+			"/etc/hosts",
+			"/etc/rancher/rke2/config.yaml",
+		},
+		server:  "rke2-server",
+		agent:   "rke2-agent",
+		etcdDir: "/var/lib/rancher/rke2/server/db/etcd",
+		reset:   "rke2 server --cluster-reset",
+	})
+}
+
+func (r *RKE2Bootstrapper) DownloadKubeConfig(ctx context.Context, cluster *data.Cluster, destDir string) (string, error) {
+	return downloadKubeConfig(ctx, r.nodeManager, r.sshClientFactory, cluster, "/etc/rancher/rke2/rke2.yaml", destDir)
+}
+
+func (r *RKE2Bootstrapper) Prepare(ctx context.Context, cluster *data.Cluster, force bool) error {
 	return nil
 }
 
@@ -103,7 +178,7 @@ func (r *RKE2Bootstrapper) Type() string {
 	return constants.RKE2
 }
 
-func (r *RKE2Bootstrapper) init(cluster *data.Cluster) error {
+func (r *RKE2Bootstrapper) init(ctx context.Context, cluster *data.Cluster) error {
 	cmds := []string{
 		"swapoff -a",
 		fmt.Sprintf("curl -sfSLO %s", script.RemoteScriptUrl(script.InstallPrerequisitesRKE2)),
@@ -111,17 +186,17 @@ func (r *RKE2Bootstrapper) init(cluster *data.Cluster) error {
 		fmt.Sprintf("%s ./%s install_rke2", config.RKE2VersionsEnvVars(cluster.Spec.Version, "").String(), script.InstallPrerequisitesRKE2),
 	}
 
-	return initNodes(cluster, cmds)
+	return initNodes(ctx, r.sshClientFactory, cluster, cmds)
 }
 
-func (r *RKE2Bootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOptions *RKE2ExtraOptions) (token string, err error) {
+func (r *RKE2Bootstrapper) bootstrap(ctx context.Context, node *data.Node, isSingleNode bool, extraOptions *RKE2ExtraOptions) (token string, err error) {
 	logrus.WithField("node", node.Name).Infoln("bootstrapping the first master node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := r.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
@@ -132,9 +207,10 @@ func (r *RKE2Bootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOp
 	joinToken := util.GenerateRandomStr(8)
 	deployCmdOpts := []string{
 		fmt.Sprintf(`--node-name="%s"`, node.Name),
-		fmt.Sprintf("--bind-address=%s", node.Status.IPAddresses),
+		fmt.Sprintf("--bind-address=%s", node.Address()),
 		fmt.Sprintf("--token=%s", joinToken),
 	}
+	deployCmdOpts = append(deployCmdOpts, rke2NodeLabelTaintOptions(node)...)
 
 	if extraOptions.ServerInstallOptions != nil {
 		deployCmdOpts = append(deployCmdOpts, extraOptions.ServerInstallOptions...)
@@ -180,14 +256,14 @@ func (r *RKE2Bootstrapper) bootstrap(node *data.Node, isSingleNode bool, extraOp
 	return strings.TrimSuffix(joinToken, "\n"), nil
 }
 
-func (r *RKE2Bootstrapper) join(node *data.Node, apiServerAddress string, joinToken string, extraOptions *RKE2ExtraOptions) error {
+func (r *RKE2Bootstrapper) join(ctx context.Context, node *data.Node, apiServerAddress string, joinToken string, extraOptions *RKE2ExtraOptions) error {
 	logrus.WithField("node", node.Name).Infoln("joining node")
 
-	sshClient, err := utilssh.NewClient(
+	sshClient, err := r.sshClientFactory(ctx,
 		node.Name,
 		node.Spec.Cluster.Prikey,
 		"root",
-		node.Status.IPAddresses,
+		node.Address(),
 		nil,
 	)
 	if err != nil {
@@ -200,6 +276,8 @@ func (r *RKE2Bootstrapper) join(node *data.Node, apiServerAddress string, joinTo
 		fmt.Sprintf("--server=https://%s:9345", apiServerAddress),
 		fmt.Sprintf("--token=%s", joinToken),
 	}
+	deployCmdOpts = append(deployCmdOpts, rke2NodeLabelTaintOptions(node)...)
+
 	cmd := "INSTALL_RKE2_TYPE=server rke2-install.sh"
 	systemdService := "rke2-server.service"
 
@@ -256,6 +334,22 @@ func (r *RKE2Bootstrapper) join(node *data.Node, apiServerAddress string, joinTo
 	return nil
 }
 
+func rke2NodeLabelTaintOptions(node *data.Node) []string {
+	var options []string
+
+	labels, taints := nativeNodeLabelsTaints(node)
+
+	for _, l := range labels {
+		options = append(options, fmt.Sprintf("--node-label=%s", l))
+	}
+
+	for _, t := range taints {
+		options = append(options, fmt.Sprintf("--node-taint=%s", t))
+	}
+
+	return options
+}
+
 func createRKE2Config(options []string) (string, error) {
 	cfg := map[string]interface{}{}
 
@@ -267,16 +361,19 @@ func createRKE2Config(options []string) (string, error) {
 			return "", errors.New(fmt.Sprintf("ignored the invalid option, %s", str))
 		}
 
-		if _, exist := cfg[opt[0]]; exist {
-			switch reflect.TypeOf(cfg[opt[0]]).Kind() {
-			case reflect.Slice, reflect.Array:
-				cfg[opt[0]] = append(cfg[opt[0]].([]interface{}), opt[1])
-			default:
+		// the repeated options are merged as a list, and the list options are always configured as lists
+		switch value := cfg[opt[0]].(type) {
+		case nil:
+			if funk.ContainsString(rke2ListOptions, opt[0]) {
 				cfg[opt[0]] = []interface{}{opt[1]}
+			} else {
+				cfg[opt[0]] = opt[1]
 			}
+		case []interface{}:
+			cfg[opt[0]] = append(value, opt[1])
+		default:
+			cfg[opt[0]] = []interface{}{value, opt[1]}
 		}
-
-		cfg[opt[0]] = opt[1]
 	}
 
 	if len(cfg) == 0 {
@@ -3,19 +3,38 @@ package cache
 import (
 	pkgconfig "github.com/innobead/kubefire/pkg/config"
 	"github.com/innobead/kubefire/pkg/node"
+	"github.com/innobead/kubefire/pkg/util"
+	"time"
 )
 
 type Type string
 type Path string
 type Value []byte
+type Size int64
 
 type Cache struct {
 	Type        Type
 	Path        Path
 	Value       Value
+	Size        Size
+	LastUsed    time.Time
+	InUse       bool // used by the existing nodes, which can not be deleted
+	Pinned      bool // pinned by 'kubefire image pin', which can not be deleted
 	Description string
 }
 
+// Types are the cache types which can be deleted.
+var Types = []Type{
+	BootstrapperCacheType,
+	BinCacheType,
+	NodeImageCacheType,
+	NodeKernelCacheType,
+}
+
+func (s Size) String() string {
+	return util.FormatSize(int64(s))
+}
+
 type Manager interface {
 	Create(t Type, path Path, value Value) error
 	Update(t Type, path Path, value Value) error
@@ -23,6 +42,7 @@ type Manager interface {
 	List(t Type, withValue bool) ([]*Cache, error)
 	ListAll(withValue bool) ([]*Cache, error)
 	Delete(t Type) error
+	DeletePath(t Type, path Path) error
 	DeleteAll() error
 }
 
@@ -81,13 +81,16 @@ func (l *LocalManager) Get(t Type, path Path, withValue bool) (*Cache, error) {
 		file = l.pathFile(t, path, true)
 	}
 
-	if _, err := os.Stat(file); os.IsNotExist(err) {
+	info, err := os.Stat(file)
+	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	cache := &Cache{
 		Type:        t,
 		Path:        path,
+		Size:        Size(info.Size()),
+		LastUsed:    info.ModTime(),
 		Description: "",
 	}
 
@@ -162,6 +165,17 @@ func (l *LocalManager) Delete(t Type) error {
 	return os.RemoveAll(dir)
 }
 
+func (l *LocalManager) DeletePath(t Type, path Path) error {
+	file := string(path)
+	if !filepath.IsAbs(file) {
+		file = l.pathFile(t, path, false)
+	}
+
+	logrus.Infof("Delete local cache %s\n", file)
+
+	return errors.WithStack(os.Remove(file))
+}
+
 func (l *LocalManager) DeleteAll() error {
 	for _, t := range []Type{BootstrapperCacheType, BinCacheType} {
 		err := l.Delete(t)
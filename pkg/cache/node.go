@@ -1,42 +1,92 @@
 package cache
 
 import (
+	"context"
+	"github.com/goccy/go-yaml"
+	"github.com/hashicorp/go-multierror"
+	interr "github.com/innobead/kubefire/internal/error"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
 	"github.com/innobead/kubefire/pkg/node"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/thoas/go-funk"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 const (
-	NodeCacheType Type = "node"
+	NodeImageCacheType  Type = "image"
+	NodeKernelCacheType Type = "kernel"
 )
 
+// NodeCache is the rootfs and kernel images cached by the node backend. The path of the cache is the image name, and
+// the value is never loaded, because the images are large. The images used by the existing nodes or pinned are never
+// deleted.
 type NodeCache struct {
 	nodeManager node.Manager
+	pinFile     string
 }
 
-func NewNodeCache(nodeManager node.Manager) Manager {
+// pins are the names of the pinned images mapped by the cache types.
+type pins map[Type][]Path
+
+func NewNodeCache(nodeManager node.Manager) *NodeCache {
 	return &NodeCache{
 		nodeManager: nodeManager,
+		pinFile:     filepath.Join(pkgconfig.RootDir, "pinned-images.yaml"),
 	}
 }
 
+// Create pulls the image of the path, and the value is ignored.
 func (n *NodeCache) Create(t Type, path Path, value Value) error {
-	panic("implement me")
+	_, err := n.Pull(context.Background(), t, string(path))
+	return err
 }
 
 func (n *NodeCache) Update(t Type, path Path, value Value) error {
-	panic("implement me")
+	return n.Create(t, path, value)
 }
 
 func (n *NodeCache) Get(t Type, path Path, withValue bool) (*Cache, error) {
-	panic("implement me")
+	caches, err := n.List(t, withValue)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range caches {
+		if c.Path == path {
+			return c, nil
+		}
+	}
+
+	return nil, errors.WithMessagef(interr.NotFoundError, "%s cache (%s)", t, path)
 }
 
 func (n *NodeCache) List(t Type, withValue bool) ([]*Cache, error) {
-	panic("implement me")
+	caches, err := n.ListAll(withValue)
+	if err != nil {
+		return nil, err
+	}
+
+	var typeCaches []*Cache
+
+	for _, c := range caches {
+		if c.Type == t {
+			typeCaches = append(typeCaches, c)
+		}
+	}
+
+	return typeCaches, nil
 }
 
 func (n *NodeCache) ListAll(withValue bool) ([]*Cache, error) {
-	nodeCaches, err := n.nodeManager.GetCaches()
+	nodeCaches, err := n.nodeManager.GetCaches(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	pins, err := n.loadPins()
 	if err != nil {
 		return nil, err
 	}
@@ -44,30 +94,177 @@ func (n *NodeCache) ListAll(withValue bool) ([]*Cache, error) {
 	var caches []*Cache
 
 	for _, nc := range nodeCaches {
-		cache := &Cache{}
+		var cache *Cache
 
 		switch nc := nc.(type) {
 		case *node.IgniteCache:
-			cache.Type = NodeCacheType
-			cache.Path = Path(nc.Name)
-			cache.Description = nc.Description
+			cache = &Cache{
+				Type:        Type(nc.Type),
+				Path:        Path(nc.Name),
+				Size:        Size(nc.Size),
+				LastUsed:    nc.LastUsed,
+				InUse:       nc.InUse,
+				Description: nc.Description,
+			}
+
+		case *node.MicroVMCache:
+			cache = &Cache{
+				Type:        Type(nc.Type),
+				Path:        Path(nc.Name),
+				Size:        Size(nc.Size),
+				LastUsed:    nc.LastUsed,
+				InUse:       nc.InUse,
+				Description: nc.Description,
+			}
 
 		default:
 			continue
 		}
 
+		cache.Pinned = funk.Contains(pins[cache.Type], cache.Path)
 		caches = append(caches, cache)
 	}
 
 	return caches, nil
 }
 
+// Delete deletes the caches of the type except the caches in use or pinned.
 func (n *NodeCache) Delete(t Type) error {
-	panic("implement me")
+	caches, err := n.List(t, false)
+	if err != nil {
+		return err
+	}
+
+	var result error
+
+	for _, c := range caches {
+		if c.InUse || c.Pinned {
+			logrus.WithFields(logrus.Fields{
+				string(t): c.Path,
+				"in-use":  c.InUse,
+				"pinned":  c.Pinned,
+			}).Infoln("skipped deleting node cache")
+			continue
+		}
+
+		if err := n.DeletePath(c.Type, c.Path); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return result
+}
+
+func (n *NodeCache) DeletePath(t Type, path Path) error {
+	pins, err := n.loadPins()
+	if err != nil {
+		return err
+	}
+
+	if funk.Contains(pins[t], path) {
+		return errors.WithMessagef(interr.CachePinnedError, "%s (%s)", t, path)
+	}
+
+	return n.nodeManager.DeleteCache(context.Background(), string(t), string(path))
 }
 
 func (n *NodeCache) DeleteAll() error {
 	logrus.Infof("Delete node caches\n")
 
-	return n.nodeManager.DeleteCaches()
+	var result error
+
+	for _, t := range []Type{NodeImageCacheType, NodeKernelCacheType} {
+		if err := n.Delete(t); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return result
+}
+
+// Pull pulls the rootfs or kernel image to the caches, and returns the cache of the image. The image is pulled only once,
+// so pulling the cached image only updates the last used time.
+func (n *NodeCache) Pull(ctx context.Context, t Type, image string) (*Cache, error) {
+	if t != NodeImageCacheType && t != NodeKernelCacheType {
+		return nil, errors.Errorf("invalid node cache type (%s)", t)
+	}
+
+	name, err := n.nodeManager.PullImage(ctx, string(t), image)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "failed to pull %s (%s)", t, image)
+	}
+
+	return n.Get(t, Path(name), false)
+}
+
+// Pin pins the cached image, so it is not deleted until it is unpinned.
+func (n *NodeCache) Pin(t Type, path Path) error {
+	if _, err := n.Get(t, path, false); err != nil {
+		return err
+	}
+
+	pins, err := n.loadPins()
+	if err != nil {
+		return err
+	}
+
+	if funk.Contains(pins[t], path) {
+		return nil
+	}
+
+	pins[t] = append(pins[t], path)
+
+	return n.savePins(pins)
+}
+
+// Unpin unpins the image, which is not required to be cached.
+func (n *NodeCache) Unpin(t Type, path Path) error {
+	pins, err := n.loadPins()
+	if err != nil {
+		return err
+	}
+
+	var paths []Path
+
+	for _, p := range pins[t] {
+		if p != path {
+			paths = append(paths, p)
+		}
+	}
+
+	if len(paths) == len(pins[t]) {
+		return errors.WithMessagef(interr.NotFoundError, "pinned %s (%s)", t, path)
+	}
+
+	pins[t] = paths
+
+	return n.savePins(pins)
+}
+
+func (n *NodeCache) loadPins() (pins, error) {
+	p := pins{}
+
+	bytes, err := ioutil.ReadFile(n.pinFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	if err := yaml.Unmarshal(bytes, &p); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return p, nil
+}
+
+func (n *NodeCache) savePins(p pins) error {
+	bytes, err := yaml.Marshal(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(n.pinFile, bytes, 0644))
 }
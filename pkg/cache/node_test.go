@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	interr "github.com/innobead/kubefire/internal/error"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func newFakeNodeCache(t *testing.T) *NodeCache {
+	nodeManager := node.NewFakeNodeManager()
+	nodeManager.SetCaches(
+		&node.MicroVMCache{Type: "image", Name: "image-1", Size: 1 << 30, InUse: true},
+		&node.MicroVMCache{Type: "image", Name: "image-2", Size: 1 << 30},
+		&node.MicroVMCache{Type: "kernel", Name: "kernel-1", Size: 50 << 20, InUse: true},
+		&node.MicroVMCache{Type: "kernel", Name: "kernel-2", Size: 50 << 20},
+	)
+
+	manager := NewNodeCache(nodeManager)
+	manager.pinFile = filepath.Join(t.TempDir(), "pinned-images.yaml")
+
+	return manager
+}
+
+func cachePaths(caches []*Cache) []Path {
+	var paths []Path
+
+	for _, c := range caches {
+		paths = append(paths, c.Path)
+	}
+
+	return paths
+}
+
+func TestNodeCache_List(t *testing.T) {
+	manager := newFakeNodeCache(t)
+
+	caches, err := manager.ListAll(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []Path{"image-1", "image-2", "kernel-1", "kernel-2"}, cachePaths(caches))
+	assert.True(t, caches[0].InUse)
+	assert.Equal(t, "1GB", caches[0].Size.String())
+
+	caches, err = manager.List(NodeKernelCacheType, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []Path{"kernel-1", "kernel-2"}, cachePaths(caches))
+
+	cache, err := manager.Get(NodeImageCacheType, "image-2", false)
+	assert.NoError(t, err)
+	assert.False(t, cache.InUse)
+
+	_, err = manager.Get(NodeImageCacheType, "kernel-1", false)
+	assert.True(t, errors.Is(err, interr.NotFoundError))
+}
+
+func TestNodeCache_Delete(t *testing.T) {
+	tests := []struct {
+		name    string
+		delete  func(manager *NodeCache) error
+		want    []Path
+		wantErr error
+	}{
+		{
+			name:   "delete all",
+			delete: func(manager *NodeCache) error { return manager.DeleteAll() },
+			want:   []Path{"image-1", "kernel-1"},
+		},
+		{
+			name:   "delete type",
+			delete: func(manager *NodeCache) error { return manager.Delete(NodeImageCacheType) },
+			want:   []Path{"image-1", "kernel-1", "kernel-2"},
+		},
+		{
+			name:   "delete path",
+			delete: func(manager *NodeCache) error { return manager.DeletePath(NodeKernelCacheType, "kernel-2") },
+			want:   []Path{"image-1", "image-2", "kernel-1"},
+		},
+		{
+			name: "delete all except pinned",
+			delete: func(manager *NodeCache) error {
+				if err := manager.Pin(NodeImageCacheType, "image-2"); err != nil {
+					return err
+				}
+
+				return manager.DeleteAll()
+			},
+			want: []Path{"image-1", "image-2", "kernel-1"},
+		},
+		{
+			name: "delete path pinned",
+			delete: func(manager *NodeCache) error {
+				if err := manager.Pin(NodeKernelCacheType, "kernel-2"); err != nil {
+					return err
+				}
+
+				return manager.DeletePath(NodeKernelCacheType, "kernel-2")
+			},
+			want:    []Path{"image-1", "image-2", "kernel-1", "kernel-2"},
+			wantErr: interr.CachePinnedError,
+		},
+		{
+			name:    "delete path in use",
+			delete:  func(manager *NodeCache) error { return manager.DeletePath(NodeImageCacheType, "image-1") },
+			want:    []Path{"image-1", "image-2", "kernel-1", "kernel-2"},
+			wantErr: interr.CacheInUseError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newFakeNodeCache(t)
+
+			err := tt.delete(manager)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			caches, err := manager.ListAll(false)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, cachePaths(caches))
+		})
+	}
+}
+
+func TestNodeCache_PullPin(t *testing.T) {
+	manager := newFakeNodeCache(t)
+
+	cache, err := manager.Pull(context.Background(), NodeImageCacheType, "image-3")
+	assert.NoError(t, err)
+	assert.Equal(t, Path("image-3"), cache.Path)
+	assert.False(t, cache.Pinned)
+
+	_, err = manager.Pull(context.Background(), "bin", "image-3")
+	assert.Error(t, err)
+
+	assert.NoError(t, manager.Pin(NodeImageCacheType, "image-3"))
+	assert.NoError(t, manager.Pin(NodeImageCacheType, "image-3"))
+	assert.True(t, errors.Is(manager.Pin(NodeImageCacheType, "image-4"), interr.NotFoundError))
+
+	cache, err = manager.Get(NodeImageCacheType, "image-3", false)
+	assert.NoError(t, err)
+	assert.True(t, cache.Pinned)
+
+	assert.NoError(t, manager.Unpin(NodeImageCacheType, "image-3"))
+	assert.True(t, errors.Is(manager.Unpin(NodeImageCacheType, "image-3"), interr.NotFoundError))
+	assert.NoError(t, manager.DeletePath(NodeImageCacheType, "image-3"))
+}
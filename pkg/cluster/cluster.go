@@ -1,32 +1,85 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
+	"github.com/hashicorp/go-multierror"
+	intconfig "github.com/innobead/kubefire/internal/config"
+	interr "github.com/innobead/kubefire/internal/error"
 	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/constants"
 	"github.com/innobead/kubefire/pkg/data"
 	"github.com/innobead/kubefire/pkg/node"
+	"github.com/innobead/kubefire/pkg/util"
+	utilssh "github.com/innobead/kubefire/pkg/util/ssh"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/thoas/go-funk"
+	"golang.org/x/crypto/ssh"
+	"io"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Manager interface {
 	Init(cluster *pkgconfig.Cluster) error
-	Create(name string, started bool) error
-	Delete(name string, force bool) error
-	Get(name string) (*data.Cluster, error)
-	List() ([]*data.Cluster, error)
+	Create(ctx context.Context, name string, opts CreateOptions) error
+	Delete(ctx context.Context, name string, force bool) error
+	AddNodes(ctx context.Context, name string, nodeType node.Type, pool string, count int, opts CreateOptions) ([]*data.Node, error)
+	DeleteNodes(ctx context.Context, name string, nodes []*data.Node) error
+	ResizeNodes(ctx context.Context, name string, nodes []*data.Node, spec *pkgconfig.Node, opts ResizeOptions) error
+	Snapshot(ctx context.Context, name string, snapshot string, memory bool) error
+	Restore(ctx context.Context, name string, snapshot string) error
+	Clone(ctx context.Context, src string, snapshot string, dst string) (map[string]*data.Node, error)
+	CheckAddresses(ctx context.Context, name string) (map[string]*data.Node, error)
+	RecordAddresses(ctx context.Context, name string) error
+	SyncNetworks(ctx context.Context) error
+	ExecNodes(ctx context.Context, name string, nodes []string, cmd string, stdout io.Writer, stderr io.Writer) error
+	CopyToNode(ctx context.Context, nodeName string, srcPath string, remotePath string) error
+	CopyFromNode(ctx context.Context, nodeName string, remotePath string, destPath string) error
+	Plan(ctx context.Context, cluster *pkgconfig.Cluster) (*Plan, error)
+	MarkNodesStopped(ctx context.Context, name string, nodeNames []string, stopped bool) error
+	Get(ctx context.Context, name string) (*data.Cluster, error)
+	List(ctx context.Context) ([]*data.Cluster, error)
 	GetNodeManager() node.Manager
 	GetConfigManager() pkgconfig.Manager
 }
 
+// CreateOptions are the options of creating the nodes. The nodes created are rolled back if any node fails to be
+// created after the retries, unless KeepOnFailure is set for troubleshooting.
+type CreateOptions struct {
+	Started       bool
+	Retries       int
+	KeepOnFailure bool
+}
+
+// nodeBatch is the nodes of the same node config created at once.
+type nodeBatch struct {
+	nodeType   node.Type
+	nodeConfig *pkgconfig.Node
+	indices    []int
+}
+
 type DefaultManager struct {
-	nodeManager   node.Manager
-	configManager pkgconfig.Manager
+	nodeManager      node.Manager
+	configManager    pkgconfig.Manager
+	sshClientFactory utilssh.ClientFactory
+	hostCapacity     func(dir string) (*util.HostCapacity, error)
+	// backendNodeManager creates the node manager of another node backend, which is used to count the nodes of all
+	// backends sharing the host.
+	backendNodeManager func(backend string) node.Manager
 }
 
 func NewDefaultManager() Manager {
-	return &DefaultManager{}
+	return &DefaultManager{
+		sshClientFactory:   utilssh.DefaultClientFactory,
+		hostCapacity:       util.GetHostCapacity,
+		backendNodeManager: node.New,
+	}
 }
 
 func (d *DefaultManager) SetNodeManager(nodeManager node.Manager) {
@@ -37,6 +90,10 @@ func (d *DefaultManager) SetConfigManager(configManager pkgconfig.Manager) {
 	d.configManager = configManager
 }
 
+func (d *DefaultManager) SetSSHClientFactory(factory utilssh.ClientFactory) {
+	d.sshClientFactory = factory
+}
+
 func (d *DefaultManager) Init(cluster *pkgconfig.Cluster) error {
 	logrus.WithField("cluster", cluster.Name).Infoln("initializing cluster configuration")
 	logrus.Debugf("%+v", cluster)
@@ -48,7 +105,7 @@ func (d *DefaultManager) Init(cluster *pkgconfig.Cluster) error {
 	return d.configManager.SaveCluster(cluster)
 }
 
-func (d *DefaultManager) Create(name string, started bool) error {
+func (d *DefaultManager) Create(ctx context.Context, name string, opts CreateOptions) error {
 	logrus.WithField("cluster", name).Infoln("creating cluster")
 
 	cluster, err := d.configManager.GetCluster(name)
@@ -56,24 +113,57 @@ func (d *DefaultManager) Create(name string, started bool) error {
 		return err
 	}
 
-	nodeTypeConfigs := map[node.Type]*pkgconfig.Node{
-		node.Master: &cluster.Master,
-		node.Worker: &cluster.Worker,
+	var names []string
+
+	for _, c := range cluster.NodeConfigs() {
+		for _, i := range node.Indices(c.Count) {
+			names = append(names, node.ConfigName(nodeConfigType(cluster, c), c, i))
+		}
 	}
-	for t, c := range nodeTypeConfigs {
+
+	if err := d.allocateAddresses(ctx, cluster, names); err != nil {
+		return err
+	}
+
+	if cluster.Network != nil {
+		if err := d.SyncNetworks(ctx); err != nil {
+			return err
+		}
+	}
+
+	var batches []nodeBatch
+
+	for _, c := range cluster.NodeConfigs() {
 		if c.Count == 0 {
 			continue
 		}
 
-		if err := d.nodeManager.CreateNodes(t, c, started); err != nil {
+		batches = append(batches, nodeBatch{nodeType: nodeConfigType(cluster, c), nodeConfig: c, indices: node.Indices(c.Count)})
+	}
+
+	if err := d.createNodes(ctx, batches, opts); err != nil {
+		if opts.KeepOnFailure {
 			return err
 		}
+
+		// the cluster is removed along with the nodes rolled back, so it can be created again
+		if err := d.configManager.DeleteCluster(cluster); err != nil {
+			logrus.WithField("cluster", name).WithError(err).Warnln("failed to delete cluster configuration")
+		}
+
+		if cluster.Network != nil {
+			if err := d.SyncNetworks(context.WithoutCancel(ctx)); err != nil {
+				logrus.WithField("cluster", name).WithError(err).Warnln("failed to delete cluster network")
+			}
+		}
+
+		return err
 	}
 
 	return nil
 }
 
-func (d *DefaultManager) Delete(name string, force bool) error {
+func (d *DefaultManager) Delete(ctx context.Context, name string, force bool) error {
 	logrus.WithFields(logrus.Fields{
 		"cluster": name,
 		"force":   force,
@@ -86,12 +176,8 @@ func (d *DefaultManager) Delete(name string, force bool) error {
 		}
 	}
 
-	nodeTypeConfigs := map[node.Type]*pkgconfig.Node{
-		node.Master: &cluster.Master,
-		node.Worker: &cluster.Worker,
-	}
-	for t, n := range nodeTypeConfigs {
-		if err := d.nodeManager.DeleteNodes(t, n); err != nil {
+	for _, n := range cluster.NodeConfigs() {
+		if err := d.nodeManager.DeleteNodes(ctx, nodeConfigType(cluster, n), n); err != nil {
 			if !force {
 				return err
 			}
@@ -104,10 +190,594 @@ func (d *DefaultManager) Delete(name string, force bool) error {
 		return err
 	}
 
+	if cluster.Network != nil {
+		if err := d.SyncNetworks(ctx); err != nil {
+			if !force {
+				return err
+			}
+
+			logrus.WithError(err).Warnln("failed to delete cluster network")
+		}
+	}
+
+	return nil
+}
+
+// AddNodes creates the nodes following the existing nodes of the node type and worker pool, and updates the node count
+// of the cluster config.
+func (d *DefaultManager) AddNodes(ctx context.Context, name string, nodeType node.Type, pool string, count int, opts CreateOptions) ([]*data.Node, error) {
+	logrus.WithFields(logrus.Fields{
+		"cluster": name,
+		"pool":    pool,
+		"count":   count,
+	}).Infof("adding %s nodes to cluster", nodeType)
+
+	cluster, err := d.configManager.GetCluster(name)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := d.nodeManager.ListNodes(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeConfig := cluster.NodeConfig(string(nodeType), pool)
+	if nodeConfig == nil {
+		return nil, errors.Errorf("worker pool (%s) not found", pool)
+	}
+
+	indices := node.NextIndices(nodes, nodeType, pool, count)
+
+	var names []string
+	for _, i := range indices {
+		names = append(names, node.ConfigName(nodeType, nodeConfig, i))
+	}
+
+	if err := d.allocateAddresses(ctx, cluster, names); err != nil {
+		return nil, err
+	}
+
+	createErr := d.createNodes(ctx, []nodeBatch{{nodeType: nodeType, nodeConfig: nodeConfig, indices: indices}}, opts)
+	if createErr != nil && !opts.KeepOnFailure {
+		return nil, createErr
+	}
+
+	var addedNodes []*data.Node
+
+	// the nodes kept on failure are counted as well, so they are managed along with the others
+	for _, i := range indices {
+		n, err := d.nodeManager.GetNode(ctx, node.ConfigName(nodeType, nodeConfig, i))
+		if err != nil {
+			if createErr == nil {
+				return nil, errors.WithMessagef(err, "failed to create %s node (%d)", nodeType, i)
+			}
+
+			continue
+		}
+
+		addedNodes = append(addedNodes, n)
+	}
+
+	nodeConfig.Count += len(addedNodes)
+
+	if err := d.configManager.SaveCluster(cluster); err != nil {
+		return addedNodes, err
+	}
+
+	return addedNodes, createErr
+}
+
+// DeleteNodes deletes the nodes of the cluster, and updates the node counts of the cluster config.
+func (d *DefaultManager) DeleteNodes(ctx context.Context, name string, nodes []*data.Node) error {
+	logrus.WithField("cluster", name).Infoln("deleting nodes of cluster")
+
+	cluster, err := d.configManager.GetCluster(name)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if err := d.nodeManager.DeleteNode(ctx, n.Name); err != nil {
+			return err
+		}
+
+		if c := cluster.NodeConfig(n.Labels[node.RoleLabel], n.Labels[node.PoolLabel]); c != nil && c.Count > 0 {
+			c.Count--
+		}
+
+		delete(cluster.Addresses, n.Name)
+	}
+
+	return d.configManager.SaveCluster(cluster)
+}
+
+// Snapshot saves the cluster folder and the snapshots of all nodes. Without the memory snapshot, the running nodes are
+// stopped during taking snapshot and started again afterwards, otherwise all nodes have to be running.
+func (d *DefaultManager) Snapshot(ctx context.Context, name string, snapshotName string, memory bool) error {
+	logrus.WithFields(logrus.Fields{
+		"cluster":  name,
+		"snapshot": snapshotName,
+		"memory":   memory,
+	}).Infoln("taking snapshot of cluster")
+
+	cluster, err := d.configManager.GetCluster(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.configManager.GetSnapshot(name, snapshotName); err == nil {
+		return errors.Errorf("snapshot (%s) of cluster (%s) already exists", snapshotName, name)
+	}
+
+	nodes, err := d.nodeManager.ListNodes(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	snapshot := &pkgconfig.Snapshot{
+		Name:      snapshotName,
+		Cluster:   name,
+		Backend:   intconfig.NodeBackend,
+		Memory:    memory,
+		Addresses: map[string]string{},
+		CreatedAt: time.Now(),
+	}
+
+	for _, n := range nodes {
+		snapshot.Nodes = append(snapshot.Nodes, n.Name)
+
+		if n.Status.IPAddresses != "" {
+			snapshot.Addresses[n.Name] = n.Status.IPAddresses
+		}
+
+		if memory && !n.Status.Running {
+			return errors.Errorf("node (%s) has to be running before taking memory snapshot", n.Name)
+		}
+	}
+
+	if !memory {
+		var runningNodes, stoppedNodes []string
+
+		for _, n := range nodes {
+			if n.Status.Running {
+				runningNodes = append(runningNodes, n.Name)
+			}
+		}
+
+		// prevent the supervisor from restarting the nodes during taking snapshot
+		if len(runningNodes) > 0 {
+			if err := d.MarkNodesStopped(ctx, name, runningNodes, true); err != nil {
+				return err
+			}
+		}
+
+		// the nodes stopped are started again even if the context is canceled
+		defer func() {
+			startCtx := context.WithoutCancel(ctx)
+
+			for _, n := range stoppedNodes {
+				if err := d.nodeManager.StartNode(startCtx, n); err != nil {
+					logrus.WithField("node", n).WithError(err).Warnln("failed to start node after taking snapshot")
+				}
+			}
+
+			if len(runningNodes) > 0 {
+				if err := d.MarkNodesStopped(startCtx, name, runningNodes, false); err != nil {
+					logrus.WithField("cluster", name).WithError(err).Warnln("failed to unmark the nodes stopped for taking snapshot")
+				}
+			}
+		}()
+
+		for _, n := range runningNodes {
+			if err := d.nodeManager.StopNode(ctx, n); err != nil {
+				return err
+			}
+
+			stoppedNodes = append(stoppedNodes, n)
+		}
+	}
+
+	err = util.CopyFiles(cluster.LocalClusterDir(), snapshot.LocalClusterDir())
+	if err == nil {
+		err = forEachNode(snapshot.Nodes, func(n string) error {
+			return d.nodeManager.SnapshotNode(ctx, n, snapshot.LocalNodeDir(n), memory)
+		})
+	}
+	if err == nil {
+		err = d.configManager.SaveSnapshot(snapshot)
+	}
+
+	if err != nil {
+		if err := d.configManager.DeleteSnapshot(snapshot); err != nil {
+			logrus.WithField("snapshot", snapshotName).WithError(err).Warnln("failed to delete incomplete snapshot")
+		}
+
+		return err
+	}
+
 	return nil
 }
 
-func (d *DefaultManager) Get(name string) (*data.Cluster, error) {
+// Restore replaces the cluster folder and nodes with the snapshot, then starts all nodes. The nodes not in the snapshot
+// are deleted, and the nodes in the snapshot are created again if they have been deleted.
+func (d *DefaultManager) Restore(ctx context.Context, name string, snapshotName string) error {
+	logrus.WithFields(logrus.Fields{
+		"cluster":  name,
+		"snapshot": snapshotName,
+	}).Infoln("restoring cluster from snapshot")
+
+	snapshot, err := d.getSnapshot(name, snapshotName)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := d.nodeManager.ListNodes(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if funk.ContainsString(snapshot.Nodes, n.Name) {
+			continue
+		}
+
+		if err := d.nodeManager.DeleteNode(ctx, n.Name); err != nil {
+			return err
+		}
+	}
+
+	cluster := pkgconfig.NewCluster()
+	cluster.Name = name
+
+	if err := d.configManager.DeleteCluster(cluster); err != nil {
+		return err
+	}
+
+	if err := util.CopyFiles(snapshot.LocalClusterDir(), cluster.LocalClusterDir()); err != nil {
+		return err
+	}
+
+	return forEachNode(snapshot.Nodes, func(n string) error {
+		return d.nodeManager.RestoreNode(ctx, n, name, snapshot.LocalNodeDir(n), true)
+	})
+}
+
+// Clone creates a new cluster from the snapshot of the source cluster. The nodes are restored with the new names, and get
+// new MAC and IP addresses after starting. The original nodes of the cloned nodes are returned, because the names and
+// addresses of the original nodes have to be replaced on the cloned nodes by the bootstrapper.
+func (d *DefaultManager) Clone(ctx context.Context, src string, snapshotName string, dst string) (map[string]*data.Node, error) {
+	logrus.WithFields(logrus.Fields{
+		"cluster":  src,
+		"snapshot": snapshotName,
+		"clone":    dst,
+	}).Infoln("cloning cluster from snapshot")
+
+	snapshot, err := d.getSnapshot(src, snapshotName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.configManager.GetCluster(dst); err == nil {
+		return nil, errors.Errorf("cluster (%s) configuration already exists", dst)
+	}
+
+	cluster := pkgconfig.NewCluster()
+	cluster.Name = dst
+
+	if err := util.CopyFiles(snapshot.LocalClusterDir(), cluster.LocalClusterDir()); err != nil {
+		return nil, err
+	}
+
+	// the copied config still belongs to the source cluster
+	cluster, err = d.configManager.GetCluster(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster.Name = dst
+	cluster.Prikey, cluster.Pubkey = cluster.LocalClusterKeyFiles()
+	cluster.Addresses = nil
+	cluster.NodeBackend = snapshot.Backend
+
+	if cluster.Network != nil {
+		// the subnet can not be shared with the source cluster, so the cloned nodes are on the kubefire bridge network
+		logrus.WithField("cluster", dst).Warnf("isolated network (%s) of cluster (%s) is not cloned", cluster.Network.Subnet, src)
+		cluster.Network = nil
+	}
+
+	if err := d.configManager.SaveCluster(cluster); err != nil {
+		return nil, err
+	}
+
+	origins := map[string]*data.Node{}
+	var names []string
+
+	for _, n := range snapshot.Nodes {
+		name := CloneNodeName(src, dst, n)
+		names = append(names, name)
+
+		origins[name] = &data.Node{
+			Name: n,
+			Status: data.NodeStatus{
+				IPAddresses: snapshot.Addresses[n],
+			},
+		}
+	}
+
+	err = forEachNode(names, func(n string) error {
+		return d.nodeManager.RestoreNode(ctx, n, dst, snapshot.LocalNodeDir(origins[n].Name), true)
+	})
+	if err != nil {
+		return origins, err
+	}
+
+	// the cloned nodes get new addresses after starting
+	return origins, d.RecordAddresses(ctx, dst)
+}
+
+// CheckAddresses returns the original nodes of the running nodes whose addresses are different from the persistent
+// addresses recorded in the cluster config, which are mapped by the node names.
+func (d *DefaultManager) CheckAddresses(ctx context.Context, name string) (map[string]*data.Node, error) {
+	logrus.WithField("cluster", name).Debugln("checking node addresses of cluster")
+
+	cluster, err := d.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	origins := map[string]*data.Node{}
+
+	for _, n := range cluster.Nodes {
+		recorded := cluster.Spec.Addresses[n.Name]
+
+		if !n.Status.Running || recorded == "" || n.Address() == "" || n.Address() == recorded {
+			continue
+		}
+
+		logrus.WithField("node", n.Name).Warnf("node address changed from %s to %s", recorded, n.Address())
+
+		origins[n.Name] = &data.Node{
+			Name:   n.Name,
+			Labels: n.Labels,
+			Status: data.NodeStatus{
+				IPAddresses: recorded,
+			},
+		}
+	}
+
+	return origins, nil
+}
+
+// RecordAddresses records the current addresses of the running nodes in the cluster config as the persistent addresses.
+func (d *DefaultManager) RecordAddresses(ctx context.Context, name string) error {
+	logrus.WithField("cluster", name).Debugln("recording node addresses of cluster")
+
+	cluster, err := d.configManager.GetCluster(name)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := d.nodeManager.ListNodes(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	addresses := map[string]string{}
+
+	for _, n := range nodes {
+		address := cluster.Addresses[n.Name]
+		if n.Status.Running && n.Address() != "" {
+			address = n.Address()
+		}
+
+		if address != "" {
+			addresses[n.Name] = address
+		}
+	}
+
+	cluster.Addresses = addresses
+
+	return d.configManager.SaveCluster(cluster)
+}
+
+// SyncNetworks creates the isolated networks of the clusters, deletes the networks of the deleted clusters, and updates
+// the routing between the networks.
+func (d *DefaultManager) SyncNetworks(ctx context.Context) error {
+	logrus.Debugln("syncing cluster networks")
+
+	clusters, err := d.configManager.ListClusters()
+	if err != nil {
+		return err
+	}
+
+	return d.nodeManager.SyncNetworks(ctx, clusters)
+}
+
+// ExecNodes runs the command on the nodes of the cluster in parallel without stdin. The outputs are prefixed by the
+// node names if running on multiple nodes. The errors of the failed nodes are aggregated, and the error of the command
+// exiting with non-zero status is *ssh.ExitError.
+func (d *DefaultManager) ExecNodes(ctx context.Context, name string, nodes []string, cmd string, stdout io.Writer, stderr io.Writer) error {
+	logrus.WithFields(logrus.Fields{
+		"cluster": name,
+		"nodes":   nodes,
+	}).Debugf("running %s on nodes", cmd)
+
+	cluster, err := d.configManager.GetCluster(name)
+	if err != nil {
+		return err
+	}
+
+	var lock sync.Mutex
+
+	return forEachNode(nodes, func(n string) error {
+		sshClient, err := d.nodeSSHClient(ctx, cluster, n)
+		if err != nil {
+			return err
+		}
+		defer sshClient.Close()
+
+		// the command is logged by the cluster manager already
+		sshClient.SetRunLogLevel(logrus.DebugLevel)
+
+		var writers []*util.PrefixWriter
+		nodeStdout, nodeStderr := stdout, stderr
+
+		if len(nodes) > 1 {
+			prefix := fmt.Sprintf("[%s] ", n)
+			writers = append(writers, util.NewPrefixWriter(stdout, &lock, prefix), util.NewPrefixWriter(stderr, &lock, prefix))
+			nodeStdout, nodeStderr = writers[0], writers[1]
+		}
+
+		before := func(session *ssh.Session) bool {
+			session.Stdin = nil
+			session.Stdout = nodeStdout
+			session.Stderr = nodeStderr
+			return true
+		}
+
+		err = sshClient.Run(before, nil, cmd)
+
+		for _, w := range writers {
+			_ = w.Flush()
+		}
+
+		return err
+	})
+}
+
+// CopyToNode copies the local file or folder recursively to the node.
+func (d *DefaultManager) CopyToNode(ctx context.Context, nodeName string, srcPath string, remotePath string) error {
+	logrus.WithField("node", nodeName).Infof("copying %s to %s of node", srcPath, remotePath)
+
+	sshClient, err := d.nodeSSHClient(ctx, nil, nodeName)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+
+	return sshClient.CopyToRemote(srcPath, remotePath)
+}
+
+// CopyFromNode copies the file or folder of the node recursively to the local path.
+func (d *DefaultManager) CopyFromNode(ctx context.Context, nodeName string, remotePath string, destPath string) error {
+	logrus.WithField("node", nodeName).Infof("copying %s of node to %s", remotePath, destPath)
+
+	sshClient, err := d.nodeSSHClient(ctx, nil, nodeName)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+
+	return sshClient.CopyFromRemote(remotePath, destPath)
+}
+
+// nodeSSHClient returns the SSH client connecting to the running node by the key of the cluster, which is the cluster
+// of the node if not specified.
+func (d *DefaultManager) nodeSSHClient(ctx context.Context, cluster *pkgconfig.Cluster, nodeName string) (utilssh.Commander, error) {
+	n, err := d.nodeManager.GetNode(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !n.Status.Running || n.Address() == "" {
+		return nil, errors.Errorf("node (%s) is not running", nodeName)
+	}
+
+	if cluster == nil {
+		if cluster, err = d.configManager.GetCluster(n.Spec.Cluster.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.sshClientFactory(ctx, nodeName, cluster.Prikey, "root", n.Address(), nil)
+}
+
+// allocateAddresses allocates the persistent addresses of the nodes not having addresses yet, then saves them in the
+// cluster config before creating the nodes.
+func (d *DefaultManager) allocateAddresses(ctx context.Context, cluster *pkgconfig.Cluster, names []string) error {
+	var pending []string
+
+	for _, n := range names {
+		if cluster.Addresses[n] == "" {
+			pending = append(pending, n)
+		}
+	}
+
+	// ignite allocates the node addresses by itself, so the addresses are only recorded after the cluster is deployed
+	if len(pending) == 0 || nodeBackend(cluster) == constants.IGNITE {
+		return nil
+	}
+
+	used, err := d.usedAddresses(ctx)
+	if err != nil {
+		return err
+	}
+
+	ipam, err := node.NewClusterIPAM(cluster)
+	if err != nil {
+		return err
+	}
+
+	addresses, err := ipam.Allocate(pending, used)
+	if err != nil {
+		return err
+	}
+
+	if cluster.Addresses == nil {
+		cluster.Addresses = map[string]string{}
+	}
+
+	for n, address := range addresses {
+		cluster.Addresses[n] = address
+	}
+
+	return d.configManager.SaveCluster(cluster)
+}
+
+// usedAddresses returns the addresses recorded by all clusters and used by all nodes.
+func (d *DefaultManager) usedAddresses(ctx context.Context) ([]string, error) {
+	var used []string
+
+	clusters, err := d.configManager.ListClusters()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range clusters {
+		for _, address := range c.Addresses {
+			used = append(used, address)
+		}
+	}
+
+	nodes, err := d.nodeManager.ListNodes(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range nodes {
+		for _, address := range strings.Split(n.Status.IPAddresses, ",") {
+			used = append(used, strings.TrimSpace(address))
+		}
+	}
+
+	return used, nil
+}
+
+func (d *DefaultManager) getSnapshot(clusterName string, snapshotName string) (*pkgconfig.Snapshot, error) {
+	snapshot, err := d.configManager.GetSnapshot(clusterName, snapshotName)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot.Backend != intconfig.NodeBackend {
+		return nil, errors.Errorf("snapshot (%s) is taken by %s node backend instead of %s", snapshotName, snapshot.Backend, intconfig.NodeBackend)
+	}
+
+	return snapshot, nil
+}
+
+func (d *DefaultManager) Get(ctx context.Context, name string) (*data.Cluster, error) {
 	logrus.WithField("cluster", name).Debugln("getting cluster")
 
 	configCluster, err := d.configManager.GetCluster(name)
@@ -115,11 +785,15 @@ func (d *DefaultManager) Get(name string) (*data.Cluster, error) {
 		return nil, err
 	}
 
-	nodes, err := d.nodeManager.ListNodes(name)
+	nodes, err := d.nodeManager.ListNodes(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := UpdateNodeRestarts(d.configManager, name, nodes...); err != nil {
+		return nil, err
+	}
+
 	return &data.Cluster{
 		Name:  configCluster.Name,
 		Spec:  *configCluster,
@@ -127,7 +801,7 @@ func (d *DefaultManager) Get(name string) (*data.Cluster, error) {
 	}, nil
 }
 
-func (d *DefaultManager) List() ([]*data.Cluster, error) {
+func (d *DefaultManager) List(ctx context.Context) ([]*data.Cluster, error) {
 	logrus.Debugln("listing clusters")
 
 	configClusters, err := d.configManager.ListClusters()
@@ -155,3 +829,181 @@ func (d *DefaultManager) GetNodeManager() node.Manager {
 func (d *DefaultManager) GetConfigManager() pkgconfig.Manager {
 	return d.configManager
 }
+
+// NodesToRemove selects the nodes of the node type and worker pool with the highest indices to remove from the cluster.
+// The first master node is never selected, because the other nodes join the cluster via it.
+func NodesToRemove(nodes []*data.Node, nodeType node.Type, pool string, count int) []*data.Node {
+	var candidates []*data.Node
+
+	for _, n := range nodes {
+		if n.Labels[node.RoleLabel] != string(nodeType) || n.Labels[node.PoolLabel] != pool {
+			continue
+		}
+
+		if n.Name == node.Name(n.Labels[node.ClusterLabel], node.Master, 1) {
+			continue
+		}
+
+		candidates = append(candidates, n)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		left, _ := strconv.Atoi(candidates[i].Labels[node.IndexLabel])
+		right, _ := strconv.Atoi(candidates[j].Labels[node.IndexLabel])
+
+		return left > right
+	})
+
+	if count < len(candidates) {
+		candidates = candidates[:count]
+	}
+
+	return candidates
+}
+
+// CloneNodeName returns the name of the node cloned from the node of the source cluster.
+func CloneNodeName(src string, dst string, nodeName string) string {
+	return dst + strings.TrimPrefix(nodeName, src)
+}
+
+// createNodes creates the nodes of the batches in order, and retries to create the failed nodes of the batch, which
+// are deleted before retrying. If any node still fails, all nodes created by this operation are deleted, unless
+// KeepOnFailure is set.
+func (d *DefaultManager) createNodes(ctx context.Context, batches []nodeBatch, opts CreateOptions) error {
+	var names []string
+	var err error
+
+	for _, b := range batches {
+		for attempt := 0; ; attempt++ {
+			for _, i := range b.indices {
+				if name := node.ConfigName(b.nodeType, b.nodeConfig, i); !funk.ContainsString(names, name) {
+					names = append(names, name)
+				}
+			}
+
+			err = d.nodeManager.CreateNodesWithIndices(ctx, b.nodeType, b.nodeConfig, b.indices, opts.Started)
+			if err == nil || attempt >= opts.Retries || ctx.Err() != nil {
+				break
+			}
+
+			b.indices = failedIndices(b, err)
+
+			logrus.WithError(err).Warnf("retrying to create %d failed %s nodes (%d/%d)", len(b.indices), b.nodeType, attempt+1, opts.Retries)
+
+			// the failed nodes may be created partially, ex: created but failed to start
+			for _, i := range b.indices {
+				if err := d.deleteCreatedNode(ctx, node.ConfigName(b.nodeType, b.nodeConfig, i)); err != nil {
+					return errors.WithMessagef(err, "failed to delete %s node (%d) before retrying", b.nodeType, i)
+				}
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	failed := node.FailedNodes(err)
+	if len(failed) == 0 {
+		failed = names
+	}
+
+	if opts.KeepOnFailure {
+		logrus.WithField("nodes", names).Warnln("kept the nodes created for troubleshooting, which have to be deleted manually")
+
+		return errors.WithMessagef(err, "failed to create nodes (%s)", strings.Join(failed, ", "))
+	}
+
+	logrus.WithField("nodes", names).Infoln("rolling back the nodes created")
+
+	// the rollback still has to finish if the creation is interrupted
+	rollbackCtx := context.WithoutCancel(ctx)
+
+	if rollbackErr := forEachNode(names, func(name string) error {
+		return d.deleteCreatedNode(rollbackCtx, name)
+	}); rollbackErr != nil {
+		logrus.WithError(rollbackErr).Errorln("failed to roll back nodes, which have to be deleted manually")
+
+		return errors.WithMessagef(err, "failed to create nodes (%s), and failed to roll back", strings.Join(failed, ", "))
+	}
+
+	return errors.WithMessagef(err, "failed to create nodes (%s), and rolled back %d nodes", strings.Join(failed, ", "), len(names))
+}
+
+// deleteCreatedNode deletes the node if it has been created.
+func (d *DefaultManager) deleteCreatedNode(ctx context.Context, name string) error {
+	if _, err := d.nodeManager.GetNode(ctx, name); err != nil {
+		if errors.Is(err, interr.NodeNotFoundError) {
+			return nil
+		}
+
+		return err
+	}
+
+	return d.nodeManager.DeleteNode(ctx, name)
+}
+
+// failedIndices returns the indices of the failed nodes of the batch, or all indices if no specific node failed.
+func failedIndices(b nodeBatch, err error) []int {
+	failed := node.FailedNodes(err)
+	if len(failed) == 0 {
+		return b.indices
+	}
+
+	var indices []int
+
+	for _, i := range b.indices {
+		if funk.ContainsString(failed, node.ConfigName(b.nodeType, b.nodeConfig, i)) {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+// forEachNode runs the function for the nodes concurrently, and returns the errors of all nodes.
+func forEachNode(nodes []string, f func(name string) error) error {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var err error
+
+	for _, n := range nodes {
+		wg.Add(1)
+
+		go func(n string) {
+			defer wg.Done()
+
+			if e := f(n); e != nil {
+				lock.Lock()
+				err = multierror.Append(err, errors.WithMessagef(e, "node (%s)", n))
+				lock.Unlock()
+			}
+		}(n)
+	}
+
+	wg.Wait()
+
+	return err
+}
+
+// nodeBackend returns the node backend creating the cluster. The current node backend is used for the clusters created
+// by the previous versions, which have no node backend recorded.
+func nodeBackend(cluster *pkgconfig.Cluster) string {
+	if cluster.NodeBackend == "" {
+		return intconfig.NodeBackend
+	}
+
+	return cluster.NodeBackend
+}
+
+func nodeConfigType(cluster *pkgconfig.Cluster, nodeConfig *pkgconfig.Node) node.Type {
+	if nodeConfig == &cluster.Master {
+		return node.Master
+	}
+
+	return node.Worker
+}
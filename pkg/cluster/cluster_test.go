@@ -0,0 +1,723 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"github.com/hashicorp/go-multierror"
+	intconfig "github.com/innobead/kubefire/internal/config"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/constants"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/innobead/kubefire/pkg/util"
+	utilssh "github.com/innobead/kubefire/pkg/util/ssh"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFakeManager(t *testing.T, masterCount int, workerCount int, pools ...pkgconfig.Node) *DefaultManager {
+	rootDir, snapshotRootDir := pkgconfig.ClusterRootDir, pkgconfig.SnapshotRootDir
+	pkgconfig.ClusterRootDir, pkgconfig.SnapshotRootDir = t.TempDir(), t.TempDir()
+	t.Cleanup(func() {
+		pkgconfig.ClusterRootDir, pkgconfig.SnapshotRootDir = rootDir, snapshotRootDir
+	})
+
+	manager := &DefaultManager{}
+	manager.SetNodeManager(node.NewFakeNodeManager())
+	manager.SetConfigManager(pkgconfig.NewLocalConfigManager())
+
+	cluster := pkgconfig.NewDefaultCluster()
+	cluster.Name = "demo"
+	cluster.Master.Count = masterCount
+	cluster.Worker.Count = workerCount
+	cluster.WorkerPools = pools
+
+	assert.NoError(t, manager.Init(cluster))
+	assert.NoError(t, manager.Create(context.Background(), cluster.Name, CreateOptions{Started: true}))
+
+	return manager
+}
+
+func nodeNames(nodes []*data.Node) []string {
+	var names []string
+
+	for _, n := range nodes {
+		names = append(names, n.Name)
+	}
+
+	return names
+}
+
+func TestDefaultManager_AddNodes(t *testing.T) {
+	manager := newFakeManager(t, 1, 2)
+
+	nodes, err := manager.AddNodes(context.Background(), "demo", node.Worker, "", 2, CreateOptions{Started: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"demo-worker-3", "demo-worker-4"}, nodeNames(nodes))
+
+	cluster, err := manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, cluster.Spec.Worker.Count)
+	assert.Len(t, cluster.Nodes, 5)
+}
+
+func TestDefaultManager_AddNodesFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		opts     CreateOptions
+		wantErr  bool
+		want     []string
+		running  bool
+	}{
+		{
+			name:     "retry succeeded",
+			failures: 1,
+			opts:     CreateOptions{Started: true, Retries: 1},
+			want:     []string{"demo-master-1", "demo-worker-1", "demo-worker-2"},
+			running:  true,
+		},
+		{
+			name:     "rolled back",
+			failures: 2,
+			opts:     CreateOptions{Started: true, Retries: 1},
+			wantErr:  true,
+			want:     []string{"demo-master-1"},
+		},
+		{
+			name:     "kept on failure",
+			failures: 1,
+			opts:     CreateOptions{Started: true, KeepOnFailure: true},
+			wantErr:  true,
+			want:     []string{"demo-master-1", "demo-worker-1", "demo-worker-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newFakeManager(t, 1, 0)
+			manager.nodeManager.(*node.FakeNodeManager).SetCreateFailures("demo-worker-1", tt.failures)
+
+			_, err := manager.AddNodes(context.Background(), "demo", node.Worker, "", 2, tt.opts)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+
+			if err != nil {
+				assert.Equal(t, []string{"demo-worker-1"}, node.FailedNodes(err))
+			}
+
+			cluster, err := manager.Get(context.Background(), "demo")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, nodeNames(cluster.Nodes))
+			assert.Equal(t, len(tt.want)-1, cluster.Spec.Worker.Count)
+
+			if len(cluster.Nodes) > 1 {
+				assert.Equal(t, tt.running, cluster.Nodes[1].Status.Running)
+			}
+		})
+	}
+}
+
+func TestDefaultManager_DeleteNodes(t *testing.T) {
+	manager := newFakeManager(t, 3, 2)
+
+	cluster, err := manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+
+	nodes := append(NodesToRemove(cluster.Nodes, node.Master, "", 5), NodesToRemove(cluster.Nodes, node.Worker, "", 1)...)
+	assert.Equal(t, []string{"demo-master-3", "demo-master-2", "demo-worker-2"}, nodeNames(nodes))
+
+	assert.NoError(t, manager.DeleteNodes(context.Background(), "demo", nodes))
+
+	cluster, err = manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cluster.Spec.Master.Count)
+	assert.Equal(t, 1, cluster.Spec.Worker.Count)
+	assert.Equal(t, []string{"demo-master-1", "demo-worker-1"}, nodeNames(cluster.Nodes))
+}
+
+func TestDefaultManager_WorkerPools(t *testing.T) {
+	manager := newFakeManager(t, 1, 1, pkgconfig.Node{Name: "gpu", Count: 1, Cpus: 8})
+
+	cluster, err := manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"demo-master-1", "demo-worker-1", "demo-worker-gpu-1"}, nodeNames(cluster.Nodes))
+	assert.Equal(t, "gpu", cluster.Nodes[2].Labels[node.PoolLabel])
+
+	nodes, err := manager.AddNodes(context.Background(), "demo", node.Worker, "gpu", 1, CreateOptions{Started: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"demo-worker-gpu-2"}, nodeNames(nodes))
+
+	_, err = manager.AddNodes(context.Background(), "demo", node.Worker, "unknown", 1, CreateOptions{Started: true})
+	assert.Error(t, err)
+
+	cluster, err = manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cluster.Spec.Worker.Count)
+	assert.Equal(t, 2, cluster.Spec.WorkerPools[0].Count)
+
+	nodes = NodesToRemove(cluster.Nodes, node.Worker, "gpu", 1)
+	assert.Equal(t, []string{"demo-worker-gpu-2"}, nodeNames(nodes))
+	assert.NoError(t, manager.DeleteNodes(context.Background(), "demo", nodes))
+
+	assert.NoError(t, manager.Delete(context.Background(), "demo", false))
+
+	nodes, err = manager.GetNodeManager().ListNodes(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Empty(t, nodes)
+}
+
+func TestDefaultManager_SnapshotRestore(t *testing.T) {
+	manager := newFakeManager(t, 1, 2)
+
+	assert.NoError(t, manager.Snapshot(context.Background(), "demo", "base", false))
+	assert.Error(t, manager.Snapshot(context.Background(), "demo", "base", false))
+
+	snapshot, err := manager.GetConfigManager().GetSnapshot("demo", "base")
+	assert.NoError(t, err)
+	assert.False(t, snapshot.Memory)
+	assert.Equal(t, []string{"demo-master-1", "demo-worker-1", "demo-worker-2"}, snapshot.Nodes)
+	assert.FileExists(t, path.Join(snapshot.LocalClusterDir(), "cluster.yaml"))
+
+	// the nodes stopped for taking snapshot are started again
+	cluster, err := manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+	for _, n := range cluster.Nodes {
+		assert.True(t, n.Status.Running, n.Name)
+	}
+
+	_, err = manager.AddNodes(context.Background(), "demo", node.Worker, "", 1, CreateOptions{Started: true})
+	assert.NoError(t, err)
+	assert.NoError(t, manager.GetNodeManager().DeleteNode(context.Background(), "demo-worker-1"))
+
+	assert.NoError(t, manager.Restore(context.Background(), "demo", "base"))
+
+	cluster, err = manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cluster.Spec.Worker.Count)
+	assert.Equal(t, []string{"demo-master-1", "demo-worker-1", "demo-worker-2"}, nodeNames(cluster.Nodes))
+	for _, n := range cluster.Nodes {
+		assert.True(t, n.Status.Running, n.Name)
+	}
+
+	assert.NoError(t, manager.Snapshot(context.Background(), "demo", "live", true))
+	assert.Error(t, manager.Restore(context.Background(), "demo", "unknown"))
+}
+
+func TestDefaultManager_Clone(t *testing.T) {
+	manager := newFakeManager(t, 1, 1)
+
+	assert.NoError(t, manager.Snapshot(context.Background(), "demo", "base", false))
+
+	origins, err := manager.Clone(context.Background(), "demo", "base", "dev")
+	assert.NoError(t, err)
+	assert.Equal(t, "demo-master-1", origins["dev-master-1"].Name)
+	assert.Equal(t, "demo-worker-1", origins["dev-worker-1"].Name)
+	assert.NotEmpty(t, origins["dev-worker-1"].Status.IPAddresses)
+
+	cluster, err := manager.Get(context.Background(), "dev")
+	assert.NoError(t, err)
+	assert.Equal(t, "dev", cluster.Spec.Name)
+	assert.Equal(t, path.Join(cluster.Spec.LocalClusterDir(), "key"), cluster.Spec.Prikey)
+	assert.Equal(t, []string{"dev-master-1", "dev-worker-1"}, nodeNames(cluster.Nodes))
+	assert.Equal(t, "dev", cluster.Nodes[0].Labels[node.ClusterLabel])
+	assert.FileExists(t, cluster.Spec.Prikey)
+
+	// the source cluster is untouched
+	cluster, err = manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"demo-master-1", "demo-worker-1"}, nodeNames(cluster.Nodes))
+
+	_, err = manager.Clone(context.Background(), "demo", "base", "dev")
+	assert.Error(t, err)
+}
+
+func TestDefaultManager_Addresses(t *testing.T) {
+	manager := newFakeManager(t, 1, 2)
+
+	cluster, err := manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"demo-master-1": "10.62.0.2",
+		"demo-worker-1": "10.62.0.3",
+		"demo-worker-2": "10.62.0.4",
+	}, cluster.Spec.Addresses)
+
+	for _, n := range cluster.Nodes {
+		assert.Equal(t, cluster.Spec.Addresses[n.Name], n.Address())
+	}
+
+	nodes, err := manager.AddNodes(context.Background(), "demo", node.Worker, "", 1, CreateOptions{Started: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.62.0.5", nodes[0].Address())
+
+	origins, err := manager.CheckAddresses(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Empty(t, origins)
+
+	assert.NoError(t, manager.nodeManager.(*node.FakeNodeManager).SetAddress("demo-worker-2", "10.62.0.100"))
+
+	origins, err = manager.CheckAddresses(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Len(t, origins, 1)
+	assert.Equal(t, "10.62.0.4", origins["demo-worker-2"].Address())
+
+	assert.NoError(t, manager.RecordAddresses(context.Background(), "demo"))
+
+	origins, err = manager.CheckAddresses(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Empty(t, origins)
+
+	assert.NoError(t, manager.DeleteNodes(context.Background(), "demo", nodes))
+
+	cluster, err = manager.Get(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.62.0.100", cluster.Spec.Addresses["demo-worker-2"])
+	assert.NotContains(t, cluster.Spec.Addresses, "demo-worker-3")
+
+	// ignite allocates the node addresses by itself, so no address is reserved
+	cluster.Spec.NodeBackend = constants.IGNITE
+	assert.NoError(t, manager.configManager.SaveCluster(&cluster.Spec))
+
+	nodes, err = manager.AddNodes(context.Background(), "demo", node.Worker, "", 1, CreateOptions{Started: true})
+	assert.NoError(t, err)
+
+	spec, err := manager.configManager.GetCluster("demo")
+	assert.NoError(t, err)
+	assert.NotContains(t, spec.Addresses, nodes[0].Name)
+}
+
+func TestDefaultManager_Networks(t *testing.T) {
+	manager := newFakeManager(t, 1, 1)
+	fakeNodeManager := manager.nodeManager.(*node.FakeNodeManager)
+
+	cluster := pkgconfig.NewDefaultCluster()
+	cluster.Name = "isolated"
+	cluster.Network = &pkgconfig.Network{Subnet: "10.63.0.0/24"}
+
+	assert.NoError(t, manager.Init(cluster))
+	assert.NoError(t, manager.Create(context.Background(), cluster.Name, CreateOptions{Started: true}))
+	assert.Equal(t, map[string]string{"isolated": "10.63.0.0/24"}, fakeNodeManager.Networks())
+
+	nodes, err := manager.nodeManager.ListNodes(context.Background(), "isolated")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.63.0.2", nodes[0].Address())
+
+	assert.NoError(t, manager.Delete(context.Background(), "isolated", false))
+	assert.Empty(t, fakeNodeManager.Networks())
+}
+
+func TestDefaultManager_ExecNodes(t *testing.T) {
+	manager := newFakeManager(t, 1, 2)
+
+	fakeClients := utilssh.NewFakeClients()
+	fakeClients.Outputs["hostname"] = "output\n"
+	fakeClients.Errors["false"] = errors.New("exited with status 1")
+	manager.SetSSHClientFactory(fakeClients.Factory())
+
+	stdout := &bytes.Buffer{}
+	assert.NoError(t, manager.ExecNodes(context.Background(), "demo", []string{"demo-master-1"}, "hostname", stdout, stdout))
+	assert.Equal(t, "output\n", stdout.String())
+
+	stdout.Reset()
+	assert.NoError(t, manager.ExecNodes(context.Background(), "demo", []string{"demo-worker-1", "demo-worker-2"}, "hostname", stdout, stdout))
+	assert.ElementsMatch(t, []string{"[demo-worker-1] output", "[demo-worker-2] output"}, strings.Split(strings.TrimSpace(stdout.String()), "\n"))
+
+	err := manager.ExecNodes(context.Background(), "demo", []string{"demo-worker-1", "demo-worker-2"}, "false", stdout, stdout)
+	assert.Error(t, err)
+	assert.Len(t, err.(*multierror.Error).Errors, 2)
+}
+
+func TestDefaultManager_Plan(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    util.HostCapacity
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "enough",
+			host: util.HostCapacity{Cpus: 8, MemoryTotal: 16 << 30, MemoryAvailable: 8 << 30, DiskTotal: 200 << 30, DiskFree: 100 << 30},
+			want: map[string]string{"cpu": PlanStatusOK, "memory": PlanStatusOK, "disk": PlanStatusOK, "kvm": PlanStatusOK},
+		},
+		{
+			name: "cpu overcommitted",
+			host: util.HostCapacity{Cpus: 6, MemoryTotal: 16 << 30, MemoryAvailable: 8 << 30, DiskTotal: 200 << 30, DiskFree: 100 << 30},
+			want: map[string]string{"cpu": PlanStatusOvercommitted, "memory": PlanStatusOK, "disk": PlanStatusOK, "kvm": PlanStatusOK},
+		},
+		{
+			name:    "memory and disk insufficient",
+			host:    util.HostCapacity{Cpus: 8, MemoryTotal: 16 << 30, MemoryAvailable: 3 << 30, DiskTotal: 200 << 30, DiskFree: 15 << 30},
+			want:    map[string]string{"cpu": PlanStatusOK, "memory": PlanStatusInsufficient, "disk": PlanStatusInsufficient, "kvm": PlanStatusOK},
+			wantErr: true,
+		},
+		{
+			name:    "kvm unavailable",
+			host:    util.HostCapacity{Cpus: 8, MemoryTotal: 16 << 30, MemoryAvailable: 8 << 30, DiskTotal: 200 << 30, DiskFree: 100 << 30, KVMError: errors.New("/dev/kvm not found")},
+			want:    map[string]string{"cpu": PlanStatusOK, "memory": PlanStatusOK, "disk": PlanStatusOK, "kvm": PlanStatusInsufficient},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the running demo cluster uses 4 CPUs and 4GB memory, and the stopped node of another backend only uses the disk
+			manager := newFakeManager(t, 1, 1)
+			manager.hostCapacity = func(dir string) (*util.HostCapacity, error) {
+				return &tt.host, nil
+			}
+
+			other := pkgconfig.NewDefaultCluster()
+			other.Name = "other"
+			otherNodeManager := node.NewFakeNodeManager()
+			assert.NoError(t, otherNodeManager.CreateNodesWithIndices(context.Background(), node.Master, &other.Master, []int{1}, false))
+
+			manager.backendNodeManager = func(backend string) node.Manager {
+				if backend == constants.FIRECRACKER {
+					return otherNodeManager
+				}
+
+				return node.NewFakeNodeManager()
+			}
+
+			cluster := pkgconfig.NewDefaultCluster()
+			cluster.Name = "dev"
+			cluster.Worker.Count = 1
+
+			plan, err := manager.Plan(context.Background(), cluster)
+			assert.NoError(t, err)
+
+			statuses := map[string]string{}
+			for _, r := range plan.Resources {
+				statuses[r.Resource] = r.Status
+			}
+
+			assert.Equal(t, tt.want, statuses)
+			assert.Equal(t, "4", plan.Resources[0].Requested)
+			assert.Equal(t, "4GB", plan.Resources[1].Used)
+			assert.Equal(t, "30GB", plan.Resources[2].Used)
+			assert.Equal(t, manager.nodeManager.StoragePool(), plan.Resources[2].Pool)
+			assert.Equal(t, tt.wantErr, plan.Check() != nil)
+		})
+	}
+}
+
+func TestDefaultManager_ResizeNodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodes       []string
+		spec        pkgconfig.Node
+		rolling     bool
+		failDrain   string // the node failing to drain
+		failStop    string // the node failing to stop
+		wantCalls   []string
+		wantWorker  pkgconfig.Node // the worker node config persisted
+		wantResized bool
+		wantErr     bool
+	}{
+		{
+			name:        "all workers rolling",
+			nodes:       []string{"demo-worker-1", "demo-worker-2"},
+			spec:        pkgconfig.Node{Cpus: 4, DiskSize: "20GB"},
+			rolling:     true,
+			wantCalls:   []string{"drain demo-worker-1", "uncordon demo-worker-1", "drain demo-worker-2", "uncordon demo-worker-2"},
+			wantWorker:  pkgconfig.Node{Cpus: 4, Memory: "2GB", DiskSize: "20GB"},
+			wantResized: true,
+		},
+		{
+			name:        "part of workers",
+			nodes:       []string{"demo-worker-1"},
+			spec:        pkgconfig.Node{Memory: "4GB"},
+			wantWorker:  pkgconfig.Node{Cpus: 2, Memory: "2GB", DiskSize: "10GB"},
+			wantResized: true,
+		},
+		{
+			name:       "shrink disk",
+			nodes:      []string{"demo-worker-1", "demo-worker-2"},
+			spec:       pkgconfig.Node{DiskSize: "5GB"},
+			wantWorker: pkgconfig.Node{Cpus: 2, Memory: "2GB", DiskSize: "10GB"},
+			wantErr:    true,
+		},
+		{
+			name:       "drain failed",
+			nodes:      []string{"demo-worker-1", "demo-worker-2"},
+			spec:       pkgconfig.Node{Cpus: 4},
+			rolling:    true,
+			failDrain:  "demo-worker-2",
+			wantCalls:  []string{"drain demo-worker-1", "uncordon demo-worker-1", "drain demo-worker-2", "uncordon demo-worker-2"},
+			wantWorker: pkgconfig.Node{Cpus: 2, Memory: "2GB", DiskSize: "10GB"},
+			wantErr:    true,
+		},
+		{
+			name:       "stop failed",
+			nodes:      []string{"demo-worker-1", "demo-worker-2"},
+			spec:       pkgconfig.Node{Cpus: 4},
+			failStop:   "demo-worker-2",
+			wantWorker: pkgconfig.Node{Cpus: 2, Memory: "2GB", DiskSize: "10GB"},
+			wantErr:    true,
+		},
+		{
+			name:       "stop failed rolling",
+			nodes:      []string{"demo-worker-1", "demo-worker-2"},
+			spec:       pkgconfig.Node{Cpus: 4},
+			rolling:    true,
+			failStop:   "demo-worker-2",
+			wantCalls:  []string{"drain demo-worker-1", "uncordon demo-worker-1", "drain demo-worker-2", "uncordon demo-worker-2"},
+			wantWorker: pkgconfig.Node{Cpus: 2, Memory: "2GB", DiskSize: "10GB"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newFakeManager(t, 1, 2)
+			manager.SetNodeManager(&stopFailingNodeManager{Manager: manager.nodeManager, name: tt.failStop})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var nodes []*data.Node
+			for _, name := range tt.nodes {
+				n, err := manager.nodeManager.GetNode(ctx, name)
+				assert.NoError(t, err)
+
+				nodes = append(nodes, n)
+			}
+
+			var calls []string
+			opts := ResizeOptions{
+				Rolling: tt.rolling,
+				Drain: func(ctx context.Context, n *data.Node) error {
+					calls = append(calls, "drain "+n.Name)
+
+					if n.Name == tt.failDrain {
+						cancel()
+						return errors.New("drain failed")
+					}
+
+					return nil
+				},
+				Uncordon: func(ctx context.Context, n *data.Node) error {
+					calls = append(calls, "uncordon "+n.Name)
+					return ctx.Err()
+				},
+			}
+
+			err := manager.ResizeNodes(ctx, "demo", nodes, &tt.spec, opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantCalls, calls)
+
+			for _, name := range tt.nodes {
+				n, err := manager.nodeManager.GetNode(context.Background(), name)
+				assert.NoError(t, err)
+				assert.True(t, n.Status.Running)
+
+				if tt.wantResized {
+					assert.Equal(t, tt.spec.Cpus > 0, n.Spec.Cpus == tt.spec.Cpus)
+					assert.Equal(t, tt.spec.Memory != "", n.Spec.Memory == tt.spec.Memory)
+				}
+			}
+
+			health, err := manager.configManager.GetHealth("demo")
+			assert.NoError(t, err)
+
+			for _, h := range health.Nodes {
+				assert.False(t, h.Stopped)
+			}
+
+			cluster, err := manager.configManager.GetCluster("demo")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantWorker, pkgconfig.Node{Cpus: cluster.Worker.Cpus, Memory: cluster.Worker.Memory, DiskSize: cluster.Worker.DiskSize})
+			assert.Equal(t, "2GB", cluster.Master.Memory)
+		})
+	}
+}
+
+// stopFailingNodeManager fails to stop the node of the name.
+type stopFailingNodeManager struct {
+	node.Manager
+	name string
+}
+
+func (s *stopFailingNodeManager) StopNode(ctx context.Context, name string) error {
+	if name == s.name {
+		return errors.Errorf("failed to stop node (%s)", name)
+	}
+
+	return s.Manager.StopNode(ctx, name)
+}
+
+func TestSupervisor(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		log          string
+		stopped      bool
+		wantRestarts int
+	}{
+		{
+			name:         "always restarts crashed node",
+			policy:       pkgconfig.RestartAlways,
+			log:          "Kernel panic - not syncing: Fatal exception\n",
+			wantRestarts: 1,
+		},
+		{
+			name:         "always restarts node shut down cleanly",
+			policy:       pkgconfig.RestartAlways,
+			log:          "reboot: Power down\n",
+			wantRestarts: 1,
+		},
+		{
+			name:         "on-failure restarts crashed node",
+			policy:       pkgconfig.RestartOnFailure,
+			log:          "Kernel panic - not syncing: Fatal exception\nRebooting in 1 seconds..\nreboot: Restarting system\n",
+			wantRestarts: 1,
+		},
+		{
+			name:         "on-failure ignores node shut down cleanly",
+			policy:       pkgconfig.RestartOnFailure,
+			log:          "reboot: Power down\n",
+			wantRestarts: 0,
+		},
+		{
+			name:         "on-failure restarts node crashed after the previous clean shutdown",
+			policy:       pkgconfig.RestartOnFailure,
+			log:          "reboot: Power down\n" + node.ConsoleLogStartMarker + "\nLinux version 4.19.125\n",
+			wantRestarts: 1,
+		},
+		{
+			name:         "never",
+			policy:       pkgconfig.RestartNever,
+			wantRestarts: 0,
+		},
+		{
+			name:         "ignores node stopped by kubefire",
+			policy:       pkgconfig.RestartAlways,
+			stopped:      true,
+			wantRestarts: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			manager := newFakeManager(t, 1, 1)
+			fakeNodeManager := manager.nodeManager.(*node.FakeNodeManager)
+
+			if tt.stopped {
+				assert.NoError(t, manager.MarkNodesStopped(ctx, "demo", []string{"demo-worker-1"}, true))
+			}
+			fakeNodeManager.SetLogs("demo-worker-1", tt.log)
+			assert.NoError(t, fakeNodeManager.StopNode(ctx, "demo-worker-1"))
+
+			now := time.Now()
+			supervisor := NewSupervisor(manager, tt.policy)
+			supervisor.now = func() time.Time { return now }
+
+			// the node found stopped is restarted after the backoff
+			assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+			now = now.Add(superviseBackoffBase)
+			assert.NoError(t, supervisor.SuperviseOnce(ctx, []string{"demo"}))
+
+			cluster, err := manager.Get(ctx, "demo")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRestarts, cluster.Nodes[1].Status.Restarts)
+			assert.Equal(t, tt.wantRestarts > 0, cluster.Nodes[1].Status.Running)
+			assert.Equal(t, 0, cluster.Nodes[0].Status.Restarts)
+		})
+	}
+}
+
+// hookedNodeManager runs the hook before starting the node, to change the node health while the node is restarting.
+type hookedNodeManager struct {
+	node.Manager
+	beforeStart func(name string)
+}
+
+func (h *hookedNodeManager) StartNode(ctx context.Context, name string) error {
+	h.beforeStart(name)
+	return h.Manager.StartNode(ctx, name)
+}
+
+func TestSupervisor_KeepsStoppedMarks(t *testing.T) {
+	ctx := context.Background()
+	manager := newFakeManager(t, 1, 1)
+	fakeNodeManager := manager.nodeManager.(*node.FakeNodeManager)
+
+	assert.NoError(t, fakeNodeManager.StopNode(ctx, "demo-worker-1"))
+
+	now := time.Now()
+	supervisor := NewSupervisor(manager, pkgconfig.RestartAlways)
+	supervisor.now = func() time.Time { return now }
+
+	// the master node is stopped on purpose while the worker node is restarting
+	supervisor.nodeManagers[intconfig.NodeBackend] = &hookedNodeManager{
+		Manager: fakeNodeManager,
+		beforeStart: func(name string) {
+			assert.NoError(t, manager.MarkNodesStopped(ctx, "demo", []string{"demo-master-1"}, true))
+			assert.NoError(t, fakeNodeManager.StopNode(ctx, "demo-master-1"))
+		},
+	}
+
+	assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+	now = now.Add(superviseBackoffBase)
+	assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+
+	health, err := manager.configManager.GetHealth("demo")
+	assert.NoError(t, err)
+	assert.True(t, health.Node("demo-master-1").Stopped)
+	assert.Equal(t, 1, health.Node("demo-worker-1").Restarts)
+
+	// the master node stopped on purpose is not restarted
+	now = now.Add(superviseBackoffMax)
+	assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+
+	master, err := fakeNodeManager.GetNode(ctx, "demo-master-1")
+	assert.NoError(t, err)
+	assert.False(t, master.Status.Running)
+}
+
+func TestSupervisor_Backoff(t *testing.T) {
+	ctx := context.Background()
+	manager := newFakeManager(t, 1, 0)
+	fakeNodeManager := manager.nodeManager.(*node.FakeNodeManager)
+
+	now := time.Now()
+	supervisor := NewSupervisor(manager, pkgconfig.RestartAlways)
+	supervisor.now = func() time.Time { return now }
+
+	restarts := func() int {
+		n, err := fakeNodeManager.GetNode(ctx, "demo-master-1")
+		assert.NoError(t, err)
+		assert.NoError(t, UpdateNodeRestarts(manager.configManager, "demo", n))
+
+		return n.Status.Restarts
+	}
+
+	// the backoff is doubled after every consecutive restart
+	for i, backoff := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second} {
+		assert.NoError(t, fakeNodeManager.StopNode(ctx, "demo-master-1"))
+		assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+
+		now = now.Add(backoff - time.Second)
+		assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+		assert.Equal(t, i, restarts())
+
+		now = now.Add(time.Second)
+		assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+		assert.Equal(t, i+1, restarts())
+	}
+
+	// the backoff is reset after the node keeps running long enough
+	now = now.Add(superviseBackoffReset)
+	assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+	assert.NoError(t, fakeNodeManager.StopNode(ctx, "demo-master-1"))
+	assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+
+	now = now.Add(superviseBackoffBase)
+	assert.NoError(t, supervisor.SuperviseOnce(ctx, nil))
+	assert.Equal(t, 4, restarts())
+}
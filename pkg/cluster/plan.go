@@ -0,0 +1,276 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	intconfig "github.com/innobead/kubefire/internal/config"
+	interr "github.com/innobead/kubefire/internal/error"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+const (
+	PlanStatusOK            = "ok"
+	PlanStatusOvercommitted = "overcommitted"
+	PlanStatusInsufficient  = "insufficient"
+)
+
+// PlanResource is the host resource requested by the nodes to create, compared with the amount used by the existing
+// kubefire nodes and the capacity of the host.
+type PlanResource struct {
+	Resource  string
+	Requested string
+	Used      string
+	Available string
+	Capacity  string
+	Pool      string // the storage checked for the disks
+	Status    string
+	Message   string
+}
+
+// Plan is the host capacity plan of creating the nodes of a cluster.
+type Plan struct {
+	Cluster   string
+	Resources []*PlanResource
+}
+
+// nodeResources are the resources requested by the nodes.
+type nodeResources struct {
+	cpus    int
+	maxCpus int
+	memory  int64
+	disk    int64
+}
+
+// Check returns the error if any host resource is insufficient, and warns the overcommitted resources.
+func (p *Plan) Check() error {
+	var insufficient []string
+
+	for _, r := range p.Resources {
+		switch r.Status {
+		case PlanStatusInsufficient:
+			insufficient = append(insufficient, r.Message)
+
+		case PlanStatusOvercommitted:
+			logrus.WithField("cluster", p.Cluster).Warnln(r.Message)
+		}
+	}
+
+	if len(insufficient) > 0 {
+		return errors.WithMessage(interr.HostCapacityInsufficientError, strings.Join(insufficient, "; "))
+	}
+
+	return nil
+}
+
+// Plan sums the resources requested by the nodes of the cluster and used by the existing kubefire nodes of all node
+// backends, then compares them with the host CPUs, memory, the disk space of the node storage and the KVM
+// availability. The vCPUs and memory are only used by the running nodes, but the disks are used by all nodes.
+func (d *DefaultManager) Plan(ctx context.Context, cluster *pkgconfig.Cluster) (*Plan, error) {
+	host, err := d.hostCapacity(d.nodeManager.StorageDir())
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to get the host capacity")
+	}
+
+	requested := nodeResources{}
+
+	for _, c := range cluster.NodeConfigs() {
+		if err := requested.add(c, c.Count); err != nil {
+			return nil, errors.WithMessagef(err, "invalid node config of cluster (%s)", cluster.Name)
+		}
+	}
+
+	nodes, err := d.listAllBackendNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	used := nodeResources{}
+	usedDisk := nodeResources{}
+
+	for _, n := range nodes {
+		// the resources of the nodes created by other tools may not be parsed, which are ignored
+		if n.Status.Running {
+			if err := used.add(&n.Spec, 1); err != nil {
+				logrus.WithField("node", n.Name).WithError(err).Debugln("ignored the resources of node")
+			}
+		}
+
+		if err := usedDisk.add(&n.Spec, 1); err != nil {
+			logrus.WithField("node", n.Name).WithError(err).Debugln("ignored the disk of node")
+		}
+	}
+
+	plan := &Plan{
+		Cluster: cluster.Name,
+		Resources: []*PlanResource{
+			planCpus(requested, used, host),
+			planMemory(requested, used, host),
+			planDisk(requested, usedDisk, host, d.nodeManager.StoragePool()),
+			planKVM(host),
+		},
+	}
+
+	return plan, nil
+}
+
+// listAllBackendNodes returns the nodes of all node backends, because the nodes created by other backends share the
+// host too. The nodes of the other backends are ignored if they cannot be listed, ex: the backend is not installed.
+func (d *DefaultManager) listAllBackendNodes(ctx context.Context) ([]*data.Node, error) {
+	nodes, err := d.nodeManager.ListNodes(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, backend := range node.BuiltinBackends {
+		if backend == intconfig.NodeBackend {
+			continue
+		}
+
+		backendNodes, err := d.backendNodeManager(backend).ListNodes(ctx, "")
+		if err != nil {
+			logrus.WithField("node-backend", backend).WithError(err).Debugln("ignored the nodes of node backend")
+			continue
+		}
+
+		nodes = append(nodes, backendNodes...)
+	}
+
+	return nodes, nil
+}
+
+func (r *nodeResources) add(n *pkgconfig.Node, count int) error {
+	if count <= 0 {
+		return nil
+	}
+
+	memory, err := parseNodeSize(n.Memory)
+	if err != nil {
+		return err
+	}
+
+	disk, err := parseNodeSize(n.DiskSize)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range n.ExtraDisks {
+		size, err := parseNodeSize(d.Size)
+		if err != nil {
+			return err
+		}
+
+		disk += size * int64(d.GetCount())
+	}
+
+	r.cpus += n.Cpus * count
+	r.memory += memory * int64(count)
+	r.disk += disk * int64(count)
+
+	if n.Cpus > r.maxCpus {
+		r.maxCpus = n.Cpus
+	}
+
+	return nil
+}
+
+func parseNodeSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+
+	return util.ParseSize(size)
+}
+
+func planCpus(requested nodeResources, used nodeResources, host *util.HostCapacity) *PlanResource {
+	r := &PlanResource{
+		Resource:  "cpu",
+		Requested: strconv.Itoa(requested.cpus),
+		Used:      strconv.Itoa(used.cpus),
+		Available: strconv.Itoa(max(host.Cpus-used.cpus, 0)),
+		Capacity:  strconv.Itoa(host.Cpus),
+		Status:    PlanStatusOK,
+	}
+
+	// the vCPUs can be overcommitted, but a node can not have more vCPUs than the host
+	switch {
+	case requested.maxCpus > host.Cpus:
+		r.Status = PlanStatusInsufficient
+		r.Message = fmt.Sprintf("a node requests %d CPUs, more than %d CPUs of host", requested.maxCpus, host.Cpus)
+
+	case requested.cpus+used.cpus > host.Cpus:
+		r.Status = PlanStatusOvercommitted
+		r.Message = fmt.Sprintf("%d CPUs requested and %d CPUs used by running nodes are more than %d CPUs of host", requested.cpus, used.cpus, host.Cpus)
+	}
+
+	return r
+}
+
+func planMemory(requested nodeResources, used nodeResources, host *util.HostCapacity) *PlanResource {
+	r := &PlanResource{
+		Resource:  "memory",
+		Requested: util.FormatSize(requested.memory),
+		Used:      util.FormatSize(used.memory),
+		Available: util.FormatSize(host.MemoryAvailable),
+		Capacity:  util.FormatSize(host.MemoryTotal),
+		Status:    PlanStatusOK,
+	}
+
+	// the memory of the running nodes is allocated on demand, so it may not be deducted from the available memory yet
+	switch {
+	case requested.memory > host.MemoryAvailable:
+		r.Status = PlanStatusInsufficient
+		r.Message = fmt.Sprintf("%s memory requested is more than %s available memory of host", r.Requested, r.Available)
+
+	case requested.memory+used.memory > host.MemoryTotal:
+		r.Status = PlanStatusOvercommitted
+		r.Message = fmt.Sprintf("%s memory requested and %s memory used by running nodes are more than %s memory of host", r.Requested, r.Used, r.Capacity)
+	}
+
+	return r
+}
+
+func planDisk(requested nodeResources, used nodeResources, host *util.HostCapacity, pool string) *PlanResource {
+	r := &PlanResource{
+		Resource:  "disk",
+		Requested: util.FormatSize(requested.disk),
+		Used:      util.FormatSize(used.disk),
+		Available: util.FormatSize(host.DiskFree),
+		Capacity:  util.FormatSize(host.DiskTotal),
+		Pool:      pool,
+		Status:    PlanStatusOK,
+	}
+
+	// the disks are thin-provisioned, so the disks of the existing nodes only take the space written
+	if requested.disk > host.DiskFree {
+		r.Status = PlanStatusInsufficient
+		r.Message = fmt.Sprintf("%s disk requested is more than %s free disk space of %s", r.Requested, r.Available, pool)
+	}
+
+	return r
+}
+
+func planKVM(host *util.HostCapacity) *PlanResource {
+	r := &PlanResource{
+		Resource:  "kvm",
+		Requested: "required",
+		Available: "yes",
+		Capacity:  "yes",
+		Status:    PlanStatusOK,
+	}
+
+	if host.KVMError != nil {
+		r.Available = "no"
+		r.Capacity = "no"
+		r.Status = PlanStatusInsufficient
+		r.Message = fmt.Sprintf("KVM is not available, %v", host.KVMError)
+	}
+
+	return r
+}
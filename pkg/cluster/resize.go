@@ -0,0 +1,191 @@
+package cluster
+
+import (
+	"context"
+	"github.com/hashicorp/go-multierror"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ResizeOptions are the options of resizing the nodes. Without rolling, all running nodes are stopped, resized and
+// started together. With rolling, the running nodes are drained, resized and uncordoned one by one, so the workloads
+// are moved to other nodes during resizing.
+type ResizeOptions struct {
+	Rolling  bool
+	Drain    func(ctx context.Context, n *data.Node) error
+	Uncordon func(ctx context.Context, n *data.Node) error
+}
+
+// ResizeNodes updates the CPUs, memory and disk size of the nodes of the cluster, and the empty resources of the spec
+// are unchanged. The running nodes are stopped during resizing and started again afterwards. The resources are
+// persisted in the node configs of the cluster if all nodes of the node config are resized.
+func (d *DefaultManager) ResizeNodes(ctx context.Context, name string, nodes []*data.Node, spec *pkgconfig.Node, opts ResizeOptions) error {
+	logrus.WithFields(logrus.Fields{
+		"cluster": name,
+		"rolling": opts.Rolling,
+	}).Infoln("resizing nodes of cluster")
+
+	if opts.Rolling {
+		for _, n := range nodes {
+			if err := d.resizeNodes(ctx, name, []*data.Node{n}, spec, opts); err != nil {
+				return err
+			}
+		}
+	} else if err := d.resizeNodes(ctx, name, nodes, spec, opts); err != nil {
+		return err
+	}
+
+	return d.updateNodeConfigs(ctx, name, nodes, spec)
+}
+
+func (d *DefaultManager) resizeNodes(ctx context.Context, name string, nodes []*data.Node, spec *pkgconfig.Node, opts ResizeOptions) error {
+	var runningNodes []*data.Node
+	var runningNames []string
+
+	for _, n := range nodes {
+		if n.Status.Running {
+			runningNodes = append(runningNodes, n)
+			runningNames = append(runningNames, n.Name)
+		}
+	}
+
+	if len(runningNames) > 0 {
+		// prevent the supervisor from restarting the nodes during resizing
+		if err := d.MarkNodesStopped(ctx, name, runningNames, true); err != nil {
+			return err
+		}
+	}
+
+	// the nodes drained or stopped are restored even if any step fails part-way
+	var drained, stopped []*data.Node
+	var err error
+
+	for _, n := range runningNodes {
+		if opts.Rolling && opts.Drain != nil {
+			// draining cordons the node first, so the node is uncordoned even if draining fails
+			drained = append(drained, n)
+
+			if err = opts.Drain(ctx, n); err != nil {
+				err = errors.WithMessagef(err, "failed to drain node (%s)", n.Name)
+				break
+			}
+		}
+
+		if err = d.nodeManager.StopNode(ctx, n.Name); err != nil {
+			err = errors.WithMessagef(err, "failed to stop node (%s)", n.Name)
+			break
+		}
+
+		stopped = append(stopped, n)
+	}
+
+	if err == nil {
+		for _, n := range nodes {
+			if err = d.nodeManager.ResizeNode(ctx, n.Name, spec); err != nil {
+				err = errors.WithMessagef(err, "failed to resize node (%s)", n.Name)
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		// the nodes are restored even if the context is canceled
+		if restoreErr := d.restoreResizedNodes(context.WithoutCancel(ctx), name, runningNames, drained, stopped, opts); restoreErr != nil {
+			logrus.WithField("cluster", name).WithError(restoreErr).Errorln("failed to restore nodes of cluster")
+		}
+
+		return err
+	}
+
+	return d.restoreResizedNodes(ctx, name, runningNames, drained, stopped, opts)
+}
+
+// restoreResizedNodes starts the stopped nodes, unmarks the nodes marked stopped for resizing, and uncordons the drained
+// nodes. All nodes are restored even if any of them fails.
+func (d *DefaultManager) restoreResizedNodes(ctx context.Context, name string, markedNames []string, drained []*data.Node, stopped []*data.Node, opts ResizeOptions) error {
+	var err error
+
+	for _, n := range stopped {
+		if startErr := d.nodeManager.StartNode(ctx, n.Name); startErr != nil {
+			err = multierror.Append(err, errors.WithMessagef(startErr, "failed to start node (%s)", n.Name))
+		}
+	}
+
+	if len(markedNames) > 0 {
+		if markErr := d.MarkNodesStopped(ctx, name, markedNames, false); markErr != nil {
+			err = multierror.Append(err, markErr)
+		}
+	}
+
+	if opts.Uncordon != nil {
+		for _, n := range drained {
+			if uncordonErr := opts.Uncordon(ctx, n); uncordonErr != nil {
+				err = multierror.Append(err, errors.WithMessagef(uncordonErr, "failed to uncordon node (%s)", n.Name))
+			}
+		}
+	}
+
+	return err
+}
+
+// updateNodeConfigs persists the resources in the node configs whose nodes are all resized, so the nodes added later
+// have the same resources.
+func (d *DefaultManager) updateNodeConfigs(ctx context.Context, name string, resized []*data.Node, spec *pkgconfig.Node) error {
+	cluster, err := d.configManager.GetCluster(name)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := d.nodeManager.ListNodes(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	resizedNames := map[string]bool{}
+	for _, n := range resized {
+		resizedNames[n.Name] = true
+	}
+
+	// the node configs having any node not resized
+	partial := map[*pkgconfig.Node]bool{}
+
+	for _, n := range nodes {
+		c := cluster.NodeConfig(n.Labels[node.RoleLabel], n.Labels[node.PoolLabel])
+		if c != nil && !resizedNames[n.Name] {
+			partial[c] = true
+		}
+	}
+
+	updated := false
+
+	for _, n := range resized {
+		c := cluster.NodeConfig(n.Labels[node.RoleLabel], n.Labels[node.PoolLabel])
+		if c == nil || partial[c] {
+			continue
+		}
+
+		if spec.Cpus > 0 {
+			c.Cpus = spec.Cpus
+		}
+
+		if spec.Memory != "" {
+			c.Memory = spec.Memory
+		}
+
+		if spec.DiskSize != "" {
+			c.DiskSize = spec.DiskSize
+		}
+
+		updated = true
+	}
+
+	if !updated {
+		logrus.WithField("cluster", name).Warnln("the node configs of cluster are unchanged, because not all nodes of the node configs are resized")
+		return nil
+	}
+
+	return d.configManager.SaveCluster(cluster)
+}
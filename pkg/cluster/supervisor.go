@@ -0,0 +1,330 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"github.com/hashicorp/go-multierror"
+	intconfig "github.com/innobead/kubefire/internal/config"
+	pkgconfig "github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/node"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"time"
+)
+
+const (
+	superviseBackoffBase  = 10 * time.Second
+	superviseBackoffMax   = 5 * time.Minute
+	superviseBackoffReset = 10 * time.Minute // the time of the node running after restarting to reset the backoff
+	consoleLogTailSize    = 4096
+)
+
+var (
+	// cleanShutdownPattern matches the last kernel messages of the node shut down cleanly. Firecracker exits when the
+	// node reboots, so the reboot is regarded as shut down as well.
+	cleanShutdownPattern = regexp.MustCompile(`reboot: (Power down|System halted|Restarting system)`)
+	kernelPanicPattern   = regexp.MustCompile(`Kernel panic`)
+)
+
+// Supervisor watches the nodes of the clusters, and restarts the nodes stopped unexpectedly per the restart policy of
+// the cluster with the exponential backoff. The nodes stopped by kubefire on purpose are never restarted.
+type Supervisor struct {
+	nodeManagers  map[string]node.Manager // the node managers of the node backends creating the clusters
+	configManager pkgconfig.Manager
+	restart       string
+	nodes         map[string]*supervisedNode
+	now           func() time.Time
+}
+
+// supervisedNode is the state of the node kept by the supervisor to back off restarting.
+type supervisedNode struct {
+	downSince   time.Time
+	failed      bool // crashed instead of shut down cleanly
+	failures    int  // the consecutive restarts, reset after the node keeps running long enough
+	lastRestart time.Time
+}
+
+// NewSupervisor creates the supervisor of the clusters managed by the cluster manager. The restart policy overrides the
+// policies of the clusters if not empty.
+func NewSupervisor(manager Manager, restart string) *Supervisor {
+	return &Supervisor{
+		nodeManagers:  map[string]node.Manager{intconfig.NodeBackend: manager.GetNodeManager()},
+		configManager: manager.GetConfigManager(),
+		restart:       restart,
+		nodes:         map[string]*supervisedNode{},
+		now:           time.Now,
+	}
+}
+
+// Run supervises the clusters every interval until the context is done. All clusters are supervised if no cluster
+// specified.
+func (s *Supervisor) Run(ctx context.Context, clusterNames []string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.SuperviseOnce(ctx, clusterNames); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warnln("failed to supervise nodes")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SuperviseOnce checks the nodes of the clusters, and restarts the stopped nodes if the backoff has elapsed since the
+// node was found stopped or restarted last time.
+func (s *Supervisor) SuperviseOnce(ctx context.Context, clusterNames []string) error {
+	var clusters []*pkgconfig.Cluster
+
+	if len(clusterNames) == 0 {
+		var err error
+
+		clusters, err = s.configManager.ListClusters()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range clusterNames {
+		cluster, err := s.configManager.GetCluster(name)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to get cluster (%s)", name)
+		}
+
+		clusters = append(clusters, cluster)
+	}
+
+	var result error
+
+	for _, cluster := range clusters {
+		policy := s.restart
+		if policy == "" {
+			policy = cluster.Restart
+		}
+
+		if policy == "" || policy == pkgconfig.RestartNever {
+			continue
+		}
+
+		if err := s.superviseCluster(ctx, cluster, policy); err != nil {
+			result = multierror.Append(result, errors.WithMessagef(err, "failed to supervise cluster (%s)", cluster.Name))
+		}
+	}
+
+	return result
+}
+
+func (s *Supervisor) superviseCluster(ctx context.Context, cluster *pkgconfig.Cluster, policy string) error {
+	nodeManager := s.nodeManagerOf(cluster)
+
+	nodes, err := nodeManager.ListNodes(ctx, cluster.Name)
+	if err != nil {
+		return err
+	}
+
+	health, err := s.configManager.GetHealth(cluster.Name)
+	if err != nil {
+		return err
+	}
+
+	var result error
+	now := s.now()
+
+	for _, n := range nodes {
+		state, ok := s.nodes[n.Name]
+		if !ok {
+			state = &supervisedNode{}
+			s.nodes[n.Name] = state
+		}
+
+		if n.Status.Running {
+			state.downSince = time.Time{}
+
+			if state.failures > 0 && now.Sub(state.lastRestart) >= superviseBackoffReset {
+				state.failures = 0
+			}
+
+			continue
+		}
+
+		if h, ok := health.Nodes[n.Name]; ok && h.Stopped {
+			delete(s.nodes, n.Name)
+			continue
+		}
+
+		if state.downSince.IsZero() {
+			state.downSince = now
+			state.failed = nodeFailed(ctx, nodeManager, n.Name)
+
+			logrus.WithFields(logrus.Fields{
+				"node":   n.Name,
+				"failed": state.failed,
+			}).Warnln("node stopped unexpectedly")
+		}
+
+		if policy == pkgconfig.RestartOnFailure && !state.failed {
+			logrus.WithField("node", n.Name).Debugln("node was shut down cleanly, not restarted")
+			continue
+		}
+
+		if now.Sub(state.downSince) < superviseBackoff(state.failures) {
+			continue
+		}
+
+		// the node may be stopped on purpose by other commands after the health was read
+		if stopped, err := s.nodeStopped(cluster.Name, n.Name); err != nil || stopped {
+			if err != nil {
+				result = multierror.Append(result, err)
+			}
+
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"node":     n.Name,
+			"restarts": health.Node(n.Name).Restarts,
+		}).Infoln("restarting node")
+
+		state.failures++
+		state.lastRestart = now
+		state.downSince = now
+
+		if err := nodeManager.StartNode(ctx, n.Name); err != nil {
+			result = multierror.Append(result, errors.WithMessagef(err, "failed to restart node (%s)", n.Name))
+			continue
+		}
+
+		// only the restart counters of the node are changed, so the marks changed by other commands are kept
+		err := s.configManager.UpdateHealth(cluster.Name, func(health *pkgconfig.Health) {
+			health.Node(n.Name).Restarts++
+			health.Node(n.Name).LastRestart = now
+		})
+		if err != nil {
+			result = multierror.Append(result, errors.WithMessagef(err, "failed to record the restart of node (%s)", n.Name))
+		}
+
+		checkAddress(ctx, nodeManager, cluster, n.Name)
+	}
+
+	return result
+}
+
+// nodeStopped checks if the node is marked stopped on purpose in the latest node health.
+func (s *Supervisor) nodeStopped(clusterName string, name string) (bool, error) {
+	health, err := s.configManager.GetHealth(clusterName)
+	if err != nil {
+		return false, err
+	}
+
+	h, ok := health.Nodes[name]
+
+	return ok && h.Stopped, nil
+}
+
+// nodeFailed checks the tail of the console log to tell if the node crashed or was shut down cleanly. The node is
+// regarded as crashed if the log is unavailable.
+func nodeFailed(ctx context.Context, nodeManager node.Manager, name string) bool {
+	buf := &bytes.Buffer{}
+
+	if err := nodeManager.Logs(ctx, name, false, buf); err != nil {
+		logrus.WithField("node", name).WithError(err).Debugln("failed to get the console log of node")
+		return true
+	}
+
+	// only the output of the last boot is checked
+	tail := buf.Bytes()
+	if i := bytes.LastIndex(tail, []byte(node.ConsoleLogStartMarker)); i >= 0 {
+		tail = tail[i:]
+	}
+
+	if len(tail) > consoleLogTailSize {
+		tail = tail[len(tail)-consoleLogTailSize:]
+	}
+
+	return kernelPanicPattern.Match(tail) || !cleanShutdownPattern.Match(tail)
+}
+
+// checkAddress warns if the node restarted has a different address from the one recorded, because the node backend
+// like ignite may allocate a new address after restarting.
+func checkAddress(ctx context.Context, nodeManager node.Manager, cluster *pkgconfig.Cluster, name string) {
+	address, ok := cluster.Addresses[name]
+	if !ok {
+		return
+	}
+
+	n, err := nodeManager.GetNode(ctx, name)
+	if err != nil || n.Address() == "" || n.Address() == address {
+		return
+	}
+
+	logrus.WithField("node", name).Warnf("node address changed from %s to %s, run 'kubefire cluster repair %s' to repair the cluster", address, n.Address(), cluster.Name)
+}
+
+// nodeManagerOf returns the node manager of the node backend creating the cluster.
+func (s *Supervisor) nodeManagerOf(cluster *pkgconfig.Cluster) node.Manager {
+	backend := nodeBackend(cluster)
+
+	if _, ok := s.nodeManagers[backend]; !ok {
+		s.nodeManagers[backend] = node.New(backend)
+	}
+
+	return s.nodeManagers[backend]
+}
+
+// superviseBackoff returns the delay of restarting the node after the consecutive restarts.
+func superviseBackoff(failures int) time.Duration {
+	backoff := superviseBackoffBase
+
+	for i := 0; i < failures && backoff < superviseBackoffMax; i++ {
+		backoff *= 2
+	}
+
+	if backoff > superviseBackoffMax {
+		return superviseBackoffMax
+	}
+
+	return backoff
+}
+
+// MarkNodesStopped records the nodes stopped or started by kubefire on purpose, so the supervisor does not restart the
+// nodes stopped by kubefire. All nodes of the cluster are marked if no node specified.
+func (d *DefaultManager) MarkNodesStopped(ctx context.Context, name string, nodeNames []string, stopped bool) error {
+	if len(nodeNames) == 0 {
+		nodes, err := d.nodeManager.ListNodes(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range nodes {
+			nodeNames = append(nodeNames, n.Name)
+		}
+	}
+
+	return d.configManager.UpdateHealth(name, func(health *pkgconfig.Health) {
+		for _, n := range nodeNames {
+			health.Node(n).Stopped = stopped
+		}
+	})
+}
+
+// UpdateNodeRestarts sets the restart counts recorded by the supervisor to the status of the nodes of the cluster.
+func UpdateNodeRestarts(configManager pkgconfig.Manager, clusterName string, nodes ...*data.Node) error {
+	health, err := configManager.GetHealth(clusterName)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if h, ok := health.Nodes[n.Name]; ok {
+			n.Status.Restarts = h.Restarts
+		}
+	}
+
+	return nil
+}
@@ -17,16 +17,45 @@ type Cluster struct {
 	Pubkey       string `json:"pubkey"`
 	Prikey       string `json:"prikey"`
 	Version      string `json:"version"`
+	NodeBackend  string `json:"node_backend,omitempty"` // the node backend creating the nodes, the one of --node-backend if empty (created by the previous versions)
 
 	Image       string `json:"image"`
 	KernelImage string `json:"kernel_image,omitempty"`
 	KernelArgs  string `json:"kernel_args,omitempty"`
 
 	ExtraOptions map[string]interface{} `json:"extra_options"`
-	Deployed     bool                   `json:"deployed"` // the only status property
+	Deployed     bool                   `json:"deployed"`            // status property
+	Addresses    map[string]string      `json:"addresses,omitempty"` // status property, the persistent node addresses allocated by kubefire
+	Restart      string                 `json:"restart,omitempty"`   // the restart policy of the nodes applied by the supervisor, never if empty
 
-	Master Node `json:"master"`
-	Worker Node `json:"worker"`
+	Master      Node     `json:"master"`
+	Worker      Node     `json:"worker"`
+	WorkerPools []Node   `json:"worker_pools,omitempty"` // the named worker nodes having different resources from the default workers
+	Network     *Network `json:"network,omitempty"`      // the isolated network of the cluster instead of the shared kubefire bridge network
+}
+
+// Network is the isolated bridge network of the cluster. The traffic between the isolated network and other kubefire
+// networks is dropped unless the clusters are routed by each other.
+type Network struct {
+	Subnet string   `json:"subnet"`           // ex: 10.63.0.0/24
+	Routes []string `json:"routes,omitempty"` // the names of the clusters routed with the cluster without NAT
+}
+
+// RoutedWith checks if the cluster is routed with the other cluster by any of them.
+func (c *Cluster) RoutedWith(other *Cluster) bool {
+	for _, pair := range [][]*Cluster{{c, other}, {other, c}} {
+		if pair[0].Network == nil {
+			continue
+		}
+
+		for _, r := range pair[0].Network.Routes {
+			if r == pair[1].Name {
+				return true
+			}
+		}
+	}
+
+	return false
 }
 
 func NewCluster() *Cluster {
@@ -67,11 +96,95 @@ func NewDefaultCluster() *Cluster {
 }
 
 type Node struct {
-	Count    int      `json:"count"`
-	Memory   string   `json:"memory,omitempty"`
-	Cpus     int      `json:"cpus,omitempty"`
-	DiskSize string   `json:"disk_size,omitempty"`
-	Cluster  *Cluster `json:"-"`
+	Name        string            `json:"name,omitempty"` // the pool name, only used by worker pools
+	Count       int               `json:"count"`
+	Memory      string            `json:"memory,omitempty"`
+	Cpus        int               `json:"cpus,omitempty"`
+	DiskSize    string            `json:"disk_size,omitempty"`
+	Image       string            `json:"image,omitempty"`        // override the cluster image if not empty
+	KernelImage string            `json:"kernel_image,omitempty"` // override the cluster kernel image if not empty
+	KernelArgs  string            `json:"kernel_args,omitempty"`  // override the cluster kernel args if not empty
+	Labels      map[string]string `json:"labels,omitempty"`       // Kubernetes node labels
+	Taints      []string          `json:"taints,omitempty"`       // Kubernetes node taints (ex: key=value:NoSchedule)
+	ExtraDisks  []ExtraDisk       `json:"extra_disks,omitempty"`  // raw disks attached in addition to the rootfs
+	Ports       []string          `json:"ports,omitempty"`        // host ports forwarded to node ports by 'node port-forward' (ex: 8443:6443, 80)
+	Cluster     *Cluster          `json:"-"`
+}
+
+// ExtraDisk is the raw disk attached to the node without any filesystem, for example, to test storage systems like
+// Longhorn or Rook.
+type ExtraDisk struct {
+	Size        string `json:"size"`
+	Count       int    `json:"count,omitempty"`        // 1 if not set
+	BackingFile string `json:"backing_file,omitempty"` // the host file copied as the initial content of every disk
+}
+
+func (d *ExtraDisk) GetCount() int {
+	if d.Count > 0 {
+		return d.Count
+	}
+
+	return 1
+}
+
+func (n *Node) GetImage() string {
+	if n.Image != "" {
+		return n.Image
+	}
+
+	return n.Cluster.Image
+}
+
+func (n *Node) GetKernelImage() string {
+	if n.KernelImage != "" {
+		return n.KernelImage
+	}
+
+	return n.Cluster.KernelImage
+}
+
+func (n *Node) GetKernelArgs() string {
+	if n.KernelArgs != "" {
+		return n.KernelArgs
+	}
+
+	return n.Cluster.KernelArgs
+}
+
+// NodeConfigs returns the configs of the master, worker and worker pool nodes.
+func (c *Cluster) NodeConfigs() []*Node {
+	nodes := []*Node{&c.Master, &c.Worker}
+
+	for i := range c.WorkerPools {
+		nodes = append(nodes, &c.WorkerPools[i])
+	}
+
+	return nodes
+}
+
+// NodeConfig returns the node config of the role (master or worker) and the worker pool name, or nil if not found.
+func (c *Cluster) NodeConfig(role string, pool string) *Node {
+	switch {
+	case role == "master" && pool == "":
+		return &c.Master
+	case role == "worker" && pool == "":
+		return &c.Worker
+	case role == "worker":
+		for i := range c.WorkerPools {
+			if c.WorkerPools[i].Name == pool {
+				return &c.WorkerPools[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// UpdateNodeReferences sets the cluster reference of all node configs, which is required after unmarshalling.
+func (c *Cluster) UpdateNodeReferences() {
+	for _, n := range c.NodeConfigs() {
+		n.Cluster = c
+	}
 }
 
 func (c *Cluster) LocalClusterDir() string {
@@ -86,6 +199,12 @@ func (c *Cluster) LocalClusterConfigFile() string {
 	return path.Join(c.LocalClusterDir(), "cluster.yaml")
 }
 
+// LocalNodeLogFile returns the serial console log file of the node, which is kept after the node is deleted until the
+// cluster is deleted.
+func (c *Cluster) LocalNodeLogFile(nodeName string) string {
+	return path.Join(c.LocalClusterDir(), "logs", nodeName+".log")
+}
+
 func (c *Cluster) LocalClusterKeyFiles() (string, string) {
 	return path.Join(c.LocalClusterDir(), "key"), path.Join(c.LocalClusterDir(), "key.pub")
 }
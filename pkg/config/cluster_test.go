@@ -1,6 +1,7 @@
 package config
 
 import (
+	"github.com/goccy/go-yaml"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -120,3 +121,40 @@ func TestCluster_ParseExtraOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestCluster_NodeConfig(t *testing.T) {
+	config := `
+image: default-image
+master:
+  count: 1
+worker:
+  count: 2
+worker_pools:
+- name: gpu
+  count: 1
+  cpus: 8
+  image: gpu-image
+  labels:
+    accelerator: gpu
+  taints:
+  - gpu=true:NoSchedule
+`
+
+	cluster := NewCluster()
+	assert.NoError(t, yaml.Unmarshal([]byte(config), cluster))
+	cluster.UpdateNodeReferences()
+
+	assert.Len(t, cluster.NodeConfigs(), 3)
+	assert.Equal(t, &cluster.Master, cluster.NodeConfig("master", ""))
+	assert.Equal(t, &cluster.Worker, cluster.NodeConfig("worker", ""))
+	assert.Nil(t, cluster.NodeConfig("master", "gpu"))
+	assert.Nil(t, cluster.NodeConfig("worker", "unknown"))
+
+	pool := cluster.NodeConfig("worker", "gpu")
+	assert.NotNil(t, pool)
+	assert.Equal(t, 8, pool.Cpus)
+	assert.Equal(t, "gpu-image", pool.GetImage())
+	assert.Equal(t, "default-image", cluster.Worker.GetImage())
+	assert.Equal(t, map[string]string{"accelerator": "gpu"}, pool.Labels)
+	assert.Equal(t, []string{"gpu=true:NoSchedule"}, pool.Taints)
+}
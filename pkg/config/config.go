@@ -6,6 +6,15 @@ type Manager interface {
 	GetCluster(name string) (*Cluster, error)
 	ListClusters() ([]*Cluster, error)
 
+	SaveSnapshot(snapshot *Snapshot) error
+	DeleteSnapshot(snapshot *Snapshot) error
+	GetSnapshot(clusterName string, name string) (*Snapshot, error)
+
+	// UpdateHealth changes the node health of the cluster exclusively, so the changes of concurrent commands and the
+	// supervisor are not overwritten by each other.
+	UpdateHealth(clusterName string, update func(health *Health)) error
+	GetHealth(clusterName string) (*Health, error)
+
 	SaveBootstrapperVersions(latestVersion BootstrapperVersioner, versions []BootstrapperVersioner) error
 	GetBootstrapperVersions(latestVersion BootstrapperVersioner) ([]BootstrapperVersioner, error)
 	DeleteBootstrapperVersions(latestVersion BootstrapperVersioner) error
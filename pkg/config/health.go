@@ -0,0 +1,48 @@
+package config
+
+import (
+	"path"
+	"time"
+)
+
+const (
+	RestartAlways    = "always"     // restart the nodes stopped unexpectedly, including the nodes shut down cleanly
+	RestartOnFailure = "on-failure" // restart the nodes crashed only
+	RestartNever     = "never"
+)
+
+var RestartPolicies = []string{
+	RestartAlways,
+	RestartOnFailure,
+	RestartNever,
+}
+
+// Health is the node health of the cluster recorded by the supervisor. It is saved apart from the cluster config, so
+// the supervisor does not overwrite the cluster config changed by other commands.
+type Health struct {
+	Cluster string                 `json:"cluster"`
+	Nodes   map[string]*NodeHealth `json:"nodes,omitempty"`
+}
+
+type NodeHealth struct {
+	Restarts    int       `json:"restarts"`
+	LastRestart time.Time `json:"last_restart,omitempty"`
+	Stopped     bool      `json:"stopped,omitempty"` // stopped by kubefire on purpose, which is never restarted by the supervisor
+}
+
+// Node returns the health of the node, which is added if not found.
+func (h *Health) Node(name string) *NodeHealth {
+	if h.Nodes == nil {
+		h.Nodes = map[string]*NodeHealth{}
+	}
+
+	if _, ok := h.Nodes[name]; !ok {
+		h.Nodes[name] = &NodeHealth{}
+	}
+
+	return h.Nodes[name]
+}
+
+func (h *Health) LocalHealthFile() string {
+	return path.Join(ClusterRootDir, h.Cluster, "health.yaml")
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"github.com/goccy/go-yaml"
+	"github.com/innobead/kubefire/pkg/util/flock"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
@@ -20,6 +21,8 @@ var (
 	ClusterRootDir      = path.Join(RootDir, "clusters")
 	BinDir              = path.Join(RootDir, "bin")
 	BootstrapperRootDir = path.Join(RootDir, "bootstrappers")
+	MicroVMRootDir      = path.Join(RootDir, "microvms")
+	SnapshotRootDir     = path.Join(RootDir, "snapshots")
 )
 
 type LocalConfigManager struct {
@@ -84,8 +87,7 @@ func (l *LocalConfigManager) GetCluster(name string) (*Cluster, error) {
 		return nil, errors.WithStack(err)
 	}
 
-	c.Master.Cluster = c
-	c.Worker.Cluster = c
+	c.UpdateNodeReferences()
 
 	return c, nil
 }
@@ -121,6 +123,102 @@ func (l *LocalConfigManager) ListClusters() ([]*Cluster, error) {
 	return clusters, nil
 }
 
+func (l *LocalConfigManager) SaveSnapshot(snapshot *Snapshot) error {
+	logrus.WithFields(logrus.Fields{
+		"cluster":  snapshot.Cluster,
+		"snapshot": snapshot.Name,
+	}).Infoln("saving snapshot configurations")
+
+	if err := os.MkdirAll(snapshot.LocalSnapshotDir(), 0755); err != nil && err != os.ErrExist {
+		return errors.WithStack(err)
+	}
+
+	bytes, err := yaml.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return errors.WithStack(ioutil.WriteFile(snapshot.LocalSnapshotFile(), bytes, 0644))
+}
+
+func (l *LocalConfigManager) DeleteSnapshot(snapshot *Snapshot) error {
+	logrus.WithFields(logrus.Fields{
+		"cluster":  snapshot.Cluster,
+		"snapshot": snapshot.Name,
+	}).Infoln("deleting snapshot")
+
+	return errors.WithStack(os.RemoveAll(snapshot.LocalSnapshotDir()))
+}
+
+func (l *LocalConfigManager) GetSnapshot(clusterName string, name string) (*Snapshot, error) {
+	logrus.WithFields(logrus.Fields{
+		"cluster":  clusterName,
+		"snapshot": name,
+	}).Debugln("getting snapshot configurations")
+
+	s := &Snapshot{Name: name, Cluster: clusterName}
+
+	bytes, err := ioutil.ReadFile(s.LocalSnapshotFile())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := yaml.Unmarshal(bytes, s); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return s, nil
+}
+
+// UpdateHealth re-reads the node health of the cluster, changes and saves it while holding the lock of the health file.
+func (l *LocalConfigManager) UpdateHealth(clusterName string, update func(health *Health)) error {
+	logrus.WithField("cluster", clusterName).Debugln("updating node health")
+
+	h := &Health{Cluster: clusterName}
+
+	lock, err := flock.LockFile(h.LocalHealthFile()+".lock", true)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	health, err := l.GetHealth(clusterName)
+	if err != nil {
+		return err
+	}
+
+	update(health)
+
+	bytes, err := yaml.Marshal(health)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(health.LocalHealthFile(), bytes, 0644))
+}
+
+// GetHealth returns the node health of the cluster, which is empty if nothing recorded yet.
+func (l *LocalConfigManager) GetHealth(clusterName string) (*Health, error) {
+	logrus.WithField("cluster", clusterName).Debugln("getting node health")
+
+	h := &Health{Cluster: clusterName, Nodes: map[string]*NodeHealth{}}
+
+	bytes, err := ioutil.ReadFile(h.LocalHealthFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	if err := yaml.Unmarshal(bytes, h); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return h, nil
+}
+
 func (l *LocalConfigManager) SaveBootstrapperVersions(latestVersion BootstrapperVersioner, versions []BootstrapperVersioner) error {
 	logrus.WithField("bootstrapper", latestVersion.Type()).Debugln("saving bootstrapper version configurations")
 
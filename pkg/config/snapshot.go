@@ -0,0 +1,36 @@
+package config
+
+import (
+	"path"
+	"time"
+)
+
+// Snapshot is a point-in-time copy of a cluster, including the cluster folder (cluster.yaml, keys, kubeconfig) and the
+// disks of all nodes. The memory of nodes is also included if the node backend supports it.
+type Snapshot struct {
+	Name      string            `json:"name"`
+	Cluster   string            `json:"cluster"`
+	Backend   string            `json:"backend"`
+	Memory    bool              `json:"memory"`
+	Nodes     []string          `json:"nodes"`
+	Addresses map[string]string `json:"addresses,omitempty"` // the node addresses when taking snapshot, replaced on the cloned nodes
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+func (s *Snapshot) LocalSnapshotDir() string {
+	return path.Join(SnapshotRootDir, s.Cluster, s.Name)
+}
+
+func (s *Snapshot) LocalSnapshotFile() string {
+	return path.Join(s.LocalSnapshotDir(), "snapshot.yaml")
+}
+
+// LocalClusterDir is the copy of the cluster folder.
+func (s *Snapshot) LocalClusterDir() string {
+	return path.Join(s.LocalSnapshotDir(), "cluster")
+}
+
+// LocalNodeDir is the folder having the disk and memory files of the node created by the node backend.
+func (s *Snapshot) LocalNodeDir(nodeName string) string {
+	return path.Join(s.LocalSnapshotDir(), "nodes", nodeName)
+}
@@ -0,0 +1,13 @@
+package constants
+
+const (
+	CniConfigDir = "/etc/cni/net.d"
+	CniBinDir    = "/opt/cni/bin"
+	// CniConfigFile is the network configuration of the kubefire bridge created by the prerequisites installation.
+	CniConfigFile = "00-kubefire.conflist"
+	// CniSubnet is the default subnet of the kubefire bridge.
+	CniSubnet = "10.62.0.0/16"
+	// CniClusterConfigDir is the folder of the network configurations of the isolated cluster networks generated by
+	// kubefire. They are not in CniConfigDir, so the default network is still the kubefire bridge for other CNI users.
+	CniClusterConfigDir = "/etc/cni/net.d/kubefire"
+)
@@ -0,0 +1,7 @@
+package constants
+
+const (
+	IGNITE      = "ignite"
+	FIRECRACKER = "firecracker"
+	QEMU        = "qemu"
+)
@@ -13,6 +13,7 @@ type Cluster struct {
 
 type Node struct {
 	Name   string
+	Labels map[string]string
 	Spec   config.Node
 	Status NodeStatus
 }
@@ -22,8 +23,35 @@ type NodeStatus struct {
 	IPAddresses string
 	Image       string
 	Kernel      string
+	ExtraDisks  NodeDisks
+	Restarts    int // the times of the node restarted by the supervisor
 }
 
+// NodeDisk is the extra disk attached to the node.
+type NodeDisk struct {
+	Device      string
+	Size        string
+	BackingFile string
+}
+
+type NodeDisks []NodeDisk
+
+func (d NodeDisks) String() string {
+	var disks []string
+
+	for _, disk := range d {
+		disks = append(disks, disk.Device+"="+disk.Size)
+	}
+
+	return strings.Join(disks, ", ")
+}
+
+// Address returns the first address of the node, because ignite may report multiple addresses.
+func (n Node) Address() string {
+	return strings.TrimSpace(strings.Split(n.Status.IPAddresses, ",")[0])
+}
+
+// IsMaster checks the role label of the node, which is added to the legacy nodes by node.MigrateLegacyLabels.
 func (n Node) IsMaster() bool {
-	return strings.Contains(n.Name, "master")
+	return n.Labels["role"] == "master"
 }
@@ -0,0 +1,257 @@
+package node
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"github.com/innobead/kubefire/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// clusterNetworkIsolationChain drops the traffic between the networks not routed with each other. It is in the
+	// mangle table, so it is evaluated before the rules accepting the node traffic added by the CNI firewall plugin.
+	clusterNetworkIsolationChain = "KUBEFIRE-ISOLATION"
+	// clusterNetworkRoutingChain skips the masquerading of the traffic between the routed networks.
+	clusterNetworkRoutingChain = "KUBEFIRE-ROUTING"
+	// cniNetworksDir is the folder of the addresses allocated by the host-local IPAM of CNI.
+	cniNetworksDir = "/var/lib/cni/networks"
+)
+
+type iptablesChain struct {
+	table string
+	chain string
+	hook  string
+	rules [][]string
+}
+
+// ClusterNetworkName returns the CNI network name of the isolated cluster network.
+func ClusterNetworkName(clusterName string) string {
+	return "kubefire-cluster-" + clusterName
+}
+
+// ClusterNetworkBridge returns the bridge name of the isolated cluster network, which is hashed from the cluster name
+// because the interface name is limited to 15 characters.
+func ClusterNetworkBridge(clusterName string) string {
+	sum := sha1.Sum([]byte(clusterName))
+	return fmt.Sprintf("kf%x", sum[:5])
+}
+
+// ClusterNetworkConf returns the CNI network configuration of the isolated cluster network, which is the same as the
+// kubefire bridge network except the bridge and subnet.
+func ClusterNetworkConf(cluster *config.Cluster) ([]byte, error) {
+	conf := map[string]interface{}{
+		"cniVersion": "0.4.0",
+		"name":       ClusterNetworkName(cluster.Name),
+		"plugins": []interface{}{
+			map[string]interface{}{
+				"type":             "bridge",
+				"bridge":           ClusterNetworkBridge(cluster.Name),
+				"isGateway":        true,
+				"isDefaultGateway": true,
+				"promiscMode":      true,
+				"ipMasq":           true,
+				"ipam": map[string]interface{}{
+					"type":   "host-local-rev",
+					"subnet": cluster.Network.Subnet,
+				},
+			},
+			map[string]interface{}{
+				"type": "portmap",
+				"capabilities": map[string]bool{
+					"portMappings": true,
+				},
+			},
+			map[string]interface{}{
+				"type": "firewall",
+			},
+		},
+	}
+
+	bytes, err := json.MarshalIndent(conf, "", "\t")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return bytes, nil
+}
+
+// clusterNetworkChains returns the iptables chains isolating the cluster networks from each other and the kubefire
+// bridge network, except the networks routed with each other, which are not masqueraded.
+func clusterNetworkChains(clusters []*config.Cluster, defaultSubnet string) []*iptablesChain {
+	isolation := &iptablesChain{table: "mangle", chain: clusterNetworkIsolationChain, hook: "FORWARD"}
+	routing := &iptablesChain{table: "nat", chain: clusterNetworkRoutingChain, hook: "POSTROUTING"}
+
+	var isolated []*config.Cluster
+	shared := map[string]bool{}
+
+	for _, c := range clusters {
+		if c.Network != nil {
+			isolated = append(isolated, c)
+		} else {
+			shared[c.Name] = true
+		}
+	}
+
+	sort.Slice(isolated, func(i, j int) bool {
+		return isolated[i].Name < isolated[j].Name
+	})
+
+	addRules := func(subnet string, other string, routed bool) {
+		for _, pair := range [][]string{{subnet, other}, {other, subnet}} {
+			if routed {
+				routing.rules = append(routing.rules, []string{"-s", pair[0], "-d", pair[1], "-j", "ACCEPT"})
+			} else {
+				isolation.rules = append(isolation.rules, []string{"-s", pair[0], "-d", pair[1], "-j", "DROP"})
+			}
+		}
+	}
+
+	for i, c := range isolated {
+		// the kubefire bridge network is routed if any of the clusters on it is routed
+		routedWithShared := false
+		for _, r := range c.Network.Routes {
+			routedWithShared = routedWithShared || shared[r]
+		}
+
+		addRules(c.Network.Subnet, defaultSubnet, routedWithShared)
+
+		for _, other := range isolated[i+1:] {
+			addRules(c.Network.Subnet, other.Network.Subnet, c.RoutedWith(other))
+		}
+	}
+
+	return []*iptablesChain{isolation, routing}
+}
+
+// SyncNetworks generates the CNI network configurations of the isolated cluster networks, removes the networks of the
+// deleted clusters, then updates the iptables rules isolating or routing the networks.
+func (n *MicroVMNetwork) SyncNetworks(ctx context.Context, clusters []*config.Cluster) error {
+	logrus.Debugln("syncing cluster networks")
+
+	if err := os.MkdirAll(n.clusterConfDir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	confFiles := map[string]bool{}
+
+	for _, c := range clusters {
+		if c.Network == nil {
+			continue
+		}
+
+		conf, err := ClusterNetworkConf(c)
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(n.clusterConfFile(c.Name), conf, 0644); err != nil {
+			return errors.WithStack(err)
+		}
+
+		confFiles[n.clusterConfFile(c.Name)] = true
+	}
+
+	entries, err := ioutil.ReadDir(n.clusterConfDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, entry := range entries {
+		f := path.Join(n.clusterConfDir, entry.Name())
+		if confFiles[f] || !strings.HasSuffix(f, ".conflist") {
+			continue
+		}
+
+		if err := n.deleteNetwork(ctx, strings.TrimSuffix(entry.Name(), ".conflist")); err != nil {
+			return err
+		}
+	}
+
+	defaultSubnet, err := DefaultSubnet()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range clusterNetworkChains(clusters, defaultSubnet) {
+		if err := c.apply(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteNetwork deletes the bridge and allocated addresses of the isolated network of the deleted cluster.
+func (n *MicroVMNetwork) deleteNetwork(ctx context.Context, clusterName string) error {
+	logrus.WithField("cluster", clusterName).Infoln("deleting cluster network")
+
+	bridge := ClusterNetworkBridge(clusterName)
+
+	if _, err := os.Stat(path.Join("/sys/class/net", bridge)); err == nil {
+		if _, err := runMicroVMCommand(ctx, "ip", "link", "delete", bridge); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(path.Join(cniNetworksDir, ClusterNetworkName(clusterName))); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.Remove(n.clusterConfFile(clusterName)))
+}
+
+// clusterConfFile returns the network configuration file of the isolated cluster network.
+func (n *MicroVMNetwork) clusterConfFile(clusterName string) string {
+	return path.Join(n.clusterConfDir, clusterName+".conflist")
+}
+
+// confFileOf returns the network configuration of the cluster of the microVM, which is the isolated cluster network if
+// generated, otherwise the kubefire bridge network.
+func (n *MicroVMNetwork) confFileOf(vm *MicroVM) string {
+	f := n.clusterConfFile(vm.Labels[ClusterLabel])
+	if _, err := os.Stat(f); err == nil {
+		return f
+	}
+
+	return n.confFile
+}
+
+// apply replaces the rules of the chain, and makes sure the chain is jumped from the beginning of the hook chain. The
+// chain is not created if there is no rule.
+func (c *iptablesChain) apply(ctx context.Context) error {
+	if _, err := runMicroVMCommand(ctx, "iptables", "-t", c.table, "-S", c.chain); err != nil {
+		if len(c.rules) == 0 {
+			return nil
+		}
+
+		if _, err := runMicroVMCommand(ctx, "iptables", "-t", c.table, "-N", c.chain); err != nil {
+			return err
+		}
+	}
+
+	if _, err := runMicroVMCommand(ctx, "iptables", "-t", c.table, "-F", c.chain); err != nil {
+		return err
+	}
+
+	for _, rule := range c.rules {
+		if _, err := runMicroVMCommand(ctx, "iptables", append([]string{"-t", c.table, "-A", c.chain}, rule...)...); err != nil {
+			return err
+		}
+	}
+
+	if _, err := runMicroVMCommand(ctx, "iptables", "-t", c.table, "-C", c.hook, "-j", c.chain); err != nil {
+		if _, err := runMicroVMCommand(ctx, "iptables", "-t", c.table, "-I", c.hook, "1", "-j", c.chain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package node
+
+import (
+	"github.com/innobead/kubefire/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClusterNetworkChains(t *testing.T) {
+	tests := []struct {
+		name      string
+		clusters  []*config.Cluster
+		isolation [][]string
+		routing   [][]string
+	}{
+		{
+			name:     "shared network only",
+			clusters: []*config.Cluster{{Name: "c1"}},
+		},
+		{
+			name: "isolated networks",
+			clusters: []*config.Cluster{
+				{Name: "c2", Network: &config.Network{Subnet: "10.64.0.0/24"}},
+				{Name: "c1", Network: &config.Network{Subnet: "10.63.0.0/24"}},
+			},
+			isolation: [][]string{
+				{"-s", "10.63.0.0/24", "-d", "10.62.0.0/16", "-j", "DROP"},
+				{"-s", "10.62.0.0/16", "-d", "10.63.0.0/24", "-j", "DROP"},
+				{"-s", "10.63.0.0/24", "-d", "10.64.0.0/24", "-j", "DROP"},
+				{"-s", "10.64.0.0/24", "-d", "10.63.0.0/24", "-j", "DROP"},
+				{"-s", "10.64.0.0/24", "-d", "10.62.0.0/16", "-j", "DROP"},
+				{"-s", "10.62.0.0/16", "-d", "10.64.0.0/24", "-j", "DROP"},
+			},
+		},
+		{
+			name: "routed networks",
+			clusters: []*config.Cluster{
+				{Name: "c0"},
+				{Name: "c1", Network: &config.Network{Subnet: "10.63.0.0/24", Routes: []string{"c0"}}},
+				{Name: "c2", Network: &config.Network{Subnet: "10.64.0.0/24", Routes: []string{"c1"}}},
+			},
+			isolation: [][]string{
+				{"-s", "10.64.0.0/24", "-d", "10.62.0.0/16", "-j", "DROP"},
+				{"-s", "10.62.0.0/16", "-d", "10.64.0.0/24", "-j", "DROP"},
+			},
+			routing: [][]string{
+				{"-s", "10.63.0.0/24", "-d", "10.62.0.0/16", "-j", "ACCEPT"},
+				{"-s", "10.62.0.0/16", "-d", "10.63.0.0/24", "-j", "ACCEPT"},
+				{"-s", "10.63.0.0/24", "-d", "10.64.0.0/24", "-j", "ACCEPT"},
+				{"-s", "10.64.0.0/24", "-d", "10.63.0.0/24", "-j", "ACCEPT"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chains := clusterNetworkChains(tt.clusters, "10.62.0.0/16")
+
+			assert.Equal(t, tt.isolation, chains[0].rules)
+			assert.Equal(t, tt.routing, chains[1].rules)
+		})
+	}
+}
+
+func TestClusterNetworkBridge(t *testing.T) {
+	assert.LessOrEqual(t, len(ClusterNetworkBridge("a-very-long-cluster-name")), 15)
+	assert.NotEqual(t, ClusterNetworkBridge("c1"), ClusterNetworkBridge("c2"))
+}
@@ -0,0 +1,435 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	interr "github.com/innobead/kubefire/internal/error"
+	"github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FakeNodeManager manages the nodes in memory without creating any VM. It is used to test the components depending on node.Manager.
+type FakeNodeManager struct {
+	lock   sync.Mutex
+	nodes  map[string]*data.Node
+	lastIP int
+	caches []interface{}
+	// networks are the subnets of the isolated cluster networks synced
+	networks map[string]string
+	// createFailures are the remaining times of failing to create the nodes
+	createFailures map[string]int
+	// logs are the console logs of the nodes
+	logs map[string]string
+}
+
+func NewFakeNodeManager() *FakeNodeManager {
+	return &FakeNodeManager{
+		nodes:          map[string]*data.Node{},
+		createFailures: map[string]int{},
+		logs:           map[string]string{},
+	}
+}
+
+func (f *FakeNodeManager) CreateNodes(ctx context.Context, nodeType Type, node *config.Node, started bool) error {
+	return f.CreateNodesWithIndices(ctx, nodeType, node, Indices(node.Count), started)
+}
+
+func (f *FakeNodeManager) CreateNodesWithIndices(ctx context.Context, nodeType Type, node *config.Node, indices []int, started bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var err error
+
+	for _, j := range indices {
+		name := ConfigName(nodeType, node, j)
+
+		if _, ok := f.nodes[name]; ok {
+			err = multierror.Append(err, &CreateNodeError{Name: name, Err: errors.Errorf("node (%s) already exists", name)})
+			continue
+		}
+
+		f.lastIP++
+
+		address := node.Cluster.Addresses[name]
+		if address == "" {
+			address = fmt.Sprintf("10.62.%d.%d", f.lastIP/254, f.lastIP%254+1)
+		}
+
+		n := &data.Node{
+			Name:   name,
+			Labels: ConfigLabels(nodeType, node, j),
+			Spec:   *node,
+			Status: data.NodeStatus{
+				Running:     started,
+				IPAddresses: address,
+				Image:       node.GetImage(),
+				Kernel:      node.GetKernelImage(),
+			},
+		}
+		n.Spec.Cluster = config.NewCluster()
+		n.Spec.Cluster.Name = node.Cluster.Name
+
+		for i, disk := range newMicroVMDisks(node.ExtraDisks) {
+			n.Status.ExtraDisks = append(n.Status.ExtraDisks, data.NodeDisk{
+				Device:      ExtraDiskDevice(i),
+				Size:        disk.Size,
+				BackingFile: disk.BackingFile,
+			})
+		}
+
+		f.nodes[name] = n
+
+		// the failed node is left stopped, the same as the VM created but failed to start
+		if f.createFailures[name] > 0 {
+			f.createFailures[name]--
+			n.Status.Running = false
+
+			err = multierror.Append(err, &CreateNodeError{Name: name, Err: errors.Errorf("failed to start node (%s)", name)})
+		}
+	}
+
+	return err
+}
+
+func (f *FakeNodeManager) DeleteNodes(ctx context.Context, nodeType Type, node *config.Node) error {
+	return deleteNodes(ctx, f, nodeType, node)
+}
+
+func (f *FakeNodeManager) DeleteNode(ctx context.Context, name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.nodes[name]; !ok {
+		return errors.WithMessagef(interr.NodeNotFoundError, "%s node unavailable", name)
+	}
+
+	delete(f.nodes, name)
+
+	return nil
+}
+
+func (f *FakeNodeManager) GetNode(ctx context.Context, name string) (*data.Node, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n, ok := f.nodes[name]
+	if !ok {
+		return nil, errors.WithMessagef(interr.NodeNotFoundError, "%s node unavailable", name)
+	}
+
+	return copyNode(n), nil
+}
+
+// ListNodes returns the nodes sorted by role and index, masters first.
+func (f *FakeNodeManager) ListNodes(ctx context.Context, clusterName string) ([]*data.Node, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var nodes []*data.Node
+
+	for _, n := range f.nodes {
+		if IsClusterNode(n.Labels, clusterName) {
+			nodes = append(nodes, copyNode(n))
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Labels[RoleLabel] != nodes[j].Labels[RoleLabel] {
+			return nodes[i].Labels[RoleLabel] == string(Master)
+		}
+
+		left, _ := strconv.Atoi(nodes[i].Labels[IndexLabel])
+		right, _ := strconv.Atoi(nodes[j].Labels[IndexLabel])
+
+		if left == right {
+			return nodes[i].Name < nodes[j].Name
+		}
+
+		return left < right
+	})
+
+	return nodes, nil
+}
+
+func (f *FakeNodeManager) LoginBySSH(ctx context.Context, name string, configManager config.Manager) error {
+	_, err := f.GetNode(ctx, name)
+	return err
+}
+
+func (f *FakeNodeManager) WaitNodesRunning(ctx context.Context, clusterName string, timeout time.Duration) error {
+	nodes, err := f.ListNodes(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if !n.Status.Running {
+			return errors.New(fmt.Sprintf("node (%s) is not running", n.Name))
+		}
+	}
+
+	return nil
+}
+
+func (f *FakeNodeManager) StartNodes(ctx context.Context, clusterName string) error {
+	return startNodes(ctx, f, clusterName)
+}
+
+func (f *FakeNodeManager) StartNode(ctx context.Context, name string) error {
+	return f.setRunning(name, true)
+}
+
+func (f *FakeNodeManager) StopNodes(ctx context.Context, clusterName string) error {
+	return stopNodes(ctx, f, clusterName)
+}
+
+func (f *FakeNodeManager) StopNode(ctx context.Context, name string) error {
+	return f.setRunning(name, false)
+}
+
+// SnapshotNode saves the node to the snapshot folder. The same as ignite, the node has to be stopped if the memory
+// snapshot is not required.
+func (f *FakeNodeManager) SnapshotNode(ctx context.Context, name string, destDir string, memory bool) error {
+	n, err := f.GetNode(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if n.Status.Running != memory {
+		return errors.Errorf("node (%s) has to be running for memory snapshot or stopped for disk snapshot", name)
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return saveSnapshotNodeFile(destDir, n)
+}
+
+// RestoreNode creates or replaces the node of the cluster with the one saved in the snapshot folder.
+func (f *FakeNodeManager) RestoreNode(ctx context.Context, name string, clusterName string, srcDir string, started bool) error {
+	n := &data.Node{}
+	if err := loadSnapshotNodeFile(srcDir, n); err != nil {
+		return err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.lastIP++
+
+	n.Name = name
+	n.Labels[ClusterLabel] = clusterName
+	n.Spec.Cluster = config.NewCluster()
+	n.Spec.Cluster.Name = clusterName
+	n.Status.Running = started
+	n.Status.IPAddresses = fmt.Sprintf("10.62.%d.%d", f.lastIP/254, f.lastIP%254+1)
+	f.nodes[name] = n
+
+	return nil
+}
+
+func (f *FakeNodeManager) ResizeNode(ctx context.Context, name string, spec *config.Node) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n, ok := f.nodes[name]
+	if !ok {
+		return errors.WithMessagef(interr.NodeNotFoundError, "%s node unavailable", name)
+	}
+
+	if n.Status.Running {
+		return errors.Errorf("node (%s) has to be stopped before resizing", name)
+	}
+
+	diskSize, err := diskGrowth(name, n.Spec.DiskSize, spec.DiskSize)
+	if err != nil {
+		return err
+	}
+
+	if diskSize > 0 {
+		n.Spec.DiskSize = spec.DiskSize
+	}
+
+	if spec.Cpus > 0 {
+		n.Spec.Cpus = spec.Cpus
+	}
+
+	if spec.Memory != "" {
+		n.Spec.Memory = spec.Memory
+	}
+
+	return nil
+}
+
+func (f *FakeNodeManager) Logs(ctx context.Context, name string, follow bool, out io.Writer) error {
+	if _, err := f.GetNode(ctx, name); err != nil {
+		return err
+	}
+
+	f.lock.Lock()
+	log, ok := f.logs[name]
+	f.lock.Unlock()
+
+	if !ok {
+		log = fmt.Sprintf("%s console\n", name)
+	}
+
+	_, err := io.WriteString(out, log)
+
+	return errors.WithStack(err)
+}
+
+func (f *FakeNodeManager) SyncNetworks(ctx context.Context, clusters []*config.Cluster) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.networks = map[string]string{}
+
+	for _, c := range clusters {
+		if c.Network != nil {
+			f.networks[c.Name] = c.Network.Subnet
+		}
+	}
+
+	return nil
+}
+
+// Networks returns the subnets of the isolated cluster networks synced by SyncNetworks.
+func (f *FakeNodeManager) Networks() map[string]string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.networks
+}
+
+func (f *FakeNodeManager) GetCaches(ctx context.Context) ([]interface{}, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.caches, nil
+}
+
+func (f *FakeNodeManager) PullImage(ctx context.Context, cacheType string, image string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, c := range f.caches {
+		if c, ok := c.(*MicroVMCache); ok && c.Type == cacheType && c.Name == image {
+			c.LastUsed = time.Now()
+			return image, nil
+		}
+	}
+
+	f.caches = append(f.caches, &MicroVMCache{
+		Type:        cacheType,
+		Name:        image,
+		ID:          "oci://" + image,
+		LastUsed:    time.Now(),
+		Description: "oci://" + image,
+	})
+
+	return image, nil
+}
+
+func (f *FakeNodeManager) DeleteCache(ctx context.Context, cacheType string, name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for i, c := range f.caches {
+		c, ok := c.(*MicroVMCache)
+		if !ok || c.Type != cacheType || c.Name != name {
+			continue
+		}
+
+		if c.InUse {
+			return errors.WithMessagef(interr.CacheInUseError, "%s (%s)", cacheType, name)
+		}
+
+		f.caches = append(append([]interface{}{}, f.caches[:i]...), f.caches[i+1:]...)
+
+		return nil
+	}
+
+	return errors.WithMessagef(interr.NotFoundError, "%s cache (%s)", cacheType, name)
+}
+
+func (f *FakeNodeManager) StorageDir() string {
+	return os.TempDir()
+}
+
+func (f *FakeNodeManager) StoragePool() string {
+	return fmt.Sprintf("fake disks (%s)", os.TempDir())
+}
+
+// SetCaches sets the caches returned by GetCaches, and only *MicroVMCache can be deleted by DeleteCache.
+func (f *FakeNodeManager) SetCaches(caches ...interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.caches = caches
+}
+
+// SetCreateFailures makes creating the node fail for the times.
+func (f *FakeNodeManager) SetCreateFailures(name string, times int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.createFailures[name] = times
+}
+
+// SetLogs sets the console log of the node returned by Logs.
+func (f *FakeNodeManager) SetLogs(name string, log string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.logs[name] = log
+}
+
+// SetAddress changes the address of the node, for example, to simulate the address changed after restarting.
+func (f *FakeNodeManager) SetAddress(name string, address string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n, ok := f.nodes[name]
+	if !ok {
+		return errors.WithMessagef(interr.NodeNotFoundError, "%s node unavailable", name)
+	}
+
+	n.Status.IPAddresses = address
+
+	return nil
+}
+
+func (f *FakeNodeManager) setRunning(name string, running bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n, ok := f.nodes[name]
+	if !ok {
+		return errors.WithMessagef(interr.NodeNotFoundError, "%s node unavailable", name)
+	}
+
+	n.Status.Running = running
+
+	return nil
+}
+
+func copyNode(n *data.Node) *data.Node {
+	c := *n
+
+	c.Labels = map[string]string{}
+	for k, v := range n.Labels {
+		c.Labels[k] = v
+	}
+
+	return &c
+}
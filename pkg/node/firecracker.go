@@ -0,0 +1,301 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/avast/retry-go"
+	"github.com/innobead/kubefire/pkg/constants"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+const firecrackerStopTimeout = 30 * time.Second
+
+// FirecrackerDriver runs the microVM by Firecracker, which is configured via its API socket.
+type FirecrackerDriver struct {
+	binary string
+}
+
+func NewFirecrackerNodeManager() *MicroVMNodeManager {
+	return NewMicroVMNodeManager(NewFirecrackerDriver())
+}
+
+func NewFirecrackerDriver() *FirecrackerDriver {
+	return &FirecrackerDriver{binary: "firecracker"}
+}
+
+func (f *FirecrackerDriver) Name() string {
+	return constants.FIRECRACKER
+}
+
+func (f *FirecrackerDriver) Start(ctx context.Context, vm *MicroVM) (int, error) {
+	logrus.WithField("node", vm.Name).Infoln("booting firecracker microVM")
+
+	requests, err := f.bootRequests(vm)
+	if err != nil {
+		return 0, err
+	}
+
+	return f.launch(ctx, vm, requests)
+}
+
+// bootRequests returns the API requests configuring the microVM before booting. The extra disks are attached after the
+// rootfs in order, so they are the block devices following the root device in the guest.
+func (f *FirecrackerDriver) bootRequests(vm *MicroVM) ([]firecrackerRequest, error) {
+	memory, err := vm.MemoryMiB()
+	if err != nil {
+		return nil, err
+	}
+
+	requests := []firecrackerRequest{
+		{http.MethodPut, "/machine-config", firecrackerMachineConfig{VcpuCount: vm.Cpus, MemSizeMib: memory}},
+		{http.MethodPut, "/boot-source", firecrackerBootSource{KernelImagePath: vm.KernelPath(), BootArgs: vm.BootArgs()}},
+		{http.MethodPut, "/drives/rootfs", firecrackerDrive{DriveID: "rootfs", PathOnHost: vm.RootfsPath(), IsRootDevice: true}},
+	}
+
+	for _, disk := range vm.ExtraDisks {
+		requests = append(requests, firecrackerRequest{http.MethodPut, "/drives/" + disk.ID, firecrackerDrive{DriveID: disk.ID, PathOnHost: vm.ExtraDiskPath(disk)}})
+	}
+
+	return append(
+		requests,
+		firecrackerRequest{http.MethodPut, "/network-interfaces/" + microVMInterface, firecrackerNetworkInterface{IfaceID: microVMInterface, GuestMac: vm.Status.MAC, HostDevName: microVMTapDevice}},
+		firecrackerRequest{http.MethodPut, "/actions", firecrackerAction{ActionType: "InstanceStart"}},
+	), nil
+}
+
+func (f *FirecrackerDriver) Pause(ctx context.Context, vm *MicroVM) error {
+	logrus.WithField("node", vm.Name).Infoln("pausing firecracker microVM")
+
+	return newFirecrackerClient(vm.SocketPath()).request(ctx, http.MethodPatch, "/vm", firecrackerVMState{State: "Paused"})
+}
+
+func (f *FirecrackerDriver) Resume(ctx context.Context, vm *MicroVM) error {
+	logrus.WithField("node", vm.Name).Infoln("resuming firecracker microVM")
+
+	return newFirecrackerClient(vm.SocketPath()).request(ctx, http.MethodPatch, "/vm", firecrackerVMState{State: "Resumed"})
+}
+
+func (f *FirecrackerDriver) SaveSnapshot(ctx context.Context, vm *MicroVM, stateFile string, memoryFile string) error {
+	logrus.WithField("node", vm.Name).Infoln("saving firecracker microVM snapshot")
+
+	return newFirecrackerClient(vm.SocketPath()).request(ctx, http.MethodPut, "/snapshot/create", firecrackerSnapshotCreate{
+		SnapshotType: "Full",
+		SnapshotPath: stateFile,
+		MemFilePath:  memoryFile,
+	})
+}
+
+func (f *FirecrackerDriver) LoadSnapshot(ctx context.Context, vm *MicroVM, stateFile string, memoryFile string) (int, error) {
+	logrus.WithField("node", vm.Name).Infoln("loading firecracker microVM snapshot")
+
+	requests := []firecrackerRequest{
+		{http.MethodPut, "/snapshot/load", firecrackerSnapshotLoad{
+			SnapshotPath: stateFile,
+			MemBackend:   firecrackerMemoryBackend{BackendType: "File", BackendPath: memoryFile},
+			ResumeVM:     true,
+		}},
+	}
+
+	return f.launch(ctx, vm, requests)
+}
+
+// launch starts the Firecracker process, then configures the microVM via the API socket.
+func (f *FirecrackerDriver) launch(ctx context.Context, vm *MicroVM, requests []firecrackerRequest) (int, error) {
+	_ = os.Remove(vm.SocketPath())
+
+	consoleLog, err := os.OpenFile(vm.ConsoleLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer consoleLog.Close()
+
+	// the process is detached from kubefire, so the microVM keeps running after the command exits
+	cmd := exec.Command("ip", "netns", "exec", vm.Netns(), f.binary, "--api-sock", vm.SocketPath(), "--id", vm.Name)
+	cmd.Stdout = consoleLog
+	cmd.Stderr = consoleLog
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	logrus.Debugf("%+v", cmd.Args)
+
+	if err := cmd.Start(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	pid := cmd.Process.Pid
+
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	client := newFirecrackerClient(vm.SocketPath())
+
+	err = retry.Do(func() error {
+		_, err := os.Stat(vm.SocketPath())
+		return err
+	}, retry.Context(ctx), retry.Attempts(50), retry.Delay(100*time.Millisecond), retry.DelayType(retry.FixedDelay))
+
+	if err == nil {
+		for _, r := range requests {
+			if err = client.request(ctx, r.method, r.path, r.body); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+		return 0, err
+	}
+
+	return pid, nil
+}
+
+func (f *FirecrackerDriver) Stop(ctx context.Context, vm *MicroVM) error {
+	logrus.WithField("node", vm.Name).Infoln("shutting down firecracker microVM")
+
+	// the guest reboots with `reboot=k` and then Firecracker exits
+	if err := newFirecrackerClient(vm.SocketPath()).request(ctx, http.MethodPut, "/actions", firecrackerAction{ActionType: "SendCtrlAltDel"}); err != nil {
+		logrus.WithField("node", vm.Name).WithError(err).Warnln("failed to shut down microVM gracefully")
+	}
+
+	err := retry.Do(func() error {
+		if vm.Running() {
+			return errors.Errorf("node (%s) is still running", vm.Name)
+		}
+
+		return nil
+	}, retry.Attempts(uint(firecrackerStopTimeout/time.Second)), retry.Delay(time.Second), retry.DelayType(retry.FixedDelay))
+
+	if err != nil {
+		logrus.WithField("node", vm.Name).Warnln("killing microVM")
+
+		if err := syscall.Kill(vm.Status.Pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return errors.WithStack(err)
+		}
+	}
+
+	_ = os.Remove(vm.SocketPath())
+
+	return nil
+}
+
+type firecrackerMachineConfig struct {
+	VcpuCount  int   `json:"vcpu_count"`
+	MemSizeMib int64 `json:"mem_size_mib"`
+}
+
+type firecrackerBootSource struct {
+	KernelImagePath string `json:"kernel_image_path"`
+	BootArgs        string `json:"boot_args,omitempty"`
+}
+
+type firecrackerDrive struct {
+	DriveID      string `json:"drive_id"`
+	PathOnHost   string `json:"path_on_host"`
+	IsRootDevice bool   `json:"is_root_device"`
+	IsReadOnly   bool   `json:"is_read_only"`
+}
+
+type firecrackerNetworkInterface struct {
+	IfaceID     string `json:"iface_id"`
+	GuestMac    string `json:"guest_mac,omitempty"`
+	HostDevName string `json:"host_dev_name"`
+}
+
+type firecrackerAction struct {
+	ActionType string `json:"action_type"`
+}
+
+type firecrackerVMState struct {
+	State string `json:"state"`
+}
+
+type firecrackerSnapshotCreate struct {
+	SnapshotType string `json:"snapshot_type"`
+	SnapshotPath string `json:"snapshot_path"`
+	MemFilePath  string `json:"mem_file_path"`
+}
+
+type firecrackerSnapshotLoad struct {
+	SnapshotPath string                   `json:"snapshot_path"`
+	MemBackend   firecrackerMemoryBackend `json:"mem_backend"`
+	ResumeVM     bool                     `json:"resume_vm"`
+}
+
+type firecrackerMemoryBackend struct {
+	BackendType string `json:"backend_type"`
+	BackendPath string `json:"backend_path"`
+}
+
+type firecrackerFault struct {
+	FaultMessage string `json:"fault_message"`
+}
+
+type firecrackerRequest struct {
+	method string
+	path   string
+	body   interface{}
+}
+
+// firecrackerClient is the client of the Firecracker API served on the unix socket.
+type firecrackerClient struct {
+	client *http.Client
+}
+
+func newFirecrackerClient(socketPath string) *firecrackerClient {
+	return &firecrackerClient{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// request calls the Firecracker API, which is canceled along with the context.
+func (c *firecrackerClient) request(ctx context.Context, method string, path string, body interface{}) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	logrus.Debugf("firecracker API: %s %s %s", method, path, content)
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, bytes.NewReader(content))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		fault := &firecrackerFault{}
+
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		if err := json.Unmarshal(respBody, fault); err != nil || fault.FaultMessage == "" {
+			fault.FaultMessage = string(respBody)
+		}
+
+		return errors.New(fmt.Sprintf("firecracker API %s %s failed (status: %d): %s", method, path, resp.StatusCode, fault.FaultMessage))
+	}
+
+	return nil
+}
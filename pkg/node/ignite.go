@@ -1,558 +1,707 @@
 package node
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"github.com/avast/retry-go"
+	interr "github.com/innobead/kubefire/internal/error"
 	"github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/constants"
 	"github.com/innobead/kubefire/pkg/data"
 	"github.com/innobead/kubefire/pkg/util"
+	"github.com/innobead/kubefire/pkg/util/flock"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"html/template"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
-	"reflect"
+	"path"
 	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 )
 
+// igniteDataDir is the folder of the images and VMs of ignite, and igniteVMDir is the folder of the VMs. The VM disk is
+// a device mapper snapshot of the VM image, and the changes are stored in the overlay file.
 const (
-	RunCmd    = `ignite run {{.Image}} --name={{.Name}} --label=cluster={{.Cluster}} --ssh={{.Pubkey}} --kernel-image={{.KernelImage}} --kernel-image={{.KernelImage}} --cpus={{.Cpus}} --memory={{.Memory}} --size={{.DiskSize}}`
-	CreateCmd = `ignite create {{.Image}} --name={{.Name}} --label=cluster={{.Cluster}} --ssh={{.Pubkey}} --kernel-image={{.KernelImage}} --kernel-image={{.KernelImage}} --cpus={{.Cpus}} --memory={{.Memory}} --size={{.DiskSize}}`
-	DeleteCmd = "ignite rm {{.Name}} --force"
-	//FIXME: ignite 0.8.0 issue, need specific runtime and network plugin options even there are default values already
-	StartCmd          = "ignite start {{.Name}} --runtime containerd --network-plugin cni"
-	StopCmd           = "ignite stop {{.Name}}"
-	ListImageCmd      = "ignite {{.Image}} ls -q"
-	InspectCmd        = "ignite inspect {{.Resource}} {{.ResourceName}} -t \"{{.ResourceFilter}}\""
-	DeleteResourceCmd = "ignite {{.Resource}} rm {{.ResourceName}}"
+	igniteDataDir     = "/var/lib/firecracker"
+	igniteVMDir       = igniteDataDir + "/vm"
+	igniteOverlayFile = "overlay.dm"
+)
+
+const (
+	// igniteLogsInterval is the interval of saving the console output of the running VMs.
+	igniteLogsInterval = time.Second
+	// igniteLogOffsetSuffix is the suffix of the file recording the size of the console output saved to the log.
+	igniteLogOffsetSuffix = ".offset"
+	// igniteLogFollowSuffix is the suffix of the file locked by the process following the console output.
+	igniteLogFollowSuffix = ".follow"
 )
 
 type IgniteNodeManager struct {
+	client      IgniteClient
+	vmDir       string
+	logFollower func(name string) error // starts following the console output of the started VM in the background
 }
 
 type IgniteCache struct {
 	Type        string
 	Name        string
+	ID          string
+	Size        int64
+	LastUsed    time.Time // the last time the image was pulled or used by nodes
+	InUse       bool      // used by the existing nodes
 	Description string
 }
 
 func NewIgniteNodeManager() *IgniteNodeManager {
-	return &IgniteNodeManager{}
+	manager := NewIgniteNodeManagerWithClient(NewCliIgniteClient(nil))
+	manager.logFollower = startIgniteLogFollower
+
+	return manager
 }
 
-func (i *IgniteNodeManager) CreateNodes(nodeType Type, node *config.Node, started bool) error {
+func NewIgniteNodeManagerWithClient(client IgniteClient) *IgniteNodeManager {
+	return &IgniteNodeManager{client: client, vmDir: igniteVMDir}
+}
+
+func (i *IgniteNodeManager) CreateNodes(ctx context.Context, nodeType Type, node *config.Node, started bool) error {
+	return i.CreateNodesWithIndices(ctx, nodeType, node, Indices(node.Count), started)
+}
+
+func (i *IgniteNodeManager) CreateNodesWithIndices(ctx context.Context, nodeType Type, node *config.Node, indices []int, started bool) error {
+	if len(node.ExtraDisks) > 0 {
+		return errors.WithMessage(interr.NodeExtraDiskNotSupportError, "extra disks are not supported by ignite")
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"cluster": node.Cluster.Name,
 		"started": started,
+		"indices": indices,
 	}).Infof("creating %s nodes of cluster", nodeType)
 
-	templateContent := CreateCmd
-	if started {
-		templateContent = RunCmd
-	}
-
-	tmp, err := template.New("create").Parse(templateContent)
-	if err != nil {
-		return errors.WithStack(err)
-	}
+	return createNodes(nodeType, node, indices, func(name string, j int) error {
+		vm := &IgniteVM{
+			ObjectMeta: IgniteObjectMeta{
+				Name:   name,
+				Labels: ConfigLabels(nodeType, node, j),
+			},
+			Spec: IgniteVMSpec{
+				Image:    IgniteOCISpec{OCI: node.GetImage()},
+				Kernel:   IgniteKernelSpec{OCI: node.GetKernelImage(), CmdLine: node.GetKernelArgs()},
+				CPUs:     node.Cpus,
+				Memory:   node.Memory,
+				DiskSize: node.DiskSize,
+				SSHKey:   node.Cluster.Pubkey,
+			},
+		}
 
-	var wgCreateNode sync.WaitGroup
-
-	for i := 1; i <= node.Count; i++ {
-		tmpBuffer := &bytes.Buffer{}
-
-		n := &struct {
-			Name        string
-			Cluster     string
-			Image       string
-			KernelImage string
-			Pubkey      string
-			Cpus        int
-			Memory      string
-			DiskSize    string
-		}{
-			Name:        Name(node.Cluster.Name, nodeType, i),
-			Cluster:     node.Cluster.Name,
-			Image:       node.Cluster.Image,
-			KernelImage: node.Cluster.KernelImage,
-			Pubkey:      node.Cluster.Pubkey,
-			Cpus:        node.Cpus,
-			Memory:      node.Memory,
-			DiskSize:    node.DiskSize,
+		if err := i.client.CreateVM(ctx, vm, started); err != nil {
+			return err
 		}
 
-		if err := tmp.Execute(tmpBuffer, n); err != nil {
-			return errors.WithStack(err)
+		if started {
+			i.followLogs(name)
 		}
 
-		cmdArgs := strings.Split(tmpBuffer.String(), " ")
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--kernel-args=%s", node.Cluster.KernelArgs))
+		return nil
+	})
+}
 
-		cmd := util.UpdateCommandDefaultLogWithInfo(
-			exec.CommandContext(
-				context.Background(),
-				"sudo",
-				cmdArgs...,
-			),
-		)
+func (i *IgniteNodeManager) DeleteNodes(ctx context.Context, nodeType Type, node *config.Node) error {
+	return deleteNodes(ctx, i, nodeType, node)
+}
 
-		logrus.WithField("node", n.Name).Infoln("creating node")
+func (i *IgniteNodeManager) DeleteNode(ctx context.Context, name string) error {
+	logrus.WithField("node", name).Infoln("deleting node")
 
-		err := cmd.Start()
-		if err != nil {
-			return errors.WithStack(err)
-		}
+	if err := i.SaveLogs(ctx, name); err != nil {
+		logrus.WithField("node", name).WithError(err).Warnln("failed to save node console log")
+	}
+
+	return i.client.RemoveVM(ctx, name)
+}
 
-		wgCreateNode.Add(1)
+func (i *IgniteNodeManager) GetNode(ctx context.Context, name string) (*data.Node, error) {
+	logrus.WithField("node", name).Debugln("getting node")
 
-		go func(name string) {
-			defer wgCreateNode.Done()
+	vm, err := i.client.InspectVM(ctx, name)
+	if err != nil {
+		if errors.Is(err, interr.NodeNotFoundError) {
+			return nil, errors.WithMessagef(interr.NodeNotFoundError, "%s node unavailable", name)
+		}
 
-			if err := cmd.Wait(); err != nil {
-				logrus.WithField("node", name).WithError(err).Errorln("failed to create node")
-			}
-		}(n.Name)
+		return nil, err
 	}
 
-	wgCreateNode.Wait()
+	MigrateLegacyLabels(vm.ObjectMeta.Name, vm.ObjectMeta.Labels)
 
-	return nil
+	if !IsClusterNode(vm.ObjectMeta.Labels, "") {
+		return nil, errors.WithMessagef(interr.NodeNotFoundError, "%s is not a node of any cluster", name)
+	}
+
+	return vmToNode(vm), nil
 }
 
-func (i *IgniteNodeManager) DeleteNodes(nodeType Type, node *config.Node) error {
-	logrus.WithField("cluster", node.Cluster.Name).Infof("deleting %s nodes", nodeType)
+func (i *IgniteNodeManager) ListNodes(ctx context.Context, clusterName string) ([]*data.Node, error) {
+	logrus.WithField("cluster", clusterName).Debugln("listing nodes of cluster")
 
-	for j := 1; j <= node.Count; j++ {
-		name := Name(node.Cluster.Name, nodeType, j)
-		if err := i.DeleteNode(name); err != nil {
-			return err
-		}
+	vms, err := i.client.ListVMs(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	var nodes []*data.Node
 
-func (i *IgniteNodeManager) DeleteNode(name string) error {
-	logrus.WithField("node", name).Infoln("deleting node")
+	for _, vm := range vms {
+		MigrateLegacyLabels(vm.ObjectMeta.Name, vm.ObjectMeta.Labels)
 
-	_, err := i.runCmd(
-		"delete",
-		DeleteCmd,
-		struct {
-			Name string
-		}{
-			Name: name,
-		},
-		true,
-	)
+		if !IsClusterNode(vm.ObjectMeta.Labels, clusterName) {
+			continue
+		}
+
+		nodes = append(nodes, vmToNode(vm))
+	}
 
-	return err
+	return nodes, nil
 }
 
-func (i *IgniteNodeManager) GetNode(name string) (*data.Node, error) {
-	logrus.WithField("node", name).Debugln("getting node")
+func (i *IgniteNodeManager) LoginBySSH(ctx context.Context, name string, configManager config.Manager) error {
+	logrus.WithField("node", name).Infoln("ssh into node")
 
-	cmdArgs := strings.Split(fmt.Sprintf("ignite ps --all -f {{.ObjectMeta.Name}}=%s", name), " ")
-	cmd := util.UpdateCommandDefaultLog(
-		exec.CommandContext(
-			context.Background(),
-			"sudo",
-			cmdArgs...,
-		),
-		logrus.DebugLevel,
-	)
-
-	if err := cmd.Run(); err != nil {
-		return nil, err
+	node, err := i.GetNode(ctx, name)
+	if err != nil {
+		return err
 	}
 
-	node := &data.Node{
-		Name:   name,
-		Spec:   config.Node{Cluster: config.NewCluster()},
-		Status: data.NodeStatus{},
+	cluster, err := configManager.GetCluster(node.Spec.Cluster.Name)
+	if err != nil {
+		return err
 	}
 
-	nodeValueFilters := map[interface{}]map[string]string{
-		node.Spec.Cluster: {
-			"{{.ObjectMeta.Labels.cluster}}": "Name",
-		},
-		&node.Spec: {
-			"{{.Spec.CPUs}}":     "Cpus",
-			"{{.Spec.Memory}}":   "Memory",
-			"{{.Spec.DiskSize}}": "DiskSize",
-		},
-		&node.Status: {
-			"{{.Status.Running}}":             "Running",
-			"{{.Status.Network.IPAddresses}}": "IPAddresses",
-			"{{.Status.Image.ID}}":            "Image",
-			"{{.Status.Kernel.ID}}":           "Kernel",
-		},
+	return i.client.SSH(ctx, name, cluster.Prikey)
+}
+
+// Logs writes the serial console output of the running VM, or the console log saved when the VM is stopped.
+func (i *IgniteNodeManager) Logs(ctx context.Context, name string, follow bool, out io.Writer) error {
+	node, err := i.GetNode(ctx, name)
+	if err != nil {
+		return err
 	}
 
-	for v, filters := range nodeValueFilters {
-		nodeValue := reflect.ValueOf(v).Elem()
+	if !node.Status.Running {
+		return util.TailFile(ctx, node.Spec.Cluster.LocalNodeLogFile(name), false, out)
+	}
 
-		for filter, field := range filters {
-			newCmdArgs := cmdArgs
-			newCmdArgs = append(newCmdArgs, "-t "+filter)
+	written := 0
 
-			cmd := exec.CommandContext(context.Background(), "sudo", newCmdArgs...)
+	for {
+		logs, err := i.client.Logs(ctx, name)
+		if err != nil {
+			return err
+		}
 
-			logrus.Debugf("%+v", cmd.Args)
+		// the output starts over after the VM restarted
+		if len(logs) < written {
+			written = 0
+		}
 
-			output, err := cmd.Output()
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+		if _, err := out.Write(logs[written:]); err != nil {
+			return errors.WithStack(err)
+		}
+		written = len(logs)
 
-			if len(output) == 0 {
-				return nil, errors.Errorf("%s node unavailable", name)
-			}
+		if !follow {
+			return nil
+		}
 
-			fieldValue := strings.TrimSuffix(strings.TrimSpace(string(output)), "\n")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
 
-			f := nodeValue.FieldByName(field)
-			switch f.Kind() {
-			case reflect.String:
-				f.SetString(fieldValue)
+// SaveLogs appends the serial console output of the running VM not saved yet to the console log of the node, because
+// ignite only keeps the output while the VM is running. The size of the output saved is recorded along with the log, so
+// the output is never saved twice by the processes saving it concurrently.
+func (i *IgniteNodeManager) SaveLogs(ctx context.Context, name string) error {
+	node, err := i.GetNode(ctx, name)
+	if err != nil || !node.Status.Running {
+		return err
+	}
 
-			case reflect.Int:
-				if i, err := strconv.ParseInt(fieldValue, 10, 64); err == nil {
-					f.SetInt(i)
-				}
+	logFile := node.Spec.Cluster.LocalNodeLogFile(name)
 
-			case reflect.Bool:
-				if b, err := strconv.ParseBool(fieldValue); err == nil {
-					f.SetBool(b)
-				}
-			}
+	return withIgniteLogOffset(logFile, func(offset int) (int, error) {
+		logs, err := i.client.Logs(ctx, name)
+		if err != nil {
+			return offset, err
 		}
-	}
 
-	return node, nil
-}
+		// the output starts over after the VM restarted
+		if len(logs) < offset {
+			offset = 0
+		}
 
-func (i *IgniteNodeManager) ListNodes(clusterName string) ([]*data.Node, error) {
-	logrus.WithField("cluster", clusterName).Debugln("listing nodes of cluster")
+		return len(logs), util.AppendFile(logFile, logs[offset:])
+	})
+}
 
-	cmdArgs := strings.Split("ignite ps --all", " ")
+// FollowLogs saves the serial console output of the VM every second until the VM is stopped or the context is done.
+// Only one process follows the output of the VM.
+func (i *IgniteNodeManager) FollowLogs(ctx context.Context, name string) error {
+	node, err := i.GetNode(ctx, name)
+	if err != nil {
+		return err
+	}
 
-	if clusterName != "" {
-		cmdArgs = append(
-			cmdArgs,
-			"-f",
-			fmt.Sprintf("{{.ObjectMeta.Name}}=~%s-", clusterName),
-			"-t",
-			"{{.ObjectMeta.Name}}",
-		)
+	lock, err := flock.LockFile(node.Spec.Cluster.LocalNodeLogFile(name)+igniteLogFollowSuffix, false)
+	if err != nil || lock == nil {
+		return err
 	}
+	defer lock.Close()
 
-	cmd := exec.CommandContext(context.Background(), "sudo", cmdArgs...)
+	for {
+		node, err := i.GetNode(ctx, name)
+		if err != nil || !node.Status.Running {
+			return err
+		}
 
-	logrus.Debugf("%+v", cmd.Args)
+		if err := i.SaveLogs(ctx, name); err != nil {
+			logrus.WithField("node", name).WithError(err).Debugln("failed to save node console log")
+		}
 
-	output, err := cmd.Output()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(igniteLogsInterval):
+		}
+	}
+}
+
+// resetLogs marks the start of the VM in the console log of the node, and resets the size of the output saved, because
+// the output starts over after the VM is started.
+func (i *IgniteNodeManager) resetLogs(ctx context.Context, name string) error {
+	node, err := i.GetNode(ctx, name)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return err
 	}
 
-	var nodes []*data.Node
+	logFile := node.Spec.Cluster.LocalNodeLogFile(name)
 
-	if len(output) > 0 {
-		names := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return withIgniteLogOffset(logFile, func(offset int) (int, error) {
+		marker := fmt.Sprintf("\n%s at %s\n", ConsoleLogStartMarker, time.Now().Format(time.RFC3339))
+		return 0, util.AppendFile(logFile, []byte(marker))
+	})
+}
 
-		for _, n := range names {
-			if !IsValidNodeName(n, clusterName) {
-				continue
-			}
+// followLogs starts following the console output of the started VM in the background, and only warns if failed.
+func (i *IgniteNodeManager) followLogs(name string) {
+	if i.logFollower == nil {
+		return
+	}
 
-			node, err := i.GetNode(n)
-			if err != nil {
-				return nil, err
-			}
+	if err := i.logFollower(name); err != nil {
+		logrus.WithField("node", name).WithError(err).Warnln("failed to follow node console log")
+	}
+}
 
-			nodes = append(nodes, node)
-		}
+// startIgniteLogFollower runs the hidden 'kubefire node save-logs' command in the background to save the console output
+// of the VM until it is stopped. The process is detached from kubefire, so it keeps running after the command exits.
+func startIgniteLogFollower(name string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return errors.WithStack(err)
 	}
 
-	return nodes, nil
-}
+	cmd := exec.Command(executable, "--node-backend="+constants.IGNITE, "node", "save-logs", name)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 
-func (i *IgniteNodeManager) LoginBySSH(name string, configManager config.Manager) error {
-	logrus.WithField("node", name).Infoln("ssh into node")
+	logrus.Debugf("%+v", cmd.Args)
+
+	if err := cmd.Start(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	go func() {
+		_ = cmd.Wait()
+	}()
 
-	node, err := i.GetNode(name)
+	return nil
+}
+
+// withIgniteLogOffset calls the function with the size of the console output saved to the console log, and records the
+// size returned. The offset file is locked during the call.
+func withIgniteLogOffset(logFile string, f func(offset int) (int, error)) error {
+	lock, err := flock.LockFile(logFile+igniteLogOffsetSuffix, true)
 	if err != nil {
 		return err
 	}
+	defer lock.Close()
 
-	cluster, err := configManager.GetCluster(node.Spec.Cluster.Name)
+	bytes, err := ioutil.ReadAll(lock)
 	if err != nil {
-		return err
+		return errors.WithStack(err)
 	}
 
-	cmdArgs := strings.Split(fmt.Sprintf("ignite ssh -i %s %s", cluster.Prikey, name), " ")
+	offset, _ := strconv.Atoi(strings.TrimSpace(string(bytes)))
 
-	cmd := exec.CommandContext(
-		context.Background(),
-		"sudo",
-		cmdArgs...,
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	offset, err = f(offset)
+	if err != nil {
+		return err
+	}
 
-	if err := cmd.Run(); err != nil {
+	if err := lock.Truncate(0); err != nil {
 		return errors.WithStack(err)
 	}
 
+	_, err = lock.WriteAt([]byte(strconv.Itoa(offset)), 0)
+
+	return errors.WithStack(err)
+}
+
+func (i *IgniteNodeManager) WaitNodesRunning(ctx context.Context, clusterName string, timeout time.Duration) error {
+	return waitNodesRunning(ctx, i, clusterName, timeout)
+}
+
+func (i *IgniteNodeManager) StartNodes(ctx context.Context, clusterName string) error {
+	return startNodes(ctx, i, clusterName)
+}
+
+func (i *IgniteNodeManager) StartNode(ctx context.Context, name string) error {
+	logrus.WithField("node", name).Infoln("starting node")
+
+	if err := i.resetLogs(ctx, name); err != nil {
+		logrus.WithField("node", name).WithError(err).Warnln("failed to reset node console log")
+	}
+
+	if err := i.client.StartVM(ctx, name); err != nil {
+		return err
+	}
+
+	i.followLogs(name)
+
 	return nil
 }
 
-func (i *IgniteNodeManager) WaitNodesRunning(clusterName string, timeoutMin time.Duration) error {
-	logrus.WithField("cluster", clusterName).Infoln("waiting nodes of cluster running")
+func (i *IgniteNodeManager) StopNodes(ctx context.Context, clusterName string) error {
+	return stopNodes(ctx, i, clusterName)
+}
 
-	err := retry.Do(func() error {
-		nodes, err := i.ListNodes(clusterName)
-		if err != nil {
-			return err
-		}
+func (i *IgniteNodeManager) StopNode(ctx context.Context, name string) error {
+	logrus.WithField("node", name).Infoln("stopping node")
 
-		for _, n := range nodes {
-			if !n.Status.Running {
-				return errors.New(fmt.Sprintf("node (%s) is not running", n.Name))
-			}
-		}
+	if err := i.SaveLogs(ctx, name); err != nil {
+		logrus.WithField("node", name).WithError(err).Warnln("failed to save node console log")
+	}
 
-		return nil
-	}, retry.Delay(5*time.Second), retry.MaxDelay(timeoutMin*time.Minute))
+	return i.client.StopVM(ctx, name)
+}
+
+// SnapshotNode copies the overlay disk of the stopped node. The memory snapshot is not supported by ignite.
+func (i *IgniteNodeManager) SnapshotNode(ctx context.Context, name string, destDir string, memory bool) error {
+	logrus.WithField("node", name).Infoln("taking snapshot of node")
+
+	if memory {
+		return errors.WithMessagef(interr.NodeSnapshotNotSupportError, "memory snapshot of node (%s) is not supported by ignite", name)
+	}
 
+	vm, err := i.client.InspectVM(ctx, name)
 	if err != nil {
+		return err
+	}
+
+	if vm.Status.Running {
+		return errors.Errorf("node (%s) has to be stopped before taking snapshot", name)
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	if err := copyDiskFile(ctx, path.Join(i.vmDir, vm.ObjectMeta.UID, igniteOverlayFile), path.Join(destDir, snapshotDiskFile)); err != nil {
+		return err
+	}
+
+	return saveSnapshotNodeFile(destDir, vm)
 }
 
-func (i *IgniteNodeManager) StartNodes(clusterName string) error {
-	logrus.WithField("cluster", clusterName).Infoln("starting nodes of cluster running")
+// RestoreNode recreates the node of the cluster if it does not exist, then overwrites the overlay disk with the snapshot.
+// The node has to use the same image as the snapshot, because the overlay disk only has the changes to the image.
+func (i *IgniteNodeManager) RestoreNode(ctx context.Context, name string, clusterName string, srcDir string, started bool) error {
+	logrus.WithField("node", name).Infoln("restoring node from snapshot")
 
-	nodes, err := i.ListNodes(clusterName)
-	if err != nil {
+	saved := &IgniteVM{}
+	if err := loadSnapshotNodeFile(srcDir, saved); err != nil {
 		return err
 	}
 
-	for _, n := range nodes {
-		if n.Status.Running {
-			logrus.WithField("node", n.Name).Infoln("node is already running")
-			continue
+	vm, err := i.client.InspectVM(ctx, name)
+	if err != nil {
+		if !errors.Is(err, interr.NodeNotFoundError) {
+			return err
 		}
 
-		if err := i.StartNode(n.Name); err != nil {
+		saved.ObjectMeta.Name = name
+
+		// the VM saved may have no labels, ex: created by the previous versions or other tools
+		if saved.ObjectMeta.Labels == nil {
+			saved.ObjectMeta.Labels = map[string]string{}
+		}
+		saved.ObjectMeta.Labels[ClusterLabel] = clusterName
+		MigrateLegacyLabels(name, saved.ObjectMeta.Labels)
+
+		if err := i.client.CreateVM(ctx, saved, false); err != nil {
+			return err
+		}
+
+		if vm, err = i.client.InspectVM(ctx, name); err != nil {
+			return err
+		}
+	} else if vm.Status.Running {
+		if err := i.client.StopVM(ctx, name); err != nil {
 			return err
 		}
 	}
 
-	return nil
-}
+	if vm.Status.Image.ID != saved.Status.Image.ID {
+		return errors.Errorf("node (%s) image (%s) is different from the snapshot image (%s)", name, vm.Status.Image.ID, saved.Status.Image.ID)
+	}
 
-func (i *IgniteNodeManager) StartNode(name string) error {
-	logrus.WithField("node", name).Infoln("starting node")
+	if err := copyDiskFile(ctx, path.Join(srcDir, snapshotDiskFile), path.Join(i.vmDir, vm.ObjectMeta.UID, igniteOverlayFile)); err != nil {
+		return err
+	}
 
-	_, err := i.runCmd(
-		"start",
-		StartCmd,
-		struct {
-			Name string
-		}{
-			Name: name,
-		},
-		true,
-	)
+	if started {
+		return i.StartNode(ctx, name)
+	}
 
-	return err
+	return nil
 }
 
-func (i *IgniteNodeManager) StopNodes(clusterName string) error {
-	logrus.WithField("cluster", clusterName).Infoln("stopping nodes of cluster running")
+// ResizeNode updates the CPUs and memory of the stopped node. ignite has no command to update VMs, so the node is
+// recreated with the new resources, and the overlay disk is kept the same as restoring the node from a snapshot. Growing
+// the disk is not supported, because the disk is the device mapper snapshot created by ignite with the fixed size.
+func (i *IgniteNodeManager) ResizeNode(ctx context.Context, name string, spec *config.Node) error {
+	logrus.WithFields(logrus.Fields{
+		"node":   name,
+		"cpus":   spec.Cpus,
+		"memory": spec.Memory,
+		"disk":   spec.DiskSize,
+	}).Infoln("resizing node")
 
-	nodes, err := i.ListNodes(clusterName)
+	vm, err := i.client.InspectVM(ctx, name)
 	if err != nil {
 		return err
 	}
 
-	for _, n := range nodes {
-		if !n.Status.Running {
-			logrus.WithField("node", n.Name).Infoln("node is already stopped")
-			continue
-		}
+	if vm.Status.Running {
+		return errors.Errorf("node (%s) has to be stopped before resizing", name)
+	}
 
-		if err := i.StopNode(n.Name); err != nil {
-			return err
-		}
+	diskSize, err := diskGrowth(name, vm.Spec.DiskSize, spec.DiskSize)
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
+	if diskSize > 0 {
+		return errors.WithMessagef(interr.NodeResizeNotSupportError, "growing disk of node (%s) is not supported by ignite", name)
+	}
 
-func (i *IgniteNodeManager) StopNode(name string) error {
-	logrus.WithField("node", name).Infoln("stopping node")
+	if spec.Cpus > 0 {
+		vm.Spec.CPUs = spec.Cpus
+	}
 
-	_, err := i.runCmd(
-		"stop",
-		StopCmd,
-		struct {
-			Name string
-		}{
-			Name: name,
-		},
-		true,
-	)
+	if spec.Memory != "" {
+		vm.Spec.Memory = spec.Memory
+	}
 
-	return err
+	if err := os.MkdirAll(config.RootDir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	tmpDir, err := ioutil.TempDir(config.RootDir, "resize-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := i.SnapshotNode(ctx, name, tmpDir, false); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return err
+	}
+
+	if err := saveSnapshotNodeFile(tmpDir, vm); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return err
+	}
+
+	if err := i.client.RemoveVM(ctx, name); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return err
+	}
+
+	if err := i.RestoreNode(ctx, name, vm.ObjectMeta.Labels[ClusterLabel], tmpDir, false); err != nil {
+		return errors.WithMessagef(err, "failed to recreate node (%s), the disk of node is kept in %s", name, tmpDir)
+	}
+
+	return errors.WithStack(os.RemoveAll(tmpDir))
 }
 
-func (i *IgniteNodeManager) GetCaches() ([]interface{}, error) {
-	var caches []interface{}
+// SyncNetworks does nothing, because ignite always connects the VMs to the first CNI network, so the isolated cluster
+// networks are not supported.
+func (i *IgniteNodeManager) SyncNetworks(ctx context.Context, clusters []*config.Cluster) error {
+	return nil
+}
 
-	resources := []struct {
-		Image          string
-		Filters        []string
-		Resource       string
-		ResourceName   string
-		ResourceFilter string
-	}{
-		{
-			Image:          "image",
-			Filters:        []string{"{{.Spec.OCI}}", "{{.Status.OCISource.ID}}"},
-			Resource:       "image",
-			ResourceFilter: "{{.Name}}",
-		},
-		{
-			Image:          "kernel",
-			Filters:        []string{"{{.Status.OCISource.ID}}"},
-			Resource:       "kernel",
-			ResourceFilter: "{{.Name}}",
-		},
+func (i *IgniteNodeManager) GetCaches(ctx context.Context) ([]interface{}, error) {
+	vms, err := i.client.ListVMs(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, resource := range resources {
-		var cache IgniteCache
+	var caches []interface{}
 
-		output, err := i.runCmd("", ListImageCmd, resource, false)
+	for _, resource := range []IgniteResource{IgniteImageResource, IgniteKernelResource} {
+		images, err := i.client.ListImages(ctx, resource)
 		if err != nil {
 			return nil, err
 		}
-		if output == "" {
-			continue
-		}
-
-		imgIds := strings.Split(output, "\n")
 
-		for _, imgId := range imgIds {
-			imgId = strings.Trim(imgId, "\t\n")
-
-			c := resource
-			c.ResourceName = imgId
+		for _, image := range images {
+			var imgDescription []string
+			if resource == IgniteImageResource {
+				imgDescription = append(imgDescription, image.Spec.OCI)
+			}
+			imgDescription = append(imgDescription, image.Status.OCISource.ID)
+
+			cache := &IgniteCache{
+				Type:        string(resource),
+				Name:        image.ObjectMeta.Name,
+				ID:          image.Status.OCISource.ID,
+				LastUsed:    image.ObjectMeta.Created,
+				Description: strings.Join(imgDescription, ","),
+			}
 
-			imgName, err := i.runCmd("", InspectCmd, c, false)
-			if err != nil {
-				return nil, err
+			if size, err := util.ParseSize(image.Status.OCISource.Size); err == nil {
+				cache.Size = size
 			}
 
-			var imgDescription []string
-			for _, f := range c.Filters {
-				c.ResourceFilter = f
-				description, err := i.runCmd("", InspectCmd, c, false)
-				if err != nil {
-					return nil, err
+			// the image used by a running VM is being used now
+			for _, vm := range vms {
+				if !igniteVMUses(vm, resource, image) {
+					continue
 				}
 
-				imgDescription = append(imgDescription, strings.Trim(description, `"`))
+				cache.InUse = true
+
+				if vm.Status.Running {
+					cache.LastUsed = time.Now()
+				}
 			}
 
-			cache.Type = c.Image
-			cache.Name = strings.Trim(imgName, `"`)
-			cache.Description = strings.Join(imgDescription, ",")
+			caches = append(caches, cache)
 		}
-
-		caches = append(caches, &cache)
 	}
 
 	return caches, nil
 }
 
-func (i *IgniteNodeManager) DeleteCaches() error {
-	logrus.Infof("Deleting ignite image caches")
+func (i *IgniteNodeManager) PullImage(ctx context.Context, cacheType string, image string) (string, error) {
+	resource := IgniteResource(cacheType)
+	if resource != IgniteImageResource && resource != IgniteKernelResource {
+		return "", errors.Errorf("invalid cache type (%s)", cacheType)
+	}
 
-	caches, err := i.GetCaches()
-	if err != nil {
-		return err
+	if err := i.client.ImportImage(ctx, resource, image); err != nil {
+		return "", err
 	}
 
-	for _, c := range caches {
-		c := c.(*IgniteCache)
+	images, err := i.client.ListImages(ctx, resource)
+	if err != nil {
+		return "", err
+	}
 
-		_, err := i.runCmd(
-			"",
-			DeleteResourceCmd,
-			struct {
-				Resource     string
-				ResourceName string
-			}{
-				Resource:     c.Type,
-				ResourceName: c.Name,
-			},
-			true,
-		)
-		if err != nil {
-			return err
+	// ignite adds the latest tag to the image name if no tag specified
+	for _, img := range images {
+		if img.ObjectMeta.Name == image || img.ObjectMeta.Name == image+":latest" {
+			return img.ObjectMeta.Name, nil
 		}
 	}
 
-	return nil
+	return image, nil
 }
 
-func (i *IgniteNodeManager) runCmd(templateName string, templateContent string, templateVars interface{}, logOutput bool) (string, error) {
-	tmp, err := template.New(templateName).Parse(templateContent)
+func (i *IgniteNodeManager) DeleteCache(ctx context.Context, cacheType string, name string) error {
+	caches, err := i.GetCaches(ctx)
 	if err != nil {
-		return "", errors.WithStack(err)
+		return err
 	}
 
-	tmpBuffer := &bytes.Buffer{}
-	if err := tmp.Execute(tmpBuffer, templateVars); err != nil {
-		return "", errors.WithStack(err)
+	for _, c := range caches {
+		c := c.(*IgniteCache)
+
+		if c.Type != cacheType || c.Name != name {
+			continue
+		}
+
+		if c.InUse {
+			return errors.WithMessagef(interr.CacheInUseError, "%s (%s)", cacheType, name)
+		}
+
+		logrus.WithField(cacheType, name).Infoln("deleting ignite cache")
+
+		return i.client.RemoveImage(ctx, IgniteResource(c.Type), c.Name)
 	}
 
-	cmd := exec.CommandContext(
-		context.Background(),
-		"sudo",
-		strings.Split(tmpBuffer.String(), " ")...,
-	)
+	return errors.WithMessagef(interr.NotFoundError, "%s cache (%s)", cacheType, name)
+}
 
-	if logOutput {
-		cmd = util.UpdateCommandDefaultLogWithInfo(cmd)
+// igniteVMUses checks if the VM is created from the image or kernel. The VM status may not have the image ID if the VM
+// is stopped, so the OCI reference of the VM spec is checked as well.
+func igniteVMUses(vm *IgniteVM, resource IgniteResource, image *IgniteImage) bool {
+	oci, id := vm.Spec.Image.OCI, vm.Status.Image.ID
+	if resource == IgniteKernelResource {
+		oci, id = vm.Spec.Kernel.OCI, vm.Status.Kernel.ID
+	}
 
-		if err := cmd.Run(); err != nil {
-			return "", errors.WithStack(err)
-		}
+	return (oci != "" && (oci == image.Spec.OCI || oci == image.ObjectMeta.Name)) || (id != "" && id == image.Status.OCISource.ID)
+}
 
-		return "", nil
+func vmToNode(vm *IgniteVM) *data.Node {
+	node := &data.Node{
+		Name:   vm.ObjectMeta.Name,
+		Labels: vm.ObjectMeta.Labels,
+		Spec: config.Node{
+			Cluster:  config.NewCluster(),
+			Cpus:     vm.Spec.CPUs,
+			Memory:   vm.Spec.Memory,
+			DiskSize: vm.Spec.DiskSize,
+		},
+		Status: data.NodeStatus{
+			Running: vm.Status.Running,
+			Image:   vm.Status.Image.ID,
+			Kernel:  vm.Status.Kernel.ID,
+		},
 	}
 
-	outputBuffer := &bytes.Buffer{}
-	cmd.Stdout = outputBuffer
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	node.Spec.Cluster.Name = vm.ObjectMeta.Labels[ClusterLabel]
 
-	if err := cmd.Run(); err != nil {
-		return "", errors.WithStack(err)
+	if vm.Status.Network != nil {
+		node.Status.IPAddresses = strings.Join(vm.Status.Network.IPAddresses, ", ")
 	}
 
-	return strings.Trim(outputBuffer.String(), "\t\n"), nil
+	return node
+}
+
+func (i *IgniteNodeManager) StorageDir() string {
+	return igniteDataDir
+}
+
+// StoragePool returns the folder of the overlay files, which are the copy-on-write devices of the device mapper
+// snapshots of the VMs, so the disks written by the VMs are allocated from the filesystem of the folder.
+func (i *IgniteNodeManager) StoragePool() string {
+	return fmt.Sprintf("ignite device mapper overlays (%s)", igniteDataDir)
 }
@@ -0,0 +1,346 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	interr "github.com/innobead/kubefire/internal/error"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+type IgniteResource string
+
+const (
+	IgniteVMResource     IgniteResource = "vm"
+	IgniteImageResource  IgniteResource = "image"
+	IgniteKernelResource IgniteResource = "kernel"
+)
+
+// IgniteVM is the subset of the ignite VM API object (ignite.weave.works/v1alpha4) used by kubefire.
+type IgniteVM struct {
+	ObjectMeta IgniteObjectMeta `json:"metadata"`
+	Spec       IgniteVMSpec     `json:"spec"`
+	Status     IgniteVMStatus   `json:"status"`
+}
+
+type IgniteObjectMeta struct {
+	Name    string            `json:"name"`
+	UID     string            `json:"uid,omitempty"`
+	Created time.Time         `json:"created,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+type IgniteVMSpec struct {
+	Image    IgniteOCISpec    `json:"image"`
+	Kernel   IgniteKernelSpec `json:"kernel"`
+	CPUs     int              `json:"cpus"`
+	Memory   string           `json:"memory"`
+	DiskSize string           `json:"diskSize"`
+	SSHKey   string           `json:"-"`
+}
+
+type IgniteOCISpec struct {
+	OCI string `json:"oci"`
+}
+
+type IgniteKernelSpec struct {
+	OCI     string `json:"oci"`
+	CmdLine string `json:"cmdLine,omitempty"`
+}
+
+type IgniteVMStatus struct {
+	Running bool                 `json:"running"`
+	Network *IgniteNetworkStatus `json:"network,omitempty"`
+	Image   IgniteOCISource      `json:"image"`
+	Kernel  IgniteOCISource      `json:"kernel"`
+}
+
+type IgniteNetworkStatus struct {
+	Plugin      string   `json:"plugin,omitempty"`
+	IPAddresses []string `json:"ipAddresses"`
+}
+
+type IgniteOCISource struct {
+	ID   string `json:"id"`
+	Size string `json:"size,omitempty"`
+}
+
+// IgniteImage is the subset of the ignite Image and Kernel API objects used by kubefire.
+type IgniteImage struct {
+	ObjectMeta IgniteObjectMeta `json:"metadata"`
+	Spec       IgniteOCISpec    `json:"spec"`
+	Status     struct {
+		OCISource IgniteOCISource `json:"ociSource"`
+	} `json:"status"`
+}
+
+// igniteVMPsTemplate renders every VM listed by `ignite ps` as a JSON document of IgniteVM, so all VMs can be
+// retrieved by running ignite only once. The template has no json function, so the fields are written out one by one
+// and the strings are quoted by printf. The trailing empty label is to terminate the rendered label map.
+const igniteVMPsTemplate = `{"metadata":{"name":{{printf "%q" .ObjectMeta.Name}},"uid":{{printf "%q" .ObjectMeta.UID}},"labels":{ ` +
+	`{{- range $k, $v := .ObjectMeta.Labels}}{{printf "%q" $k}}:{{printf "%q" $v}},{{end}}"":""}},` +
+	`"spec":{"image":{"oci":{{printf "%q" .Spec.Image.OCI}}},"kernel":{"oci":{{printf "%q" .Spec.Kernel.OCI}},"cmdLine":{{printf "%q" .Spec.Kernel.CmdLine}}},` +
+	`"cpus":{{.Spec.CPUs}},"memory":{{printf "%q" .Spec.Memory}},"diskSize":{{printf "%q" .Spec.DiskSize}}},` +
+	`"status":{"running":{{.Status.Running}},"network":{"ipAddresses":[{{with .Status.Network}}{{range $i, $ip := .IPAddresses}}{{if $i}},{{end}}{{printf "%q" $ip}}{{end}}{{end}}]},` +
+	`"image":{"id":{{with .Status.Image.ID}}{{printf "%q" .}}{{else}}""{{end}}},` +
+	`"kernel":{"id":{{with .Status.Kernel.ID}}{{printf "%q" .}}{{else}}""{{end}}}}}`
+
+// IgniteCmdError is returned when an ignite command exits unsuccessfully.
+type IgniteCmdError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *IgniteCmdError) Error() string {
+	msg := fmt.Sprintf("ignite %s failed (exit code: %d)", strings.Join(e.Args, " "), e.ExitCode)
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+
+	return msg
+}
+
+// Is makes the error comparable to interr.NodeNotFoundError via errors.Is when ignite cannot find the requested resource.
+func (e *IgniteCmdError) Is(target error) bool {
+	if target != interr.NodeNotFoundError && target != interr.NotFoundError {
+		return false
+	}
+
+	stderr := strings.ToLower(e.Stderr)
+
+	return strings.Contains(stderr, "not found") || strings.Contains(stderr, "can't find")
+}
+
+// IgniteExecutor runs ignite with the given arguments. Every argument is passed as is without any shell splitting.
+type IgniteExecutor func(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+
+type IgniteClient interface {
+	CreateVM(ctx context.Context, vm *IgniteVM, started bool) error
+	StartVM(ctx context.Context, name string) error
+	StopVM(ctx context.Context, name string) error
+	RemoveVM(ctx context.Context, name string) error
+	InspectVM(ctx context.Context, name string) (*IgniteVM, error)
+	ListVMs(ctx context.Context) ([]*IgniteVM, error)
+	ListImages(ctx context.Context, resource IgniteResource) ([]*IgniteImage, error)
+	ImportImage(ctx context.Context, resource IgniteResource, name string) error
+	RemoveImage(ctx context.Context, resource IgniteResource, name string) error
+	SSH(ctx context.Context, name string, keyPath string) error
+	Logs(ctx context.Context, name string) ([]byte, error)
+}
+
+// CliIgniteClient manages the ignite API objects via the ignite commands. The ignite API packages are not used, because
+// they bring the whole dependencies of ignite into kubefire, so the objects are decoded from the JSON output of ignite.
+// The metadata files stored by ignite are private to ignite, so they are never read or modified.
+type CliIgniteClient struct {
+	executor IgniteExecutor
+}
+
+func NewCliIgniteClient(executor IgniteExecutor) *CliIgniteClient {
+	if executor == nil {
+		executor = SudoIgniteExecutor
+	}
+
+	return &CliIgniteClient{executor: executor}
+}
+
+// SudoIgniteExecutor runs `sudo ignite` with the given arguments.
+func SudoIgniteExecutor(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	cmd := util.CommandContext(ctx, "sudo", append([]string{"ignite"}, args...)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	logrus.Debugf("%+v", cmd.Args)
+
+	return cmd.Run()
+}
+
+func (c *CliIgniteClient) CreateVM(ctx context.Context, vm *IgniteVM, started bool) error {
+	subCmd := "create"
+	if started {
+		subCmd = "run"
+	}
+
+	args := []string{
+		subCmd,
+		vm.Spec.Image.OCI,
+		"--name=" + vm.ObjectMeta.Name,
+		"--kernel-image=" + vm.Spec.Kernel.OCI,
+		fmt.Sprintf("--cpus=%d", vm.Spec.CPUs),
+		"--memory=" + vm.Spec.Memory,
+		"--size=" + vm.Spec.DiskSize,
+	}
+
+	var labelKeys []string
+	for k := range vm.ObjectMeta.Labels {
+		labelKeys = append(labelKeys, k)
+	}
+	sort.Strings(labelKeys)
+
+	for _, k := range labelKeys {
+		args = append(args, fmt.Sprintf("--label=%s=%s", k, vm.ObjectMeta.Labels[k]))
+	}
+
+	if vm.Spec.SSHKey != "" {
+		args = append(args, "--ssh="+vm.Spec.SSHKey)
+	}
+
+	if vm.Spec.Kernel.CmdLine != "" {
+		args = append(args, "--kernel-args="+vm.Spec.Kernel.CmdLine)
+	}
+
+	return c.runLogged(ctx, args...)
+}
+
+func (c *CliIgniteClient) StartVM(ctx context.Context, name string) error {
+	//FIXME: ignite 0.8.0 issue, need specific runtime and network plugin options even there are default values already
+	return c.runLogged(ctx, "start", name, "--runtime", "containerd", "--network-plugin", "cni")
+}
+
+func (c *CliIgniteClient) StopVM(ctx context.Context, name string) error {
+	return c.runLogged(ctx, "stop", name)
+}
+
+func (c *CliIgniteClient) RemoveVM(ctx context.Context, name string) error {
+	return c.runLogged(ctx, "rm", name, "--force")
+}
+
+func (c *CliIgniteClient) InspectVM(ctx context.Context, name string) (*IgniteVM, error) {
+	output, err := c.run(ctx, "inspect", string(IgniteVMResource), name, "--output", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	vm := &IgniteVM{}
+	if err := json.Unmarshal(output, vm); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return vm, nil
+}
+
+func (c *CliIgniteClient) ListVMs(ctx context.Context) ([]*IgniteVM, error) {
+	output, err := c.run(ctx, "ps", "--all", "-t", igniteVMPsTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var vms []*IgniteVM
+
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		vm := &IgniteVM{}
+
+		if err := decoder.Decode(vm); err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, errors.WithStack(err)
+		}
+
+		delete(vm.ObjectMeta.Labels, "")
+		vms = append(vms, vm)
+	}
+
+	return vms, nil
+}
+
+// ListImages inspects every image or kernel listed by ignite, because `ignite image ls` and `ignite kernel ls` only
+// output the tables.
+func (c *CliIgniteClient) ListImages(ctx context.Context, resource IgniteResource) ([]*IgniteImage, error) {
+	output, err := c.run(ctx, string(resource), "ls", "-q")
+	if err != nil {
+		return nil, err
+	}
+
+	var images []*IgniteImage
+
+	for _, id := range strings.Fields(string(output)) {
+		output, err := c.run(ctx, "inspect", string(resource), id, "--output", "json")
+		if err != nil {
+			return nil, err
+		}
+
+		image := &IgniteImage{}
+		if err := json.Unmarshal(output, image); err != nil {
+			return nil, errors.WithMessagef(err, "invalid %s object (%s)", resource, id)
+		}
+
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+func (c *CliIgniteClient) ImportImage(ctx context.Context, resource IgniteResource, name string) error {
+	return c.runLogged(ctx, string(resource), "import", name)
+}
+
+func (c *CliIgniteClient) RemoveImage(ctx context.Context, resource IgniteResource, name string) error {
+	return c.runLogged(ctx, string(resource), "rm", name)
+}
+
+func (c *CliIgniteClient) SSH(ctx context.Context, name string, keyPath string) error {
+	return c.exec(ctx, []string{"ssh", "-i", keyPath, name}, os.Stdin, os.Stdout, os.Stderr)
+}
+
+func (c *CliIgniteClient) Logs(ctx context.Context, name string) ([]byte, error) {
+	return c.run(ctx, "logs", name)
+}
+
+func (c *CliIgniteClient) run(ctx context.Context, args ...string) ([]byte, error) {
+	stdout := &bytes.Buffer{}
+
+	if err := c.exec(ctx, args, nil, stdout, nil); err != nil {
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (c *CliIgniteClient) runLogged(ctx context.Context, args ...string) error {
+	log := util.NewLogWriter(logrus.NewEntry(logrus.StandardLogger()), logrus.InfoLevel, "")
+
+	return c.exec(ctx, args, nil, log, log)
+}
+
+func (c *CliIgniteClient) exec(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	stderrBuf := &bytes.Buffer{}
+
+	if stderr == nil {
+		stderr = stderrBuf
+	} else {
+		stderr = io.MultiWriter(stderr, stderrBuf)
+	}
+
+	if err := c.executor(ctx, args, stdin, stdout, stderr); err != nil {
+		if ctx.Err() != nil {
+			return errors.WithMessagef(ctx.Err(), "ignite %s interrupted", strings.Join(args, " "))
+		}
+
+		cmdErr := &IgniteCmdError{
+			Args:     args,
+			ExitCode: -1,
+			Stderr:   strings.TrimSpace(stderrBuf.String()),
+		}
+
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			cmdErr.ExitCode = exitErr.ExitCode()
+		}
+
+		return errors.WithStack(cmdErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,490 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	interr "github.com/innobead/kubefire/internal/error"
+	"github.com/innobead/kubefire/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+)
+
+type fakeIgniteExecutor struct {
+	lock    sync.Mutex
+	calls   [][]string
+	outputs map[string]string
+	errors  map[string]string
+	hook    func(args []string) // called before the outputs and errors are looked up, to change them by the calls
+}
+
+func (f *fakeIgniteExecutor) execute(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.calls = append(f.calls, args)
+	key := strings.Join(args, " ")
+
+	if f.hook != nil {
+		f.hook(args)
+	}
+
+	if msg, ok := f.errors[key]; ok {
+		_, _ = fmt.Fprint(stderr, msg)
+		return errors.New("exit status 1")
+	}
+
+	if output, ok := f.outputs[key]; ok {
+		_, _ = fmt.Fprint(stdout, output)
+	}
+
+	return nil
+}
+
+const testVMJson = `{
+  "kind": "VM",
+  "apiVersion": "ignite.weave.works/v1alpha4",
+  "metadata": {"name": "demo-master-1", "uid": "6a3d5b8b", "labels": {"cluster": "demo"}},
+  "spec": {
+    "image": {"oci": "ghcr.io/innobead/kubefire-opensuse-leap:15.2"},
+    "kernel": {"oci": "ghcr.io/innobead/kubefire-ignite-kernel:4.19.125-amd64", "cmdLine": "console=ttyS0"},
+    "cpus": 2, "memory": "2GB", "diskSize": "10GB", "ssh": true
+  },
+  "status": {
+    "running": true,
+    "network": {"plugin": "cni", "ipAddresses": ["10.62.0.2"]},
+    "image": {"id": "oci://ghcr.io/innobead/kubefire-opensuse-leap@sha256:1234", "size": "1GB"},
+    "kernel": {"id": "oci://ghcr.io/innobead/kubefire-ignite-kernel@sha256:5678", "size": "50MB"}
+  }
+}`
+
+func TestIgniteNodeManager_CreateNodes(t *testing.T) {
+	executor := &fakeIgniteExecutor{}
+	manager := NewIgniteNodeManagerWithClient(NewCliIgniteClient(executor.execute))
+
+	cluster := config.NewDefaultCluster()
+	cluster.Name = "demo"
+	cluster.Pubkey = "/tmp/key with space.pub"
+	cluster.Master.Count = 2
+
+	err := manager.CreateNodes(context.Background(), Master, &cluster.Master, true)
+	assert.NoError(t, err)
+	assert.Len(t, executor.calls, 2)
+
+	for _, args := range executor.calls {
+		assert.Equal(t, "run", args[0])
+		assert.Equal(t, cluster.Image, args[1])
+		assert.Contains(t, args, "--ssh=/tmp/key with space.pub")
+		assert.Contains(t, args, "--kernel-args="+cluster.KernelArgs)
+		assert.Contains(t, args, "--label=cluster=demo")
+		assert.Contains(t, args, "--label=role=master")
+	}
+}
+
+func TestIgniteNodeManager_GetNode(t *testing.T) {
+	executor := &fakeIgniteExecutor{
+		outputs: map[string]string{
+			"inspect vm demo-master-1 --output json": testVMJson,
+		},
+		errors: map[string]string{
+			"inspect vm demo-master-2 --output json": `Error: can't find VM with name "demo-master-2"`,
+		},
+	}
+	manager := NewIgniteNodeManagerWithClient(NewCliIgniteClient(executor.execute))
+
+	node, err := manager.GetNode(context.Background(), "demo-master-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "demo-master-1", node.Name)
+	assert.Equal(t, "demo", node.Spec.Cluster.Name)
+	assert.Equal(t, 2, node.Spec.Cpus)
+	assert.Equal(t, "2GB", node.Spec.Memory)
+	assert.True(t, node.Status.Running)
+	assert.Equal(t, "10.62.0.2", node.Status.IPAddresses)
+
+	_, err = manager.GetNode(context.Background(), "demo-master-2")
+	assert.True(t, errors.Is(err, interr.NodeNotFoundError))
+}
+
+// the types shaped like the ignite VM API object rendered by `ignite ps -t`, whose sizes and IDs are formatted by String()
+type testIgniteSize uint64
+
+func (s testIgniteSize) String() string {
+	return fmt.Sprintf("%.1f GB", float64(s)/(1<<30))
+}
+
+type testIgniteOCIContentID struct {
+	repo   string
+	digest string
+}
+
+func (i *testIgniteOCIContentID) String() string {
+	return fmt.Sprintf("oci://%s@%s", i.repo, i.digest)
+}
+
+type testIgniteVM struct {
+	ObjectMeta struct {
+		Name   string
+		UID    string
+		Labels map[string]string
+	}
+	Spec struct {
+		Image  struct{ OCI string }
+		Kernel struct {
+			OCI     string
+			CmdLine string
+		}
+		CPUs     uint64
+		Memory   testIgniteSize
+		DiskSize testIgniteSize
+	}
+	Status struct {
+		Running bool
+		Network *struct{ IPAddresses []net.IP }
+		Image   struct{ ID *testIgniteOCIContentID }
+		Kernel  struct{ ID *testIgniteOCIContentID }
+	}
+}
+
+func TestIgniteVMPsTemplate(t *testing.T) {
+	tmpl, err := template.New("ps").Parse(igniteVMPsTemplate)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	running := testIgniteVM{}
+	running.ObjectMeta.Name = "demo-master-1"
+	running.ObjectMeta.UID = "1"
+	running.ObjectMeta.Labels = map[string]string{"cluster": "demo", "note": `say "hi" to café`}
+	running.Spec.Image.OCI = "image"
+	running.Spec.Kernel.OCI = "kernel"
+	running.Spec.Kernel.CmdLine = "console=ttyS0 ip=dhcp"
+	running.Spec.CPUs = 2
+	running.Spec.Memory = 2 << 30
+	running.Spec.DiskSize = 10 << 30
+	running.Status.Running = true
+	running.Status.Network = &struct{ IPAddresses []net.IP }{IPAddresses: []net.IP{net.ParseIP("10.62.0.2"), net.ParseIP("10.62.0.3")}}
+	running.Status.Image.ID = &testIgniteOCIContentID{repo: "image", digest: "sha256:1234"}
+	running.Status.Kernel.ID = &testIgniteOCIContentID{repo: "kernel", digest: "sha256:5678"}
+
+	// the stopped VM without network, image and kernel status
+	stopped := testIgniteVM{}
+	stopped.ObjectMeta.Name = "demo-worker-1"
+	stopped.ObjectMeta.UID = "2"
+
+	output := &strings.Builder{}
+	for _, vm := range []testIgniteVM{running, stopped} {
+		assert.NoError(t, tmpl.Execute(output, vm))
+		output.WriteString("\n")
+	}
+
+	executor := &fakeIgniteExecutor{
+		outputs: map[string]string{
+			"ps --all -t " + igniteVMPsTemplate: output.String(),
+		},
+	}
+
+	vms, err := NewCliIgniteClient(executor.execute).ListVMs(context.Background())
+	if !assert.NoError(t, err) || !assert.Len(t, vms, 2) {
+		return
+	}
+
+	assert.Equal(t, "demo-master-1", vms[0].ObjectMeta.Name)
+	assert.Equal(t, running.ObjectMeta.Labels, vms[0].ObjectMeta.Labels)
+	assert.Equal(t, "console=ttyS0 ip=dhcp", vms[0].Spec.Kernel.CmdLine)
+	assert.Equal(t, 2, vms[0].Spec.CPUs)
+	assert.Equal(t, "2.0 GB", vms[0].Spec.Memory)
+	assert.Equal(t, "10.0 GB", vms[0].Spec.DiskSize)
+	assert.True(t, vms[0].Status.Running)
+	assert.Equal(t, []string{"10.62.0.2", "10.62.0.3"}, vms[0].Status.Network.IPAddresses)
+	assert.Equal(t, "oci://image@sha256:1234", vms[0].Status.Image.ID)
+	assert.Equal(t, "oci://kernel@sha256:5678", vms[0].Status.Kernel.ID)
+
+	assert.Equal(t, "demo-worker-1", vms[1].ObjectMeta.Name)
+	assert.Empty(t, vms[1].ObjectMeta.Labels)
+	assert.False(t, vms[1].Status.Running)
+	assert.Empty(t, vms[1].Status.Network.IPAddresses)
+	assert.Equal(t, "", vms[1].Status.Image.ID)
+}
+
+func TestIgniteNodeManager_ListNodes(t *testing.T) {
+	psOutput := `{"metadata":{"name":"demo-master-1","uid":"1","labels":{"cluster":"demo"}},` +
+		`"spec":{"image":{"oci":"image"},"kernel":{"oci":"kernel","cmdLine":"console=ttyS0"},"cpus":2,"memory":"2.0 GB","diskSize":"10.0 GB"},` +
+		`"status":{"running":true,"network":{"ipAddresses":["10.62.0.2"]},"image":{"id":"oci://image"},"kernel":{"id":"oci://kernel"}}}
+{"metadata":{"name":"demo-worker-1","uid":"2","labels":{"cluster":"demo"}},` +
+		`"spec":{"image":{"oci":"image"},"kernel":{"oci":"kernel","cmdLine":"console=ttyS0"},"cpus":2,"memory":"2.0 GB","diskSize":"10.0 GB"},` +
+		`"status":{"running":false,"network":{"ipAddresses":[]},"image":{"id":""},"kernel":{"id":""}}}
+{"metadata":{"name":"demo-2-master-1","uid":"3","labels":{"cluster":"demo-2","role":"master","index":"1"}},` +
+		`"spec":{"image":{"oci":"image"},"kernel":{"oci":"kernel","cmdLine":""},"cpus":1,"memory":"1.0 GB","diskSize":"5.0 GB"},` +
+		`"status":{"running":true,"network":{"ipAddresses":["10.62.0.4"]},"image":{"id":"oci://image"},"kernel":{"id":"oci://kernel"}}}
+`
+
+	executor := &fakeIgniteExecutor{
+		outputs: map[string]string{
+			"ps --all -t " + igniteVMPsTemplate: psOutput,
+		},
+	}
+	manager := NewIgniteNodeManagerWithClient(NewCliIgniteClient(executor.execute))
+
+	nodes, err := manager.ListNodes(context.Background(), "demo")
+	assert.NoError(t, err)
+	assert.Len(t, executor.calls, 1)
+	assert.Len(t, nodes, 2)
+
+	assert.Equal(t, "demo-master-1", nodes[0].Name)
+	assert.True(t, nodes[0].IsMaster())
+	assert.True(t, nodes[0].Status.Running)
+	assert.Equal(t, "10.62.0.2", nodes[0].Status.IPAddresses)
+
+	assert.Equal(t, "demo-worker-1", nodes[1].Name)
+	assert.False(t, nodes[1].IsMaster())
+	assert.False(t, nodes[1].Status.Running)
+	assert.Equal(t, "", nodes[1].Status.Image)
+}
+
+func TestIgniteNodeManager_GetCaches(t *testing.T) {
+	psOutput := `{"metadata":{"name":"demo-master-1","uid":"1","labels":{"cluster":"demo"}},` +
+		`"spec":{"image":{"oci":"image-1"},"kernel":{"oci":"kernel-1","cmdLine":""},"cpus":2,"memory":"2.0 GB","diskSize":"10.0 GB"},` +
+		`"status":{"running":false,"network":{"ipAddresses":[]},"image":{"id":""},"kernel":{"id":""}}}
+`
+	imageJson := `{"metadata":{"name":"%s","uid":"%s","created":"2020-01-01T00:00:00Z"},"spec":{"oci":"%s"},"status":{"ociSource":{"id":"oci://%s@sha256:1234","size":"%s"}}}`
+
+	executor := &fakeIgniteExecutor{
+		outputs: map[string]string{
+			"ps --all -t " + igniteVMPsTemplate: psOutput,
+			"image ls -q":                       "a\nb\n",
+			"kernel ls -q":                      "c\n",
+			"inspect image a --output json":     fmt.Sprintf(imageJson, "image-1", "a", "image-1", "image-1", "1.0 GB"),
+			"inspect image b --output json":     fmt.Sprintf(imageJson, "image-2", "b", "image-2", "image-2", "512.0 MB"),
+			"inspect kernel c --output json":    fmt.Sprintf(imageJson, "kernel-1", "c", "kernel-1", "kernel-1", "50.0 MB"),
+		},
+	}
+	manager := NewIgniteNodeManagerWithClient(NewCliIgniteClient(executor.execute))
+
+	caches, err := manager.GetCaches(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, caches, 3)
+	assert.Len(t, executor.calls, 6)
+
+	expected := []IgniteCache{
+		{Type: "image", Name: "image-1", Size: 1 << 30, InUse: true},
+		{Type: "image", Name: "image-2", Size: 512 << 20, InUse: false},
+		{Type: "kernel", Name: "kernel-1", Size: 50 << 20, InUse: true},
+	}
+
+	for i, c := range caches {
+		c := c.(*IgniteCache)
+
+		assert.Equal(t, expected[i].Type, c.Type)
+		assert.Equal(t, expected[i].Name, c.Name)
+		assert.Equal(t, expected[i].Size, c.Size)
+		assert.Equal(t, expected[i].InUse, c.InUse)
+		assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), c.LastUsed.UTC())
+	}
+
+	err = manager.DeleteCache(context.Background(), "image", "image-1")
+	assert.True(t, errors.Is(err, interr.CacheInUseError))
+
+	assert.NoError(t, manager.DeleteCache(context.Background(), "image", "image-2"))
+	assert.Equal(t, []string{"image", "rm", "image-2"}, executor.calls[len(executor.calls)-1])
+}
+
+func TestIgniteNodeManager_PullImage(t *testing.T) {
+	executor := &fakeIgniteExecutor{
+		outputs: map[string]string{
+			"kernel ls -q":                   "a\n",
+			"inspect kernel a --output json": `{"metadata":{"name":"kernel:latest","uid":"a"},"spec":{"oci":"kernel:latest"},"status":{"ociSource":{"id":"oci://kernel@sha256:1234"}}}`,
+		},
+	}
+	manager := NewIgniteNodeManagerWithClient(NewCliIgniteClient(executor.execute))
+
+	name, err := manager.PullImage(context.Background(), "kernel", "kernel")
+	assert.NoError(t, err)
+	assert.Equal(t, "kernel:latest", name)
+	assert.Equal(t, []string{"kernel", "import", "kernel"}, executor.calls[0])
+
+	_, err = manager.PullImage(context.Background(), "vm", "kernel")
+	assert.Error(t, err)
+}
+
+func TestIgniteNodeManager_ResizeNode(t *testing.T) {
+	stoppedVMJson := strings.Replace(testVMJson, `"running": true`, `"running": false`, 1)
+	recreatedVMJson := strings.Replace(stoppedVMJson, `"uid": "6a3d5b8b"`, `"uid": "7b4e6c9c"`, 1)
+	notFound := `Error: can't find VM with name "demo-worker-1"`
+
+	executor := &fakeIgniteExecutor{
+		outputs: map[string]string{
+			"inspect vm demo-master-1 --output json": testVMJson,
+			"inspect vm demo-worker-1 --output json": stoppedVMJson,
+		},
+		errors: map[string]string{},
+	}
+	manager := NewIgniteNodeManagerWithClient(NewCliIgniteClient(executor.execute))
+	manager.vmDir = t.TempDir()
+
+	assert.Error(t, manager.ResizeNode(context.Background(), "demo-master-1", &config.Node{Cpus: 4}))
+
+	err := manager.ResizeNode(context.Background(), "demo-worker-1", &config.Node{DiskSize: "20GB"})
+	assert.True(t, errors.Is(err, interr.NodeResizeNotSupportError))
+	assert.Error(t, manager.ResizeNode(context.Background(), "demo-worker-1", &config.Node{DiskSize: "5GB"}))
+
+	if os.Geteuid() != 0 {
+		t.Skip("copying the overlay disk owned by root requires root permission")
+	}
+
+	rootDir := config.RootDir
+	config.RootDir = t.TempDir()
+	defer func() { config.RootDir = rootDir }()
+
+	assert.NoError(t, os.MkdirAll(path.Join(manager.vmDir, "6a3d5b8b"), 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(manager.vmDir, "6a3d5b8b", igniteOverlayFile), []byte("overlay"), 0644))
+
+	// the VM is recreated by ignite with a new uid
+	executor.hook = func(args []string) {
+		switch args[0] {
+		case "rm":
+			executor.errors["inspect vm demo-worker-1 --output json"] = notFound
+		case "create":
+			delete(executor.errors, "inspect vm demo-worker-1 --output json")
+			executor.outputs["inspect vm demo-worker-1 --output json"] = recreatedVMJson
+			_ = os.MkdirAll(path.Join(manager.vmDir, "7b4e6c9c"), 0755)
+		}
+	}
+	executor.calls = nil
+
+	assert.NoError(t, manager.ResizeNode(context.Background(), "demo-worker-1", &config.Node{Cpus: 4, Memory: "4GB", DiskSize: "10GB"}))
+
+	var createArgs []string
+	for _, args := range executor.calls {
+		if args[0] == "create" {
+			createArgs = args
+		}
+	}
+	assert.Contains(t, createArgs, "--cpus=4")
+	assert.Contains(t, createArgs, "--memory=4GB")
+	assert.Contains(t, createArgs, "--label=cluster=demo")
+
+	bytes, err := ioutil.ReadFile(path.Join(manager.vmDir, "7b4e6c9c", igniteOverlayFile))
+	assert.NoError(t, err)
+	assert.Equal(t, "overlay", string(bytes))
+
+	files, err := ioutil.ReadDir(config.RootDir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestIgniteNodeManager_RestoreNode(t *testing.T) {
+	stoppedVMJson := strings.Replace(testVMJson, `"running": true`, `"running": false`, 1)
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+	}{
+		{"snapshot with labels", Labels("demo", Master, 1)},
+		{"snapshot without labels", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if os.Geteuid() != 0 {
+				t.Skip("copying the overlay disk owned by root requires root permission")
+			}
+
+			srcDir := t.TempDir()
+
+			saved := &IgniteVM{}
+			assert.NoError(t, json.Unmarshal([]byte(stoppedVMJson), saved))
+			saved.ObjectMeta.Labels = tt.labels
+			assert.NoError(t, saveSnapshotNodeFile(srcDir, saved))
+			assert.NoError(t, ioutil.WriteFile(path.Join(srcDir, snapshotDiskFile), []byte("overlay"), 0644))
+
+			executor := &fakeIgniteExecutor{
+				outputs: map[string]string{},
+				errors: map[string]string{
+					"inspect vm demo-2-master-1 --output json": `Error: can't find VM with name "demo-2-master-1"`,
+				},
+			}
+			manager := NewIgniteNodeManagerWithClient(NewCliIgniteClient(executor.execute))
+			manager.vmDir = t.TempDir()
+
+			executor.hook = func(args []string) {
+				if args[0] == "create" {
+					delete(executor.errors, "inspect vm demo-2-master-1 --output json")
+					executor.outputs["inspect vm demo-2-master-1 --output json"] = stoppedVMJson
+					_ = os.MkdirAll(path.Join(manager.vmDir, "6a3d5b8b"), 0755)
+				}
+			}
+
+			assert.NoError(t, manager.RestoreNode(context.Background(), "demo-2-master-1", "demo-2", srcDir, false))
+
+			var createArgs []string
+			for _, args := range executor.calls {
+				if args[0] == "create" {
+					createArgs = args
+				}
+			}
+			assert.Contains(t, createArgs, "--name=demo-2-master-1")
+			for _, label := range []string{"--label=cluster=demo-2", "--label=role=master", "--label=index=1"} {
+				assert.Contains(t, createArgs, label)
+			}
+
+			bytes, err := ioutil.ReadFile(path.Join(manager.vmDir, "6a3d5b8b", igniteOverlayFile))
+			assert.NoError(t, err)
+			assert.Equal(t, "overlay", string(bytes))
+		})
+	}
+}
+
+func TestIgniteNodeManager_SaveLogs(t *testing.T) {
+	rootDir := config.ClusterRootDir
+	config.ClusterRootDir = t.TempDir()
+	defer func() { config.ClusterRootDir = rootDir }()
+
+	executor := &fakeIgniteExecutor{
+		outputs: map[string]string{
+			"inspect vm demo-master-1 --output json": testVMJson,
+		},
+	}
+	manager := NewIgniteNodeManagerWithClient(NewCliIgniteClient(executor.execute))
+
+	var followed []string
+	manager.logFollower = func(name string) error {
+		followed = append(followed, name)
+		return nil
+	}
+
+	cluster := config.NewCluster()
+	cluster.Name = "demo"
+	logFile := cluster.LocalNodeLogFile("demo-master-1")
+
+	assert.NoError(t, manager.StartNode(context.Background(), "demo-master-1"))
+	assert.Equal(t, []string{"demo-master-1"}, followed)
+
+	// the output saved concurrently or repeatedly is only appended once
+	for _, output := range []string{"boot\n", "boot\nlogin:\n", "boot\nlogin:\n"} {
+		executor.outputs["logs demo-master-1"] = output
+		assert.NoError(t, manager.SaveLogs(context.Background(), "demo-master-1"))
+	}
+
+	// the output starts over after the VM restarted
+	assert.NoError(t, manager.StartNode(context.Background(), "demo-master-1"))
+	executor.outputs["logs demo-master-1"] = "boot\n"
+	assert.NoError(t, manager.SaveLogs(context.Background(), "demo-master-1"))
+
+	bytes, err := ioutil.ReadFile(logFile)
+	assert.NoError(t, err)
+
+	boots := strings.Split(string(bytes), ConsoleLogStartMarker)
+	assert.Len(t, boots, 3)
+	assert.True(t, strings.HasSuffix(boots[1], "\nboot\nlogin:\n\n"))
+	assert.True(t, strings.HasSuffix(boots[2], "\nboot\n"))
+}
@@ -0,0 +1,185 @@
+package node
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/constants"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+)
+
+// IPAM allocates the persistent node addresses from the subnet of the kubefire CNI bridge network. The addresses are
+// recorded in the cluster config, then requested from CNI when starting the nodes, so the nodes keep the same addresses
+// after restarting.
+type IPAM struct {
+	rangeStart uint32
+	rangeEnd   uint32
+}
+
+type cniIPAMRange struct {
+	Subnet     string `json:"subnet"`
+	RangeStart string `json:"rangeStart"`
+	RangeEnd   string `json:"rangeEnd"`
+}
+
+type cniIPAMConfig struct {
+	cniIPAMRange
+	Ranges [][]cniIPAMRange `json:"ranges"`
+}
+
+// NewDefaultIPAM returns the IPAM of the kubefire CNI bridge network, or the default subnet if the network
+// configuration is not available.
+func NewDefaultIPAM() (*IPAM, error) {
+	r, err := defaultIPAMRange()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewIPAM(r.Subnet, r.RangeStart, r.RangeEnd)
+}
+
+// NewClusterIPAM returns the IPAM of the isolated network of the cluster, or the kubefire CNI bridge network if the
+// cluster does not have its own network.
+func NewClusterIPAM(cluster *config.Cluster) (*IPAM, error) {
+	if cluster.Network != nil {
+		return NewIPAM(cluster.Network.Subnet, "", "")
+	}
+
+	return NewDefaultIPAM()
+}
+
+// DefaultSubnet returns the subnet of the kubefire CNI bridge network.
+func DefaultSubnet() (string, error) {
+	r, err := defaultIPAMRange()
+	if err != nil {
+		return "", err
+	}
+
+	return r.Subnet, nil
+}
+
+func defaultIPAMRange() (*cniIPAMRange, error) {
+	defaultRange := &cniIPAMRange{Subnet: constants.CniSubnet}
+
+	content, err := ioutil.ReadFile(path.Join(constants.CniConfigDir, constants.CniConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return defaultRange, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	conf := struct {
+		Plugins []struct {
+			IPAM *cniIPAMConfig `json:"ipam"`
+		} `json:"plugins"`
+	}{}
+
+	if err := json.Unmarshal(content, &conf); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, p := range conf.Plugins {
+		switch {
+		case p.IPAM == nil:
+			continue
+		case p.IPAM.Subnet != "":
+			return &p.IPAM.cniIPAMRange, nil
+		case len(p.IPAM.Ranges) > 0 && len(p.IPAM.Ranges[0]) > 0:
+			return &p.IPAM.Ranges[0][0], nil
+		}
+	}
+
+	return defaultRange, nil
+}
+
+// NewIPAM returns the IPAM allocating the addresses in the range of the IPv4 subnet. The same as host-local IPAM of CNI,
+// the range excludes the network, gateway and broadcast addresses if not specified.
+func NewIPAM(subnet string, rangeStart string, rangeEnd string) (*IPAM, error) {
+	_, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if ipNet.IP.To4() == nil {
+		return nil, errors.Errorf("IPv6 subnet (%s) is not supported", subnet)
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones < 2 {
+		return nil, errors.Errorf("subnet (%s) is too small", subnet)
+	}
+
+	network := ipToUint32(ipNet.IP)
+
+	ipam := &IPAM{
+		rangeStart: network + 2,
+		rangeEnd:   network + (1 << uint(bits-ones)) - 2,
+	}
+
+	for _, r := range []struct {
+		value string
+		dest  *uint32
+	}{
+		{rangeStart, &ipam.rangeStart},
+		{rangeEnd, &ipam.rangeEnd},
+	} {
+		if r.value == "" {
+			continue
+		}
+
+		ip := net.ParseIP(r.value)
+		if ip == nil || !ipNet.Contains(ip) {
+			return nil, errors.Errorf("address (%s) is not in subnet (%s)", r.value, subnet)
+		}
+
+		*r.dest = ipToUint32(ip)
+	}
+
+	return ipam, nil
+}
+
+// Allocate returns the addresses of the node names, which are not in the used addresses.
+func (i *IPAM) Allocate(names []string, used []string) (map[string]string, error) {
+	usedIPs := map[uint32]bool{}
+
+	for _, u := range used {
+		if ip := net.ParseIP(u); ip != nil && ip.To4() != nil {
+			usedIPs[ipToUint32(ip)] = true
+		}
+	}
+
+	addresses := map[string]string{}
+	next := i.rangeStart
+
+	for _, name := range names {
+		for next <= i.rangeEnd && usedIPs[next] {
+			next++
+		}
+
+		if next > i.rangeEnd {
+			return nil, errors.Errorf("no address available for node (%s)", name)
+		}
+
+		addresses[name] = uint32ToIP(next).String()
+		usedIPs[next] = true
+	}
+
+	return addresses, nil
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIP(value uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, value)
+
+	return ip
+}
@@ -0,0 +1,51 @@
+package node
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIPAM_Allocate(t *testing.T) {
+	tests := []struct {
+		name       string
+		subnet     string
+		rangeStart string
+		used       []string
+		expected   map[string]string
+		wantErr    bool
+	}{
+		{
+			name:     "skip used addresses",
+			subnet:   "10.62.0.0/16",
+			used:     []string{"10.62.0.2", "10.62.0.4", ""},
+			expected: map[string]string{"a": "10.62.0.3", "b": "10.62.0.5"},
+		},
+		{
+			name:       "range start",
+			subnet:     "10.62.0.0/16",
+			rangeStart: "10.62.128.0",
+			expected:   map[string]string{"a": "10.62.128.0", "b": "10.62.128.1"},
+		},
+		{
+			name:    "no address available",
+			subnet:  "10.62.0.0/29",
+			used:    []string{"10.62.0.2", "10.62.0.3", "10.62.0.4", "10.62.0.5"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipam, err := NewIPAM(tt.subnet, tt.rangeStart, "")
+			assert.NoError(t, err)
+
+			addresses, err := ipam.Allocate([]string{"a", "b"}, tt.used)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, addresses)
+		})
+	}
+}
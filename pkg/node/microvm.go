@@ -0,0 +1,932 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	interr "github.com/innobead/kubefire/internal/error"
+	"github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/constants"
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const microVMStateFile = "vm.json"
+
+var kernelIPArgPattern = regexp.MustCompile(`(^|\s)ip=\S*`)
+
+// MicroVMDriver runs the hypervisor process of a microVM. The rootfs, kernel and network of the microVM are already
+// prepared by MicroVMNodeManager before starting, so a driver only needs to know how to boot and shut down the VM.
+type MicroVMDriver interface {
+	Name() string
+	Start(ctx context.Context, vm *MicroVM) (int, error)
+	Stop(ctx context.Context, vm *MicroVM) error
+}
+
+// MicroVMSnapshotter is implemented by the drivers supporting the memory snapshot of running microVMs.
+type MicroVMSnapshotter interface {
+	Pause(ctx context.Context, vm *MicroVM) error
+	Resume(ctx context.Context, vm *MicroVM) error
+	SaveSnapshot(ctx context.Context, vm *MicroVM, stateFile string, memoryFile string) error
+	LoadSnapshot(ctx context.Context, vm *MicroVM, stateFile string, memoryFile string) (int, error)
+}
+
+// MicroVM is the persisted state of a node managed by MicroVMNodeManager.
+type MicroVM struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels"`
+	Image       string            `json:"image"`
+	KernelImage string            `json:"kernelImage"`
+	KernelArgs  string            `json:"kernelArgs"`
+	Cpus        int               `json:"cpus"`
+	Memory      string            `json:"memory"`
+	DiskSize    string            `json:"diskSize"`
+	ExtraDisks  []MicroVMDisk     `json:"extraDisks,omitempty"`
+	Address     string            `json:"address,omitempty"` // the persistent address requested from CNI
+	Status      MicroVMStatus     `json:"status"`
+
+	dir string
+}
+
+type MicroVMStatus struct {
+	Pid       int    `json:"pid,omitempty"`
+	ImageID   string `json:"imageID,omitempty"`
+	KernelID  string `json:"kernelID,omitempty"`
+	MAC       string `json:"mac,omitempty"`
+	IPAddress string `json:"ipAddress,omitempty"`
+	PrefixLen int    `json:"prefixLen,omitempty"`
+	Gateway   string `json:"gateway,omitempty"`
+}
+
+// MicroVMDisk is the extra raw disk of the microVM, which is attached after the rootfs in order.
+type MicroVMDisk struct {
+	ID          string `json:"id"`
+	Size        string `json:"size"`
+	BackingFile string `json:"backingFile,omitempty"`
+}
+
+type MicroVMCache struct {
+	Type        string
+	Name        string
+	ID          string
+	Size        int64
+	LastUsed    time.Time // the last time the image was pulled or used by nodes
+	InUse       bool      // used by the existing nodes
+	Description string
+}
+
+func (m *MicroVM) Dir() string {
+	return m.dir
+}
+
+func (m *MicroVM) RootfsPath() string {
+	return path.Join(m.dir, "rootfs.ext4")
+}
+
+func (m *MicroVM) ExtraDiskPath(disk MicroVMDisk) string {
+	return path.Join(m.dir, disk.ID+".img")
+}
+
+func (m *MicroVM) KernelPath() string {
+	return path.Join(m.dir, "vmlinux")
+}
+
+func (m *MicroVM) SocketPath() string {
+	return path.Join(m.dir, "api.sock")
+}
+
+// ConsoleLogPath returns the serial console log file in the cluster folder, so it is kept after the microVM is deleted.
+func (m *MicroVM) ConsoleLogPath() string {
+	cluster := config.NewCluster()
+	cluster.Name = m.Labels[ClusterLabel]
+
+	return cluster.LocalNodeLogFile(m.Name)
+}
+
+// Netns is the network namespace holding the CNI interface and the TAP device of the microVM.
+func (m *MicroVM) Netns() string {
+	return "kubefire-" + m.Name
+}
+
+func (m *MicroVM) MemoryMiB() (int64, error) {
+	size, err := util.ParseSize(m.Memory)
+	if err != nil {
+		return 0, err
+	}
+
+	return size >> 20, nil
+}
+
+// BootArgs returns the kernel arguments with the static address allocated from CNI instead of `ip=dhcp`.
+func (m *MicroVM) BootArgs() string {
+	args := strings.TrimSpace(kernelIPArgPattern.ReplaceAllString(m.KernelArgs, ""))
+
+	if m.Status.IPAddress == "" {
+		return args
+	}
+
+	netmask := "255.255.255.255"
+	if m.Status.PrefixLen > 0 {
+		mask := uint32(0xffffffff) << (32 - uint(m.Status.PrefixLen))
+		netmask = fmt.Sprintf("%d.%d.%d.%d", byte(mask>>24), byte(mask>>16), byte(mask>>8), byte(mask))
+	}
+
+	return strings.TrimSpace(fmt.Sprintf(
+		"%s ip=%s::%s:%s:%s:eth0:off",
+		args,
+		m.Status.IPAddress,
+		m.Status.Gateway,
+		netmask,
+		m.Name,
+	))
+}
+
+// Running checks if the hypervisor process of the microVM is still alive. The process command line has to have the
+// VM name as the exact --id (firecracker) or -name (qemu) argument to avoid treating a reused pid as the VM process.
+func (m *MicroVM) Running() bool {
+	if m.Status.Pid <= 0 {
+		return false
+	}
+
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", m.Status.Pid))
+	if err != nil {
+		return false
+	}
+
+	return isMicroVMProcess(cmdline, m.Name)
+}
+
+// microVMBackends are the node backends of the microVM drivers, which share the image caches.
+var microVMBackends = []string{
+	constants.FIRECRACKER,
+	constants.QEMU,
+}
+
+// MicroVMNodeManager manages nodes as microVMs run by the hypervisor directly without ignite.
+// Every microVM is stored in its own directory under config.MicroVMRootDir.
+type MicroVMNodeManager struct {
+	driver  MicroVMDriver
+	rootDir string
+	images  *MicroVMImageBuilder
+	network *MicroVMNetwork
+}
+
+func NewMicroVMNodeManager(driver MicroVMDriver) *MicroVMNodeManager {
+	return &MicroVMNodeManager{
+		driver:  driver,
+		rootDir: path.Join(config.MicroVMRootDir, driver.Name()),
+		images:  NewMicroVMImageBuilder(config.MicroVMRootDir),
+		network: NewMicroVMNetwork(),
+	}
+}
+
+func (m *MicroVMNodeManager) CreateNodes(ctx context.Context, nodeType Type, node *config.Node, started bool) error {
+	return m.CreateNodesWithIndices(ctx, nodeType, node, Indices(node.Count), started)
+}
+
+func (m *MicroVMNodeManager) CreateNodesWithIndices(ctx context.Context, nodeType Type, node *config.Node, indices []int, started bool) error {
+	logrus.WithFields(logrus.Fields{
+		"cluster": node.Cluster.Name,
+		"started": started,
+		"indices": indices,
+		"backend": m.driver.Name(),
+	}).Infof("creating %s nodes of cluster", nodeType)
+
+	if err := checkRootPermission(m.driver.Name()); err != nil {
+		return err
+	}
+
+	rootfs, err := m.images.Rootfs(ctx, node.GetImage())
+	if err != nil {
+		return err
+	}
+
+	kernel, err := m.images.Kernel(ctx, node.GetKernelImage())
+	if err != nil {
+		return err
+	}
+
+	pubkey, err := ioutil.ReadFile(node.Cluster.Pubkey)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return createNodes(nodeType, node, indices, func(name string, j int) error {
+		vm := &MicroVM{
+			Name:        name,
+			Labels:      ConfigLabels(nodeType, node, j),
+			Image:       node.GetImage(),
+			KernelImage: node.GetKernelImage(),
+			KernelArgs:  node.GetKernelArgs(),
+			Cpus:        node.Cpus,
+			Memory:      node.Memory,
+			DiskSize:    node.DiskSize,
+			ExtraDisks:  newMicroVMDisks(node.ExtraDisks),
+			Address:     node.Cluster.Addresses[name],
+			Status: MicroVMStatus{
+				ImageID:  rootfs.ID,
+				KernelID: kernel.ID,
+			},
+			dir: path.Join(m.rootDir, name),
+		}
+
+		return m.createVM(ctx, vm, rootfs, kernel, pubkey, started)
+	})
+}
+
+func (m *MicroVMNodeManager) DeleteNodes(ctx context.Context, nodeType Type, node *config.Node) error {
+	return deleteNodes(ctx, m, nodeType, node)
+}
+
+func (m *MicroVMNodeManager) DeleteNode(ctx context.Context, name string) error {
+	logrus.WithField("node", name).Infoln("deleting node")
+
+	vm, err := m.loadVM(name)
+	if err != nil {
+		return err
+	}
+
+	if vm.Running() {
+		if err := m.stopVM(ctx, vm); err != nil {
+			return err
+		}
+	} else if err := m.network.Teardown(ctx, vm); err != nil {
+		logrus.WithField("node", name).WithError(err).Warnln("failed to clean up node network")
+	}
+
+	return errors.WithStack(os.RemoveAll(vm.dir))
+}
+
+func (m *MicroVMNodeManager) GetNode(ctx context.Context, name string) (*data.Node, error) {
+	logrus.WithField("node", name).Debugln("getting node")
+
+	vm, err := m.loadVM(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsClusterNode(vm.Labels, "") {
+		return nil, errors.WithMessagef(interr.NodeNotFoundError, "%s is not a node of any cluster", name)
+	}
+
+	return microVMToNode(vm), nil
+}
+
+func (m *MicroVMNodeManager) ListNodes(ctx context.Context, clusterName string) ([]*data.Node, error) {
+	logrus.WithField("cluster", clusterName).Debugln("listing nodes of cluster")
+
+	vms, err := m.listVMs()
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*data.Node
+
+	for _, vm := range vms {
+		if !IsClusterNode(vm.Labels, clusterName) {
+			continue
+		}
+
+		nodes = append(nodes, microVMToNode(vm))
+	}
+
+	return nodes, nil
+}
+
+func (m *MicroVMNodeManager) LoginBySSH(ctx context.Context, name string, configManager config.Manager) error {
+	logrus.WithField("node", name).Infoln("ssh into node")
+
+	vm, err := m.loadVM(name)
+	if err != nil {
+		return err
+	}
+
+	if !vm.Running() || vm.Status.IPAddress == "" {
+		return errors.Errorf("node (%s) is not running", name)
+	}
+
+	cluster, err := configManager.GetCluster(vm.Labels[ClusterLabel])
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(
+		"ssh",
+		"-i", cluster.Prikey,
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"root@"+vm.Status.IPAddress,
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return errors.WithStack(cmd.Run())
+}
+
+func (m *MicroVMNodeManager) StorageDir() string {
+	return config.MicroVMRootDir
+}
+
+func (m *MicroVMNodeManager) StoragePool() string {
+	return fmt.Sprintf("%s sparse disks (%s)", m.driver.Name(), config.MicroVMRootDir)
+}
+
+func (m *MicroVMNodeManager) WaitNodesRunning(ctx context.Context, clusterName string, timeout time.Duration) error {
+	return waitNodesRunning(ctx, m, clusterName, timeout)
+}
+
+func (m *MicroVMNodeManager) StartNodes(ctx context.Context, clusterName string) error {
+	return startNodes(ctx, m, clusterName)
+}
+
+func (m *MicroVMNodeManager) StartNode(ctx context.Context, name string) error {
+	logrus.WithField("node", name).Infoln("starting node")
+
+	if err := checkRootPermission(m.driver.Name()); err != nil {
+		return err
+	}
+
+	vm, err := m.loadVM(name)
+	if err != nil {
+		return err
+	}
+
+	if vm.Running() {
+		return nil
+	}
+
+	return m.startVM(ctx, vm)
+}
+
+func (m *MicroVMNodeManager) StopNodes(ctx context.Context, clusterName string) error {
+	return stopNodes(ctx, m, clusterName)
+}
+
+func (m *MicroVMNodeManager) StopNode(ctx context.Context, name string) error {
+	logrus.WithField("node", name).Infoln("stopping node")
+
+	if err := checkRootPermission(m.driver.Name()); err != nil {
+		return err
+	}
+
+	vm, err := m.loadVM(name)
+	if err != nil {
+		return err
+	}
+
+	return m.stopVM(ctx, vm)
+}
+
+// SnapshotNode copies the disk and kernel of the stopped node. If the memory snapshot is required, the node has to be
+// running and is paused during taking snapshot.
+func (m *MicroVMNodeManager) SnapshotNode(ctx context.Context, name string, destDir string, memory bool) error {
+	logrus.WithFields(logrus.Fields{
+		"node":   name,
+		"memory": memory,
+	}).Infoln("taking snapshot of node")
+
+	if err := checkRootPermission(m.driver.Name()); err != nil {
+		return err
+	}
+
+	vm, err := m.loadVM(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if memory {
+		snapshotter, ok := m.driver.(MicroVMSnapshotter)
+		if !ok {
+			return errors.WithMessagef(interr.NodeSnapshotNotSupportError, "memory snapshot of node (%s) is not supported by %s", name, m.driver.Name())
+		}
+
+		if !vm.Running() {
+			return errors.Errorf("node (%s) has to be running before taking memory snapshot", name)
+		}
+
+		if err := snapshotter.Pause(ctx, vm); err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := snapshotter.Resume(context.WithoutCancel(ctx), vm); err != nil {
+				logrus.WithField("node", name).WithError(err).Warnln("failed to resume node")
+			}
+		}()
+
+		if err := snapshotter.SaveSnapshot(ctx, vm, path.Join(destDir, snapshotStateFile), path.Join(destDir, snapshotMemoryFile)); err != nil {
+			return err
+		}
+	} else if vm.Running() {
+		return errors.Errorf("node (%s) has to be stopped before taking snapshot", name)
+	}
+
+	if err := copyDiskFile(ctx, vm.RootfsPath(), path.Join(destDir, snapshotDiskFile)); err != nil {
+		return err
+	}
+
+	for _, disk := range vm.ExtraDisks {
+		if err := copyDiskFile(ctx, vm.ExtraDiskPath(disk), path.Join(destDir, path.Base(vm.ExtraDiskPath(disk)))); err != nil {
+			return err
+		}
+	}
+
+	if err := util.CopyFile(vm.KernelPath(), path.Join(destDir, snapshotKernelFile)); err != nil {
+		return err
+	}
+
+	return saveSnapshotNodeFile(destDir, vm)
+}
+
+// RestoreNode replaces the disk and kernel of the node with the snapshot, and creates the node of the cluster if it does
+// not exist. If the snapshot has the memory, the started node resumes from the memory snapshot instead of booting, but
+// this requires the same node name and address as before.
+func (m *MicroVMNodeManager) RestoreNode(ctx context.Context, name string, clusterName string, srcDir string, started bool) error {
+	logrus.WithField("node", name).Infoln("restoring node from snapshot")
+
+	if err := checkRootPermission(m.driver.Name()); err != nil {
+		return err
+	}
+
+	vm := &MicroVM{}
+	if err := loadSnapshotNodeFile(srcDir, vm); err != nil {
+		return err
+	}
+
+	if current, err := m.loadVM(name); err == nil {
+		if err := m.stopVM(ctx, current); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, interr.NodeNotFoundError) {
+		return err
+	}
+
+	snapshotName, snapshotAddress := vm.Name, vm.Status.IPAddress
+
+	// the cloned node gets a new persistent address, instead of the one of the original node
+	if name != snapshotName {
+		vm.Address = ""
+	}
+
+	vm.Name = name
+	vm.Labels[ClusterLabel] = clusterName
+	vm.Status = MicroVMStatus{
+		ImageID:  vm.Status.ImageID,
+		KernelID: vm.Status.KernelID,
+	}
+	vm.dir = path.Join(m.rootDir, name)
+
+	if err := os.MkdirAll(vm.dir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := copyDiskFile(ctx, path.Join(srcDir, snapshotDiskFile), vm.RootfsPath()); err != nil {
+		return err
+	}
+
+	for _, disk := range vm.ExtraDisks {
+		if err := copyDiskFile(ctx, path.Join(srcDir, path.Base(vm.ExtraDiskPath(disk))), vm.ExtraDiskPath(disk)); err != nil {
+			return err
+		}
+	}
+
+	if err := util.CopyFile(path.Join(srcDir, snapshotKernelFile), vm.KernelPath()); err != nil {
+		return err
+	}
+
+	if err := m.saveVM(vm); err != nil {
+		return err
+	}
+
+	if !started {
+		return nil
+	}
+
+	snapshotter, ok := m.driver.(MicroVMSnapshotter)
+	if _, err := os.Stat(path.Join(srcDir, snapshotStateFile)); !ok || err != nil || name != snapshotName {
+		return m.startVM(ctx, vm)
+	}
+
+	memoryFile := path.Join(vm.dir, snapshotMemoryFile)
+	if err := copyDiskFile(ctx, path.Join(srcDir, snapshotMemoryFile), memoryFile); err != nil {
+		return err
+	}
+
+	return m.runVM(ctx, vm, func(ctx context.Context, vm *MicroVM) (int, error) {
+		if vm.Status.IPAddress != snapshotAddress {
+			logrus.WithField("node", name).Warnf("node address (%s) is different from the snapshot address (%s), booting node without memory snapshot", vm.Status.IPAddress, snapshotAddress)
+			return m.driver.Start(ctx, vm)
+		}
+
+		return snapshotter.LoadSnapshot(ctx, vm, path.Join(srcDir, snapshotStateFile), memoryFile)
+	})
+}
+
+// ResizeNode updates the CPUs and memory of the stopped node, and grows the rootfs disk and its filesystem.
+func (m *MicroVMNodeManager) ResizeNode(ctx context.Context, name string, spec *config.Node) error {
+	logrus.WithFields(logrus.Fields{
+		"node":   name,
+		"cpus":   spec.Cpus,
+		"memory": spec.Memory,
+		"disk":   spec.DiskSize,
+	}).Infoln("resizing node")
+
+	if err := checkRootPermission(m.driver.Name()); err != nil {
+		return err
+	}
+
+	vm, err := m.loadVM(name)
+	if err != nil {
+		return err
+	}
+
+	if vm.Running() {
+		return errors.Errorf("node (%s) has to be stopped before resizing", name)
+	}
+
+	diskSize, err := diskGrowth(name, vm.DiskSize, spec.DiskSize)
+	if err != nil {
+		return err
+	}
+
+	if diskSize > 0 {
+		if err := growMicroVMRootfs(ctx, vm.RootfsPath(), diskSize); err != nil {
+			return err
+		}
+
+		vm.DiskSize = spec.DiskSize
+	}
+
+	if spec.Cpus > 0 {
+		vm.Cpus = spec.Cpus
+	}
+
+	if spec.Memory != "" {
+		vm.Memory = spec.Memory
+	}
+
+	return m.saveVM(vm)
+}
+
+func (m *MicroVMNodeManager) Logs(ctx context.Context, name string, follow bool, out io.Writer) error {
+	vm, err := m.loadVM(name)
+	if err != nil {
+		return err
+	}
+
+	return util.TailFile(ctx, vm.ConsoleLogPath(), follow, out)
+}
+
+func (m *MicroVMNodeManager) SyncNetworks(ctx context.Context, clusters []*config.Cluster) error {
+	if err := checkRootPermission(m.driver.Name()); err != nil {
+		return err
+	}
+
+	return m.network.SyncNetworks(ctx, clusters)
+}
+
+func (m *MicroVMNodeManager) GetCaches(ctx context.Context) ([]interface{}, error) {
+	caches, err := m.images.Caches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the image caches are shared by the microVM drivers, so the VMs of all drivers are checked
+	var vms []*MicroVM
+
+	for _, backend := range microVMBackends {
+		driverVMs, err := listMicroVMs(path.Join(m.images.rootDir, backend))
+		if err != nil {
+			return nil, err
+		}
+
+		vms = append(vms, driverVMs...)
+	}
+
+	for _, c := range caches {
+		c := c.(*MicroVMCache)
+
+		for _, vm := range vms {
+			id := vm.Status.ImageID
+			if c.Type == microVMKernelType {
+				id = vm.Status.KernelID
+			}
+
+			if id != c.ID {
+				continue
+			}
+
+			c.InUse = true
+
+			// the VM state is saved when the VM is started or stopped
+			if t := modTime(path.Join(vm.dir, microVMStateFile)); t.After(c.LastUsed) {
+				c.LastUsed = t
+			}
+		}
+	}
+
+	return caches, nil
+}
+
+func (m *MicroVMNodeManager) PullImage(ctx context.Context, cacheType string, image string) (string, error) {
+	if err := checkRootPermission(m.driver.Name()); err != nil {
+		return "", err
+	}
+
+	var img *MicroVMImage
+	var err error
+
+	switch cacheType {
+	case microVMImageType:
+		img, err = m.images.Rootfs(ctx, image)
+	case microVMKernelType:
+		img, err = m.images.Kernel(ctx, image)
+	default:
+		return "", errors.Errorf("invalid cache type (%s)", cacheType)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return img.Name, nil
+}
+
+func (m *MicroVMNodeManager) DeleteCache(ctx context.Context, cacheType string, name string) error {
+	caches, err := m.GetCaches(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range caches {
+		c := c.(*MicroVMCache)
+
+		if c.Type != cacheType || c.Name != name {
+			continue
+		}
+
+		if c.InUse {
+			return errors.WithMessagef(interr.CacheInUseError, "%s (%s)", cacheType, name)
+		}
+
+		logrus.WithField(cacheType, name).Infof("deleting %s cache", m.driver.Name())
+
+		return m.images.DeleteCache(ctx, cacheType, name)
+	}
+
+	return errors.WithMessagef(interr.NotFoundError, "%s cache (%s)", cacheType, name)
+}
+
+func (m *MicroVMNodeManager) createVM(ctx context.Context, vm *MicroVM, rootfs *MicroVMImage, kernel *MicroVMImage, pubkey []byte, started bool) error {
+	if _, err := os.Stat(vm.dir); err == nil {
+		return errors.Errorf("node (%s) already exists", vm.Name)
+	}
+
+	if err := os.MkdirAll(vm.dir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := m.images.CreateDisk(ctx, vm, rootfs, kernel, pubkey); err != nil {
+		_ = os.RemoveAll(vm.dir)
+		return err
+	}
+
+	if err := m.images.CreateExtraDisks(ctx, vm); err != nil {
+		_ = os.RemoveAll(vm.dir)
+		return err
+	}
+
+	if err := m.saveVM(vm); err != nil {
+		return err
+	}
+
+	if started {
+		return m.startVM(ctx, vm)
+	}
+
+	return nil
+}
+
+func (m *MicroVMNodeManager) startVM(ctx context.Context, vm *MicroVM) error {
+	return m.runVM(ctx, vm, m.driver.Start)
+}
+
+// runVM sets up the network of the microVM, then runs the microVM by the function starting the hypervisor process.
+func (m *MicroVMNodeManager) runVM(ctx context.Context, vm *MicroVM, run func(ctx context.Context, vm *MicroVM) (int, error)) error {
+	if err := os.MkdirAll(path.Dir(vm.ConsoleLogPath()), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := m.network.Setup(ctx, vm); err != nil {
+		return err
+	}
+
+	pid, err := run(ctx, vm)
+	if err != nil {
+		// the network is cleaned up even if the context is canceled
+		if err := m.network.Teardown(context.WithoutCancel(ctx), vm); err != nil {
+			logrus.WithField("node", vm.Name).WithError(err).Warnln("failed to clean up node network")
+		}
+
+		return err
+	}
+
+	vm.Status.Pid = pid
+
+	return m.saveVM(vm)
+}
+
+func (m *MicroVMNodeManager) stopVM(ctx context.Context, vm *MicroVM) error {
+	if vm.Running() {
+		if err := m.driver.Stop(ctx, vm); err != nil {
+			return err
+		}
+	}
+
+	if err := m.network.Teardown(ctx, vm); err != nil {
+		return err
+	}
+
+	// the memory of the microVM resumed from snapshot is no longer used
+	_ = os.Remove(path.Join(vm.dir, snapshotMemoryFile))
+
+	vm.Status.Pid = 0
+	vm.Status.IPAddress = ""
+	vm.Status.PrefixLen = 0
+	vm.Status.Gateway = ""
+	vm.Status.MAC = ""
+
+	return m.saveVM(vm)
+}
+
+func (m *MicroVMNodeManager) loadVM(name string) (*MicroVM, error) {
+	return loadMicroVM(m.rootDir, name)
+}
+
+func loadMicroVM(rootDir string, name string) (*MicroVM, error) {
+	dir := path.Join(rootDir, name)
+
+	bytes, err := ioutil.ReadFile(path.Join(dir, microVMStateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.WithMessagef(interr.NodeNotFoundError, "%s node unavailable", name)
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	vm := &MicroVM{}
+	if err := json.Unmarshal(bytes, vm); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	vm.dir = dir
+
+	return vm, nil
+}
+
+func (m *MicroVMNodeManager) saveVM(vm *MicroVM) error {
+	bytes, err := json.MarshalIndent(vm, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(path.Join(vm.dir, microVMStateFile), bytes, 0644))
+}
+
+func (m *MicroVMNodeManager) listVMs() ([]*MicroVM, error) {
+	return listMicroVMs(m.rootDir)
+}
+
+func listMicroVMs(rootDir string) ([]*MicroVM, error) {
+	entries, err := ioutil.ReadDir(rootDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	var vms []*MicroVM
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		vm, err := loadMicroVM(rootDir, entry.Name())
+		if err != nil {
+			if errors.Is(err, interr.NodeNotFoundError) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		vms = append(vms, vm)
+	}
+
+	return vms, nil
+}
+
+func microVMToNode(vm *MicroVM) *data.Node {
+	node := &data.Node{
+		Name:   vm.Name,
+		Labels: vm.Labels,
+		Spec: config.Node{
+			Cluster:  config.NewCluster(),
+			Cpus:     vm.Cpus,
+			Memory:   vm.Memory,
+			DiskSize: vm.DiskSize,
+		},
+		Status: data.NodeStatus{
+			Running: vm.Running(),
+			Image:   vm.Status.ImageID,
+			Kernel:  vm.Status.KernelID,
+		},
+	}
+
+	for i, disk := range vm.ExtraDisks {
+		node.Status.ExtraDisks = append(node.Status.ExtraDisks, data.NodeDisk{
+			Device:      ExtraDiskDevice(i),
+			Size:        disk.Size,
+			BackingFile: disk.BackingFile,
+		})
+	}
+
+	node.Spec.Cluster.Name = vm.Labels[ClusterLabel]
+
+	if node.Status.Running {
+		node.Status.IPAddresses = vm.Status.IPAddress
+	}
+
+	return node
+}
+
+// newMicroVMDisks expands the extra disk configs to the disks of a microVM.
+func newMicroVMDisks(configs []config.ExtraDisk) []MicroVMDisk {
+	var disks []MicroVMDisk
+
+	for _, c := range configs {
+		for i := 0; i < c.GetCount(); i++ {
+			disks = append(disks, MicroVMDisk{
+				ID:          fmt.Sprintf("extra-disk-%d", len(disks)+1),
+				Size:        c.Size,
+				BackingFile: c.BackingFile,
+			})
+		}
+	}
+
+	return disks
+}
+
+func checkRootPermission(backend string) error {
+	if os.Geteuid() != 0 {
+		return errors.Errorf("%s node backend requires root permission", backend)
+	}
+
+	return nil
+}
+
+// isMicroVMProcess checks if the null separated process command line is the hypervisor process of the named microVM.
+func isMicroVMProcess(cmdline []byte, name string) bool {
+	args := bytes.Split(bytes.TrimRight(cmdline, "\x00"), []byte{0})
+
+	for i := 0; i+1 < len(args); i++ {
+		if (string(args[i]) == "--id" || string(args[i]) == "-name") && string(args[i+1]) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runMicroVMCommand runs the command required to prepare the microVM and returns the combined output.
+func runMicroVMCommand(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := util.CommandContext(ctx, name, args...)
+
+	logrus.Debugf("%+v", cmd.Args)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to run %s: %s", strings.Join(cmd.Args, " "), strings.TrimSpace(string(output)))
+	}
+
+	return string(output), nil
+}
@@ -0,0 +1,509 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	interr "github.com/innobead/kubefire/internal/error"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// containerdNamespace is the containerd namespace used to pull the node rootfs and kernel OCI images.
+	containerdNamespace = "kubefire"
+
+	microVMImageType  = "image"
+	microVMKernelType = "kernel"
+
+	microVMImageFile = "image.json"
+)
+
+// MicroVMImage is the rootfs or kernel extracted from an OCI image, which is cached and shared by microVMs.
+type MicroVMImage struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+
+	dir string
+}
+
+func (i *MicroVMImage) RootfsPath() string {
+	return path.Join(i.dir, "rootfs.ext4")
+}
+
+func (i *MicroVMImage) KernelPath() string {
+	return path.Join(i.dir, "vmlinux")
+}
+
+func (i *MicroVMImage) ModulesDir() string {
+	return path.Join(i.dir, "modules")
+}
+
+// MicroVMImageBuilder converts the kubefire OCI images to the rootfs and kernel files which can be booted by the
+// hypervisor directly. The images are pulled by containerd, and the results are cached under the root directory.
+type MicroVMImageBuilder struct {
+	rootDir string
+}
+
+func NewMicroVMImageBuilder(rootDir string) *MicroVMImageBuilder {
+	return &MicroVMImageBuilder{rootDir: rootDir}
+}
+
+// Rootfs returns the cached ext4 rootfs of the image, or builds it from the image content if not cached.
+func (b *MicroVMImageBuilder) Rootfs(ctx context.Context, image string) (*MicroVMImage, error) {
+	return b.prepare(ctx, microVMImageType, image, func(mountDir string, img *MicroVMImage) error {
+		output, err := runMicroVMCommand(ctx, "du", "-sk", mountDir)
+		if err != nil {
+			return err
+		}
+
+		usedKiB, err := strconv.ParseInt(strings.Fields(output)[0], 10, 64)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// reserve the space for the metadata of ext4, the disk will be grown to the node disk size later
+		sizeKiB := usedKiB*5/4 + 256*1024
+
+		if _, err := runMicroVMCommand(ctx, "truncate", "-s", fmt.Sprintf("%dK", sizeKiB), img.RootfsPath()); err != nil {
+			return err
+		}
+
+		_, err = runMicroVMCommand(ctx, "mkfs.ext4", "-F", "-q", "-d", mountDir, img.RootfsPath())
+		return err
+	})
+}
+
+// Kernel returns the cached kernel and modules of the kernel image, or extracts them from the image content if not cached.
+func (b *MicroVMImageBuilder) Kernel(ctx context.Context, image string) (*MicroVMImage, error) {
+	return b.prepare(ctx, microVMKernelType, image, func(mountDir string, img *MicroVMImage) error {
+		if _, err := runMicroVMCommand(ctx, "cp", path.Join(mountDir, "boot", "vmlinux"), img.KernelPath()); err != nil {
+			return err
+		}
+
+		modulesDir := path.Join(mountDir, "lib", "modules")
+		if _, err := os.Stat(modulesDir); os.IsNotExist(err) {
+			return nil
+		}
+
+		_, err := runMicroVMCommand(ctx, "cp", "-a", modulesDir, img.ModulesDir())
+		return err
+	})
+}
+
+// growMicroVMRootfs grows the rootfs file and its filesystem to the disk size. e2fsck exits with 1 if the filesystem
+// errors are corrected, so only the greater exit codes are failures.
+func growMicroVMRootfs(ctx context.Context, rootfs string, diskSize int64) error {
+	if _, err := runMicroVMCommand(ctx, "truncate", "-s", fmt.Sprintf(">%d", diskSize), rootfs); err != nil {
+		return err
+	}
+
+	if _, err := runMicroVMCommand(ctx, "e2fsck", "-p", "-f", rootfs); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() > 1 {
+			return err
+		}
+
+		logrus.WithField("rootfs", rootfs).Infoln("corrected filesystem errors of rootfs")
+	}
+
+	_, err := runMicroVMCommand(ctx, "resize2fs", rootfs)
+	return err
+}
+
+// CreateDisk creates the disk of the microVM from the rootfs, then grows it to the node disk size and injects the
+// kernel modules, hostname, DNS configuration and SSH public key.
+func (b *MicroVMImageBuilder) CreateDisk(ctx context.Context, vm *MicroVM, rootfs *MicroVMImage, kernel *MicroVMImage, pubkey []byte) error {
+	logrus.WithField("node", vm.Name).Infoln("creating node disk")
+
+	diskSize, err := util.ParseSize(vm.DiskSize)
+	if err != nil {
+		return err
+	}
+
+	if _, err := runMicroVMCommand(ctx, "cp", "--sparse=always", rootfs.RootfsPath(), vm.RootfsPath()); err != nil {
+		return err
+	}
+
+	if err := growMicroVMRootfs(ctx, vm.RootfsPath(), diskSize); err != nil {
+		return err
+	}
+
+	if _, err := runMicroVMCommand(ctx, "cp", kernel.KernelPath(), vm.KernelPath()); err != nil {
+		return err
+	}
+
+	mountDir, err := ioutil.TempDir(vm.Dir(), "mnt")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(mountDir)
+
+	if _, err := runMicroVMCommand(ctx, "mount", "-o", "loop", vm.RootfsPath(), mountDir); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := runMicroVMCommand(ctx, "umount", mountDir); err != nil {
+			logrus.WithField("node", vm.Name).WithError(err).Errorln("failed to unmount node disk")
+		}
+	}()
+
+	if _, err := os.Stat(kernel.ModulesDir()); err == nil {
+		if err := os.MkdirAll(path.Join(mountDir, "lib", "modules"), 0755); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if _, err := runMicroVMCommand(ctx, "cp", "-a", kernel.ModulesDir()+"/.", path.Join(mountDir, "lib", "modules")); err != nil {
+			return err
+		}
+	}
+
+	sshDir := path.Join(mountDir, "root", ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+
+	type guestFile struct {
+		path    string
+		content []byte
+		mode    os.FileMode
+	}
+
+	files := []guestFile{
+		{path.Join(sshDir, "authorized_keys"), pubkey, 0600},
+		{path.Join(mountDir, "etc", "hostname"), []byte(vm.Name + "\n"), 0644},
+	}
+
+	resolvConf := path.Join(mountDir, "etc", "resolv.conf")
+	if info, err := os.Lstat(resolvConf); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		files = append(files, guestFile{resolvConf, guestResolvConf(), 0644})
+	}
+
+	for _, file := range files {
+		if err := ioutil.WriteFile(file.path, file.content, file.mode); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// CreateExtraDisks creates the sparse raw disks of the microVM, which are copied from the backing file if specified,
+// then grown to the disk size.
+func (b *MicroVMImageBuilder) CreateExtraDisks(ctx context.Context, vm *MicroVM) error {
+	for _, disk := range vm.ExtraDisks {
+		logrus.WithFields(logrus.Fields{
+			"node": vm.Name,
+			"disk": disk.ID,
+			"size": disk.Size,
+		}).Infoln("creating node extra disk")
+
+		size, err := util.ParseSize(disk.Size)
+		if err != nil {
+			return err
+		}
+
+		if disk.BackingFile != "" {
+			if _, err := runMicroVMCommand(ctx, "cp", "--sparse=always", disk.BackingFile, vm.ExtraDiskPath(disk)); err != nil {
+				return err
+			}
+		}
+
+		if _, err := runMicroVMCommand(ctx, "truncate", "-s", fmt.Sprintf(">%d", size), vm.ExtraDiskPath(disk)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Caches returns the cached images, and the last used time is the time the image was pulled or used to create nodes.
+func (b *MicroVMImageBuilder) Caches(ctx context.Context) ([]interface{}, error) {
+	var caches []interface{}
+
+	for _, t := range []string{microVMImageType, microVMKernelType} {
+		images, err := b.listImages(t)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, img := range images {
+			size, err := dirSize(img.dir)
+			if err != nil {
+				return nil, err
+			}
+
+			caches = append(caches, &MicroVMCache{
+				Type:        t,
+				Name:        img.Name,
+				ID:          img.ID,
+				Size:        size,
+				LastUsed:    modTime(path.Join(img.dir, microVMImageFile)),
+				Description: img.ID,
+			})
+		}
+	}
+
+	return caches, nil
+}
+
+// DeleteCache deletes the cached image and the containerd image pulled.
+func (b *MicroVMImageBuilder) DeleteCache(ctx context.Context, t string, name string) error {
+	images, err := b.listImages(t)
+	if err != nil {
+		return err
+	}
+
+	for _, img := range images {
+		if img.Name != name {
+			continue
+		}
+
+		if _, err := runMicroVMCommand(ctx, "ctr", "-n", containerdNamespace, "images", "rm", img.Name); err != nil {
+			logrus.WithField("image", img.Name).WithError(err).Warnln("failed to remove containerd image")
+		}
+
+		return errors.WithStack(os.RemoveAll(img.dir))
+	}
+
+	return errors.WithMessagef(interr.NotFoundError, "%s cache (%s)", t, name)
+}
+
+func (b *MicroVMImageBuilder) typeDir(t string) string {
+	return path.Join(b.rootDir, t+"s")
+}
+
+func (b *MicroVMImageBuilder) listImages(t string) ([]*MicroVMImage, error) {
+	entries, err := ioutil.ReadDir(b.typeDir(t))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	var images []*MicroVMImage
+
+	for _, entry := range entries {
+		img, err := loadMicroVMImage(path.Join(b.typeDir(t), entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		images = append(images, img)
+	}
+
+	return images, nil
+}
+
+// prepare pulls the image and mounts its content to be extracted by the extract function. The extracted result is
+// cached, and the image is pulled only once.
+func (b *MicroVMImageBuilder) prepare(ctx context.Context, t string, image string, extract func(mountDir string, img *MicroVMImage) error) (*MicroVMImage, error) {
+	ref := normalizeImageRef(image)
+	dir := path.Join(b.typeDir(t), imageDirName(ref))
+
+	if img, err := loadMicroVMImage(dir); err == nil {
+		logrus.WithField(t, ref).Debugln("using cached image")
+
+		// record the last used time of the cached image
+		now := time.Now()
+		_ = os.Chtimes(path.Join(dir, microVMImageFile), now, now)
+
+		return img, nil
+	}
+
+	logrus.WithField(t, ref).Infoln("pulling image")
+
+	if _, err := runMicroVMCommand(ctx, "ctr", "-n", containerdNamespace, "images", "pull", ref); err != nil {
+		return nil, err
+	}
+
+	id, err := imageDigest(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(b.typeDir(t), 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	tmpDir, err := ioutil.TempDir(b.typeDir(t), ".tmp-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mountDir := path.Join(tmpDir, "mnt")
+	if err := os.Mkdir(mountDir, 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if _, err := runMicroVMCommand(ctx, "ctr", "-n", containerdNamespace, "images", "mount", ref, mountDir); err != nil {
+		return nil, err
+	}
+
+	img := &MicroVMImage{
+		Name: ref,
+		ID:   fmt.Sprintf("oci://%s@%s", imageRepository(ref), id),
+		dir:  tmpDir,
+	}
+
+	err = extract(mountDir, img)
+
+	if _, err := runMicroVMCommand(ctx, "ctr", "-n", containerdNamespace, "images", "unmount", mountDir); err != nil {
+		logrus.WithField(t, ref).WithError(err).Warnln("failed to unmount image")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(mountDir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	bytes, err := json.Marshal(img)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := ioutil.WriteFile(path.Join(tmpDir, microVMImageFile), bytes, 0644); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	img.dir = dir
+
+	return img, nil
+}
+
+// dirSize returns the total size of the files in the folder.
+func dirSize(dir string) (int64, error) {
+	var size int64
+
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, errors.WithStack(err)
+}
+
+func loadMicroVMImage(dir string) (*MicroVMImage, error) {
+	bytes, err := ioutil.ReadFile(path.Join(dir, microVMImageFile))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	img := &MicroVMImage{}
+	if err := json.Unmarshal(bytes, img); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	img.dir = dir
+
+	return img, nil
+}
+
+func imageDigest(ctx context.Context, ref string) (string, error) {
+	output, err := runMicroVMCommand(ctx, "ctr", "-n", containerdNamespace, "images", "ls", "name=="+ref)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return "", errors.Errorf("image (%s) not found in containerd", ref)
+	}
+
+	// REF TYPE DIGEST SIZE PLATFORMS LABELS
+	fields := strings.Fields(lines[1])
+	if len(fields) < 3 {
+		return "", errors.Errorf("failed to get the digest of image (%s)", ref)
+	}
+
+	return fields[2], nil
+}
+
+// normalizeImageRef converts the image name to the fully qualified reference required by containerd.
+func normalizeImageRef(image string) string {
+	ref := image
+
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		if len(parts) == 1 {
+			ref = "library/" + ref
+		}
+
+		ref = "docker.io/" + ref
+	}
+
+	if !strings.Contains(path.Base(ref), ":") && !strings.Contains(ref, "@") {
+		ref += ":latest"
+	}
+
+	return ref
+}
+
+func imageRepository(ref string) string {
+	ref = strings.SplitN(ref, "@", 2)[0]
+
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+
+	return ref
+}
+
+func imageDirName(ref string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(ref)
+}
+
+// guestResolvConf returns the DNS configuration of the host for the guest. The loopback name servers like the
+// systemd-resolved stub are not reachable from the guest, so they are replaced by a public name server.
+func guestResolvConf() []byte {
+	var lines []string
+
+	if file, err := os.Open("/etc/resolv.conf"); err == nil {
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || fields[0] != "nameserver" {
+				continue
+			}
+
+			if strings.HasPrefix(fields[1], "127.") || fields[1] == "::1" {
+				continue
+			}
+
+			lines = append(lines, scanner.Text())
+		}
+	}
+
+	if len(lines) == 0 {
+		lines = append(lines, "nameserver 8.8.8.8")
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
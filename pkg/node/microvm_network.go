@@ -0,0 +1,166 @@
+package node
+
+import (
+	"context"
+	gocni "github.com/containerd/go-cni"
+	"github.com/innobead/kubefire/pkg/constants"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path"
+)
+
+const (
+	microVMNetnsDir = "/var/run/netns"
+	// microVMTapDevice is the TAP device connected to the microVM, which is created in the network namespace of the microVM.
+	microVMTapDevice = "tap0"
+	microVMInterface = "eth0"
+)
+
+// MicroVMNetwork connects the microVMs to the kubefire CNI bridge network, the same network used by ignite, or the
+// isolated network of the cluster if configured.
+//
+// The CNI interface is created in the network namespace of the microVM, then the traffic between the interface and
+// the TAP device used by the hypervisor is redirected by tc. The guest uses the MAC address and IP address allocated
+// to the CNI interface, so the network works as if the guest is attached to the bridge directly.
+type MicroVMNetwork struct {
+	confFile       string
+	clusterConfDir string // the folder of the network configurations of the isolated cluster networks
+	pluginDirs     []string
+}
+
+func NewMicroVMNetwork() *MicroVMNetwork {
+	return &MicroVMNetwork{
+		confFile:       path.Join(constants.CniConfigDir, constants.CniConfigFile),
+		clusterConfDir: constants.CniClusterConfigDir,
+		pluginDirs:     []string{constants.CniBinDir},
+	}
+}
+
+func (n *MicroVMNetwork) Setup(ctx context.Context, vm *MicroVM) error {
+	logrus.WithField("node", vm.Name).Infoln("setting up node network")
+
+	netnsPath := path.Join(microVMNetnsDir, vm.Netns())
+
+	if _, err := os.Stat(netnsPath); os.IsNotExist(err) {
+		if _, err := runMicroVMCommand(ctx, "ip", "netns", "add", vm.Netns()); err != nil {
+			return err
+		}
+	}
+
+	if err := n.attach(ctx, vm, netnsPath); err != nil {
+		return err
+	}
+
+	cmds := [][]string{
+		{"ip", "tuntap", "add", "dev", microVMTapDevice, "mode", "tap"},
+		{"ip", "link", "set", microVMTapDevice, "up"},
+		// the address is used by the guest, so it should not be answered by the namespace
+		{"ip", "addr", "flush", "dev", microVMInterface},
+		{"tc", "qdisc", "add", "dev", microVMInterface, "ingress"},
+		{"tc", "filter", "add", "dev", microVMInterface, "parent", "ffff:", "protocol", "all", "u32", "match", "u8", "0", "0", "action", "mirred", "egress", "redirect", "dev", microVMTapDevice},
+		{"tc", "qdisc", "add", "dev", microVMTapDevice, "ingress"},
+		{"tc", "filter", "add", "dev", microVMTapDevice, "parent", "ffff:", "protocol", "all", "u32", "match", "u8", "0", "0", "action", "mirred", "egress", "redirect", "dev", microVMInterface},
+	}
+
+	for _, cmd := range cmds {
+		if _, err := runMicroVMCommand(ctx, "ip", append([]string{"netns", "exec", vm.Netns()}, cmd...)...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attach adds the CNI interface to the network namespace of the microVM, and records the allocated MAC and IP
+// addresses to the microVM status.
+func (n *MicroVMNetwork) attach(ctx context.Context, vm *MicroVM, netnsPath string) error {
+	client, err := n.cniClient(n.confFileOf(vm))
+	if err != nil {
+		return err
+	}
+
+	var opts []gocni.NamespaceOpts
+	if vm.Address != "" {
+		opts = append(opts, gocni.WithArgs("IgnoreUnknown", "1"), gocni.WithArgs("IP", vm.Address))
+	}
+
+	result, err := client.Setup(ctx, vm.Name, netnsPath, opts...)
+	if err != nil && vm.Address != "" {
+		// the address may be taken by others when the node is stopped, then the node has to be repaired after starting
+		logrus.WithField("node", vm.Name).WithError(err).Warnf("failed to request persistent address (%s), allocating a new one", vm.Address)
+
+		_ = client.Remove(ctx, vm.Name, netnsPath)
+
+		vm.Address = ""
+		result, err = client.Setup(ctx, vm.Name, netnsPath)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	iface, ok := result.Interfaces[microVMInterface]
+	if !ok || len(iface.IPConfigs) == 0 {
+		return errors.Errorf("no address allocated to node (%s)", vm.Name)
+	}
+
+	vm.Status.MAC = iface.Mac
+	vm.Status.IPAddress = iface.IPConfigs[0].IP.String()
+	vm.Status.Gateway = iface.IPConfigs[0].Gateway.String()
+
+	if vm.Address == "" {
+		vm.Address = vm.Status.IPAddress
+	}
+
+	for _, r := range result.Raw() {
+		for _, ip := range r.IPs {
+			if ip.Address.IP.Equal(iface.IPConfigs[0].IP) {
+				vm.Status.PrefixLen, _ = ip.Address.Mask.Size()
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n *MicroVMNetwork) Teardown(ctx context.Context, vm *MicroVM) error {
+	logrus.WithField("node", vm.Name).Debugln("tearing down node network")
+
+	netnsPath := path.Join(microVMNetnsDir, vm.Netns())
+
+	if _, err := os.Stat(netnsPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	client, err := n.cniClient(n.confFileOf(vm))
+	if err != nil {
+		return err
+	}
+
+	if err := client.Remove(ctx, vm.Name, netnsPath); err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = runMicroVMCommand(ctx, "ip", "netns", "delete", vm.Netns())
+
+	return err
+}
+
+func (n *MicroVMNetwork) cniClient(confFile string) (gocni.CNI, error) {
+	client, err := gocni.New(
+		gocni.WithMinNetworkCount(2),
+		gocni.WithPluginConfDir(constants.CniConfigDir),
+		gocni.WithPluginDir(n.pluginDirs),
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// go-cni names the interface of a network by its index, so the network is loaded before the loopback network to
+	// be created as eth0
+	if err := client.Load(gocni.WithConfListFile(confFile), gocni.WithLoNetwork); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,121 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"github.com/innobead/kubefire/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// fakeBridgePlugin returns the result in the same shape as the CNI bridge plugin, which has the bridge, the host veth
+// and the interface named by CNI_IFNAME in the network namespace, and the IP address assigned to the last one. The
+// address and gateway are formatted by the test cases.
+const fakeBridgePlugin = `#!/bin/sh
+case "$CNI_COMMAND" in
+ADD)
+  cat <<RESULT
+{
+  "cniVersion": "0.4.0",
+  "interfaces": [
+    {"name": "kubefire0", "mac": "0a:58:0a:3e:00:01"},
+    {"name": "veth1234", "mac": "0a:58:0a:3e:00:02"},
+    {"name": "$CNI_IFNAME", "mac": "0a:58:0a:3e:00:05", "sandbox": "$CNI_NETNS"}
+  ],
+  "ips": [{"version": "4", "interface": 2, "address": "%s", "gateway": "%s"}]
+}
+RESULT
+  ;;
+VERSION)
+  echo '{"cniVersion": "0.4.0", "supportedVersions": ["0.3.0", "0.3.1", "0.4.0"]}'
+  ;;
+esac
+`
+
+const fakeLoopbackPlugin = `#!/bin/sh
+case "$CNI_COMMAND" in
+ADD)
+  echo '{"cniVersion": "0.3.1", "interfaces": [{"name": "lo", "sandbox": "'$CNI_NETNS'"}], "ips": [{"version": "4", "interface": 0, "address": "127.0.0.1/8"}]}'
+  ;;
+VERSION)
+  echo '{"cniVersion": "0.3.1", "supportedVersions": ["0.3.0", "0.3.1"]}'
+  ;;
+esac
+`
+
+func TestMicroVMNetwork_Attach(t *testing.T) {
+	// the results of CNI are cached in /var/lib/cni
+	if os.Geteuid() != 0 {
+		t.Skip("requires root permission")
+	}
+
+	cluster := config.NewCluster()
+	cluster.Name = "kubefire-test"
+	cluster.Network = &config.Network{Subnet: "10.63.0.0/24"}
+
+	clusterConf, err := ClusterNetworkConf(cluster)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		clusterConf string
+		address     string
+		gateway     string
+		prefixLen   int
+	}{
+		{"kubefire bridge network", "", "10.62.0.5/16", "10.62.0.1", 16},
+		{"isolated cluster network", string(clusterConf), "10.63.0.254/24", "10.63.0.1", 24},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			bridgePlugin := fmt.Sprintf(fakeBridgePlugin, tt.address, tt.gateway)
+
+			// the chained portmap and firewall plugins return the result of the bridge plugin as is
+			files := map[string]string{
+				"bridge":            bridgePlugin,
+				"portmap":           bridgePlugin,
+				"firewall":          bridgePlugin,
+				"loopback":          fakeLoopbackPlugin,
+				"kubefire.conflist": `{"cniVersion": "0.4.0", "name": "kubefire-test", "plugins": [{"type": "bridge"}]}`,
+			}
+			if tt.clusterConf != "" {
+				// the kubefire bridge network fails if it is used instead of the isolated cluster network
+				files["kubefire.conflist"] = `{"cniVersion": "0.4.0", "name": "kubefire-test", "plugins": [{"type": "missing"}]}`
+				files[cluster.Name+".conflist"] = tt.clusterConf
+			}
+
+			for name, content := range files {
+				assert.NoError(t, ioutil.WriteFile(path.Join(dir, name), []byte(content), 0755))
+			}
+
+			network := &MicroVMNetwork{
+				confFile:       path.Join(dir, "kubefire.conflist"),
+				clusterConfDir: dir,
+				pluginDirs:     []string{dir},
+			}
+
+			vm := &MicroVM{Name: "kubefire-test-master-1", Labels: map[string]string{ClusterLabel: cluster.Name}}
+			netnsPath := path.Join(dir, "netns")
+
+			address := strings.Split(tt.address, "/")[0]
+
+			err := network.attach(context.Background(), vm, netnsPath)
+			assert.NoError(t, err)
+			assert.Equal(t, "0a:58:0a:3e:00:05", vm.Status.MAC)
+			assert.Equal(t, address, vm.Status.IPAddress)
+			assert.Equal(t, tt.gateway, vm.Status.Gateway)
+			assert.Equal(t, tt.prefixLen, vm.Status.PrefixLen)
+			assert.Equal(t, address, vm.Address)
+
+			client, err := network.cniClient(network.confFileOf(vm))
+			assert.NoError(t, err)
+			assert.NoError(t, client.Remove(context.Background(), vm.Name, netnsPath))
+		})
+	}
+}
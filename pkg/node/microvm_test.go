@@ -0,0 +1,288 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestMicroVM_BootArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		kernelArgs string
+		status     MicroVMStatus
+		want       string
+	}{
+		{
+			"dhcp replaced by static address",
+			"console=ttyS0 reboot=k panic=1 pci=off ip=dhcp security=apparmor",
+			MicroVMStatus{IPAddress: "10.62.0.5", Gateway: "10.62.0.1", PrefixLen: 16},
+			"console=ttyS0 reboot=k panic=1 pci=off security=apparmor ip=10.62.0.5::10.62.0.1:255.255.0.0:demo-master-1:eth0:off",
+		},
+		{
+			"no address allocated",
+			"ip=dhcp console=ttyS0",
+			MicroVMStatus{},
+			"console=ttyS0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := &MicroVM{Name: "demo-master-1", KernelArgs: tt.kernelArgs, Status: tt.status}
+			assert.Equal(t, tt.want, vm.BootArgs())
+		})
+	}
+}
+
+func TestNormalizeImageRef(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"ghcr.io/innobead/kubefire-opensuse-leap:15.2", "ghcr.io/innobead/kubefire-opensuse-leap:15.2"},
+		{"ubuntu", "docker.io/library/ubuntu:latest"},
+		{"weaveworks/ignite-ubuntu:latest", "docker.io/weaveworks/ignite-ubuntu:latest"},
+		{"localhost:5000/kubefire/image", "localhost:5000/kubefire/image:latest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeImageRef(tt.image))
+		})
+	}
+}
+
+func TestQemuDriver_args(t *testing.T) {
+	vm := &MicroVM{
+		Name:       "demo-master-1",
+		KernelArgs: "console=ttyS0 pci=off ip=dhcp",
+		Cpus:       2,
+		Memory:     "2GB",
+		ExtraDisks: newMicroVMDisks([]config.ExtraDisk{{Size: "10GB", Count: 2}}),
+		Status:     MicroVMStatus{MAC: "aa:bb:cc:dd:ee:ff"},
+	}
+
+	tests := []struct {
+		machine  string
+		bootArgs string
+		device   string
+		disk     string
+	}{
+		{QemuMicroVMMachine, "console=ttyS0 pci=off root=/dev/vda rw", "virtio-net-device,netdev=net0,mac=aa:bb:cc:dd:ee:ff", "virtio-blk-device,drive=extra-disk-2"},
+		{QemuQ35Machine, "console=ttyS0 root=/dev/vda rw", "virtio-net-pci,netdev=net0,mac=aa:bb:cc:dd:ee:ff", "virtio-blk-pci,drive=extra-disk-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.machine, func(t *testing.T) {
+			args, err := NewQemuDriver(tt.machine).args(vm, "/tmp/qemu.pid")
+			assert.NoError(t, err)
+			assert.Contains(t, args, tt.bootArgs)
+			assert.Contains(t, args, tt.device)
+			assert.Contains(t, args, tt.disk)
+			assert.Contains(t, args, "2048M")
+		})
+	}
+
+	_, err := NewQemuDriver("pc").args(vm, "/tmp/qemu.pid")
+	assert.Error(t, err)
+}
+
+func TestMicroVM_ExtraDisks(t *testing.T) {
+	dir := t.TempDir()
+
+	backingFile := path.Join(dir, "backing.img")
+	assert.NoError(t, ioutil.WriteFile(backingFile, []byte("seed"), 0644))
+
+	vm := &MicroVM{
+		Name:       "demo-worker-1",
+		Cpus:       1,
+		Memory:     "1GB",
+		ExtraDisks: newMicroVMDisks([]config.ExtraDisk{{Size: "1MB", Count: 2}, {Size: "2MB", BackingFile: backingFile}}),
+		Status:     MicroVMStatus{MAC: "aa:bb:cc:dd:ee:ff"},
+		dir:        dir,
+	}
+
+	assert.NoError(t, NewMicroVMImageBuilder(dir).CreateExtraDisks(context.Background(), vm))
+
+	sizes := []int64{1 << 20, 1 << 20, 2 << 20}
+	for i, disk := range vm.ExtraDisks {
+		info, err := os.Stat(vm.ExtraDiskPath(disk))
+		if assert.NoError(t, err) {
+			assert.Equal(t, sizes[i], info.Size())
+		}
+	}
+
+	content, err := ioutil.ReadFile(vm.ExtraDiskPath(vm.ExtraDisks[2]))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), "seed"))
+
+	t.Run(constants.FIRECRACKER, func(t *testing.T) {
+		listener, err := net.Listen("unix", vm.SocketPath())
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		var drives []firecrackerDrive
+
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/drives/") {
+				drive := firecrackerDrive{}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&drive))
+				assert.Equal(t, "/drives/"+drive.DriveID, r.URL.Path)
+				drives = append(drives, drive)
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})}
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		defer server.Close()
+
+		requests, err := NewFirecrackerDriver().bootRequests(vm)
+		assert.NoError(t, err)
+
+		client := newFirecrackerClient(vm.SocketPath())
+		for _, r := range requests {
+			assert.NoError(t, client.request(context.Background(), r.method, r.path, r.body))
+		}
+
+		// the extra disks follow the root device, so they are /dev/vdb, /dev/vdc... in the guest
+		if assert.Len(t, drives, 4) {
+			assert.True(t, drives[0].IsRootDevice)
+
+			for i, disk := range vm.ExtraDisks {
+				assert.Equal(t, disk.ID, drives[i+1].DriveID)
+				assert.Equal(t, vm.ExtraDiskPath(disk), drives[i+1].PathOnHost)
+				assert.False(t, drives[i+1].IsRootDevice)
+				assert.FileExists(t, drives[i+1].PathOnHost)
+			}
+		}
+	})
+
+	t.Run(constants.QEMU, func(t *testing.T) {
+		args, err := NewQemuDriver(QemuMicroVMMachine).args(vm, path.Join(dir, "qemu.pid"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		var drives []string
+		for i, arg := range args {
+			if arg == "-drive" {
+				drives = append(drives, args[i+1])
+			}
+		}
+
+		if assert.Len(t, drives, 4) {
+			assert.True(t, strings.HasPrefix(drives[0], "id=rootfs,"))
+
+			for i, disk := range vm.ExtraDisks {
+				assert.True(t, strings.HasPrefix(drives[i+1], fmt.Sprintf("id=%s,file=%s,format=raw,", disk.ID, vm.ExtraDiskPath(disk))))
+				assert.Contains(t, args, fmt.Sprintf("virtio-blk-device,drive=%s", disk.ID))
+			}
+		}
+	})
+}
+
+func TestIsMicroVMProcess(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmdline string
+		want    bool
+	}{
+		{"firecracker", "firecracker\x00--api-sock\x00/var/lib/kubefire/api.sock\x00--id\x00c-worker-1\x00", true},
+		{"qemu", "qemu-system-x86_64\x00-name\x00c-worker-1\x00-machine\x00microvm,accel=kvm\x00", true},
+		{"node name as prefix", "firecracker\x00--id\x00c-worker-10\x00", false},
+		{"node name in other args", "qemu-system-x86_64\x00-name\x00c-worker-10\x00-pidfile\x00/c-worker-1/qemu.pid\x00", false},
+		{"other process", "sleep\x00c-worker-1\x00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isMicroVMProcess([]byte(tt.cmdline), "c-worker-1"))
+		})
+	}
+}
+
+func TestGrowMicroVMRootfs(t *testing.T) {
+	for _, cmd := range []string{"mkfs.ext4", "debugfs", "e2fsck", "resize2fs"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			t.Skipf("requires %s", cmd)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		prepare []string // the debugfs request to damage the filesystem, or empty to leave it clean
+		garbage bool     // the rootfs is not a filesystem
+		wantErr bool
+	}{
+		{name: "clean filesystem"},
+		{name: "filesystem errors corrected", prepare: []string{"-w", "-R", "ssv free_blocks_count 10"}},
+		{name: "not a filesystem", garbage: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootfs := path.Join(t.TempDir(), "rootfs.img")
+
+			if tt.garbage {
+				assert.NoError(t, ioutil.WriteFile(rootfs, []byte(strings.Repeat("kubefire", 1<<16)), 0644))
+			} else {
+				assert.NoError(t, exec.Command("truncate", "-s", "16M", rootfs).Run())
+				assert.NoError(t, exec.Command("mkfs.ext4", "-q", "-F", rootfs).Run())
+			}
+
+			if len(tt.prepare) > 0 {
+				assert.NoError(t, exec.Command("debugfs", append(tt.prepare, rootfs)...).Run())
+			}
+
+			err := growMicroVMRootfs(context.Background(), rootfs, 32<<20)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			if !tt.wantErr {
+				info, err := os.Stat(rootfs)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(32<<20), info.Size())
+			}
+		})
+	}
+}
+
+func TestMicroVMNodeManager_GetCaches(t *testing.T) {
+	rootDir := t.TempDir()
+	manager := &MicroVMNodeManager{
+		driver:  NewFirecrackerDriver(),
+		rootDir: path.Join(rootDir, constants.FIRECRACKER),
+		images:  NewMicroVMImageBuilder(rootDir),
+	}
+
+	files := map[string]string{
+		"images/rootfs-1/" + microVMImageFile:  `{"name": "rootfs-1", "id": "sha256:1"}`,
+		"images/rootfs-2/" + microVMImageFile:  `{"name": "rootfs-2", "id": "sha256:2"}`,
+		"kernels/kernel-1/" + microVMImageFile: `{"name": "kernel-1", "id": "sha256:3"}`,
+		// the image caches are shared with the nodes of the other microVM driver
+		constants.QEMU + "/demo-master-1/" + microVMStateFile: `{"name": "demo-master-1", "status": {"imageID": "sha256:2", "kernelID": "sha256:3"}}`,
+	}
+	for file, content := range files {
+		assert.NoError(t, os.MkdirAll(path.Dir(path.Join(rootDir, file)), 0755))
+		assert.NoError(t, ioutil.WriteFile(path.Join(rootDir, file), []byte(content), 0644))
+	}
+
+	caches, err := manager.GetCaches(context.Background())
+	assert.NoError(t, err)
+
+	inUse := map[string]bool{}
+	for _, c := range caches {
+		inUse[c.(*MicroVMCache).Name] = c.(*MicroVMCache).InUse
+	}
+
+	assert.Equal(t, map[string]bool{"rootfs-1": false, "rootfs-2": true, "kernel-1": true}, inUse)
+}
@@ -1,11 +1,23 @@
 package node
 
 import (
+	"context"
 	"fmt"
+	"github.com/avast/retry-go"
+	"github.com/hashicorp/go-multierror"
+	intconfig "github.com/innobead/kubefire/internal/config"
 	"github.com/innobead/kubefire/pkg/config"
+	"github.com/innobead/kubefire/pkg/constants"
 	"github.com/innobead/kubefire/pkg/data"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thoas/go-funk"
+	"io"
+	"os"
 	"regexp"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -17,31 +29,410 @@ const (
 
 	//NameFormat node name format: <cluster name>-<node type>-<node index>
 	NameFormat = "%s-%s-%s"
+	//PoolNameFormat worker pool node name format: <cluster name>-<node type>-<pool name>-<node index>
+	PoolNameFormat = "%s-%s-%s-%s"
 )
 
-var namePattern = fmt.Sprintf(`%%s-(%s|%s)-\d+`, Master, Worker)
+const (
+	ClusterLabel = "cluster"
+	RoleLabel    = "role"
+	IndexLabel   = "index"
+	PoolLabel    = "pool"
+	VersionLabel = "kubefire-version"
+)
+
+var BuiltinBackends = []string{
+	constants.IGNITE,
+	constants.FIRECRACKER,
+	constants.QEMU,
+}
+
+// waitNodesRunningInterval is the interval of checking if the nodes are running.
+const waitNodesRunningInterval = 5 * time.Second
+
+// ConsoleLogStartMarker is appended to the console log when the node is started by the node backend not writing the
+// console output to the log directly, so the output of the current boot can be told from the previous boots.
+const ConsoleLogStartMarker = "[kubefire] node started"
+
+var namePattern = fmt.Sprintf(`^%%s-(%s|%s)-(\d+)$`, Master, Worker)
+
+// CreateNodeError is the error of the node failed to be created. The errors of all failed nodes are aggregated by
+// CreateNodesWithIndices, so the caller can retry or roll back the failed nodes only.
+type CreateNodeError struct {
+	Name string
+	Err  error
+}
+
+func (e *CreateNodeError) Error() string {
+	return fmt.Sprintf("failed to create node (%s): %v", e.Name, e.Err)
+}
+
+func (e *CreateNodeError) Unwrap() error {
+	return e.Err
+}
 
 type Manager interface {
-	CreateNodes(nodeType Type, node *config.Node, started bool) error
-	DeleteNodes(nodeType Type, node *config.Node) error
-	DeleteNode(name string) error
-	GetNode(name string) (*data.Node, error)
-	ListNodes(clusterName string) ([]*data.Node, error)
-	LoginBySSH(name string, configManager config.Manager) error
-	WaitNodesRunning(clusterName string, timeoutMin time.Duration) error
-	StartNodes(clusterName string) error
-	StartNode(name string) error
-	StopNodes(clusterName string) error
-	StopNode(name string) error
-	GetCaches() ([]interface{}, error)
-	DeleteCaches() error
+	CreateNodes(ctx context.Context, nodeType Type, node *config.Node, started bool) error
+	CreateNodesWithIndices(ctx context.Context, nodeType Type, node *config.Node, indices []int, started bool) error
+	DeleteNodes(ctx context.Context, nodeType Type, node *config.Node) error
+	DeleteNode(ctx context.Context, name string) error
+	GetNode(ctx context.Context, name string) (*data.Node, error)
+	ListNodes(ctx context.Context, clusterName string) ([]*data.Node, error)
+	LoginBySSH(ctx context.Context, name string, configManager config.Manager) error
+	Logs(ctx context.Context, name string, follow bool, out io.Writer) error
+	WaitNodesRunning(ctx context.Context, clusterName string, timeout time.Duration) error
+	StartNodes(ctx context.Context, clusterName string) error
+	StartNode(ctx context.Context, name string) error
+	StopNodes(ctx context.Context, clusterName string) error
+	StopNode(ctx context.Context, name string) error
+	SnapshotNode(ctx context.Context, name string, destDir string, memory bool) error
+	RestoreNode(ctx context.Context, name string, clusterName string, srcDir string, started bool) error
+	// ResizeNode updates the CPUs, memory and disk size of the stopped node. The empty resources of the spec are unchanged.
+	ResizeNode(ctx context.Context, name string, spec *config.Node) error
+	SyncNetworks(ctx context.Context, clusters []*config.Cluster) error
+	// GetCaches returns the cached rootfs and kernel images, which are marked in use if any node is created from them.
+	GetCaches(ctx context.Context) ([]interface{}, error)
+	// PullImage pulls the rootfs or kernel image to the caches, and returns the name of the cache.
+	PullImage(ctx context.Context, cacheType string, image string) (string, error)
+	// DeleteCache deletes the cached image or kernel, which is refused if it is in use.
+	DeleteCache(ctx context.Context, cacheType string, name string) error
+	// StorageDir returns the host folder storing the node disks.
+	StorageDir() string
+	// StoragePool describes where the node disks are allocated from, which is reported by the host capacity plan.
+	StoragePool() string
+}
+
+func New(backend string) Manager {
+	switch backend {
+	case constants.IGNITE, "":
+		return NewIgniteNodeManager()
+	case constants.FIRECRACKER:
+		return NewFirecrackerNodeManager()
+	case constants.QEMU:
+		return NewQemuNodeManager(intconfig.QemuMachine)
+	default:
+		panic("no supported node backend")
+	}
+}
+
+func IsValidBackend(backend string) bool {
+	return funk.Contains(BuiltinBackends, backend)
 }
 
 func Name(clusterName string, nodeType Type, index int) string {
 	return fmt.Sprintf(NameFormat, clusterName, nodeType, strconv.Itoa(index))
 }
 
-func IsValidNodeName(nodeName string, clusterName string) bool {
-	re, _ := regexp.Compile(fmt.Sprintf(namePattern, clusterName))
-	return re.MatchString(nodeName)
+// ConfigName returns the name of the node created from the node config. The pool name is included for the worker pool nodes.
+func ConfigName(nodeType Type, node *config.Node, index int) string {
+	if node.Name == "" {
+		return Name(node.Cluster.Name, nodeType, index)
+	}
+
+	return fmt.Sprintf(PoolNameFormat, node.Cluster.Name, nodeType, node.Name, strconv.Itoa(index))
+}
+
+// ConfigLabels returns the labels of the node created from the node config. The pool label is added for the worker pool nodes.
+func ConfigLabels(nodeType Type, node *config.Node, index int) map[string]string {
+	labels := Labels(node.Cluster.Name, nodeType, index)
+
+	if node.Name != "" {
+		labels[PoolLabel] = node.Name
+	}
+
+	return labels
+}
+
+// Indices returns the node indices from 1 to count, which are used to create the nodes of a new cluster.
+func Indices(count int) []int {
+	var indices []int
+
+	for i := 1; i <= count; i++ {
+		indices = append(indices, i)
+	}
+
+	return indices
+}
+
+// ExtraDiskDevice returns the guest device of the i-th extra disk, which is attached after the rootfs (/dev/vda).
+func ExtraDiskDevice(i int) string {
+	return fmt.Sprintf("/dev/vd%c", 'b'+i)
+}
+
+// NextIndices returns the indices following the largest index of the existing nodes of the node type and pool, which are used to add nodes to the cluster.
+func NextIndices(nodes []*data.Node, nodeType Type, pool string, count int) []int {
+	last := 0
+
+	for _, n := range nodes {
+		if n.Labels[RoleLabel] != string(nodeType) || n.Labels[PoolLabel] != pool {
+			continue
+		}
+
+		if index, err := strconv.Atoi(n.Labels[IndexLabel]); err == nil && index > last {
+			last = index
+		}
+	}
+
+	var indices []int
+
+	for i := 1; i <= count; i++ {
+		indices = append(indices, last+i)
+	}
+
+	return indices
+}
+
+// ParseName gets the node type and index from the node name of the cluster. The name has to match NameFormat exactly.
+func ParseName(nodeName string, clusterName string) (Type, int, bool) {
+	re := regexp.MustCompile(fmt.Sprintf(namePattern, regexp.QuoteMeta(clusterName)))
+
+	matches := re.FindStringSubmatch(nodeName)
+	if matches == nil {
+		return "", 0, false
+	}
+
+	index, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return Type(matches[1]), index, true
+}
+
+// Labels returns the labels added to the node to identify which cluster owns it.
+func Labels(clusterName string, nodeType Type, index int) map[string]string {
+	return map[string]string{
+		ClusterLabel: clusterName,
+		RoleLabel:    string(nodeType),
+		IndexLabel:   strconv.Itoa(index),
+		VersionLabel: intconfig.TagVersion,
+	}
+}
+
+// MigrateLegacyLabels adds the missing role and index labels to the nodes created by the previous versions, which
+// only have the cluster label. The labels are derived from the node name, which has to match NameFormat exactly.
+// It is a read-time shim: the labels are only added to the node read from the backend and never written back to the
+// VM, because ignite cannot change the labels of an existing VM. The legacy nodes keep being migrated whenever they
+// are read until they are recreated.
+func MigrateLegacyLabels(nodeName string, labels map[string]string) bool {
+	clusterName, ok := labels[ClusterLabel]
+	if !ok {
+		return false
+	}
+
+	if _, ok := labels[RoleLabel]; ok {
+		return true
+	}
+
+	nodeType, index, ok := ParseName(nodeName, clusterName)
+	if !ok {
+		return false
+	}
+
+	logrus.WithField("node", nodeName).Debugln("migrating the labels of legacy node")
+
+	labels[RoleLabel] = string(nodeType)
+	labels[IndexLabel] = strconv.Itoa(index)
+
+	return true
+}
+
+// IsClusterNode checks if the node is owned by the cluster via the node labels. The empty cluster name matches the nodes of any cluster.
+func IsClusterNode(labels map[string]string, clusterName string) bool {
+	owner, ok := labels[ClusterLabel]
+	if !ok || (clusterName != "" && owner != clusterName) {
+		return false
+	}
+
+	_, hasRole := labels[RoleLabel]
+	_, hasIndex := labels[IndexLabel]
+
+	return hasRole && hasIndex
+}
+
+// FailedNodes returns the names of the failed nodes aggregated in the error returned by CreateNodesWithIndices. Nothing
+// is returned if the error is not caused by any specific node, ex: failing to prepare the node image.
+func FailedNodes(err error) []string {
+	var names []string
+
+	merr, ok := errors.Cause(err).(*multierror.Error)
+	if !ok {
+		return nil
+	}
+
+	for _, e := range merr.Errors {
+		var nodeErr *CreateNodeError
+		if errors.As(e, &nodeErr) {
+			names = append(names, nodeErr.Name)
+		}
+	}
+
+	return names
+}
+
+// createNodes creates the nodes of the indices concurrently, and returns the errors of all failed nodes as CreateNodeError.
+func createNodes(nodeType Type, node *config.Node, indices []int, create func(name string, index int) error) error {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var err error
+
+	for _, j := range indices {
+		name := ConfigName(nodeType, node, j)
+
+		logrus.WithField("node", name).Infoln("creating node")
+
+		wg.Add(1)
+
+		go func(name string, j int) {
+			defer wg.Done()
+
+			if e := create(name, j); e != nil {
+				logrus.WithField("node", name).WithError(e).Errorln("failed to create node")
+
+				lock.Lock()
+				err = multierror.Append(err, &CreateNodeError{Name: name, Err: e})
+				lock.Unlock()
+			}
+		}(name, j)
+	}
+
+	wg.Wait()
+
+	return err
+}
+
+// diskGrowth returns the disk size requested if it is larger than the current disk size, or 0 if the disk size is
+// unchanged. The disk can not be shrunk, because the filesystem may be using the space.
+func diskGrowth(name string, current string, requested string) (int64, error) {
+	if requested == "" {
+		return 0, nil
+	}
+
+	size, err := util.ParseSize(requested)
+	if err != nil {
+		return 0, err
+	}
+
+	currentSize, err := util.ParseSize(current)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case size < currentSize:
+		return 0, errors.Errorf("disk of node (%s) can not be shrunk from %s to %s", name, current, requested)
+	case size == currentSize:
+		return 0, nil
+	}
+
+	return size, nil
+}
+
+// modTime returns the modification time of the file, or the zero time if the file is unavailable.
+func modTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+func deleteNodes(ctx context.Context, m Manager, nodeType Type, node *config.Node) error {
+	logrus.WithField("cluster", node.Cluster.Name).Infof("deleting %s nodes", nodeType)
+
+	nodes, err := m.ListNodes(ctx, node.Cluster.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if n.Labels[RoleLabel] != string(nodeType) || n.Labels[PoolLabel] != node.Name {
+			continue
+		}
+
+		if err := m.DeleteNode(ctx, n.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func waitNodesRunning(ctx context.Context, m Manager, clusterName string, timeout time.Duration) error {
+	logrus.WithField("cluster", clusterName).Infoln("waiting nodes of cluster running")
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := retry.Do(func() error {
+		nodes, err := m.ListNodes(ctx, clusterName)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range nodes {
+			if !n.Status.Running {
+				return errors.New(fmt.Sprintf("node (%s) is not running", n.Name))
+			}
+		}
+
+		return nil
+	},
+		retry.Context(ctx),
+		retry.Attempts(uint(timeout/waitNodesRunningInterval)+1),
+		retry.Delay(waitNodesRunningInterval),
+		retry.DelayType(retry.FixedDelay),
+		retry.LastErrorOnly(true),
+	)
+
+	if err != nil {
+		return errors.WithMessagef(err, "nodes of cluster (%s) are not running in %s", clusterName, timeout)
+	}
+
+	return nil
+}
+
+func startNodes(ctx context.Context, m Manager, clusterName string) error {
+	logrus.WithField("cluster", clusterName).Infoln("starting nodes of cluster running")
+
+	nodes, err := m.ListNodes(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if n.Status.Running {
+			logrus.WithField("node", n.Name).Infoln("node is already running")
+			continue
+		}
+
+		if err := m.StartNode(ctx, n.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func stopNodes(ctx context.Context, m Manager, clusterName string) error {
+	logrus.WithField("cluster", clusterName).Infoln("stopping nodes of cluster running")
+
+	nodes, err := m.ListNodes(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if !n.Status.Running {
+			logrus.WithField("node", n.Name).Infoln("node is already stopped")
+			continue
+		}
+
+		if err := m.StopNode(ctx, n.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,81 @@
+package node
+
+import (
+	"github.com/innobead/kubefire/pkg/data"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodeName    string
+		clusterName string
+		nodeType    Type
+		index       int
+		ok          bool
+	}{
+		{"master node", "dev-master-1", "dev", Master, 1, true},
+		{"worker node", "dev-worker-10", "dev", Worker, 10, true},
+		{"node of the cluster with the same prefix", "dev-2-master-1", "dev", "", 0, false},
+		{"node of the cluster with the same suffix", "mydev-master-1", "dev", "", 0, false},
+		{"cluster name with regex characters", "dev.1-master-1", "dev.1", Master, 1, true},
+		{"unknown node type", "dev-etcd-1", "dev", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeType, index, ok := ParseName(tt.nodeName, tt.clusterName)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.nodeType, nodeType)
+			assert.Equal(t, tt.index, index)
+		})
+	}
+}
+
+func TestIsClusterNode(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodeName    string
+		labels      map[string]string
+		clusterName string
+		want        bool
+	}{
+		{"labeled node", "dev-master-1", Labels("dev", Master, 1), "dev", true},
+		{"labeled node of another cluster", "dev-2-master-1", Labels("dev-2", Master, 1), "dev", false},
+		{"labeled node of any cluster", "dev-2-master-1", Labels("dev-2", Master, 1), "", true},
+		{"legacy node", "dev-worker-2", map[string]string{ClusterLabel: "dev"}, "dev", true},
+		{"legacy node of another cluster", "dev-2-worker-2", map[string]string{ClusterLabel: "dev-2"}, "dev", false},
+		{"legacy node with unexpected name", "dev-worker", map[string]string{ClusterLabel: "dev"}, "dev", false},
+		{"non kubefire node", "dev-master-1", map[string]string{}, "dev", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			MigrateLegacyLabels(tt.nodeName, tt.labels)
+			assert.Equal(t, tt.want, IsClusterNode(tt.labels, tt.clusterName))
+		})
+	}
+}
+
+func TestNextIndices(t *testing.T) {
+	nodes := []*data.Node{
+		{Name: "dev-master-1", Labels: Labels("dev", Master, 1)},
+		{Name: "dev-worker-1", Labels: Labels("dev", Worker, 1)},
+		{Name: "dev-worker-3", Labels: Labels("dev", Worker, 3)},
+	}
+
+	tests := []struct {
+		name     string
+		nodeType Type
+		count    int
+		want     []int
+	}{
+		{"after the largest index", Worker, 2, []int{4, 5}},
+		{"after the first master", Master, 1, []int{2}},
+		{"no count", Worker, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NextIndices(nodes, tt.nodeType, "", tt.count))
+		})
+	}
+}
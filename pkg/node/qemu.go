@@ -0,0 +1,234 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/avast/retry-go"
+	"github.com/innobead/kubefire/pkg/constants"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	QemuMicroVMMachine = "microvm"
+	QemuQ35Machine     = "q35"
+
+	qemuStopTimeout = 30 * time.Second
+)
+
+var QemuBuiltinMachines = []string{
+	QemuMicroVMMachine,
+	QemuQ35Machine,
+}
+
+// QemuDriver runs the microVM by QEMU/KVM with the microvm or q35 machine type. The microvm machine only has
+// virtio-mmio devices like Firecracker, and the q35 machine provides PCI devices for the features like storage testing.
+type QemuDriver struct {
+	binary  string
+	machine string
+}
+
+func NewQemuNodeManager(machine string) *MicroVMNodeManager {
+	return NewMicroVMNodeManager(NewQemuDriver(machine))
+}
+
+func NewQemuDriver(machine string) *QemuDriver {
+	if machine == "" {
+		machine = QemuMicroVMMachine
+	}
+
+	arch := "x86_64"
+	if runtime.GOARCH == "arm64" {
+		arch = "aarch64"
+	}
+
+	return &QemuDriver{
+		binary:  "qemu-system-" + arch,
+		machine: machine,
+	}
+}
+
+func (q *QemuDriver) Name() string {
+	return constants.QEMU
+}
+
+func (q *QemuDriver) Start(ctx context.Context, vm *MicroVM) (int, error) {
+	logrus.WithFields(logrus.Fields{
+		"node":    vm.Name,
+		"machine": q.machine,
+	}).Infoln("booting qemu microVM")
+
+	pidFile := path.Join(vm.Dir(), "qemu.pid")
+	_ = os.Remove(pidFile)
+	_ = os.Remove(vm.SocketPath())
+
+	args, err := q.args(vm, pidFile)
+	if err != nil {
+		return 0, err
+	}
+
+	// qemu is daemonized after the VM is initialized, so the microVM keeps running after the command exits
+	if _, err := runMicroVMCommand(ctx, "ip", append([]string{"netns", "exec", vm.Netns(), q.binary}, args...)...); err != nil {
+		return 0, err
+	}
+
+	content, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return pid, nil
+}
+
+func (q *QemuDriver) Stop(ctx context.Context, vm *MicroVM) error {
+	logrus.WithField("node", vm.Name).Infoln("shutting down qemu microVM")
+
+	if err := qmpExecute(vm.SocketPath(), "system_powerdown"); err != nil {
+		logrus.WithField("node", vm.Name).WithError(err).Warnln("failed to shut down microVM gracefully")
+	}
+
+	err := retry.Do(func() error {
+		if vm.Running() {
+			return errors.Errorf("node (%s) is still running", vm.Name)
+		}
+
+		return nil
+	}, retry.Attempts(uint(qemuStopTimeout/time.Second)), retry.Delay(time.Second), retry.DelayType(retry.FixedDelay))
+
+	if err != nil {
+		logrus.WithField("node", vm.Name).Warnln("killing microVM")
+
+		if err := syscall.Kill(vm.Status.Pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return errors.WithStack(err)
+		}
+	}
+
+	_ = os.Remove(vm.SocketPath())
+
+	return nil
+}
+
+func (q *QemuDriver) args(vm *MicroVM, pidFile string) ([]string, error) {
+	memory, err := vm.MemoryMiB()
+	if err != nil {
+		return nil, err
+	}
+
+	// the devices are virtio-mmio for the microvm machine, and virtio-pci for the q35 machine
+	deviceSuffix := "device"
+	bootArgs := vm.BootArgs()
+	machine := q.machine + ",accel=kvm"
+
+	switch q.machine {
+	case QemuMicroVMMachine:
+		// the virtio-mmio devices are added to the kernel command line by qemu automatically
+	case QemuQ35Machine:
+		deviceSuffix = "pci"
+		bootArgs = strings.Join(strings.Fields(strings.Replace(" "+bootArgs+" ", " pci=off ", " ", -1)), " ")
+	default:
+		return nil, errors.Errorf("unsupported qemu machine type: %s", q.machine)
+	}
+
+	bootArgs += " root=/dev/vda rw"
+
+	args := []string{
+		"-name", vm.Name,
+		"-machine", machine,
+		"-cpu", "host",
+		"-smp", strconv.Itoa(vm.Cpus),
+		"-m", fmt.Sprintf("%dM", memory),
+		"-nodefaults",
+		"-no-user-config",
+		"-no-reboot",
+		"-display", "none",
+		"-kernel", vm.KernelPath(),
+		"-append", bootArgs,
+		"-drive", fmt.Sprintf("id=rootfs,file=%s,format=raw,if=none,cache=none,aio=threads", vm.RootfsPath()),
+		"-device", fmt.Sprintf("virtio-blk-%s,drive=rootfs", deviceSuffix),
+	}
+
+	for _, disk := range vm.ExtraDisks {
+		args = append(
+			args,
+			"-drive", fmt.Sprintf("id=%s,file=%s,format=raw,if=none,cache=none,aio=threads", disk.ID, vm.ExtraDiskPath(disk)),
+			"-device", fmt.Sprintf("virtio-blk-%s,drive=%s", deviceSuffix, disk.ID),
+		)
+	}
+
+	return append(
+		args,
+		"-netdev", fmt.Sprintf("tap,id=net0,ifname=%s,script=no,downscript=no", microVMTapDevice),
+		"-device", fmt.Sprintf("virtio-net-%s,netdev=net0,mac=%s", deviceSuffix, vm.Status.MAC),
+		"-chardev", fmt.Sprintf("file,id=console,path=%s,append=on", vm.ConsoleLogPath()),
+		"-serial", "chardev:console",
+		"-qmp", fmt.Sprintf("unix:%s,server,nowait", vm.SocketPath()),
+		"-pidfile", pidFile,
+		"-daemonize",
+	), nil
+}
+
+// qmpExecute runs the QEMU Machine Protocol command via the QMP socket of the microVM.
+func qmpExecute(socketPath string, command string) error {
+	conn, err := net.DialTimeout("unix", socketPath, 5*time.Second)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	encoder := json.NewEncoder(conn)
+
+	// the greeting message
+	if _, err := reader.ReadBytes('\n'); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, cmd := range []string{"qmp_capabilities", command} {
+		if err := encoder.Encode(map[string]string{"execute": cmd}); err != nil {
+			return errors.WithStack(err)
+		}
+
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			resp := map[string]interface{}{}
+			if err := json.Unmarshal(line, &resp); err != nil {
+				return errors.WithStack(err)
+			}
+
+			// skip the asynchronous events
+			if _, ok := resp["event"]; ok {
+				continue
+			}
+
+			if e, ok := resp["error"]; ok {
+				return errors.Errorf("qmp command (%s) failed: %v", cmd, e)
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
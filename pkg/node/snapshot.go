@@ -0,0 +1,59 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/innobead/kubefire/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// The files of a node snapshot saved in the node folder of the cluster snapshot.
+const (
+	snapshotNodeFile   = "node.json"
+	snapshotDiskFile   = "disk.img"
+	snapshotKernelFile = "vmlinux"
+	snapshotStateFile  = "vmstate"
+	snapshotMemoryFile = "memory.img"
+)
+
+// copyDiskFile copies the disk file by keeping the holes of the sparse file. sudo is used if kubefire is not run by
+// root, because the disks created by ignite are owned by root.
+func copyDiskFile(ctx context.Context, src string, dest string) error {
+	args := []string{"cp", "--sparse=always", src, dest}
+	if os.Geteuid() != 0 {
+		args = append([]string{"sudo"}, args...)
+	}
+
+	cmd := util.CommandContext(ctx, args[0], args[1:]...)
+
+	logrus.Debugf("%+v", cmd.Args)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "failed to copy %s to %s: %s", src, dest, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+func saveSnapshotNodeFile(dir string, v interface{}) error {
+	bytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(path.Join(dir, snapshotNodeFile), bytes, 0644))
+}
+
+func loadSnapshotNodeFile(dir string, v interface{}) error {
+	bytes, err := ioutil.ReadFile(path.Join(dir, snapshotNodeFile))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(json.Unmarshal(bytes, v))
+}
@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type DefaultOutput struct {
@@ -122,7 +123,9 @@ func (d *DefaultOutput) parse(v reflect.Value, filters []string, tableHeaders *[
 			filters,
 			"Name",
 			"Status.Running",
+			"Status.Restarts",
 			"Status.IPAddresses",
+			"Status.ExtraDisks",
 		)
 
 	case config.Node:
@@ -145,6 +148,16 @@ func (d *DefaultOutput) parse(v reflect.Value, filters []string, tableHeaders *[
 	}
 
 	updateTableData := func(f reflect.Value, subTableData *[]string) {
+		if t, ok := f.Interface().(time.Time); ok {
+			if t.IsZero() {
+				*subTableData = append(*subTableData, "")
+			} else {
+				*subTableData = append(*subTableData, t.Local().Format("2006-01-02 15:04:05"))
+			}
+
+			return
+		}
+
 		switch f.Kind() {
 		case reflect.Struct:
 			v := f
@@ -156,12 +169,24 @@ func (d *DefaultOutput) parse(v reflect.Value, filters []string, tableHeaders *[
 				*subTableData = append(*subTableData, v.String())
 			}
 
+		case reflect.Slice:
+			if v, ok := f.Interface().(fmt.Stringer); ok {
+				*subTableData = append(*subTableData, v.String())
+			}
+
 		case reflect.String:
 			*subTableData = append(*subTableData, f.String())
 
 		case reflect.Int:
 			*subTableData = append(*subTableData, strconv.FormatInt(f.Int(), 10))
 
+		case reflect.Int64:
+			if v, ok := f.Interface().(fmt.Stringer); ok {
+				*subTableData = append(*subTableData, v.String())
+			} else {
+				*subTableData = append(*subTableData, strconv.FormatInt(f.Int(), 10))
+			}
+
 		case reflect.Bool:
 			*subTableData = append(*subTableData, strconv.FormatBool(f.Bool()))
 
@@ -68,7 +68,7 @@ func Download(script Type, version string, force bool) error {
 	return nil
 }
 
-func Run(script Type, version string, beforeCallback func(cmd *exec.Cmd) error) error {
+func Run(ctx context.Context, script Type, version string, beforeCallback func(cmd *exec.Cmd) error) error {
 	log := logrus.WithFields(
 		logrus.Fields{
 			"version": version,
@@ -79,7 +79,7 @@ func Run(script Type, version string, beforeCallback func(cmd *exec.Cmd) error)
 	f := LocalScriptFile(version, script)
 
 	log.Infof("running %s", f)
-	err := runScript(f, beforeCallback)
+	err := runScript(ctx, f, beforeCallback)
 
 	if err != nil {
 		return errors.WithMessagef(err, "failed to run script (%s)", script)
@@ -126,13 +126,13 @@ func downloadScript(url string, destFile string, force bool) error {
 	return nil
 }
 
-func runScript(script string, beforeCallback func(cmd *exec.Cmd) error) error {
+func runScript(ctx context.Context, script string, beforeCallback func(cmd *exec.Cmd) error) error {
 	if _, err := os.Stat(script); os.IsNotExist(err) {
 		return errors.WithStack(err)
 	}
 
 	cmd := util.UpdateCommandDefaultLogWithInfo(
-		exec.CommandContext(context.Background(), "sudo", "-E", script),
+		util.CommandContext(ctx, "sudo", "-E", script),
 	)
 
 	if beforeCallback != nil {
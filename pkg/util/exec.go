@@ -1,11 +1,29 @@
 package util
 
 import (
+	"context"
 	"github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
+	"syscall"
+	"time"
 )
 
+// commandWaitDelay is the time waiting for the command to exit after the context is done, before killing it.
+const commandWaitDelay = 10 * time.Second
+
+// CommandContext creates the command terminated when the context is done. Different from exec.CommandContext, the
+// command is terminated by SIGTERM first, so the command like sudo can relay the signal to its child process.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = commandWaitDelay
+
+	return cmd
+}
+
 func UpdateCommandDefaultLogWithInfo(cmd *exec.Cmd) *exec.Cmd {
 	return UpdateCommandDefaultLog(cmd, logrus.InfoLevel)
 }
@@ -0,0 +1,20 @@
+package util
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCommandContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := CommandContext(ctx, "sleep", "10").Run()
+
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), commandWaitDelay)
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
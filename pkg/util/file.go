@@ -0,0 +1,109 @@
+package util
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// tailFileInterval is the interval to check the new content of the followed file.
+var tailFileInterval = 500 * time.Millisecond
+
+// CopyFile copies the file content and mode to the destination file, which is overwritten if it exists.
+func CopyFile(src string, dest string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(out.Close())
+}
+
+// CopyFiles copies the regular files of the source folder to the destination folder. The sub folders are not copied.
+func CopyFiles(srcDir string, destDir string) error {
+	entries, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		if err := CopyFile(path.Join(srcDir, entry.Name()), path.Join(destDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AppendFile appends the content to the file, which is created with the parent folders if not exist.
+func AppendFile(file string, content []byte) error {
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(f.Close())
+}
+
+// TailFile writes the file content to the writer. If follow is true, the content appended to the file is written as
+// well until the context is done.
+func TailFile(ctx context.Context, file string, follow bool, out io.Writer) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	for {
+		if _, err := io.Copy(out, f); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if !follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(tailFileInterval):
+		}
+	}
+}
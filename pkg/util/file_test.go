@@ -0,0 +1,37 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestTailFile(t *testing.T) {
+	tailFileInterval = 10 * time.Millisecond
+
+	file := path.Join(t.TempDir(), "logs", "node.log")
+	assert.NoError(t, AppendFile(file, []byte("booting\n")))
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, TailFile(context.Background(), file, false, out))
+	assert.Equal(t, "booting\n", out.String())
+
+	out.Reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+
+	go func() {
+		errCh <- TailFile(ctx, file, true, out)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, AppendFile(file, []byte("login:\n")))
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	assert.NoError(t, <-errCh)
+	assert.Equal(t, "booting\nlogin:\n", out.String())
+}
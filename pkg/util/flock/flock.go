@@ -0,0 +1,38 @@
+package flock
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"path"
+	"syscall"
+)
+
+// LockFile opens the file and locks it exclusively by flock. If not wait, nil is returned if the file has been locked
+// by others. The lock is released by closing the file.
+func LockFile(file string, wait bool) (*os.File, error) {
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		_ = f.Close()
+
+		if err == syscall.EWOULDBLOCK {
+			return nil, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,110 @@
+package util
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const kvmDevice = "/dev/kvm"
+
+// HostCapacity is the capacity of the host to run the nodes.
+type HostCapacity struct {
+	Cpus            int
+	MemoryTotal     int64
+	MemoryAvailable int64
+	DiskTotal       int64
+	DiskFree        int64
+	// KVMError is the reason why KVM is not available, or nil if KVM is available.
+	KVMError error
+}
+
+// GetHostCapacity returns the capacity of the host. The disk capacity is of the file system storing the folder, or
+// its nearest existing parent folder if the folder has not been created yet.
+func GetHostCapacity(dir string) (*HostCapacity, error) {
+	capacity := &HostCapacity{
+		Cpus:     runtime.NumCPU(),
+		KVMError: checkKVM(),
+	}
+
+	if err := readMemInfo(capacity); err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, err := os.Stat(dir); err == nil || dir == filepath.Dir(dir) {
+			break
+		}
+
+		dir = filepath.Dir(dir)
+	}
+
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return nil, errors.WithMessagef(err, "failed to get the disk capacity of %s", dir)
+	}
+
+	capacity.DiskTotal = int64(stat.Blocks) * stat.Bsize
+	capacity.DiskFree = int64(stat.Bavail) * stat.Bsize
+
+	return capacity, nil
+}
+
+func readMemInfo(capacity *HostCapacity) error {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// ex: MemAvailable:   12345678 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "MemTotal:":
+			capacity.MemoryTotal = value << 10
+		case "MemAvailable:":
+			capacity.MemoryAvailable = value << 10
+		}
+	}
+
+	return errors.WithStack(scanner.Err())
+}
+
+// checkKVM checks if the KVM device exists. The device is only opened by root, because the non-root user runs the
+// node backend by sudo.
+func checkKVM() error {
+	info, err := os.Stat(kvmDevice)
+	if err != nil {
+		return errors.Errorf("%s not found, enable the virtualization in BIOS or nested virtualization of the VM", kvmDevice)
+	}
+
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return errors.Errorf("%s is not a device", kvmDevice)
+	}
+
+	if os.Geteuid() == 0 {
+		f, err := os.OpenFile(kvmDevice, os.O_RDWR, 0)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to open %s", kvmDevice)
+		}
+		_ = f.Close()
+	}
+
+	return nil
+}
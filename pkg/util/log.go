@@ -1,11 +1,14 @@
 package util
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"io"
 	"reflect"
 	"strings"
+	"sync"
 )
 
 type LogWriter struct {
@@ -46,3 +49,56 @@ func (l LogWriter) Write(p []byte) (n int, err error) {
 
 	return size, nil
 }
+
+// PrefixWriter writes the prefixed lines to the writer shared with other PrefixWriters, which are synchronized by the
+// same lock, so the lines of different writers are not interleaved.
+type PrefixWriter struct {
+	out    io.Writer
+	lock   sync.Locker
+	prefix string
+	buf    []byte
+}
+
+func NewPrefixWriter(out io.Writer, lock sync.Locker, prefix string) *PrefixWriter {
+	return &PrefixWriter{out: out, lock: lock, prefix: prefix}
+}
+
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+
+		p.buf = p.buf[i+1:]
+	}
+
+	return len(b), nil
+}
+
+// Flush writes the remaining content not ended by a newline.
+func (p *PrefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+
+	line := append(p.buf, '\n')
+	p.buf = nil
+
+	return p.writeLine(line)
+}
+
+func (p *PrefixWriter) writeLine(line []byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	_, err := fmt.Fprintf(p.out, "%s%s", p.prefix, line)
+
+	return errors.WithStack(err)
+}
@@ -0,0 +1,141 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	kubeConfigServerPattern        = regexp.MustCompile(`(?m)^([ \t]*)server:[ \t]*\S+[ \t]*$`)
+	kubeConfigTLSServerNamePattern = regexp.MustCompile(`(?m)^[ \t]*tls-server-name:.*\n`)
+)
+
+// PortForward maps the host port to the node port.
+type PortForward struct {
+	HostPort int
+	NodePort int
+}
+
+func (p PortForward) String() string {
+	return fmt.Sprintf("%d:%d", p.HostPort, p.NodePort)
+}
+
+// ParsePortForward parses the port mapping like 8443:6443, or 80 if the host port is the same as the node port.
+func ParsePortForward(port string) (*PortForward, error) {
+	values := strings.Split(port, ":")
+	if len(values) > 2 {
+		return nil, errors.Errorf("invalid port mapping: %s", port)
+	}
+
+	var ports []int
+
+	for _, v := range values {
+		p, err := strconv.Atoi(v)
+		if err != nil || p <= 0 || p > 65535 {
+			return nil, errors.Errorf("invalid port mapping: %s", port)
+		}
+
+		ports = append(ports, p)
+	}
+
+	return &PortForward{HostPort: ports[0], NodePort: ports[len(ports)-1]}, nil
+}
+
+// ForwardPorts forwards the TCP connections of the host ports listened on the address to the node ports until the
+// context is done.
+func ForwardPorts(ctx context.Context, address string, nodeAddress string, ports []PortForward) error {
+	var listeners []net.Listener
+
+	defer func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}()
+
+	for _, p := range ports {
+		l, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(p.HostPort)))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	var wg sync.WaitGroup
+
+	for i, p := range ports {
+		target := net.JoinHostPort(nodeAddress, strconv.Itoa(p.NodePort))
+
+		logrus.Infof("forwarding from %s to %s", listeners[i].Addr(), target)
+
+		wg.Add(1)
+
+		go func(l net.Listener, target string) {
+			defer wg.Done()
+
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+
+				go forwardConn(conn, target)
+			}
+		}(listeners[i], target)
+	}
+
+	<-ctx.Done()
+
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func forwardConn(conn net.Conn, target string) {
+	defer conn.Close()
+
+	targetConn, err := net.Dial("tcp", target)
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to connect to %s", target)
+		return
+	}
+	defer targetConn.Close()
+
+	done := make(chan struct{}, 2)
+
+	copyConn := func(dest net.Conn, src net.Conn) {
+		_, _ = io.Copy(dest, src)
+
+		if c, ok := dest.(*net.TCPConn); ok {
+			_ = c.CloseWrite()
+		}
+
+		done <- struct{}{}
+	}
+
+	go copyConn(targetConn, conn)
+	go copyConn(conn, targetConn)
+
+	<-done
+	<-done
+}
+
+// UpdateKubeConfigServer replaces the API server endpoint of the kubeconfig. The TLS server name is set to
+// `kubernetes`, which is always in the API server certificate, so the endpoint not in the certificate is still trusted.
+func UpdateKubeConfigServer(kubeConfig string, server string) string {
+	kubeConfig = kubeConfigTLSServerNamePattern.ReplaceAllString(kubeConfig, "")
+
+	return kubeConfigServerPattern.ReplaceAllString(kubeConfig, "${1}server: "+server+"\n${1}tls-server-name: kubernetes")
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParsePortForward(t *testing.T) {
+	tests := []struct {
+		port     string
+		expected *PortForward
+	}{
+		{"8443:6443", &PortForward{HostPort: 8443, NodePort: 6443}},
+		{"80", &PortForward{HostPort: 80, NodePort: 80}},
+		{"80:", nil},
+		{"1:2:3", nil},
+		{"70000", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.port, func(t *testing.T) {
+			port, err := ParsePortForward(tt.port)
+			if tt.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, port)
+		})
+	}
+}
+
+func TestUpdateKubeConfigServer(t *testing.T) {
+	kubeConfig := `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: ZGF0YQ==
+    server: https://10.62.0.2:6443
+    tls-server-name: old
+  name: kubernetes
+`
+	expected := `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: ZGF0YQ==
+    server: https://127.0.0.1:8443
+    tls-server-name: kubernetes
+  name: kubernetes
+`
+
+	assert.Equal(t, expected, UpdateKubeConfigServer(kubeConfig, "https://127.0.0.1:8443"))
+}
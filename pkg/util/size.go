@@ -0,0 +1,61 @@
+package util
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sizePattern = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*([a-zA-Z]*)\s*$`)
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// ParseSize converts the size like 2GB, 512MiB or 1.5 GB to bytes. The same as ignite, the units are based on 1024.
+func ParseSize(size string) (int64, error) {
+	matches := sizePattern.FindStringSubmatch(size)
+	if matches == nil {
+		return 0, errors.Errorf("invalid size: %s", size)
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(matches[2])]
+	if !ok {
+		return 0, errors.Errorf("invalid size unit: %s", size)
+	}
+
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return int64(value * float64(unit)), nil
+}
+
+// FormatSize converts bytes to the size like 2GB or 1.5TB, which can be parsed by ParseSize.
+func FormatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+
+	value := float64(size)
+	i := 0
+
+	for ; value >= 1024 && i < len(units)-1; i++ {
+		value /= 1024
+	}
+
+	return strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0") + units[i]
+}
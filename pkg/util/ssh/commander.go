@@ -1,27 +1,46 @@
 package ssh
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	"github.com/innobead/kubefire/pkg/util"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
-	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type Commander interface {
 	Init() error
 	Run(before Callback, after Callback, cmds ...string) error
+	// SetRunLogLevel sets the log level of the commands run by Run, which is info by default.
+	SetRunLogLevel(level logrus.Level)
 	Download(remotePath string, destPath string) error
+	CopyToRemote(srcPath string, remotePath string) error
+	CopyFromRemote(remotePath string, destPath string) error
+	Close() error
 }
 
 type Callback func(session *ssh.Session) bool
 
+// ClientFactory creates the client running commands on the node. It is injectable to run commands on the fake nodes in
+// tests. The connection of the client is closed when the context is done, which terminates the running commands.
+type ClientFactory func(ctx context.Context, name string, keyPath string, user string, address string, sshClientConfigCallback func(config *ssh.ClientConfig)) (Commander, error)
+
+func DefaultClientFactory(ctx context.Context, name string, keyPath string, user string, address string, sshClientConfigCallback func(config *ssh.ClientConfig)) (Commander, error) {
+	client, err := NewClient(ctx, name, keyPath, user, address, sshClientConfigCallback)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
 type Client struct {
+	ctx     context.Context
 	name    string
 	keyPath string
 	user    string
@@ -29,10 +48,12 @@ type Client struct {
 
 	sshClientConfig *ssh.ClientConfig
 	sshClient       *ssh.Client
+	stopClose       func() bool
 	log             *logrus.Entry
+	runLogLevel     logrus.Level
 }
 
-func NewClient(name string, keyPath string, user string, address string, sshClientConfigCallback func(config *ssh.ClientConfig)) (*Client, error) {
+func NewClient(ctx context.Context, name string, keyPath string, user string, address string, sshClientConfigCallback func(config *ssh.ClientConfig)) (*Client, error) {
 	clientConfig, err := CreateClientConfig(keyPath, user, sshClientConfigCallback)
 	if err != nil {
 		return nil, err
@@ -43,11 +64,13 @@ func NewClient(name string, keyPath string, user string, address string, sshClie
 	}
 
 	client := &Client{
+		ctx:             ctx,
 		name:            name,
 		keyPath:         keyPath,
 		user:            user,
 		sshClientConfig: clientConfig,
 		address:         address,
+		runLogLevel:     logrus.InfoLevel,
 	}
 	client.log = logrus.WithField("node", client.name)
 
@@ -59,19 +82,45 @@ func NewClient(name string, keyPath string, user string, address string, sshClie
 }
 
 func (c *Client) Init() error {
-	client, err := ssh.Dial("tcp", c.address, c.sshClientConfig)
+	dialer := &net.Dialer{Timeout: c.sshClientConfig.Timeout}
+
+	conn, err := dialer.DialContext(c.ctx, "tcp", c.address)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	c.sshClient = client
+	// closing the connection terminates the handshake and the sessions running when the context is done
+	stopClose := context.AfterFunc(c.ctx, func() {
+		_ = conn.Close()
+	})
+
+	if c.sshClientConfig.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(c.sshClientConfig.Timeout))
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.address, c.sshClientConfig)
+	if err != nil {
+		stopClose()
+		_ = conn.Close()
+
+		return c.contextError(err)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	c.sshClient = ssh.NewClient(sshConn, chans, reqs)
+	c.stopClose = stopClose
 
 	return nil
 }
 
+func (c *Client) SetRunLogLevel(level logrus.Level) {
+	c.runLogLevel = level
+}
+
 func (c *Client) Run(before Callback, after Callback, cmds ...string) error {
 	for _, cmd := range cmds {
-		c.log.Infof("running %s", cmd)
+		c.log.Logf(c.runLogLevel, "running %s", cmd)
 
 		session, err := c.createSSHSession()
 		if err != nil {
@@ -86,7 +135,7 @@ func (c *Client) Run(before Callback, after Callback, cmds ...string) error {
 			}
 
 			if err := session.Run(cmd); err != nil {
-				return err
+				return c.contextError(err)
 			}
 
 			if after != nil {
@@ -96,13 +145,14 @@ func (c *Client) Run(before Callback, after Callback, cmds ...string) error {
 			return nil
 		}()
 		if err != nil {
-			return errors.WithStack(err)
+			return err
 		}
 	}
 
 	return nil
 }
 
+// Download streams the remote file to the local file by cat, which does not require the SFTP server on the node.
 func (c *Client) Download(remotePath string, destPath string) error {
 	session, err := c.createSSHSession()
 	if err != nil {
@@ -110,25 +160,30 @@ func (c *Client) Download(remotePath string, destPath string) error {
 	}
 	defer session.Close()
 
-	buf := &bytes.Buffer{}
-	session.Stdout = buf
-
-	if err := session.Run(fmt.Sprintf("cat %s", remotePath)); err != nil {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil && err != os.ErrExist {
 		return errors.WithStack(err)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil && err != os.ErrExist {
+	out, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if err := ioutil.WriteFile(destPath, buf.Bytes(), 0755); err != nil {
-		return errors.WithStack(err)
+	session.Stdout = out
+
+	if err := session.Run("cat " + util.ShellQuote(remotePath)); err != nil {
+		_ = out.Close()
+		return c.contextError(err)
 	}
 
-	return nil
+	return errors.WithStack(out.Close())
 }
 
 func (c *Client) Close() error {
+	if c.stopClose != nil {
+		c.stopClose()
+	}
+
 	if c.sshClient != nil {
 		return c.sshClient.Close()
 	}
@@ -136,10 +191,19 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// contextError returns the error of the context if it is done, which is the cause of the connection closed.
+func (c *Client) contextError(err error) error {
+	if c.ctx.Err() != nil {
+		return errors.WithStack(c.ctx.Err())
+	}
+
+	return errors.WithStack(err)
+}
+
 func (c *Client) createSSHSession() (*ssh.Session, error) {
 	session, err := c.sshClient.NewSession()
 	if err != nil {
-		return nil, err
+		return nil, c.contextError(err)
 	}
 
 	log := util.NewLogWriter(
@@ -0,0 +1,231 @@
+package ssh
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// sftpCopier copies the files recursively between the local host and the remote host over SFTP.
+type sftpCopier struct {
+	sftpClient *SFTPClient
+	log        *logrus.Entry
+	files      int
+	bytes      int64
+}
+
+// CopyToRemote copies the local file or folder recursively to the remote path over SFTP, and preserves the permissions.
+// If the remote path is an existing folder, the source is copied into the folder. The content is streamed without
+// buffering the whole file in memory.
+func (c *Client) CopyToRemote(srcPath string, remotePath string) error {
+	sftpClient, err := NewSFTPClient(c.sshClient)
+	if err != nil {
+		return c.contextError(err)
+	}
+	defer sftpClient.Close()
+
+	if err := (&sftpCopier{sftpClient: sftpClient, log: c.log}).copyToRemote(srcPath, remotePath); err != nil {
+		return c.contextError(err)
+	}
+
+	return nil
+}
+
+// CopyFromRemote copies the remote file or folder recursively to the local path over SFTP, and preserves the
+// permissions. If the local path is an existing folder, the source is copied into the folder. The content is streamed
+// without buffering the whole file in memory.
+func (c *Client) CopyFromRemote(remotePath string, destPath string) error {
+	sftpClient, err := NewSFTPClient(c.sshClient)
+	if err != nil {
+		return c.contextError(err)
+	}
+	defer sftpClient.Close()
+
+	if err := (&sftpCopier{sftpClient: sftpClient, log: c.log}).copyFromRemote(remotePath, destPath); err != nil {
+		return c.contextError(err)
+	}
+
+	return nil
+}
+
+func (s *sftpCopier) copyToRemote(srcPath string, remotePath string) error {
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	destPath := remotePath
+	if remoteInfo, err := s.sftpClient.Stat(remotePath); err == nil && remoteInfo.IsDir() {
+		destPath = path.Join(remotePath, filepath.Base(srcPath))
+	}
+
+	if err := s.upload(srcPath, destPath, info); err != nil {
+		return err
+	}
+
+	s.log.Infof("copied %d files (%d bytes) from %s to %s", s.files, s.bytes, srcPath, destPath)
+
+	return nil
+}
+
+func (s *sftpCopier) copyFromRemote(remotePath string, destPath string) error {
+	info, err := s.sftpClient.Stat(remotePath)
+	if err != nil {
+		return err
+	}
+
+	if localInfo, err := os.Stat(destPath); err == nil && localInfo.IsDir() {
+		destPath = filepath.Join(destPath, path.Base(remotePath))
+	}
+
+	if err := s.download(remotePath, destPath, info); err != nil {
+		return err
+	}
+
+	s.log.Infof("copied %d files (%d bytes) from %s to %s", s.files, s.bytes, remotePath, destPath)
+
+	return nil
+}
+
+func (s *sftpCopier) upload(srcPath string, destPath string, info os.FileInfo) error {
+	if info.IsDir() {
+		if remoteInfo, err := s.sftpClient.Stat(destPath); err != nil || !remoteInfo.IsDir() {
+			if err := s.sftpClient.Mkdir(destPath, info.Mode()); err != nil {
+				return err
+			}
+		}
+
+		if err := s.sftpClient.Chmod(destPath, info.Mode()); err != nil {
+			return err
+		}
+
+		entries, err := ioutil.ReadDir(srcPath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, entry := range entries {
+			entryPath := filepath.Join(srcPath, entry.Name())
+
+			// the symbolic links are copied as the targets
+			if entry.Mode()&os.ModeSymlink != 0 {
+				if entry, err = os.Stat(entryPath); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+
+			if err := s.upload(entryPath, path.Join(destPath, entry.Name()), entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if !info.Mode().IsRegular() {
+		s.log.Warnf("skipped copying %s, which is not a regular file", srcPath)
+		return nil
+	}
+
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer in.Close()
+
+	out, err := s.sftpClient.Create(destPath, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	size, err := io.Copy(out, in)
+	if err != nil {
+		_ = out.Close()
+		return errors.WithMessagef(err, "failed to copy %s", srcPath)
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	s.log.Debugf("copied %s to %s", srcPath, destPath)
+
+	s.files++
+	s.bytes += size
+
+	return s.sftpClient.Chmod(destPath, info.Mode())
+}
+
+func (s *sftpCopier) download(remotePath string, destPath string, info *SFTPFileInfo) error {
+	if info.IsDir() {
+		if err := os.MkdirAll(destPath, info.Mode.Perm()); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := os.Chmod(destPath, info.Mode.Perm()); err != nil {
+			return errors.WithStack(err)
+		}
+
+		entries, err := s.sftpClient.ReadDir(remotePath)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			entryPath := path.Join(remotePath, entry.Name)
+
+			// the symbolic links are copied as the targets
+			if entry.Mode&os.ModeSymlink != 0 {
+				name := entry.Name
+
+				if entry, err = s.sftpClient.Stat(entryPath); err != nil {
+					return err
+				}
+				entry.Name = name
+			}
+
+			if err := s.download(entryPath, filepath.Join(destPath, entry.Name), entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if !info.Mode.IsRegular() {
+		s.log.Warnf("skipped copying %s, which is not a regular file", remotePath)
+		return nil
+	}
+
+	in, err := s.sftpClient.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode.Perm())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	size, err := io.Copy(out, in)
+	if err != nil {
+		_ = out.Close()
+		return errors.WithMessagef(err, "failed to copy %s", remotePath)
+	}
+
+	if err := out.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	s.log.Debugf("copied %s to %s", remotePath, destPath)
+
+	s.files++
+	s.bytes += size
+
+	return errors.WithStack(os.Chmod(destPath, info.Mode.Perm()))
+}
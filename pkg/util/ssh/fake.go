@@ -0,0 +1,240 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FakeCommand is the command recorded by FakeClients.
+type FakeCommand struct {
+	Node    string
+	Address string
+	Cmd     string
+}
+
+// FakeClients creates the fake clients, which record the commands instead of running them on nodes. The outputs
+// and errors of commands are scripted by the substrings of the commands.
+type FakeClients struct {
+	// Outputs are written to the session stdout when the command contains the key.
+	Outputs map[string]string
+	// Errors are returned when the command contains the key.
+	Errors map[string]error
+	// Files are the contents of the remote files downloaded by Download or CopyFromRemote, and uploaded by CopyToRemote.
+	Files map[string]string
+
+	lock     sync.Mutex
+	commands []FakeCommand
+}
+
+type FakeClient struct {
+	ctx     context.Context
+	name    string
+	address string
+	clients *FakeClients
+}
+
+func NewFakeClients() *FakeClients {
+	return &FakeClients{
+		Outputs: map[string]string{},
+		Errors:  map[string]error{},
+		Files:   map[string]string{},
+	}
+}
+
+// Factory returns the ClientFactory creating the fake clients.
+func (f *FakeClients) Factory() ClientFactory {
+	return func(ctx context.Context, name string, keyPath string, user string, address string, sshClientConfigCallback func(config *ssh.ClientConfig)) (Commander, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// the same as dialing, only a single address is accepted
+		if net.ParseIP(address) == nil {
+			return nil, errors.Errorf("invalid address (%s) of node (%s)", address, name)
+		}
+
+		return &FakeClient{
+			ctx:     ctx,
+			name:    name,
+			address: address,
+			clients: f,
+		}, nil
+	}
+}
+
+// Commands returns the recorded commands of the node, or all recorded commands if the node name is empty.
+func (f *FakeClients) Commands(node string) []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var cmds []string
+
+	for _, c := range f.commands {
+		if node == "" || c.Node == node {
+			cmds = append(cmds, c.Cmd)
+		}
+	}
+
+	return cmds
+}
+
+// Nodes returns the names of the nodes having recorded commands in order.
+func (f *FakeClients) Nodes() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var nodes []string
+	found := map[string]bool{}
+
+	for _, c := range f.commands {
+		if !found[c.Node] {
+			found[c.Node] = true
+			nodes = append(nodes, c.Node)
+		}
+	}
+
+	return nodes
+}
+
+func (f *FakeClients) record(c FakeCommand) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.commands = append(f.commands, c)
+
+	for k, err := range f.Errors {
+		if strings.Contains(c.Cmd, k) {
+			return "", err
+		}
+	}
+
+	for k, output := range f.Outputs {
+		if strings.Contains(c.Cmd, k) {
+			return output, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (c *FakeClient) Init() error {
+	return nil
+}
+
+func (c *FakeClient) Run(before Callback, after Callback, cmds ...string) error {
+	for _, cmd := range cmds {
+		if err := c.ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		session := &ssh.Session{}
+
+		if before != nil && !before(session) {
+			continue
+		}
+
+		output, err := c.clients.record(FakeCommand{Node: c.name, Address: c.address, Cmd: cmd})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if session.Stdout != nil {
+			if _, err := fmt.Fprint(session.Stdout, output); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		if after != nil {
+			_ = after(session)
+		}
+	}
+
+	return nil
+}
+
+func (c *FakeClient) Download(remotePath string, destPath string) error {
+	c.clients.lock.Lock()
+	content, ok := c.clients.Files[remotePath]
+	c.clients.lock.Unlock()
+
+	if !ok {
+		return errors.Errorf("%s not found on node (%s)", remotePath, c.name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(destPath, []byte(content), 0755))
+}
+
+func (c *FakeClient) CopyToRemote(srcPath string, remotePath string) error {
+	return filepath.Walk(srcPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return errors.WithStack(err)
+		}
+
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		rel, err := filepath.Rel(srcPath, p)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		c.clients.lock.Lock()
+		c.clients.Files[path.Join(remotePath, filepath.ToSlash(rel))] = string(content)
+		c.clients.lock.Unlock()
+
+		return nil
+	})
+}
+
+// CopyFromRemote copies the remote file, or the remote files under the remote folder to the local path.
+func (c *FakeClient) CopyFromRemote(remotePath string, destPath string) error {
+	c.clients.lock.Lock()
+	files := map[string]string{}
+	for p, content := range c.clients.Files {
+		if p == remotePath {
+			files[destPath] = content
+		} else if strings.HasPrefix(p, remotePath+"/") {
+			files[filepath.Join(destPath, strings.TrimPrefix(p, remotePath+"/"))] = content
+		}
+	}
+	c.clients.lock.Unlock()
+
+	if len(files) == 0 {
+		return errors.Errorf("%s not found on node (%s)", remotePath, c.name)
+	}
+
+	for p, content := range files {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func (c *FakeClient) SetRunLogLevel(level logrus.Level) {
+}
+
+func (c *FakeClient) Close() error {
+	return nil
+}
@@ -0,0 +1,580 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"os"
+	"sync"
+)
+
+// the packet types and flags of SFTP version 3 (draft-ietf-secsh-filexfer-02)
+const (
+	sftpVersion = 3
+
+	sftpPacketInit    = 1
+	sftpPacketVersion = 2
+	sftpPacketOpen    = 3
+	sftpPacketClose   = 4
+	sftpPacketRead    = 5
+	sftpPacketWrite   = 6
+	sftpPacketSetstat = 9
+	sftpPacketOpendir = 11
+	sftpPacketReaddir = 12
+	sftpPacketMkdir   = 14
+	sftpPacketStat    = 17
+	sftpPacketStatus  = 101
+	sftpPacketHandle  = 102
+	sftpPacketData    = 103
+	sftpPacketName    = 104
+	sftpPacketAttrs   = 105
+
+	sftpOpenRead  = 0x1
+	sftpOpenWrite = 0x2
+	sftpOpenCreat = 0x8
+	sftpOpenTrunc = 0x10
+
+	sftpAttrSize        = 0x1
+	sftpAttrUIDGID      = 0x2
+	sftpAttrPermissions = 0x4
+	sftpAttrACModTime   = 0x8
+	sftpAttrExtended    = 0x80000000
+
+	sftpStatusOK         = 0
+	sftpStatusEOF        = 1
+	sftpStatusNoSuchFile = 2
+
+	// sftpChunkSize is the data size of a read or write request, which is supported by all servers.
+	sftpChunkSize = 32 * 1024
+	// sftpMaxPacketSize is the maximum packet size of OpenSSH SFTP server.
+	sftpMaxPacketSize = 256 * 1024
+)
+
+// the file type bits of the POSIX mode
+const (
+	sftpModeType    = 0170000
+	sftpModeDir     = 0040000
+	sftpModeSymlink = 0120000
+)
+
+// SFTPFileInfo is the file attributes returned by the SFTP server.
+type SFTPFileInfo struct {
+	Name string
+	Size int64
+	Mode os.FileMode
+}
+
+func (f *SFTPFileInfo) IsDir() bool {
+	return f.Mode.IsDir()
+}
+
+// SFTPClient is a minimal SFTP client supporting the file operations to copy files, which runs the requests one by one
+// over the sftp subsystem of the SSH session. github.com/pkg/sftp is not used because it and its dependencies are not
+// vendored, so only the requests needed by CopyToRemote and CopyFromRemote are implemented here. Replace it with
+// github.com/pkg/sftp once the dependency is vendored.
+type SFTPClient struct {
+	session *ssh.Session
+	in      io.WriteCloser
+	out     io.Reader
+
+	lock   sync.Mutex
+	nextID uint32
+}
+
+// SFTPFile is the opened remote file, which reads or writes the content sequentially.
+type SFTPFile struct {
+	client *SFTPClient
+	handle string
+	offset uint64
+}
+
+type sftpPacket []byte
+
+func (p sftpPacket) uint32() (uint32, sftpPacket, error) {
+	if len(p) < 4 {
+		return 0, nil, errors.New("invalid SFTP packet")
+	}
+
+	return binary.BigEndian.Uint32(p), p[4:], nil
+}
+
+func (p sftpPacket) uint64() (uint64, sftpPacket, error) {
+	if len(p) < 8 {
+		return 0, nil, errors.New("invalid SFTP packet")
+	}
+
+	return binary.BigEndian.Uint64(p), p[8:], nil
+}
+
+func (p sftpPacket) string() (string, sftpPacket, error) {
+	n, p, err := p.uint32()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if uint32(len(p)) < n {
+		return "", nil, errors.New("invalid SFTP packet")
+	}
+
+	return string(p[:n]), p[n:], nil
+}
+
+func (p sftpPacket) attrs() (*SFTPFileInfo, sftpPacket, error) {
+	info := &SFTPFileInfo{}
+
+	flags, p, err := p.uint32()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if flags&sftpAttrSize != 0 {
+		var size uint64
+		if size, p, err = p.uint64(); err != nil {
+			return nil, nil, err
+		}
+		info.Size = int64(size)
+	}
+
+	if flags&sftpAttrUIDGID != 0 {
+		if _, p, err = p.uint64(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if flags&sftpAttrPermissions != 0 {
+		var perm uint32
+		if perm, p, err = p.uint32(); err != nil {
+			return nil, nil, err
+		}
+		info.Mode = sftpFileMode(perm)
+	}
+
+	if flags&sftpAttrACModTime != 0 {
+		if _, p, err = p.uint64(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if flags&sftpAttrExtended != 0 {
+		var count uint32
+		if count, p, err = p.uint32(); err != nil {
+			return nil, nil, err
+		}
+
+		for i := uint32(0); i < count*2; i++ {
+			if _, p, err = p.string(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return info, p, nil
+}
+
+func sftpFileMode(perm uint32) os.FileMode {
+	mode := os.FileMode(perm & 0777)
+
+	switch perm & sftpModeType {
+	case sftpModeDir:
+		mode |= os.ModeDir
+	case sftpModeSymlink:
+		mode |= os.ModeSymlink
+	}
+
+	return mode
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
+
+func appendPermissions(b []byte, mode os.FileMode) []byte {
+	return appendUint32(appendUint32(b, sftpAttrPermissions), uint32(mode.Perm()))
+}
+
+// NewSFTPClient starts the sftp subsystem in a new session of the SSH client.
+func NewSFTPClient(client *ssh.Client) (*SFTPClient, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	in, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	out, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		return nil, errors.WithMessage(err, "failed to start sftp subsystem, the SFTP server may not be installed on the node")
+	}
+
+	c, err := newSFTPClient(in, out)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	c.session = session
+
+	return c, nil
+}
+
+// newSFTPClient initializes the SFTP client talking to the SFTP server by the input and output streams.
+func newSFTPClient(in io.WriteCloser, out io.Reader) (*SFTPClient, error) {
+	c := &SFTPClient{
+		in:  in,
+		out: out,
+	}
+
+	if err := c.init(); err != nil {
+		_ = in.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *SFTPClient) init() error {
+	if err := c.writePacket(appendUint32([]byte{sftpPacketInit}, sftpVersion)); err != nil {
+		return err
+	}
+
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	if packet[0] != sftpPacketVersion {
+		return errors.Errorf("unexpected SFTP packet type (%d)", packet[0])
+	}
+
+	version, _, err := sftpPacket(packet[1:]).uint32()
+	if err != nil {
+		return err
+	}
+
+	if version < sftpVersion {
+		return errors.Errorf("SFTP version (%d) not supported", version)
+	}
+
+	return nil
+}
+
+func (c *SFTPClient) Close() error {
+	err := c.in.Close()
+
+	if c.session != nil {
+		return c.session.Close()
+	}
+
+	return errors.WithStack(err)
+}
+
+// Stat returns the file attributes of the path, which follows the symbolic links.
+func (c *SFTPClient) Stat(path string) (*SFTPFileInfo, error) {
+	packetType, payload, err := c.request(sftpPacketStat, appendString(nil, path))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := expectPacket(path, packetType, payload, sftpPacketAttrs); err != nil {
+		return nil, err
+	}
+
+	info, _, err := payload.attrs()
+	if err != nil {
+		return nil, err
+	}
+	info.Name = path
+
+	return info, nil
+}
+
+// ReadDir returns the entries of the folder except . and ..
+func (c *SFTPClient) ReadDir(path string) ([]*SFTPFileInfo, error) {
+	handle, err := c.open(sftpPacketOpendir, appendString(nil, path), path)
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeHandle(handle)
+
+	var infos []*SFTPFileInfo
+
+	for {
+		packetType, payload, err := c.request(sftpPacketReaddir, appendString(nil, handle))
+		if err != nil {
+			return nil, err
+		}
+
+		if packetType == sftpPacketStatus && statusCode(payload) == sftpStatusEOF {
+			return infos, nil
+		}
+
+		if err := expectPacket(path, packetType, payload, sftpPacketName); err != nil {
+			return nil, err
+		}
+
+		count, payload, err := payload.uint32()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := uint32(0); i < count; i++ {
+			var name string
+			var info *SFTPFileInfo
+
+			if name, payload, err = payload.string(); err != nil {
+				return nil, err
+			}
+			if _, payload, err = payload.string(); err != nil {
+				return nil, err
+			}
+			if info, payload, err = payload.attrs(); err != nil {
+				return nil, err
+			}
+
+			if name == "." || name == ".." {
+				continue
+			}
+
+			info.Name = name
+			infos = append(infos, info)
+		}
+	}
+}
+
+// Mkdir creates the folder with the permissions.
+func (c *SFTPClient) Mkdir(path string, mode os.FileMode) error {
+	packetType, payload, err := c.request(sftpPacketMkdir, appendPermissions(appendString(nil, path), mode))
+	if err != nil {
+		return err
+	}
+
+	return expectPacket(path, packetType, payload, sftpPacketStatus)
+}
+
+// Chmod changes the permissions of the file, which are not affected by the umask of the server.
+func (c *SFTPClient) Chmod(path string, mode os.FileMode) error {
+	packetType, payload, err := c.request(sftpPacketSetstat, appendPermissions(appendString(nil, path), mode))
+	if err != nil {
+		return err
+	}
+
+	return expectPacket(path, packetType, payload, sftpPacketStatus)
+}
+
+// Open opens the file to read.
+func (c *SFTPClient) Open(path string) (*SFTPFile, error) {
+	handle, err := c.open(sftpPacketOpen, appendUint32(appendUint32(appendString(nil, path), sftpOpenRead), 0), path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SFTPFile{client: c, handle: handle}, nil
+}
+
+// Create creates or truncates the file to write.
+func (c *SFTPClient) Create(path string, mode os.FileMode) (*SFTPFile, error) {
+	flags := uint32(sftpOpenWrite | sftpOpenCreat | sftpOpenTrunc)
+
+	handle, err := c.open(sftpPacketOpen, appendPermissions(appendUint32(appendString(nil, path), flags), mode), path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SFTPFile{client: c, handle: handle}, nil
+}
+
+func (c *SFTPClient) open(packetType byte, data []byte, path string) (string, error) {
+	respType, payload, err := c.request(packetType, data)
+	if err != nil {
+		return "", err
+	}
+
+	if err := expectPacket(path, respType, payload, sftpPacketHandle); err != nil {
+		return "", err
+	}
+
+	handle, _, err := payload.string()
+
+	return handle, err
+}
+
+func (c *SFTPClient) closeHandle(handle string) error {
+	packetType, payload, err := c.request(sftpPacketClose, appendString(nil, handle))
+	if err != nil {
+		return err
+	}
+
+	return expectPacket("", packetType, payload, sftpPacketStatus)
+}
+
+// request sends the request packet with a new request ID, then returns the response packet type and the payload after
+// the request ID.
+func (c *SFTPClient) request(packetType byte, data []byte) (byte, sftpPacket, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.nextID++
+	id := c.nextID
+
+	if err := c.writePacket(append(appendUint32([]byte{packetType}, id), data...)); err != nil {
+		return 0, nil, err
+	}
+
+	packet, err := c.readPacket()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	respID, payload, err := sftpPacket(packet[1:]).uint32()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if respID != id {
+		return 0, nil, errors.Errorf("unexpected SFTP response ID (%d), expected %d", respID, id)
+	}
+
+	return packet[0], payload, nil
+}
+
+func (c *SFTPClient) writePacket(packet []byte) error {
+	_, err := c.in.Write(append(appendUint32(nil, uint32(len(packet))), packet...))
+
+	return errors.WithStack(err)
+}
+
+func (c *SFTPClient) readPacket() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.out, header); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	if length == 0 || length > sftpMaxPacketSize {
+		return nil, errors.Errorf("invalid SFTP packet length (%d)", length)
+	}
+
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(c.out, packet); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return packet, nil
+}
+
+func statusCode(payload sftpPacket) uint32 {
+	code, _, err := payload.uint32()
+	if err != nil {
+		return 0
+	}
+
+	return code
+}
+
+// expectPacket checks the response packet type, and converts the failed status to the error.
+func expectPacket(path string, packetType byte, payload sftpPacket, expected byte) error {
+	if packetType == sftpPacketStatus {
+		code, rest, err := payload.uint32()
+		if err != nil {
+			return err
+		}
+
+		if code == sftpStatusOK && expected == sftpPacketStatus {
+			return nil
+		}
+
+		message, _, _ := rest.string()
+
+		if code == sftpStatusNoSuchFile {
+			return errors.WithMessage(os.ErrNotExist, path)
+		}
+
+		return errors.Errorf("SFTP request of %s failed: %s (%d)", path, message, code)
+	}
+
+	if packetType != expected {
+		return errors.Errorf("unexpected SFTP packet type (%d), expected %d", packetType, expected)
+	}
+
+	return nil
+}
+
+func (f *SFTPFile) Read(p []byte) (int, error) {
+	if len(p) > sftpChunkSize {
+		p = p[:sftpChunkSize]
+	}
+
+	data := appendUint32(appendUint64(appendString(nil, f.handle), f.offset), uint32(len(p)))
+
+	packetType, payload, err := f.client.request(sftpPacketRead, data)
+	if err != nil {
+		return 0, err
+	}
+
+	if packetType == sftpPacketStatus && statusCode(payload) == sftpStatusEOF {
+		return 0, io.EOF
+	}
+
+	if err := expectPacket(f.handle, packetType, payload, sftpPacketData); err != nil {
+		return 0, err
+	}
+
+	content, _, err := payload.string()
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(p, content)
+	f.offset += uint64(n)
+
+	return n, nil
+}
+
+func (f *SFTPFile) Write(p []byte) (int, error) {
+	written := 0
+
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > sftpChunkSize {
+			chunk = chunk[:sftpChunkSize]
+		}
+
+		data := append(appendUint32(appendUint64(appendString(nil, f.handle), f.offset), uint32(len(chunk))), chunk...)
+
+		packetType, payload, err := f.client.request(sftpPacketWrite, data)
+		if err != nil {
+			return written, err
+		}
+
+		if err := expectPacket(f.handle, packetType, payload, sftpPacketStatus); err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+		f.offset += uint64(len(chunk))
+	}
+
+	return written, nil
+}
+
+func (f *SFTPFile) Close() error {
+	return f.client.closeHandle(f.handle)
+}
@@ -0,0 +1,242 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+// fakeSFTPServer serves the subset of SFTP requests used by SFTPClient on the local file system.
+type fakeSFTPServer struct {
+	in      io.Reader
+	out     io.Writer
+	files   map[string]*os.File
+	dirs    map[string][]os.FileInfo
+	handles int
+}
+
+func newFakeSFTPClient(t *testing.T) *SFTPClient {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	server := &fakeSFTPServer{
+		in:    serverReader,
+		out:   serverWriter,
+		files: map[string]*os.File{},
+		dirs:  map[string][]os.FileInfo{},
+	}
+	go server.serve()
+
+	client, err := newSFTPClient(clientWriter, clientReader)
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return client
+}
+
+func (s *fakeSFTPServer) serve() {
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(s.in, header); err != nil {
+			return
+		}
+
+		packet := make([]byte, binary.BigEndian.Uint32(header))
+		if _, err := io.ReadFull(s.in, packet); err != nil {
+			return
+		}
+
+		if packet[0] == sftpPacketInit {
+			s.reply(appendUint32([]byte{sftpPacketVersion}, sftpVersion))
+			continue
+		}
+
+		id, payload, _ := sftpPacket(packet[1:]).uint32()
+		s.reply(s.handle(packet[0], id, payload))
+	}
+}
+
+func (s *fakeSFTPServer) reply(packet []byte) {
+	_, _ = s.out.Write(append(appendUint32(nil, uint32(len(packet))), packet...))
+}
+
+func (s *fakeSFTPServer) status(id uint32, code uint32) []byte {
+	return appendString(appendString(appendUint32(appendUint32([]byte{sftpPacketStatus}, id), code), ""), "")
+}
+
+func (s *fakeSFTPServer) attrs(b []byte, info os.FileInfo) []byte {
+	perm := uint32(info.Mode().Perm()) | 0100000
+	if info.IsDir() {
+		perm = uint32(info.Mode().Perm()) | sftpModeDir
+	}
+
+	return appendUint32(appendUint64(appendUint32(b, sftpAttrSize|sftpAttrPermissions), uint64(info.Size())), perm)
+}
+
+func (s *fakeSFTPServer) newHandle() string {
+	s.handles++
+	return strconv.Itoa(s.handles)
+}
+
+func (s *fakeSFTPServer) handle(packetType byte, id uint32, payload sftpPacket) []byte {
+	name, rest, _ := payload.string()
+
+	switch packetType {
+	case sftpPacketStat:
+		info, err := os.Stat(name)
+		if err != nil {
+			return s.status(id, sftpStatusNoSuchFile)
+		}
+
+		return s.attrs(appendUint32([]byte{sftpPacketAttrs}, id), info)
+
+	case sftpPacketOpen:
+		pflags, rest, _ := rest.uint32()
+		attrs, _, _ := rest.attrs()
+
+		flags := os.O_RDONLY
+		if pflags&sftpOpenWrite != 0 {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+
+		f, err := os.OpenFile(name, flags, attrs.Mode)
+		if err != nil {
+			return s.status(id, sftpStatusNoSuchFile)
+		}
+
+		handle := s.newHandle()
+		s.files[handle] = f
+
+		return appendString(appendUint32([]byte{sftpPacketHandle}, id), handle)
+
+	case sftpPacketRead:
+		offset, rest, _ := rest.uint64()
+		length, _, _ := rest.uint32()
+
+		buf := make([]byte, length)
+		n, err := s.files[name].ReadAt(buf, int64(offset))
+		if n == 0 && err == io.EOF {
+			return s.status(id, sftpStatusEOF)
+		}
+
+		return appendString(appendUint32([]byte{sftpPacketData}, id), string(buf[:n]))
+
+	case sftpPacketWrite:
+		offset, rest, _ := rest.uint64()
+		data, _, _ := rest.string()
+
+		if _, err := s.files[name].WriteAt([]byte(data), int64(offset)); err != nil {
+			return s.status(id, 4)
+		}
+
+		return s.status(id, sftpStatusOK)
+
+	case sftpPacketClose:
+		if f, ok := s.files[name]; ok {
+			_ = f.Close()
+		}
+
+		delete(s.files, name)
+		delete(s.dirs, name)
+
+		return s.status(id, sftpStatusOK)
+
+	case sftpPacketSetstat, sftpPacketMkdir:
+		attrs, _, _ := rest.attrs()
+
+		var err error
+		if packetType == sftpPacketMkdir {
+			err = os.Mkdir(name, attrs.Mode)
+		} else {
+			err = os.Chmod(name, attrs.Mode)
+		}
+
+		if err != nil {
+			return s.status(id, 4)
+		}
+
+		return s.status(id, sftpStatusOK)
+
+	case sftpPacketOpendir:
+		entries, err := ioutil.ReadDir(name)
+		if err != nil {
+			return s.status(id, sftpStatusNoSuchFile)
+		}
+
+		handle := s.newHandle()
+		s.dirs[handle] = entries
+
+		return appendString(appendUint32([]byte{sftpPacketHandle}, id), handle)
+
+	case sftpPacketReaddir:
+		entries := s.dirs[name]
+		if len(entries) == 0 {
+			return s.status(id, sftpStatusEOF)
+		}
+
+		s.dirs[name] = nil
+
+		b := appendUint32(appendUint32([]byte{sftpPacketName}, id), uint32(len(entries)))
+		for _, e := range entries {
+			b = s.attrs(appendString(appendString(b, e.Name()), e.Name()), e)
+		}
+
+		return b
+	}
+
+	return s.status(id, 8)
+}
+
+func TestSFTPCopier(t *testing.T) {
+	srcDir, remoteDir, destDir := t.TempDir(), t.TempDir(), t.TempDir()
+
+	assert.NoError(t, os.MkdirAll(path.Join(srcDir, "data", "bin"), 0750))
+	assert.NoError(t, ioutil.WriteFile(path.Join(srcDir, "data", "image.tar"), make([]byte, 3*sftpChunkSize+10), 0600))
+	assert.NoError(t, ioutil.WriteFile(path.Join(srcDir, "data", "bin", "run.sh"), []byte("#!/bin/sh\n"), 0755))
+
+	copier := &sftpCopier{sftpClient: newFakeSFTPClient(t), log: logrus.NewEntry(logrus.StandardLogger())}
+
+	// copy into the existing remote folder
+	assert.NoError(t, copier.copyToRemote(path.Join(srcDir, "data"), remoteDir))
+	assert.Equal(t, 2, copier.files)
+	assert.Equal(t, int64(3*sftpChunkSize+10+10), copier.bytes)
+
+	// copy from the remote folder to the new local folder
+	assert.NoError(t, copier.copyFromRemote(path.Join(remoteDir, "data"), path.Join(destDir, "copied")))
+
+	for _, f := range []struct {
+		path string
+		mode os.FileMode
+		size int64
+	}{
+		{path: "copied", mode: 0750 | os.ModeDir},
+		{path: "copied/bin", mode: 0750 | os.ModeDir},
+		{path: "copied/image.tar", mode: 0600, size: 3*sftpChunkSize + 10},
+		{path: "copied/bin/run.sh", mode: 0755, size: 10},
+	} {
+		info, err := os.Stat(path.Join(destDir, f.path))
+		assert.NoError(t, err)
+		assert.Equal(t, f.mode, info.Mode(), f.path)
+
+		if !info.IsDir() {
+			assert.Equal(t, f.size, info.Size(), f.path)
+		}
+	}
+
+	content, err := ioutil.ReadFile(path.Join(destDir, "copied", "bin", "run.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(content))
+
+	_, err = copier.sftpClient.Stat(path.Join(remoteDir, "missing"))
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+}
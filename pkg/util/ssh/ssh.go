@@ -4,8 +4,12 @@ import (
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 	"io/ioutil"
+	"time"
 )
 
+// DefaultTimeout is the timeout of connecting to the node and the SSH handshake.
+const DefaultTimeout = 30 * time.Second
+
 func CreateClientConfig(keyPath string, user string, clientConfigCallback func(config *ssh.ClientConfig)) (*ssh.ClientConfig, error) {
 	key, err := ioutil.ReadFile(keyPath)
 	if err != nil {
@@ -21,6 +25,7 @@ func CreateClientConfig(keyPath string, user string, clientConfigCallback func(c
 		User:            user,
 		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         DefaultTimeout,
 	}
 	if clientConfigCallback != nil {
 		clientConfigCallback(clientConfig)
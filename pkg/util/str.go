@@ -2,6 +2,7 @@ package util
 
 import (
 	"math/rand"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -17,3 +18,22 @@ func GenerateRandomStr(length int) string {
 	}
 	return b.String()
 }
+
+var shellSafeArgRegex = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// ShellQuote joins the arguments as a POSIX shell command line. The arguments having any character special to the
+// shell are quoted by single quotes, so they are passed to the command as they are.
+func ShellQuote(args ...string) string {
+	quoted := make([]string, len(args))
+
+	for i, arg := range args {
+		if shellSafeArgRegex.MatchString(arg) {
+			quoted[i] = arg
+			continue
+		}
+
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "safe args",
+			args: []string{"systemctl", "is-active", "kubelet"},
+			want: "systemctl is-active kubelet",
+		},
+		{
+			name: "args with spaces and shell characters",
+			args: []string{"sh", "-c", "ls / | wc -l"},
+			want: "sh -c 'ls / | wc -l'",
+		},
+		{
+			name: "args with single quotes",
+			args: []string{"echo", "it's"},
+			want: `echo 'it'\''s'`,
+		},
+		{
+			name: "empty arg",
+			args: []string{"echo", ""},
+			want: "echo ''",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ShellQuote(tt.args...))
+		})
+	}
+}